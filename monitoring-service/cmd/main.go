@@ -2,67 +2,176 @@ package main
 
 import (
 	"context"
-	"log"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
 
+	"monitoring-service/internal/access"
+	"monitoring-service/internal/avail"
+	"monitoring-service/internal/blockchain"
 	"monitoring-service/internal/blockchain/delegation"
 	"monitoring-service/internal/blockchain/nft"
 	"monitoring-service/internal/database"
-	"monitoring-service/internal/handlers"
+	"monitoring-service/internal/events"
+	"monitoring-service/internal/liveness"
+	"monitoring-service/internal/logging"
+	"monitoring-service/internal/probe"
+	"monitoring-service/internal/ratelimit"
+	"monitoring-service/internal/retention"
+	"monitoring-service/internal/router"
+	"monitoring-service/internal/status"
+	"monitoring-service/internal/tracing"
 	"monitoring-service/pkg/config"
 )
 
 func main() {
-	// Initialize logger
-	logger := log.New(os.Stdout, "[Server] ", log.LstdFlags|log.Lshortfile)
+	// Initialize logger. Packages log through the default logger with the
+	// request context, so their lines carry the request ID.
+	logLevel := new(slog.LevelVar)
+	logger := logging.New(os.Stdout, logLevel)
+	slog.SetDefault(logger)
 
 	// Load configuration
 	cfg, err := config.LoadConfig()
 	if err != nil {
-		logger.Fatalf("Failed to load config: %v", err)
+		fatal(logger, "Failed to load config", "error", err)
 	}
+	logLevel.Set(cfg.LogLevel)
 
-	// Initialize NFT checker
-	nftChecker, err := nft.NewNFTChecker(cfg.RpcURL, cfg.NFTContractAddr)
-	if err != nil {
-		logger.Fatalf("Failed to initialize NFT checker: %v", err)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(cfg, logger, os.Args[2:]))
 	}
 
-	// Initialize delegation registry
-	client, err := ethclient.Dial(cfg.RpcURL)
+	// Trace handlers, contract calls and database commands
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		logger.Fatalf("Failed to connect to Ethereum client: %v", err)
+		fatal(logger, "Failed to set up tracing", "error", err)
 	}
-	delegateRegistry, err := delegation.NewDelegationCaller(common.HexToAddress(cfg.DelegateContractAddr), client)
-	if err != nil {
-		logger.Fatalf("Failed to initialize delegation registry: %v", err)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.Error("Failed to flush traces", "error", err)
+		}
+	}()
+
+	// Every network gets its own chain readers, database, event broker and
+	// background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	defer stopWorkers()
+	var networks []router.Network
+	var databases []*database.Database
+	for _, network := range cfg.Networks {
+		networkCfg, err := cfg.ForNetwork(network.ID)
+		if err != nil {
+			fatal(logger, "Failed to load network config", "error", err)
+		}
+		networkLogger := logger
+		if len(cfg.Networks) > 1 {
+			networkLogger = logger.With("network", network.ID)
+		}
+
+		n, db, err := openNetwork(networkCfg, networkLogger)
+		if err != nil {
+			fatal(logger, "Failed to initialize network", "network", network.ID, "error", err)
+		}
+		defer db.Close()
+		networks = append(networks, n)
+		databases = append(databases, db)
+
+		go status.NewDetector(db, n.Broker, status.DefaultInterval, networkLogger).Run(workerCtx)
+		if cfg.ProbeIntervalSeconds > 0 {
+			probeClient := probe.NewHTTPClient(time.Duration(cfg.ProbeTimeoutSeconds)*time.Second, cfg.ProbeAllowPrivate)
+			go probe.NewProber(db, probeClient, time.Duration(cfg.ProbeIntervalSeconds)*time.Second, networkLogger).Run(workerCtx)
+		}
+		if cfg.HeartbeatRetentionDays > 0 {
+			retentionPeriod := time.Duration(cfg.HeartbeatRetentionDays) * 24 * time.Hour
+			go retention.NewCompactor(db, retentionPeriod, retention.DefaultInterval, networkLogger).Run(workerCtx)
+		}
 	}
 
-	// Initialize database
-	db, err := database.NewDatabase(cfg.MongoURI, cfg.MongoDB, logger)
-	if err != nil {
-		logger.Fatalf("Failed to initialize database: %v", err)
+	// Registration policy and heartbeat rate limits
+	policy := access.NewPolicy(cfg.Blocklist, cfg.Allowlist)
+	// Shared buckets live in the default network's database
+	limiter := ratelimit.FromConfig(cfg.RateLimit, databases[0], logger)
+
+	// Liveness reports are checked against Avail when an RPC is configured
+	var availChain avail.Chain
+	if cfg.AvailRPCURL != "" {
+		availClient, err := avail.Dial(cfg.AvailRPCURL)
+		if err != nil {
+			fatal(logger, "Failed to connect to Avail RPC", "error", err)
+		}
+		defer availClient.Close()
+		availChain = availClient
 	}
-	defer db.Close()
+	livenessChecker := liveness.NewChecker(availChain, cfg.AvailMaxBlockLag, logger)
+	livenessChecker.SetTimeout(cfg.ChainTimeout)
+
+	// Thresholds, rate limits and access lists are hot-reloaded on SIGHUP or
+	// when the config file changes; requests in flight are not interrupted
+	settings := config.NewLive(cfg)
+	settings.OnReload(func(cfg *config.Config) {
+		logLevel.Set(cfg.LogLevel)
+		policy.Set(cfg.Blocklist, cfg.Allowlist)
+		limiter.SetLimits(ratelimit.Limits(cfg.RateLimit))
+		livenessChecker.SetMaxLag(cfg.AvailMaxBlockLag)
+		for _, db := range databases {
+			db.SetUptimePolicy(cfg.UptimePolicy)
+		}
+	})
+	reload := func(reason string) {
+		restartRequired, err := settings.Reload()
+		if err != nil {
+			logger.Error("Config reload rejected, keeping the running config", "trigger", reason, "error", err)
+			return
+		}
+		logger.Info("Config reloaded", "trigger", reason)
+		if len(restartRequired) > 0 {
+			logger.Warn("Some changes take effect after a restart", "settings", strings.Join(restartRequired, ", "))
+		}
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := config.WatchFile(workerCtx, path, func() { reload("config file change") }); err != nil {
+			logger.Warn("Failed to watch config file, reload with SIGHUP instead", "error", err)
+		}
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-workerCtx.Done():
+				return
+			case <-hup:
+				reload("SIGHUP")
+			}
+		}
+	}()
 
 	// Initialize server
+	handler, err := router.New(settings, networks, policy, limiter, livenessChecker)
+	if err != nil {
+		fatal(logger, "Failed to initialize router", "error", err)
+	}
 	server := &http.Server{
 		Addr:    cfg.Port,
-		Handler: setupRouter(db, nftChecker, delegateRegistry),
+		Handler: handler,
 	}
 
 	// Start server
 	go func() {
-		logger.Printf("Starting server on port %s", server.Addr)
+		logger.Info("Starting server", "addr", server.Addr)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			logger.Fatalf("Failed to start server: %v", err)
+			fatal(logger, "Failed to start server", "error", err)
 		}
 	}()
 
@@ -71,100 +180,74 @@ func main() {
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
-	logger.Println("Shutting down server...")
+	logger.Info("Shutting down server")
+
+	// Stop background workers and end open event streams
+	stopWorkers()
+	for _, network := range networks {
+		network.Broker.Close()
+	}
 
 	// Create a deadline for graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		logger.Printf("Server forced to shutdown: %v", err)
+		logger.Error("Server forced to shutdown", "error", err)
 	}
 
-	logger.Println("Server exited properly")
+	logger.Info("Server exited properly")
 }
 
-func setupRouter(db *database.Database, nftChecker *nft.NFTChecker, delegateRegistry *delegation.DelegationCaller) http.Handler {
-	mux := http.NewServeMux()
-
-	// Add health check endpoint
-	mux.HandleFunc("/health", logRequest(handlers.HealthCheck))
-	
-	// Wrap delegations endpoint with CORS
-	mux.Handle("/delegations", enableCors(logRequest(handlers.GetDelegations(db))))
-	
-	// Wrap clients endpoint with CORS
-	mux.Handle("/clients", enableCors(logRequest(handlers.GetClients(db))))
-
-	// NFT check endpoint
-	mux.HandleFunc("/check-nft", logRequest(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		handlers.CheckNFT(db, delegateRegistry, nftChecker)(w, r)
-	}))
-
-	// Delegation check endpoint
-	mux.HandleFunc("/check-delegation", logRequest(func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			return
-		}
-		handlers.CheckDelegation(nftChecker, delegateRegistry)(w, r)
-	}))
-
-	return mux
+// fatal logs msg at error level and exits
+func fatal(logger *slog.Logger, msg string, args ...any) {
+	logger.Error(msg, args...)
+	os.Exit(1)
 }
 
-func logRequest(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		startTime := time.Now()
-
-		// Create a custom response writer to capture the status code
-		lrw := newLoggingResponseWriter(w)
-
-		// Call the next handler
-		next.ServeHTTP(lrw, r)
-
-		// Log the request details
-		log.Printf(
-			"Method: %s | Path: %s | Status: %d | Duration: %v | IP: %s | User-Agent: %s",
-			r.Method,
-			r.URL.Path,
-			lrw.statusCode,
-			time.Since(startTime),
-			r.RemoteAddr,
-			r.UserAgent(),
-		)
+// openNetwork connects to a network's chain and database and brings its
+// schema up to date
+func openNetwork(cfg *config.Config, logger *slog.Logger) (router.Network, *database.Database, error) {
+	// Initialize NFT checker
+	nftChecker, err := nft.NewNFTChecker(cfg.RpcURL, cfg.NFTContractAddr)
+	if err != nil {
+		return router.Network{}, nil, fmt.Errorf("failed to initialize NFT checker: %v", err)
 	}
-}
 
-type loggingResponseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func newLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
-	return &loggingResponseWriter{w, http.StatusOK}
-}
-
-func (lrw *loggingResponseWriter) WriteHeader(code int) {
-	lrw.statusCode = code
-	lrw.ResponseWriter.WriteHeader(code)
-}
-
-func enableCors(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+	// Initialize delegation registry
+	client, err := ethclient.Dial(cfg.RpcURL)
+	if err != nil {
+		return router.Network{}, nil, fmt.Errorf("failed to connect to Ethereum client: %v", err)
+	}
+	delegateRegistry, err := delegation.NewDelegationCaller(common.HexToAddress(cfg.DelegateContractAddr), client)
+	if err != nil {
+		return router.Network{}, nil, fmt.Errorf("failed to initialize delegation registry: %v", err)
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	// Initialize database
+	db, err := database.NewDatabase(cfg.MongoURI, cfg.MongoDB, logger)
+	if err != nil {
+		return router.Network{}, nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+	if err := ensureSchema(db.Migrations(), cfg.AutoMigrate, logger); err != nil {
+		db.Close()
+		return router.Network{}, nil, fmt.Errorf("database schema is not up to date: %v", err)
+	}
+	db.SetUptimePolicy(cfg.UptimePolicy)
+	db.SetTimeout(cfg.DBTimeout)
+
+	// Retry transient RPC failures on every chain read within the chain
+	// timeout, and trace each read with its retries
+	policy := blockchain.DefaultRetryPolicy
+	policy.Timeout = cfg.ChainTimeout
+	balances := blockchain.WithBalanceRetry(nftChecker, policy)
+	delegations := blockchain.WithDelegationRetry(delegateRegistry, policy)
+	return router.Network{
+		ID:          cfg.NetworkID,
+		Store:       db,
+		Balances:    blockchain.WithBalanceTracing(balances),
+		Delegations: blockchain.WithDelegationTracing(delegations, common.HexToAddress(cfg.DelegateContractAddr)),
+		Head:        client,
+		Broker:      events.NewBroker(events.DefaultHistorySize, events.DefaultBufferSize),
+	}, db, nil
 }
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/database/migrations"
+	"monitoring-service/pkg/config"
+)
+
+const migrateUsage = `Usage: server migrate <command> [-network ID] [flags]
+
+Commands:
+  status            list migrations and when they were applied
+  up [-to N]        apply pending migrations, up to version N if given
+  down [-steps N]   roll back the last N applied migrations (default 1)
+
+Each network has its own database; -network selects it (default: the
+first configured network).
+`
+
+// runMigrate implements the migrate subcommand and returns the exit code
+func runMigrate(cfg *config.Config, logger *slog.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("migrate "+args[0], flag.ContinueOnError)
+	to := flags.Int("to", 0, "apply migrations up to and including this version")
+	steps := flags.Int("steps", 1, "number of migrations to roll back")
+	network := flags.String("network", cfg.NetworkID, "network whose database to migrate")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	cfg, err := cfg.ForNetwork(*network)
+	if err != nil {
+		logger.Error(err.Error())
+		return 2
+	}
+
+	db, err := database.NewDatabase(cfg.MongoURI, cfg.MongoDB, logger)
+	if err != nil {
+		logger.Error("Failed to initialize database", "error", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	migrator := db.Migrations()
+	switch args[0] {
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			logger.Error("Failed to read migration status", "error", err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			appliedAt := "pending"
+			if status.AppliedAt != nil {
+				appliedAt = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+		}
+		w.Flush()
+
+	case "up":
+		applied, err := migrator.Up(ctx, *to)
+		for _, migration := range applied {
+			logger.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			logger.Error("Migration failed", "error", err)
+			return 1
+		}
+		if len(applied) == 0 {
+			logger.Info("No pending migrations")
+		}
+
+	case "down":
+		if *steps < 1 {
+			logger.Error("-steps must be at least 1")
+			return 2
+		}
+		reverted, err := migrator.Down(ctx, *steps)
+		for _, migration := range reverted {
+			logger.Info("Rolled back migration", "version", migration.Version, "name", migration.Name)
+		}
+		if err != nil {
+			logger.Error("Rollback failed", "error", err)
+			return 1
+		}
+
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+// schemaMigrator is the part of *migrations.Migrator ensureSchema uses
+type schemaMigrator interface {
+	Pending(ctx context.Context) ([]migrations.Migration, error)
+	Up(ctx context.Context, target int) ([]migrations.Migration, error)
+}
+
+// lockRetryInterval is how often ensureSchema retries while another
+// instance holds the migration lock
+var lockRetryInterval = 2 * time.Second
+
+// ensureSchema applies pending migrations when autoMigrate is set, and
+// otherwise refuses to start against an outdated schema
+func ensureSchema(migrator schemaMigrator, autoMigrate bool, logger *slog.Logger) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	pending, err := migrator.Pending(ctx)
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if !autoMigrate {
+		return fmt.Errorf("%d pending migrations; run `server migrate up`", len(pending))
+	}
+
+	for {
+		applied, err := migrator.Up(ctx, 0)
+		for _, migration := range applied {
+			logger.Info("Applied migration", "version", migration.Version, "name", migration.Name)
+		}
+		if err != migrations.ErrLocked {
+			return err
+		}
+
+		// Another instance is migrating; wait for it rather than serve an old schema
+		logger.Info("Waiting for schema migrations running in another instance")
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"monitoring-service/internal/database/migrations"
+	"monitoring-service/internal/logging"
+)
+
+// fakeMigrator answers Up with each of ups in turn
+type fakeMigrator struct {
+	pending []migrations.Migration
+	ups     []error
+	calls   int
+}
+
+func (m *fakeMigrator) Pending(ctx context.Context) ([]migrations.Migration, error) {
+	return m.pending, nil
+}
+
+func (m *fakeMigrator) Up(ctx context.Context, target int) ([]migrations.Migration, error) {
+	err := m.ups[m.calls]
+	m.calls++
+	if err != nil {
+		return nil, err
+	}
+	return m.pending, nil
+}
+
+func TestEnsureSchema(t *testing.T) {
+	lockRetryInterval = time.Millisecond
+	t.Cleanup(func() { lockRetryInterval = 2 * time.Second })
+
+	pending := []migrations.Migration{{Version: 12}, {Version: 13}}
+
+	tests := []struct {
+		name        string
+		pending     []migrations.Migration
+		autoMigrate bool
+		ups         []error
+		wantErr     string
+		wantUps     int
+	}{
+		{name: "UpToDate", autoMigrate: true},
+		{name: "PendingWithoutAutoMigrate", pending: pending, wantErr: "2 pending migrations"},
+		{name: "AutoMigrate", pending: pending, autoMigrate: true, ups: []error{nil}, wantUps: 1},
+		{
+			// Another instance holds the lock; wait for it to finish
+			name:        "WaitsForLock",
+			pending:     pending,
+			autoMigrate: true,
+			ups:         []error{migrations.ErrLocked, migrations.ErrLocked, nil},
+			wantUps:     3,
+		},
+		{
+			name:        "MigrationFails",
+			pending:     pending,
+			autoMigrate: true,
+			ups:         []error{migrations.ErrLocked, errors.New("migration 12 failed")},
+			wantErr:     "migration 12 failed",
+			wantUps:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &fakeMigrator{pending: tt.pending, ups: tt.ups}
+			err := ensureSchema(m, tt.autoMigrate, logging.Discard())
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("ensureSchema = %v, want error %q", err, tt.wantErr)
+			}
+			if m.calls != tt.wantUps {
+				t.Errorf("Up called %d times, want %d", m.calls, tt.wantUps)
+			}
+		})
+	}
+}
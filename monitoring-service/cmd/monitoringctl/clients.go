@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/pkg/config"
+)
+
+func runClients(cfg *config.Config, logger *log.Logger, out io.Writer, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	switch args[0] {
+	case "list":
+		flags := flag.NewFlagSet("clients list", flag.ContinueOnError)
+		status := flags.String("status", "", "only list clients with this status (Active, Inactive or Offline)")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+
+		db, err := openStore(cfg, logger)
+		if err != nil {
+			logger.Printf("Failed to initialize database: %v", err)
+			return 1
+		}
+		defer db.Close()
+
+		clients, err := db.GetAllClients(context.Background())
+		if err != nil {
+			logger.Printf("Failed to list clients: %v", err)
+			return 1
+		}
+
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ADDRESS\tOPERATOR\tSTATUS\tNFT AMOUNT\tCOMMISSION\tWEEKLY UPTIME\tLAST HEARTBEAT")
+		for _, client := range clients {
+			if *status != "" && !strings.EqualFold(client.Status, *status) {
+				continue
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%g\t%.2f%%\t%s\n",
+				client.Address,
+				client.OperatorName,
+				client.Status,
+				client.NFTAmount,
+				client.CommissionRate,
+				client.WeeklyUptimePercentage,
+				client.LastHeartbeat.Format(time.RFC3339))
+		}
+		w.Flush()
+		return 0
+
+	case "inspect":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+
+		db, err := openStore(cfg, logger)
+		if err != nil {
+			logger.Printf("Failed to initialize database: %v", err)
+			return 1
+		}
+		defer db.Close()
+
+		client, heartbeats, delegations, err := database.GetClientWithHistory(context.Background(), db, strings.ToLower(args[1]))
+		if err != nil {
+			logger.Printf("Failed to read client: %v", err)
+			return 1
+		}
+		if client == nil {
+			logger.Printf("Client %s not found", args[1])
+			return 1
+		}
+
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(struct {
+			Client      *database.ClientInfo        `json:"client"`
+			Heartbeats  []database.HeartbeatRecord  `json:"heartbeats"`
+			Delegations []database.DelegationRecord `json:"delegations"`
+		}{client, heartbeats, delegations})
+		if err != nil {
+			logger.Printf("Failed to encode client: %v", err)
+			return 1
+		}
+		return 0
+	}
+
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/export"
+	"monitoring-service/pkg/config"
+)
+
+const (
+	datasetClients     = "clients"
+	datasetHeartbeats  = "heartbeats"
+	datasetDelegations = "delegations"
+)
+
+func runExport(cfg *config.Config, logger *log.Logger, out io.Writer, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	dataset := args[0]
+
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	formatName := flags.String("format", "ndjson", "output format, csv or ndjson")
+	from := flags.String("from", "", "start of the range (RFC 3339)")
+	to := flags.String("to", "", "end of the range (RFC 3339)")
+	address := flags.String("address", "", "only export heartbeats or delegations of this client")
+	outPath := flags.String("out", "", "write to this file instead of stdout")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	format, err := export.ParseFormat(*formatName)
+	if err != nil {
+		logger.Println(err)
+		return 2
+	}
+	tr, err := parseTimeRange(*from, *to)
+	if err != nil {
+		logger.Println(err)
+		return 2
+	}
+
+	db, err := openStore(cfg, logger)
+	if err != nil {
+		logger.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	if *outPath != "" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			logger.Printf("Failed to create %s: %v", *outPath, err)
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+
+	ctx := context.Background()
+	addr := strings.ToLower(*address)
+	rows := 0
+	switch dataset {
+	case datasetClients:
+		writer := export.NewWriter(buffered, format, export.ClientColumns)
+		err = db.StreamClients(ctx, tr, func(client database.ClientInfo) error {
+			rows++
+			return writer.Write(client)
+		})
+		if err == nil {
+			err = writer.Flush()
+		}
+	case datasetHeartbeats:
+		writer := export.NewWriter(buffered, format, export.HeartbeatColumns)
+		err = db.StreamHeartbeats(ctx, addr, tr, func(heartbeat database.HeartbeatRecord) error {
+			rows++
+			return writer.Write(heartbeat)
+		})
+		if err == nil {
+			err = writer.Flush()
+		}
+	case datasetDelegations:
+		writer := export.NewWriter(buffered, format, export.DelegationColumns)
+		err = db.StreamDelegations(ctx, addr, tr, func(delegation database.DelegationRecord) error {
+			rows++
+			return writer.Write(delegation)
+		})
+		if err == nil {
+			err = writer.Flush()
+		}
+	default:
+		logger.Printf("Unknown dataset %q", dataset)
+		return 2
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err != nil {
+		logger.Printf("Export failed after %d rows: %v", rows, err)
+		return 1
+	}
+
+	logger.Printf("Exported %d %s", rows, dataset)
+	return 0
+}
+
+// Import records mirror the NDJSON export columns. Derived client columns
+// (status and uptime) are ignored.
+
+type clientRow struct {
+	Address                string    `json:"address"`
+	OperatorName           string    `json:"operator_name"`
+	RewardCollectorAddress string    `json:"reward_collector_address"`
+	NFTAmount              int64     `json:"nft_amount"`
+	CommissionRate         float64   `json:"commission_rate"`
+	TotalTime              int64     `json:"total_time"`
+	LastHeartbeat          time.Time `json:"last_heartbeat"`
+	CreatedAt              time.Time `json:"created_at"`
+}
+
+type heartbeatRow struct {
+	ClientAddress  string    `json:"client_address"`
+	Timestamp      time.Time `json:"timestamp"`
+	Duration       int64     `json:"duration"`
+	Amount         int64     `json:"amount"`
+	CommissionRate float64   `json:"commission_rate"`
+}
+
+type delegationRow struct {
+	FromAddress    string    `json:"from_address"`
+	ToAddress      string    `json:"to_address"`
+	Amount         int64     `json:"amount"`
+	CommissionRate float64   `json:"commission_rate"`
+	Timestamp      time.Time `json:"timestamp"`
+}
+
+// runImport loads an NDJSON export. The whole file is validated before
+// anything is written. Clients and delegations are upserted, so importing
+// them twice is harmless; heartbeats are appended.
+func runImport(cfg *config.Config, logger *log.Logger, out io.Writer, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	dataset := args[0]
+
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	inPath := flags.String("in", "", "NDJSON file to import")
+	dryRun := flags.Bool("dry-run", false, "print the planned changes without applying them")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *inPath == "" {
+		logger.Println("-in is required")
+		return 2
+	}
+
+	file, err := os.Open(*inPath)
+	if err != nil {
+		logger.Printf("Failed to open %s: %v", *inPath, err)
+		return 1
+	}
+	defer file.Close()
+
+	ctx := context.Background()
+	var apply func(db database.Store) error
+	switch dataset {
+	case datasetClients:
+		rows, err := readRows(file, validateClient)
+		if err != nil {
+			logger.Printf("Invalid import file: %v", err)
+			return 1
+		}
+		for _, row := range rows {
+			fmt.Fprintf(out, "upsert client %s (nft_amount %d, commission_rate %g)\n",
+				strings.ToLower(row.Address), row.NFTAmount, row.CommissionRate)
+		}
+		apply = func(db database.Store) error {
+			for _, row := range rows {
+				client := database.ClientInfo{
+					Address:                row.Address,
+					TotalTime:              row.TotalTime,
+					LastHeartbeat:          row.LastHeartbeat,
+					CreatedAt:              row.CreatedAt,
+					NFTAmount:              row.NFTAmount,
+					CommissionRate:         row.CommissionRate,
+					OperatorName:           row.OperatorName,
+					RewardCollectorAddress: row.RewardCollectorAddress,
+				}
+				if err := db.UpsertClient(ctx, client); err != nil {
+					return fmt.Errorf("client %s: %v", row.Address, err)
+				}
+			}
+			return nil
+		}
+
+	case datasetHeartbeats:
+		rows, err := readRows(file, validateHeartbeat)
+		if err != nil {
+			logger.Printf("Invalid import file: %v", err)
+			return 1
+		}
+		perClient := make(map[string]int)
+		for _, row := range rows {
+			perClient[strings.ToLower(row.ClientAddress)]++
+		}
+		addresses := make([]string, 0, len(perClient))
+		for address := range perClient {
+			addresses = append(addresses, address)
+		}
+		sort.Strings(addresses)
+		for _, address := range addresses {
+			fmt.Fprintf(out, "add %d heartbeats for %s\n", perClient[address], address)
+		}
+		apply = func(db database.Store) error {
+			for _, row := range rows {
+				row.ClientAddress = strings.ToLower(row.ClientAddress)
+				if err := db.AddHeartbeat(ctx, database.HeartbeatRecord(row)); err != nil {
+					return fmt.Errorf("heartbeat of %s at %s: %v", row.ClientAddress, row.Timestamp.Format(time.RFC3339), err)
+				}
+			}
+			return nil
+		}
+
+	case datasetDelegations:
+		rows, err := readRows(file, validateDelegation)
+		if err != nil {
+			logger.Printf("Invalid import file: %v", err)
+			return 1
+		}
+		for _, row := range rows {
+			fmt.Fprintf(out, "upsert delegation from %s to %s (amount %d)\n",
+				strings.ToLower(row.FromAddress), strings.ToLower(row.ToAddress), row.Amount)
+		}
+		apply = func(db database.Store) error {
+			for _, row := range rows {
+				if err := db.UpsertDelegation(ctx, database.DelegationRecord(row)); err != nil {
+					return fmt.Errorf("delegation from %s to %s: %v", row.FromAddress, row.ToAddress, err)
+				}
+			}
+			return nil
+		}
+
+	default:
+		logger.Printf("Unknown dataset %q", dataset)
+		return 2
+	}
+
+	if *dryRun {
+		fmt.Fprintln(out, "dry run: nothing imported")
+		return 0
+	}
+
+	db, err := openStore(cfg, logger)
+	if err != nil {
+		logger.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	if err := apply(db); err != nil {
+		logger.Printf("Import failed: %v", err)
+		return 1
+	}
+	fmt.Fprintf(out, "imported %s from %s\n", dataset, *inPath)
+	return 0
+}
+
+// readRows decodes and validates every line of an NDJSON file
+func readRows[T any](r io.Reader, validate func(T) error) ([]T, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var rows []T
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var row T
+		if err := json.Unmarshal([]byte(text), &row); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		if err := validate(row); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+func validateClient(row clientRow) error {
+	if !common.IsHexAddress(row.Address) {
+		return fmt.Errorf("invalid address %q", row.Address)
+	}
+	if row.RewardCollectorAddress != "" && !common.IsHexAddress(row.RewardCollectorAddress) {
+		return fmt.Errorf("invalid reward_collector_address %q", row.RewardCollectorAddress)
+	}
+	if row.CreatedAt.IsZero() {
+		return fmt.Errorf("missing created_at")
+	}
+	return nil
+}
+
+func validateHeartbeat(row heartbeatRow) error {
+	if !common.IsHexAddress(row.ClientAddress) {
+		return fmt.Errorf("invalid client_address %q", row.ClientAddress)
+	}
+	if row.Timestamp.IsZero() {
+		return fmt.Errorf("missing timestamp")
+	}
+	return nil
+}
+
+func validateDelegation(row delegationRow) error {
+	if !common.IsHexAddress(row.FromAddress) {
+		return fmt.Errorf("invalid from_address %q", row.FromAddress)
+	}
+	if !common.IsHexAddress(row.ToAddress) {
+		return fmt.Errorf("invalid to_address %q", row.ToAddress)
+	}
+	if row.Timestamp.IsZero() {
+		return fmt.Errorf("missing timestamp")
+	}
+	return nil
+}
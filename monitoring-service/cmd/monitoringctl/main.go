@@ -0,0 +1,152 @@
+// Command monitoringctl inspects and repairs the monitoring service's data.
+// It reads the same configuration as the server.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/blockchain/delegation"
+	"monitoring-service/internal/blockchain/nft"
+	"monitoring-service/internal/database"
+	"monitoring-service/pkg/config"
+)
+
+const usage = `Usage: monitoringctl [-network ID] <command> [flags]
+
+Commands:
+  clients list [-status S]                  list clients with uptime and status
+  clients inspect <address>                 show a client with its recent heartbeats and delegations
+  verify <address> [-dry-run]               re-verify a client's delegations against the chain
+  delegations purge <address> [-dry-run]    remove stored delegations the chain no longer backs
+  uptime recompute -from T -to T [-address A]
+                                            recount uptime over a time range from stored heartbeats
+  export <dataset> [-format F] [-from T] [-to T] [-address A] [-out FILE]
+                                            export clients, heartbeats or delegations
+  import <dataset> -in FILE [-dry-run]      import an NDJSON export of clients, heartbeats or delegations
+  token -subject S -role R [-ttl D]         issue an admin API JWT signed with ADMIN_JWT_SECRET
+
+Commands that change data print the planned changes and leave the data
+untouched when run with -dry-run. Times are RFC 3339. Commands work on the
+network given by -network, by default the first configured network.
+`
+
+func main() {
+	logger := log.New(os.Stderr, "[monitoringctl] ", log.LstdFlags)
+
+	flags := flag.NewFlagSet("monitoringctl", flag.ContinueOnError)
+	flags.Usage = func() {}
+	network := flags.String("network", "", "network to work on")
+	if err := flags.Parse(os.Args[1:]); err == flag.ErrHelp {
+		fmt.Fprint(os.Stdout, usage)
+		os.Exit(0)
+	} else if err != nil || flags.NArg() == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		logger.Fatalf("Failed to load config: %v", err)
+	}
+	if *network != "" {
+		if cfg, err = cfg.ForNetwork(*network); err != nil {
+			logger.Fatalf("Failed to load config: %v", err)
+		}
+	}
+
+	os.Exit(run(cfg, logger, os.Stdout, flags.Args()))
+}
+
+// run dispatches a command and returns the exit code
+func run(cfg *config.Config, logger *log.Logger, out io.Writer, args []string) int {
+	command, args := args[0], args[1:]
+	switch command {
+	case "clients":
+		return runClients(cfg, logger, out, args)
+	case "verify":
+		return runVerify(cfg, logger, out, args)
+	case "delegations":
+		return runDelegations(cfg, logger, out, args)
+	case "uptime":
+		return runUptime(cfg, logger, out, args)
+	case "export":
+		return runExport(cfg, logger, out, args)
+	case "import":
+		return runImport(cfg, logger, out, args)
+	case "token":
+		return runToken(cfg, logger, out, args)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(out, usage)
+		return 0
+	}
+
+	fmt.Fprint(os.Stderr, usage)
+	return 2
+}
+
+// openStore connects to the configured database. Its log lines go to the
+// command's log output.
+func openStore(cfg *config.Config, logger *log.Logger) (*database.Database, error) {
+	db, err := database.NewDatabase(cfg.MongoURI, cfg.MongoDB, slog.New(slog.NewTextHandler(logger.Writer(), nil)))
+	if err != nil {
+		return nil, err
+	}
+	db.SetUptimePolicy(cfg.UptimePolicy)
+	db.SetTimeout(cfg.DBTimeout)
+	return db, nil
+}
+
+// chainReaders connects to the configured chain, retrying transient RPC
+// failures the same way the server does
+func chainReaders(cfg *config.Config) (blockchain.DelegationReader, blockchain.BalanceReader, error) {
+	nftChecker, err := nft.NewNFTChecker(cfg.RpcURL, cfg.NFTContractAddr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize NFT checker: %v", err)
+	}
+
+	client, err := ethclient.Dial(cfg.RpcURL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to Ethereum client: %v", err)
+	}
+	delegateRegistry, err := delegation.NewDelegationCaller(common.HexToAddress(cfg.DelegateContractAddr), client)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to initialize delegation registry: %v", err)
+	}
+
+	policy := blockchain.DefaultRetryPolicy
+	policy.Timeout = cfg.ChainTimeout
+	return blockchain.WithDelegationRetry(delegateRegistry, policy),
+		blockchain.WithBalanceRetry(nftChecker, policy),
+		nil
+}
+
+// parseTimeRange parses optional RFC 3339 bounds
+func parseTimeRange(from, to string) (database.TimeRange, error) {
+	var tr database.TimeRange
+	var err error
+
+	if from != "" {
+		if tr.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return tr, fmt.Errorf("invalid -from: %v", err)
+		}
+	}
+	if to != "" {
+		if tr.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return tr, fmt.Errorf("invalid -to: %v", err)
+		}
+	}
+	if !tr.From.IsZero() && !tr.To.IsZero() && !tr.From.Before(tr.To) {
+		return tr, fmt.Errorf("-from must be before -to")
+	}
+	return tr, nil
+}
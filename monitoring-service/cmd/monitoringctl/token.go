@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"monitoring-service/internal/auth"
+	"monitoring-service/pkg/config"
+)
+
+func runToken(cfg *config.Config, logger *log.Logger, out io.Writer, args []string) int {
+	flags := flag.NewFlagSet("token", flag.ContinueOnError)
+	subject := flags.String("subject", "", "who the token is issued to; recorded in the audit log")
+	roleName := flags.String("role", string(auth.RoleReadOnly), "read-only, operator-support or admin")
+	ttl := flags.Duration("ttl", time.Hour, "how long the token is valid")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *subject == "" {
+		logger.Println("-subject is required")
+		return 2
+	}
+	role, err := auth.ParseRole(*roleName)
+	if err != nil {
+		logger.Println(err)
+		return 2
+	}
+	if *ttl <= 0 {
+		logger.Println("-ttl must be positive")
+		return 2
+	}
+	if len(cfg.AdminJWTSecret) == 0 {
+		logger.Println("ADMIN_JWT_SECRET is not set")
+		return 1
+	}
+
+	now := time.Now()
+	token, err := auth.SignToken(cfg.AdminJWTSecret, auth.Claims{
+		Subject:   *subject,
+		Role:      role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(*ttl).Unix(),
+	})
+	if err != nil {
+		logger.Printf("Failed to sign token: %v", err)
+		return 1
+	}
+
+	fmt.Fprintln(out, token)
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/uptime"
+	"monitoring-service/pkg/config"
+)
+
+// runUptime recounts uptime over a range from the stored heartbeats and
+// probes, counted under the configured uptime policy as the service does.
+// Uptime is always derived and never stored, so this only reports.
+func runUptime(cfg *config.Config, logger *log.Logger, out io.Writer, args []string) int {
+	if len(args) == 0 || args[0] != "recompute" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("uptime recompute", flag.ContinueOnError)
+	from := flags.String("from", "", "start of the range (RFC 3339)")
+	to := flags.String("to", "", "end of the range (RFC 3339)")
+	address := flags.String("address", "", "only recompute this client")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *from == "" || *to == "" {
+		logger.Println("-from and -to are required")
+		return 2
+	}
+	tr, err := parseTimeRange(*from, *to)
+	if err != nil {
+		logger.Println(err)
+		return 2
+	}
+	// Count whole intervals, the way the uptime calculator does
+	tr.From = tr.From.Truncate(uptime.IntervalDuration)
+	tr.To = tr.To.Truncate(uptime.IntervalDuration)
+	if !tr.From.Before(tr.To) {
+		logger.Printf("Range must span at least one %s interval", uptime.IntervalDuration)
+		return 2
+	}
+
+	db, err := openStore(cfg, logger)
+	if err != nil {
+		logger.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	var clients []database.ClientInfo
+	if *address != "" {
+		client, err := db.GetClient(ctx, strings.ToLower(*address))
+		if err != nil {
+			logger.Printf("Failed to read client: %v", err)
+			return 1
+		}
+		if client == nil {
+			logger.Printf("Client %s not found", *address)
+			return 1
+		}
+		clients = append(clients, *client)
+	} else if clients, err = db.GetAllClients(ctx); err != nil {
+		logger.Printf("Failed to list clients: %v", err)
+		return 1
+	}
+
+	calc := uptime.NewCalculator(db, cfg.UptimePolicy)
+	fmt.Fprintf(out, "Uptime from %s to %s (%s policy)\n", tr.From.Format(time.RFC3339), tr.To.Format(time.RFC3339), cfg.UptimePolicy)
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ADDRESS\tINTERVALS\tEXPECTED\tUPTIME")
+	for _, client := range clients {
+		// Intervals before the client registered are not expected of it
+		start := tr.From
+		if created := client.CreatedAt.Truncate(uptime.IntervalDuration); created.After(start) {
+			start = created
+		}
+		if !start.Before(tr.To) {
+			fmt.Fprintf(w, "%s\t0\t0\t-\n", client.Address)
+			continue
+		}
+
+		intervals, err := calc.CountIntervals(ctx, client.Address, start, tr.To)
+		if err != nil {
+			logger.Printf("Failed to count intervals for %s: %v", client.Address, err)
+			return 1
+		}
+		expected := int64(tr.To.Sub(start) / uptime.IntervalDuration)
+		percentage := float64(intervals) / float64(expected) * 100
+		if percentage > 100 {
+			percentage = 100
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%.2f%%\n", client.Address, intervals, expected, percentage)
+	}
+	w.Flush()
+	return 0
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/verification"
+	"monitoring-service/pkg/config"
+)
+
+// delegationPlan is how a client's stored delegations differ from the chain
+type delegationPlan struct {
+	address  string
+	client   *database.ClientInfo
+	verified verification.Result
+	// stored delegations to the address, keyed by lowercase delegator
+	stored map[string]database.DelegationRecord
+	// valid delegators, lowercase, sorted
+	valid []string
+	// stale delegators with stored delegations the chain no longer backs, sorted
+	stale []string
+}
+
+func planDelegations(ctx context.Context, cfg *config.Config, db database.Store, address string) (*delegationPlan, error) {
+	address = strings.ToLower(address)
+
+	client, err := db.GetClient(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client: %v", err)
+	}
+
+	delegationReader, balanceReader, err := chainReaders(cfg)
+	if err != nil {
+		return nil, err
+	}
+	verified, err := verification.Verify(ctx, cfg, delegationReader, balanceReader, address)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := db.GetToDelegationsByAddress(ctx, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read delegations: %v", err)
+	}
+
+	plan := &delegationPlan{
+		address:  address,
+		client:   client,
+		verified: verified,
+		stored:   make(map[string]database.DelegationRecord, len(records)),
+	}
+	for _, record := range records {
+		plan.stored[strings.ToLower(record.FromAddress)] = record
+	}
+
+	validSet := make(map[string]bool, len(verified.Delegators))
+	for delegator := range verified.Delegators {
+		delegator = strings.ToLower(delegator)
+		validSet[delegator] = true
+		plan.valid = append(plan.valid, delegator)
+	}
+	for delegator := range plan.stored {
+		if !validSet[delegator] {
+			plan.stale = append(plan.stale, delegator)
+		}
+	}
+	sort.Strings(plan.valid)
+	sort.Strings(plan.stale)
+
+	return plan, nil
+}
+
+// amount returns what the chain says delegator delegates
+func (p *delegationPlan) amount(delegator string) int64 {
+	for from, amount := range p.verified.Delegators {
+		if strings.EqualFold(from, delegator) {
+			return amount
+		}
+	}
+	return 0
+}
+
+func (p *delegationPlan) printRemovals(out io.Writer) int {
+	for _, delegator := range p.stale {
+		fmt.Fprintf(out, "remove delegation from %s (amount %d)\n", delegator, p.stored[delegator].Amount)
+	}
+	return len(p.stale)
+}
+
+func (p *delegationPlan) printUpdates(out io.Writer) int {
+	changes := 0
+	for _, delegator := range p.valid {
+		amount := p.amount(delegator)
+		record, ok := p.stored[delegator]
+		switch {
+		case !ok:
+			fmt.Fprintf(out, "add delegation from %s (amount %d)\n", delegator, amount)
+			changes++
+		case record.Amount != amount:
+			fmt.Fprintf(out, "update delegation from %s: amount %d -> %d\n", delegator, record.Amount, amount)
+			changes++
+		}
+	}
+	if p.client != nil && p.client.NFTAmount != p.verified.Total {
+		fmt.Fprintf(out, "update client %s: nft_amount %d -> %d\n", p.address, p.client.NFTAmount, p.verified.Total)
+		changes++
+	}
+	return changes
+}
+
+func runVerify(cfg *config.Config, logger *log.Logger, out io.Writer, args []string) int {
+	flags := flag.NewFlagSet("verify", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the planned changes without applying them")
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	address := args[0]
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+
+	db, err := openStore(cfg, logger)
+	if err != nil {
+		logger.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	plan, err := planDelegations(ctx, cfg, db, address)
+	if err != nil {
+		logger.Printf("Verification failed: %v", err)
+		return 1
+	}
+	if plan.client == nil {
+		logger.Printf("Client %s not found", address)
+		return 1
+	}
+
+	fmt.Fprintf(out, "%s: %d incoming delegations, %d valid delegators, total amount %d\n",
+		plan.address, plan.verified.Incoming, len(plan.valid), plan.verified.Total)
+	if plan.verified.Total == 0 {
+		fmt.Fprintln(out, "warning: no valid delegations; the client's heartbeats will be rejected")
+	}
+
+	changes := plan.printRemovals(out) + plan.printUpdates(out)
+	if changes == 0 {
+		fmt.Fprintln(out, "no changes")
+		return 0
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "dry run: %d changes not applied\n", changes)
+		return 0
+	}
+
+	if err := db.ClearDelegationsForAddress(ctx, plan.address, plan.valid); err != nil {
+		logger.Printf("Failed to remove delegations: %v", err)
+		return 1
+	}
+	for _, delegator := range plan.valid {
+		amount := plan.amount(delegator)
+		record, ok := plan.stored[delegator]
+		if ok && record.Amount == amount {
+			continue
+		}
+		if !ok {
+			record = database.DelegationRecord{
+				FromAddress:    delegator,
+				ToAddress:      plan.address,
+				CommissionRate: plan.client.CommissionRate,
+				Timestamp:      time.Now(),
+			}
+		}
+		record.Amount = amount
+		if err := db.UpsertDelegation(ctx, record); err != nil {
+			logger.Printf("Failed to write delegation from %s: %v", delegator, err)
+			return 1
+		}
+	}
+	if plan.client.NFTAmount != plan.verified.Total {
+		client := *plan.client
+		client.NFTAmount = plan.verified.Total
+		if err := db.UpsertClient(ctx, client); err != nil {
+			logger.Printf("Failed to update client: %v", err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(out, "applied %d changes\n", changes)
+	return 0
+}
+
+func runDelegations(cfg *config.Config, logger *log.Logger, out io.Writer, args []string) int {
+	if len(args) < 2 || args[0] != "purge" {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	flags := flag.NewFlagSet("delegations purge", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "print the delegations that would be removed without removing them")
+	address := args[1]
+	if err := flags.Parse(args[2:]); err != nil {
+		return 2
+	}
+
+	db, err := openStore(cfg, logger)
+	if err != nil {
+		logger.Printf("Failed to initialize database: %v", err)
+		return 1
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	plan, err := planDelegations(ctx, cfg, db, address)
+	if err != nil {
+		logger.Printf("Verification failed: %v", err)
+		return 1
+	}
+
+	removals := plan.printRemovals(out)
+	if removals == 0 {
+		fmt.Fprintln(out, "no invalid delegations")
+		return 0
+	}
+	if *dryRun {
+		fmt.Fprintf(out, "dry run: %d delegations not removed\n", removals)
+		return 0
+	}
+
+	if err := db.ClearDelegationsForAddress(ctx, plan.address, plan.valid); err != nil {
+		logger.Printf("Failed to remove delegations: %v", err)
+		return 1
+	}
+	fmt.Fprintf(out, "removed %d delegations\n", removals)
+	return 0
+}
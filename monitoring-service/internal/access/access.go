@@ -0,0 +1,281 @@
+// Package access decides which addresses may register as light clients,
+// from the configured blocklist and allowlist.
+package access
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+// Decision is the outcome of checking an address against the policy
+type Decision int
+
+const (
+	Allowed Decision = iota
+	// Blocked addresses are on the blocklist
+	Blocked
+	// NotAllowed addresses are missing from a non-empty allowlist
+	NotAllowed
+)
+
+// Policy is a blocklist and an optional allowlist. With an allowlist only
+// the addresses on it may register. The blocklist wins over the allowlist.
+// Lists can be replaced while the service runs.
+type Policy struct {
+	mu        sync.RWMutex
+	blocklist map[string]bool
+	allowlist map[string]bool
+}
+
+// NewPolicy creates a policy from the given addresses
+func NewPolicy(blocklist, allowlist []string) *Policy {
+	p := &Policy{}
+	p.Set(blocklist, allowlist)
+	return p
+}
+
+// Set replaces both lists
+func (p *Policy) Set(blocklist, allowlist []string) {
+	blocked := toSet(blocklist)
+	allowed := toSet(allowlist)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocklist = blocked
+	p.allowlist = allowed
+}
+
+// Check returns whether the address may register
+func (p *Policy) Check(address string) Decision {
+	address = strings.ToLower(address)
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.blocklist[address] {
+		return Blocked
+	}
+	if len(p.allowlist) > 0 && !p.allowlist[address] {
+		return NotAllowed
+	}
+	return Allowed
+}
+
+func toSet(addresses []string) map[string]bool {
+	set := make(map[string]bool, len(addresses))
+	for _, address := range addresses {
+		set[strings.ToLower(address)] = true
+	}
+	return set
+}
+
+// filteredStore hides clients the policy does not allow from every read of
+// client data
+type filteredStore struct {
+	database.Store
+	policy *Policy
+}
+
+// FilterStore wraps store so that clients the policy does not allow are
+// left out of every client read, and so of every route built on them:
+// client listings and lookups with their heartbeats, delegations and
+// probes, delegator views, version statistics, ranking, exports and sybil
+// flags. Their records and history are kept.
+func FilterStore(store database.Store, policy *Policy) database.Store {
+	return &filteredStore{Store: store, policy: policy}
+}
+
+func (s *filteredStore) allowed(address string) bool {
+	return s.policy.Check(address) == Allowed
+}
+
+// keep returns the items whose address the policy allows, in place
+func keep[T any](s *filteredStore, items []T, address func(T) string) []T {
+	allowed := items[:0]
+	for _, item := range items {
+		if s.allowed(address(item)) {
+			allowed = append(allowed, item)
+		}
+	}
+	return allowed
+}
+
+func (s *filteredStore) ClientExists(ctx context.Context, address string) (bool, error) {
+	if !s.allowed(address) {
+		return false, nil
+	}
+	return s.Store.ClientExists(ctx, address)
+}
+
+func (s *filteredStore) GetClient(ctx context.Context, address string) (*database.ClientInfo, error) {
+	if !s.allowed(address) {
+		return nil, nil
+	}
+	return s.Store.GetClient(ctx, address)
+}
+
+func (s *filteredStore) GetAllClients(ctx context.Context) ([]database.ClientInfo, error) {
+	clients, err := s.Store.GetAllClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keep(s, clients, func(client database.ClientInfo) string { return client.Address }), nil
+}
+
+func (s *filteredStore) GetLastHeartbeats(ctx context.Context) (map[string]time.Time, error) {
+	lastHeartbeats, err := s.Store.GetLastHeartbeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for address := range lastHeartbeats {
+		if !s.allowed(address) {
+			delete(lastHeartbeats, address)
+		}
+	}
+	return lastHeartbeats, nil
+}
+
+func (s *filteredStore) GetClientSources(ctx context.Context, since time.Time) ([]database.ClientSource, error) {
+	sources, err := s.Store.GetClientSources(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	return keep(s, sources, func(source database.ClientSource) string { return source.ClientAddress }), nil
+}
+
+func (s *filteredStore) GetVersionHistory(ctx context.Context, address string) ([]database.VersionChange, error) {
+	if !s.allowed(address) {
+		return nil, nil
+	}
+	return s.Store.GetVersionHistory(ctx, address)
+}
+
+func (s *filteredStore) GetClientVersions(ctx context.Context) (map[string]database.ClientVersion, error) {
+	versions, err := s.Store.GetClientVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for address := range versions {
+		if !s.allowed(address) {
+			delete(versions, address)
+		}
+	}
+	return versions, nil
+}
+
+func (s *filteredStore) StreamClients(ctx context.Context, tr database.TimeRange, fn func(database.ClientInfo) error) error {
+	return s.Store.StreamClients(ctx, tr, func(client database.ClientInfo) error {
+		if !s.allowed(client.Address) {
+			return nil
+		}
+		return fn(client)
+	})
+}
+
+func (s *filteredStore) StreamHeartbeats(ctx context.Context, address string, tr database.TimeRange, fn func(database.HeartbeatRecord) error) error {
+	return s.Store.StreamHeartbeats(ctx, address, tr, func(heartbeat database.HeartbeatRecord) error {
+		if !s.allowed(heartbeat.ClientAddress) {
+			return nil
+		}
+		return fn(heartbeat)
+	})
+}
+
+// StreamDelegations leaves out delegations to hidden operators
+func (s *filteredStore) StreamDelegations(ctx context.Context, address string, tr database.TimeRange, fn func(database.DelegationRecord) error) error {
+	return s.Store.StreamDelegations(ctx, address, tr, func(delegation database.DelegationRecord) error {
+		if !s.allowed(delegation.ToAddress) {
+			return nil
+		}
+		return fn(delegation)
+	})
+}
+
+func (s *filteredStore) GetDelegatorPositions(ctx context.Context, address string) ([]database.DelegatorPosition, error) {
+	positions, err := s.Store.GetDelegatorPositions(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return keep(s, positions, func(position database.DelegatorPosition) string { return position.OperatorAddress }), nil
+}
+
+func (s *filteredStore) GetHeartbeats(ctx context.Context, address string, since time.Time) ([]database.HeartbeatRecord, error) {
+	if !s.allowed(address) {
+		return nil, nil
+	}
+	return s.Store.GetHeartbeats(ctx, address, since)
+}
+
+func (s *filteredStore) GetOperatorActivity(ctx context.Context, since time.Time) (map[string]database.OperatorActivity, error) {
+	activity, err := s.Store.GetOperatorActivity(ctx, since)
+	if err != nil {
+		return nil, err
+	}
+	for address := range activity {
+		if !s.allowed(address) {
+			delete(activity, address)
+		}
+	}
+	return activity, nil
+}
+
+func (s *filteredStore) GetProbes(ctx context.Context, address string, since time.Time) ([]database.ProbeRecord, error) {
+	if !s.allowed(address) {
+		return nil, nil
+	}
+	return s.Store.GetProbes(ctx, address, since)
+}
+
+func (s *filteredStore) GetToDelegationsByAddress(ctx context.Context, address string) ([]database.DelegationRecord, error) {
+	if !s.allowed(address) {
+		return nil, nil
+	}
+	return s.Store.GetToDelegationsByAddress(ctx, address)
+}
+
+// GetFromDelegationsByAddress leaves out delegations to hidden operators
+func (s *filteredStore) GetFromDelegationsByAddress(ctx context.Context, address string) ([]database.DelegationRecord, error) {
+	delegations, err := s.Store.GetFromDelegationsByAddress(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return keep(s, delegations, delegationOperator), nil
+}
+
+// GetDelegations leaves out delegations to hidden operators
+func (s *filteredStore) GetDelegations(ctx context.Context, address string) ([]database.DelegationRecord, error) {
+	delegations, err := s.Store.GetDelegations(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+	return keep(s, delegations, delegationOperator), nil
+}
+
+func delegationOperator(delegation database.DelegationRecord) string {
+	return delegation.ToAddress
+}
+
+// ClientIP returns the address a request came from. With trustForwardedFor
+// the last X-Forwarded-For entry is used, for deployments behind a proxy
+// that appends it. Earlier entries are sent by the client and can be forged.
+func ClientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if values := r.Header.Values("X-Forwarded-For"); len(values) > 0 {
+			entries := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(entries[len(entries)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
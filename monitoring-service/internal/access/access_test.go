@@ -0,0 +1,172 @@
+package access_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"monitoring-service/internal/access"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/database/memory"
+	"monitoring-service/internal/handlers"
+	"monitoring-service/internal/logging"
+)
+
+const (
+	allowedOperator = "0x00000000000000000000000000000000000a0001"
+	blockedOperator = "0x00000000000000000000000000000000000a0002"
+	holder          = "0x00000000000000000000000000000000000b0001"
+)
+
+// newStore returns a store with both operators registered, backed by
+// holder and with a heartbeat and a source each, filtered so that
+// blockedOperator is hidden
+func newStore(t *testing.T) (*memory.Store, database.Store) {
+	t.Helper()
+
+	ctx := context.Background()
+	store := memory.New(logging.Discard())
+	t.Cleanup(func() { store.Close() })
+	for _, operator := range []string{allowedOperator, blockedOperator} {
+		err := store.RecordHeartbeat(ctx, operator, database.ClientHeartbeat{Amount: 1, CommissionRate: 5, MaxGap: 5 * time.Minute})
+		if err != nil {
+			t.Fatalf("RecordHeartbeat: %v", err)
+		}
+		if err := store.ReplaceDelegations(ctx, operator, map[string]int64{holder: 1}, 5); err != nil {
+			t.Fatalf("ReplaceDelegations: %v", err)
+		}
+		if err := store.RecordClientSource(ctx, operator, "192.0.2.1", time.Now()); err != nil {
+			t.Fatalf("RecordClientSource: %v", err)
+		}
+		heartbeat := database.HeartbeatRecord{ClientAddress: operator, Timestamp: time.Now(), Duration: 60, Amount: 1, CommissionRate: 5}
+		if err := store.AddHeartbeat(ctx, heartbeat); err != nil {
+			t.Fatalf("AddHeartbeat: %v", err)
+		}
+	}
+	return store, access.FilterStore(store, access.NewPolicy([]string{blockedOperator}, nil))
+}
+
+func get(t *testing.T, handler http.HandlerFunc, target string, resp interface{}) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s = %d: %s", target, rec.Code, rec.Body)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(resp); err != nil {
+		t.Fatalf("decode GET %s: %v", target, err)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name      string
+		forwarded []string
+		trust     bool
+		want      string
+	}{
+		{"RemoteAddr", nil, true, "192.0.2.1"},
+		{"UntrustedHeader", []string{"198.51.100.7"}, false, "192.0.2.1"},
+		{"Single", []string{"198.51.100.7"}, true, "198.51.100.7"},
+		// The client can prepend anything; the proxy appends the real address
+		{"Spoofed", []string{"203.0.113.9, 198.51.100.7"}, true, "198.51.100.7"},
+		{"SeveralHeaders", []string{"203.0.113.9", "198.51.100.7"}, true, "198.51.100.7"},
+		{"EmptyEntry", []string{"203.0.113.9, "}, true, "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/check-nft", nil)
+			r.RemoteAddr = "192.0.2.1:4711"
+			for _, value := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", value)
+			}
+			if got := access.ClientIP(r, tt.trust); got != tt.want {
+				t.Errorf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterStore(t *testing.T) {
+	ctx := context.Background()
+	store, filtered := newStore(t)
+
+	if client, err := filtered.GetClient(ctx, blockedOperator); err != nil || client != nil {
+		t.Errorf("GetClient(blocked) = %v, %v, want nil", client, err)
+	}
+	if client, err := filtered.GetClient(ctx, allowedOperator); err != nil || client == nil {
+		t.Errorf("GetClient(allowed) = %v, %v, want the client", client, err)
+	}
+	if clients, err := filtered.GetAllClients(ctx); err != nil || len(clients) != 1 || clients[0].Address != allowedOperator {
+		t.Errorf("GetAllClients = %+v, %v, want only the allowed client", clients, err)
+	}
+	if positions, err := filtered.GetDelegatorPositions(ctx, holder); err != nil || len(positions) != 1 || positions[0].OperatorAddress != allowedOperator {
+		t.Errorf("GetDelegatorPositions = %+v, %v, want only the allowed operator", positions, err)
+	}
+	if lastHeartbeats, err := filtered.GetLastHeartbeats(ctx); err != nil || len(lastHeartbeats) != 1 {
+		t.Errorf("GetLastHeartbeats = %v, %v, want only the allowed client", lastHeartbeats, err)
+	}
+	if sources, err := filtered.GetClientSources(ctx, time.Now().Add(-time.Hour)); err != nil || len(sources) != 1 {
+		t.Errorf("GetClientSources = %+v, %v, want only the allowed client", sources, err)
+	}
+	if heartbeats, err := filtered.GetHeartbeats(ctx, blockedOperator, time.Now().Add(-time.Hour)); err != nil || len(heartbeats) != 0 {
+		t.Errorf("GetHeartbeats(blocked) = %+v, %v, want none", heartbeats, err)
+	}
+	if heartbeats, err := filtered.GetHeartbeats(ctx, allowedOperator, time.Now().Add(-time.Hour)); err != nil || len(heartbeats) != 1 {
+		t.Errorf("GetHeartbeats(allowed) = %+v, %v, want one", heartbeats, err)
+	}
+	if delegations, err := filtered.GetToDelegationsByAddress(ctx, blockedOperator); err != nil || len(delegations) != 0 {
+		t.Errorf("GetToDelegationsByAddress(blocked) = %+v, %v, want none", delegations, err)
+	}
+	for name, get := range map[string]func(context.Context, string) ([]database.DelegationRecord, error){
+		"GetFromDelegationsByAddress": filtered.GetFromDelegationsByAddress,
+		"GetDelegations":              filtered.GetDelegations,
+	} {
+		if delegations, err := get(ctx, holder); err != nil || len(delegations) != 1 || delegations[0].ToAddress != allowedOperator {
+			t.Errorf("%s(holder) = %+v, %v, want only the delegation to the allowed operator", name, delegations, err)
+		}
+	}
+
+	var delegations []database.DelegationRecord
+	err := filtered.StreamDelegations(ctx, holder, database.TimeRange{}, func(d database.DelegationRecord) error {
+		delegations = append(delegations, d)
+		return nil
+	})
+	if err != nil || len(delegations) != 1 || delegations[0].ToAddress != allowedOperator {
+		t.Errorf("StreamDelegations = %+v, %v, want only delegations to the allowed operator", delegations, err)
+	}
+
+	// The records are kept
+	if client, err := store.GetClient(ctx, blockedOperator); err != nil || client == nil {
+		t.Errorf("underlying GetClient(blocked) = %v, %v, want the client", client, err)
+	}
+}
+
+// TestLegacyRoutes checks the unversioned routes kept for existing light
+// clients and dashboards, which read client history and delegations
+func TestLegacyRoutes(t *testing.T) {
+	_, filtered := newStore(t)
+
+	var history handlers.ClientWithHistoryResponse
+	get(t, handlers.GetClients(filtered), "/clients?address="+blockedOperator, &history)
+	if history.Client != nil || len(history.Heartbeats) != 0 || len(history.Delegations) != 0 {
+		t.Errorf("/clients?address=<blocked> = %+v, want no client, heartbeats or delegations", history)
+	}
+
+	history = handlers.ClientWithHistoryResponse{}
+	get(t, handlers.GetClients(filtered), "/clients?address="+allowedOperator, &history)
+	if history.Client == nil || len(history.Heartbeats) != 1 || len(history.Delegations) != 1 {
+		t.Errorf("/clients?address=<allowed> = %+v, want the client with its heartbeat and delegation", history)
+	}
+
+	var delegations handlers.GetDelegationsResponse
+	get(t, handlers.GetDelegations(filtered), "/delegations?address="+holder, &delegations)
+	if len(delegations.Clients) != 1 || delegations.Clients[0].ClientInfo.Address != allowedOperator {
+		t.Errorf("/delegations?address=<holder> = %+v, want only the allowed operator", delegations.Clients)
+	}
+}
@@ -0,0 +1,154 @@
+// Package auth authenticates callers of the admin API with API keys or
+// HS256 JWTs and assigns each a role.
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Role is what an authenticated caller may do. Each role includes the
+// permissions of the roles before it.
+type Role string
+
+const (
+	// RoleReadOnly may read admin data
+	RoleReadOnly Role = "read-only"
+	// RoleOperatorSupport may also override client status and annotate incidents
+	RoleOperatorSupport Role = "operator-support"
+	// RoleAdmin may do everything, including managing the blacklist and
+	// reading the audit log
+	RoleAdmin Role = "admin"
+)
+
+// Roles lists the roles from least to most privileged
+var Roles = []Role{RoleReadOnly, RoleOperatorSupport, RoleAdmin}
+
+var (
+	// ErrNoCredentials is returned when a request carries no API key or token
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials is returned for unknown API keys and invalid tokens
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// ParseRole validates a role name
+func ParseRole(name string) (Role, error) {
+	for _, role := range Roles {
+		if string(role) == name {
+			return role, nil
+		}
+	}
+	return "", fmt.Errorf("unknown role %q", name)
+}
+
+func (r Role) rank() int {
+	for i, role := range Roles {
+		if role == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// Allows reports whether the role includes the required role
+func (r Role) Allows(required Role) bool {
+	return r.rank() >= 0 && r.rank() >= required.rank()
+}
+
+// APIKey is a static credential for a named caller
+type APIKey struct {
+	Name string
+	Role Role
+	Key  string
+}
+
+// Principal is an authenticated caller
+type Principal struct {
+	// Subject is the API key name or the token's sub claim
+	Subject string `json:"subject"`
+	Role    Role   `json:"role"`
+	// Method is "api_key" or "jwt"
+	Method string `json:"method"`
+}
+
+type hashedKey struct {
+	hash [sha256.Size]byte
+	name string
+	role Role
+}
+
+// Authenticator checks the credentials on admin requests
+type Authenticator struct {
+	keys      []hashedKey
+	jwtSecret []byte
+}
+
+// New creates an authenticator for the given API keys and JWT secret. With
+// no keys and no secret every request is rejected.
+func New(keys []APIKey, jwtSecret []byte) *Authenticator {
+	a := &Authenticator{jwtSecret: jwtSecret}
+	for _, key := range keys {
+		a.keys = append(a.keys, hashedKey{
+			hash: sha256.Sum256([]byte(key.Key)),
+			name: key.Name,
+			role: key.Role,
+		})
+	}
+	return a
+}
+
+// Authenticate identifies the caller from an `Authorization: Bearer` header
+// holding an API key or a JWT, or from an X-API-Key header
+func (a *Authenticator) Authenticate(r *http.Request) (Principal, error) {
+	credential := r.Header.Get("X-API-Key")
+	if header := r.Header.Get("Authorization"); credential == "" && header != "" {
+		scheme, value, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return Principal{}, ErrInvalidCredentials
+		}
+		credential = strings.TrimSpace(value)
+	}
+	if credential == "" {
+		return Principal{}, ErrNoCredentials
+	}
+
+	// JWTs have three dot separated parts; API keys have none
+	if strings.Count(credential, ".") == 2 {
+		return a.verifyToken(credential)
+	}
+	return a.verifyKey(credential)
+}
+
+func (a *Authenticator) verifyKey(key string) (Principal, error) {
+	hash := sha256.Sum256([]byte(key))
+
+	// Compare against every key so timing does not reveal which one matched
+	var match *hashedKey
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare(hash[:], a.keys[i].hash[:]) == 1 {
+			match = &a.keys[i]
+		}
+	}
+	if match == nil {
+		return Principal{}, ErrInvalidCredentials
+	}
+	return Principal{Subject: match.name, Role: match.role, Method: "api_key"}, nil
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFrom returns the authenticated caller, if any
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
@@ -0,0 +1,97 @@
+// Package avail reads finalized blocks from an Avail node over its
+// Substrate JSON-RPC API, to check what light clients report against.
+package avail
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// ErrUnknownBlock is returned for a block number the chain does not have
+var ErrUnknownBlock = errors.New("unknown block")
+
+// HeadCacheTTL is how long a finalized head is reused. Avail produces a
+// block every 20 seconds, so heartbeats arriving together share one lookup.
+const HeadCacheTTL = 5 * time.Second
+
+// Head is a finalized block
+type Head struct {
+	Number uint64
+	Hash   string
+}
+
+// Chain reads finalized blocks
+type Chain interface {
+	FinalizedHead(ctx context.Context) (Head, error)
+	// BlockHash returns the hash of the canonical block at number
+	BlockHash(ctx context.Context, number uint64) (string, error)
+}
+
+// Client reads blocks from an Avail RPC endpoint
+type Client struct {
+	rpc *rpc.Client
+
+	mu      sync.Mutex
+	head    Head
+	fetched time.Time
+}
+
+// Dial connects to the Avail RPC at url. HTTP endpoints are not contacted
+// until the first call.
+func Dial(url string) (*Client, error) {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{rpc: client}, nil
+}
+
+type header struct {
+	Number string `json:"number"`
+}
+
+func (c *Client) FinalizedHead(ctx context.Context) (Head, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.fetched) < HeadCacheTTL {
+		return c.head, nil
+	}
+
+	var hash string
+	if err := c.rpc.CallContext(ctx, &hash, "chain_getFinalizedHead"); err != nil {
+		return Head{}, err
+	}
+	var h header
+	if err := c.rpc.CallContext(ctx, &h, "chain_getHeader", hash); err != nil {
+		return Head{}, err
+	}
+	number, err := hexutil.DecodeUint64(h.Number)
+	if err != nil {
+		return Head{}, err
+	}
+
+	c.head = Head{Number: number, Hash: hash}
+	c.fetched = time.Now()
+	return c.head, nil
+}
+
+func (c *Client) BlockHash(ctx context.Context, number uint64) (string, error) {
+	var hash *string
+	if err := c.rpc.CallContext(ctx, &hash, "chain_getBlockHash", number); err != nil {
+		return "", err
+	}
+	if hash == nil {
+		return "", ErrUnknownBlock
+	}
+	return *hash, nil
+}
+
+// Close disconnects from the RPC
+func (c *Client) Close() {
+	c.rpc.Close()
+}
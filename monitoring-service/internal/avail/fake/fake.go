@@ -0,0 +1,104 @@
+// Package fake is an in-memory Avail chain. It implements avail.Chain and
+// serves the same Substrate JSON-RPC methods as a node, so the service can
+// be pointed at it locally through AVAIL_RPC_URL.
+package fake
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"monitoring-service/internal/avail"
+)
+
+// Chain is a linear chain whose finalized head is set by the test
+type Chain struct {
+	mu        sync.RWMutex
+	finalized uint64
+}
+
+var _ avail.Chain = (*Chain)(nil)
+
+// New creates a chain finalized up to block number
+func New(finalized uint64) *Chain {
+	return &Chain{finalized: finalized}
+}
+
+// Finalize moves the finalized head to number
+func (c *Chain) Finalize(number uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finalized = number
+}
+
+// Hash is the deterministic hash of block number
+func Hash(number uint64) string {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], number)
+	sum := sha256.Sum256(buf[:])
+	return hexutil.Encode(sum[:])
+}
+
+func (c *Chain) FinalizedHead(ctx context.Context) (avail.Head, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return avail.Head{Number: c.finalized, Hash: Hash(c.finalized)}, nil
+}
+
+func (c *Chain) BlockHash(ctx context.Context, number uint64) (string, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if number > c.finalized {
+		return "", avail.ErrUnknownBlock
+	}
+	return Hash(number), nil
+}
+
+// Handler serves chain_getFinalizedHead, chain_getHeader and
+// chain_getBlockHash over HTTP JSON-RPC
+func (c *Chain) Handler() http.Handler {
+	server := rpc.NewServer()
+	if err := server.RegisterName("chain", &service{chain: c}); err != nil {
+		panic(err)
+	}
+	return server
+}
+
+type service struct {
+	chain *Chain
+}
+
+type header struct {
+	Number string `json:"number"`
+}
+
+func (s *service) GetFinalizedHead() string {
+	head, _ := s.chain.FinalizedHead(context.Background())
+	return head.Hash
+}
+
+func (s *service) GetHeader(hash string) (*header, error) {
+	s.chain.mu.RLock()
+	defer s.chain.mu.RUnlock()
+	for number := s.chain.finalized; ; number-- {
+		if Hash(number) == hash {
+			return &header{Number: hexutil.EncodeUint64(number)}, nil
+		}
+		if number == 0 {
+			return nil, fmt.Errorf("unknown block %s", hash)
+		}
+	}
+}
+
+func (s *service) GetBlockHash(number uint64) *string {
+	hash, err := s.chain.BlockHash(context.Background(), number)
+	if err != nil {
+		return nil
+	}
+	return &hash
+}
@@ -0,0 +1,42 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"monitoring-service/internal/blockchain/delegation"
+)
+
+// Delegation types as defined by IDelegateRegistry.DelegationType
+const (
+	DelegationTypeNone uint8 = iota
+	DelegationTypeAll
+	DelegationTypeContract
+	DelegationTypeERC721
+	DelegationTypeERC20
+	DelegationTypeERC1155
+)
+
+// BalanceReader reads NFT balances from the operator NFT contract.
+// It is satisfied by *nft.NFTChecker.
+type BalanceReader interface {
+	// GetBatchBalance returns a single element holding the address's
+	// combined balance over the tracked token IDs
+	GetBatchBalance(ctx context.Context, address string, tokenIDs []*big.Int) ([]*big.Int, error)
+	GetContractAddress() common.Address
+}
+
+// DelegationReader reads delegations from the DelegateRegistry contract.
+// It is satisfied by *delegation.DelegationCaller.
+type DelegationReader interface {
+	GetIncomingDelegations(opts *bind.CallOpts, to common.Address) ([]delegation.IDelegateRegistryDelegation, error)
+	CheckDelegateForERC1155(opts *bind.CallOpts, to common.Address, from common.Address, contract common.Address, tokenID *big.Int, rights [32]byte) (*big.Int, error)
+}
+
+// HeadReader reads the latest block number from the RPC.
+// It is satisfied by *ethclient.Client.
+type HeadReader interface {
+	BlockNumber(ctx context.Context) (uint64, error)
+}
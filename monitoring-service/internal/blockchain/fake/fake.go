@@ -0,0 +1,254 @@
+// Package fake provides a scriptable in-memory chain implementing
+// blockchain.BalanceReader, blockchain.DelegationReader and
+// blockchain.HeadReader, so handlers can be exercised without an RPC
+// endpoint. Latency and errors can be injected per method to drive timeout
+// and retry paths.
+package fake
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/blockchain/delegation"
+)
+
+// Method names accepted by FailNext, SetLatency and Calls
+const (
+	MethodGetBatchBalance         = "GetBatchBalance"
+	MethodGetIncomingDelegations  = "GetIncomingDelegations"
+	MethodCheckDelegateForERC1155 = "CheckDelegateForERC1155"
+	MethodBlockNumber             = "BlockNumber"
+)
+
+// TrackedTokens matches the token IDs nft.NFTChecker sums balances over
+const TrackedTokens = 10
+
+var (
+	_ blockchain.BalanceReader    = (*Chain)(nil)
+	_ blockchain.DelegationReader = (*Chain)(nil)
+	_ blockchain.HeadReader       = (*Chain)(nil)
+)
+
+// Chain is a fake NFT contract and DelegateRegistry
+type Chain struct {
+	mu          sync.Mutex
+	contract    common.Address
+	balances    map[common.Address]map[int64]int64
+	delegations []delegation.IDelegateRegistryDelegation
+	blockNumber uint64
+	latency     map[string]time.Duration
+	failures    map[string][]error
+	calls       map[string]int
+}
+
+// New creates an empty chain whose NFT contract lives at contract
+func New(contract common.Address) *Chain {
+	return &Chain{
+		contract:    contract,
+		blockNumber: 1,
+		balances:    make(map[common.Address]map[int64]int64),
+		latency:     make(map[string]time.Duration),
+		failures:    make(map[string][]error),
+		calls:       make(map[string]int),
+	}
+}
+
+// SetBalance sets owner's balance of tokenID
+func (c *Chain) SetBalance(owner common.Address, tokenID int64, amount int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.balances[owner] == nil {
+		c.balances[owner] = make(map[int64]int64)
+	}
+	c.balances[owner][tokenID] = amount
+}
+
+// Delegate records a delegation as if it had been written to the registry
+func (c *Chain) Delegate(d delegation.IDelegateRegistryDelegation) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.delegations = append(c.delegations, d)
+}
+
+// DelegateERC1155 records an ERC-1155 delegation of the chain's NFT contract
+func (c *Chain) DelegateERC1155(from, to common.Address, tokenID int64, rights [32]byte, amount int64) {
+	c.Delegate(delegation.IDelegateRegistryDelegation{
+		Type:     blockchain.DelegationTypeERC1155,
+		To:       to,
+		From:     from,
+		Rights:   rights,
+		Contract: c.contract,
+		TokenId:  big.NewInt(tokenID),
+		Amount:   big.NewInt(amount),
+	})
+}
+
+// Revoke removes every delegation from from to to
+func (c *Chain) Revoke(from, to common.Address) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	kept := c.delegations[:0]
+	for _, d := range c.delegations {
+		if d.From != from || d.To != to {
+			kept = append(kept, d)
+		}
+	}
+	c.delegations = kept
+}
+
+// SetBlockNumber sets the latest block number
+func (c *Chain) SetBlockNumber(n uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.blockNumber = n
+}
+
+// SetLatency delays every call to method by d
+func (c *Chain) SetLatency(method string, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.latency[method] = d
+}
+
+// FailNext makes the next len(errs) calls to method fail with errs, in order
+func (c *Chain) FailNext(method string, errs ...error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures[method] = append(c.failures[method], errs...)
+}
+
+// Calls returns how many times method has been called, including failures
+func (c *Chain) Calls(method string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[method]
+}
+
+// call records the call, applies the scripted latency and returns the next
+// scripted error for method, if any. Like an RPC, it gives up when ctx is
+// done during the latency.
+func (c *Chain) call(ctx context.Context, method string) error {
+	c.mu.Lock()
+	c.calls[method]++
+	latency := c.latency[method]
+	var err error
+	if queued := c.failures[method]; len(queued) > 0 {
+		err, c.failures[method] = queued[0], queued[1:]
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-time.After(latency):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// callContext is the context of a contract binding call
+func callContext(opts *bind.CallOpts) context.Context {
+	if opts == nil || opts.Context == nil {
+		return context.Background()
+	}
+	return opts.Context
+}
+
+func (c *Chain) GetContractAddress() common.Address {
+	return c.contract
+}
+
+// GetBatchBalance mirrors nft.NFTChecker: it ignores tokenIDs and returns the
+// combined balance of tokens 0 to TrackedTokens-1
+func (c *Chain) GetBatchBalance(ctx context.Context, address string, _ []*big.Int) ([]*big.Int, error) {
+	if err := c.call(ctx, MethodGetBatchBalance); err != nil {
+		return nil, fmt.Errorf("contract call failed: %w", err)
+	}
+
+	total := new(big.Int)
+	for tokenID := int64(0); tokenID < TrackedTokens; tokenID++ {
+		total.Add(total, c.balance(common.HexToAddress(address), big.NewInt(tokenID)))
+	}
+	return []*big.Int{total}, nil
+}
+
+func (c *Chain) balance(owner common.Address, tokenID *big.Int) *big.Int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !tokenID.IsInt64() {
+		return new(big.Int)
+	}
+	return big.NewInt(c.balances[owner][tokenID.Int64()])
+}
+
+func (c *Chain) GetIncomingDelegations(opts *bind.CallOpts, to common.Address) ([]delegation.IDelegateRegistryDelegation, error) {
+	if err := c.call(callContext(opts), MethodGetIncomingDelegations); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var incoming []delegation.IDelegateRegistryDelegation
+	for _, d := range c.delegations {
+		if d.To == to {
+			incoming = append(incoming, d)
+		}
+	}
+	return incoming, nil
+}
+
+// CheckDelegateForERC1155 follows the registry: wallet and contract wide
+// delegations grant the maximum amount, token delegations their own amount.
+// Delegations with empty rights match any requested rights.
+func (c *Chain) CheckDelegateForERC1155(opts *bind.CallOpts, to common.Address, from common.Address, contract common.Address, tokenID *big.Int, rights [32]byte) (*big.Int, error) {
+	if err := c.call(callContext(opts), MethodCheckDelegateForERC1155); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	maxAmount := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(1))
+	amount := new(big.Int)
+	for _, d := range c.delegations {
+		if d.To != to || d.From != from {
+			continue
+		}
+		if d.Rights != ([32]byte{}) && d.Rights != rights {
+			continue
+		}
+
+		switch d.Type {
+		case blockchain.DelegationTypeAll:
+			return maxAmount, nil
+		case blockchain.DelegationTypeContract:
+			if d.Contract == contract {
+				return maxAmount, nil
+			}
+		case blockchain.DelegationTypeERC1155:
+			if d.Contract == contract && d.TokenId.Cmp(tokenID) == 0 {
+				amount.Add(amount, d.Amount)
+			}
+		}
+	}
+	return amount, nil
+}
+
+func (c *Chain) BlockNumber(ctx context.Context) (uint64, error) {
+	if err := c.call(ctx, MethodBlockNumber); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.blockNumber, nil
+}
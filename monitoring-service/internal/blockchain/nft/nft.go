@@ -3,6 +3,7 @@ package nft
 import (
 	"context"
 	"fmt"
+	"log/slog"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum"
@@ -11,7 +12,7 @@ import (
 )
 
 type NFTChecker struct {
-	client       *ethclient.Client
+	client       ethereum.ContractCaller
 	contractAddr common.Address
 }
 
@@ -21,13 +22,19 @@ func NewNFTChecker(rpcURL, contractAddress string) (*NFTChecker, error) {
 		return nil, fmt.Errorf("failed to connect to Ethereum client: %v", err)
 	}
 
+	return NewNFTCheckerWithCaller(client, contractAddress), nil
+}
+
+// NewNFTCheckerWithCaller creates a checker that calls the contract through
+// caller, e.g. a simulated or fake backend
+func NewNFTCheckerWithCaller(caller ethereum.ContractCaller, contractAddress string) *NFTChecker {
 	return &NFTChecker{
-		client:       client,
+		client:       caller,
 		contractAddr: common.HexToAddress(contractAddress),
-	}, nil
+	}
 }
 
-func (n *NFTChecker) HasNFT(address string, tokenID *big.Int) (bool, error) {
+func (n *NFTChecker) HasNFT(ctx context.Context, address string, tokenID *big.Int) (bool, error) {
 	// ERC1155 balanceOf function signature
 	balanceOfSig := "0x00fdd58e" // balanceOf(address,uint256)
 
@@ -39,13 +46,13 @@ func (n *NFTChecker) HasNFT(address string, tokenID *big.Int) (bool, error) {
 
 	data := append(common.FromHex(balanceOfSig), append(paddedAddr, paddedTokenID...)...)
 
-	result, err := n.client.CallContract(context.Background(), ethereum.CallMsg{
+	result, err := n.client.CallContract(ctx, ethereum.CallMsg{
 		To:   &n.contractAddr,
 		Data: data,
 	}, nil)
 
 	if err != nil {
-		return false, fmt.Errorf("contract call failed: %v", err)
+		return false, fmt.Errorf("contract call failed: %w", err)
 	}
 
 	balance := new(big.Int).SetBytes(result)
@@ -56,8 +63,8 @@ func (n *NFTChecker) GetContractAddress() common.Address {
 	return n.contractAddr
 }
 
-func (n *NFTChecker) GetBatchBalance(address string, _ []*big.Int) ([]*big.Int, error) {
-	fmt.Printf("Checking NFT balance for address: %s\n", address)
+func (n *NFTChecker) GetBatchBalance(ctx context.Context, address string, _ []*big.Int) ([]*big.Int, error) {
+	slog.DebugContext(ctx, "Checking NFT balance", "address", address)
 
 	// We always query tokens 0 to 9.
 	numTokens := int64(10)
@@ -74,8 +81,8 @@ func (n *NFTChecker) GetBatchBalance(address string, _ []*big.Int) ([]*big.Int,
 	firstParamSize := new(big.Int).Mul(big.NewInt(32), big.NewInt(1+numTokens))
 	secondOffset := new(big.Int).Add(firstOffset, firstParamSize)
 
-	fmt.Printf("First offset: %s (expected: 40 in hex), second offset: %s (expected: 1a0 in hex)\n",
-		firstOffset.Text(16), secondOffset.Text(16))
+	slog.DebugContext(ctx, "Encoding balanceOfBatch call",
+		"first_offset", firstOffset.Text(16), "second_offset", secondOffset.Text(16))
 
 	data := common.FromHex(methodID)
 	data = append(data, common.LeftPadBytes(firstOffset.Bytes(), 32)...)
@@ -94,29 +101,29 @@ func (n *NFTChecker) GetBatchBalance(address string, _ []*big.Int) ([]*big.Int,
 		data = append(data, common.LeftPadBytes(id.Bytes(), 32)...)
 	}
 
-	result, err := n.client.CallContract(context.Background(), ethereum.CallMsg{
+	slog.DebugContext(ctx, "Calling balanceOfBatch", "calldata", fmt.Sprintf("%x", data))
+	result, err := n.client.CallContract(ctx, ethereum.CallMsg{
 		To:   &n.contractAddr,
 		Data: data,
 	}, nil)
 	if err != nil {
-		fmt.Printf("Contract call error: %v\n", err)
-		return nil, fmt.Errorf("contract call failed: %v", err)
+		return nil, fmt.Errorf("contract call failed: %w", err)
 	}
-	fmt.Printf("Raw result (%d bytes): %x\n", len(result), result)
+	slog.DebugContext(ctx, "balanceOfBatch returned", "bytes", len(result), "result", fmt.Sprintf("%x", result))
 	if len(result) < 64 {
 		return nil, fmt.Errorf("result length is invalid: %d", len(result))
 	}
 
 	offset := new(big.Int).SetBytes(result[:32]).Int64()
-	fmt.Printf("Decoded offset: %d\n", offset)
+	slog.DebugContext(ctx, "Decoded balances offset", "offset", offset)
 	if int64(len(result)) < offset+32 {
 		return nil, fmt.Errorf("result too short for length field")
 	}
 
 	arrayLen := new(big.Int).SetBytes(result[offset : offset+32]).Int64()
-	fmt.Printf("Decoded array length: %d\n", arrayLen)
+	slog.DebugContext(ctx, "Decoded balances length", "length", arrayLen)
 	if arrayLen != numTokens {
-		fmt.Printf("Warning: Expected %d balances, got %d\n", numTokens, arrayLen)
+		slog.WarnContext(ctx, "Unexpected number of balances", "address", address, "expected", numTokens, "got", arrayLen)
 	}
 
 	var totalBalance big.Int
@@ -130,6 +137,6 @@ func (n *NFTChecker) GetBatchBalance(address string, _ []*big.Int) ([]*big.Int,
 		balances = append(balances, bal)
 		totalBalance.Add(&totalBalance, bal)
 	}
-	fmt.Printf("Total combined balance: %s\n", totalBalance.String())
+	slog.DebugContext(ctx, "Total combined balance", "address", address, "balance", totalBalance.String())
 	return []*big.Int{&totalBalance}, nil
 }
@@ -0,0 +1,131 @@
+package blockchain
+
+import (
+	"context"
+	"log/slog"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"monitoring-service/internal/blockchain/delegation"
+)
+
+// RetryPolicy controls how often a failed chain read is retried
+type RetryPolicy struct {
+	// Attempts is the total number of calls made, including the first
+	Attempts int
+	// Backoff is the delay before the first retry; it doubles on each retry
+	Backoff time.Duration
+	// Timeout bounds a read, retries included. 0 leaves it to the caller's
+	// context.
+	Timeout time.Duration
+}
+
+// DefaultRetryPolicy retries transient RPC failures twice
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 200 * time.Millisecond, Timeout: 10 * time.Second}
+
+func (p RetryPolicy) do(ctx context.Context, method string, call func(ctx context.Context) error) error {
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+
+	backoff := p.Backoff
+	var err error
+	for attempt := 0; attempt < p.Attempts || attempt == 0; attempt++ {
+		if attempt > 0 {
+			// Once the caller has gone or the time is up a retry cannot help
+			if ctx.Err() != nil {
+				return err
+			}
+			slog.WarnContext(ctx, "Chain read failed, retrying", "method", method, "attempt", attempt, "error", err)
+			trace.SpanFromContext(ctx).AddEvent("retry", trace.WithAttributes(attribute.Int("attempt", attempt), attribute.String("error", err.Error())))
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return err
+			}
+			backoff *= 2
+		}
+		if err = call(ctx); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// callContext is the context of a contract binding call
+func callContext(opts *bind.CallOpts) context.Context {
+	if opts == nil || opts.Context == nil {
+		return context.Background()
+	}
+	return opts.Context
+}
+
+// withContext returns a copy of opts that calls with ctx
+func withContext(opts *bind.CallOpts, ctx context.Context) *bind.CallOpts {
+	copied := bind.CallOpts{}
+	if opts != nil {
+		copied = *opts
+	}
+	copied.Context = ctx
+	return &copied
+}
+
+type retryingBalanceReader struct {
+	reader BalanceReader
+	policy RetryPolicy
+}
+
+// WithBalanceRetry wraps reader so failed reads are retried according to policy
+func WithBalanceRetry(reader BalanceReader, policy RetryPolicy) BalanceReader {
+	return &retryingBalanceReader{reader: reader, policy: policy}
+}
+
+func (r *retryingBalanceReader) GetBatchBalance(ctx context.Context, address string, tokenIDs []*big.Int) ([]*big.Int, error) {
+	var balances []*big.Int
+	err := r.policy.do(ctx, "GetBatchBalance", func(ctx context.Context) error {
+		var err error
+		balances, err = r.reader.GetBatchBalance(ctx, address, tokenIDs)
+		return err
+	})
+	return balances, err
+}
+
+func (r *retryingBalanceReader) GetContractAddress() common.Address {
+	return r.reader.GetContractAddress()
+}
+
+type retryingDelegationReader struct {
+	reader DelegationReader
+	policy RetryPolicy
+}
+
+// WithDelegationRetry wraps reader so failed reads are retried according to policy
+func WithDelegationRetry(reader DelegationReader, policy RetryPolicy) DelegationReader {
+	return &retryingDelegationReader{reader: reader, policy: policy}
+}
+
+func (r *retryingDelegationReader) GetIncomingDelegations(opts *bind.CallOpts, to common.Address) ([]delegation.IDelegateRegistryDelegation, error) {
+	var delegations []delegation.IDelegateRegistryDelegation
+	err := r.policy.do(callContext(opts), "GetIncomingDelegations", func(ctx context.Context) error {
+		var err error
+		delegations, err = r.reader.GetIncomingDelegations(withContext(opts, ctx), to)
+		return err
+	})
+	return delegations, err
+}
+
+func (r *retryingDelegationReader) CheckDelegateForERC1155(opts *bind.CallOpts, to common.Address, from common.Address, contract common.Address, tokenID *big.Int, rights [32]byte) (*big.Int, error) {
+	var amount *big.Int
+	err := r.policy.do(callContext(opts), "CheckDelegateForERC1155", func(ctx context.Context) error {
+		var err error
+		amount, err = r.reader.CheckDelegateForERC1155(withContext(opts, ctx), to, from, contract, tokenID, rights)
+		return err
+	})
+	return amount, err
+}
@@ -0,0 +1,75 @@
+package blockchain
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"monitoring-service/internal/blockchain/delegation"
+	"monitoring-service/internal/tracing"
+)
+
+// tracedCall starts the span of a contract call. The returned call options
+// carry the span's context, so retries made inside it are recorded on it.
+func tracedCall(opts *bind.CallOpts, method string, contract common.Address, attrs ...attribute.KeyValue) (*bind.CallOpts, trace.Span) {
+	ctx, span := tracing.Start(callContext(opts), "contract."+method,
+		append(attrs, attribute.String("contract.method", method), attribute.String("contract.address", contract.Hex()))...)
+	traced := withContext(opts, ctx)
+	if traced.BlockNumber != nil {
+		span.SetAttributes(tracing.BlockNumberKey.Int64(traced.BlockNumber.Int64()))
+	}
+	return traced, span
+}
+
+type tracingBalanceReader struct {
+	reader BalanceReader
+}
+
+// WithBalanceTracing wraps reader so every read is recorded as a span
+func WithBalanceTracing(reader BalanceReader) BalanceReader {
+	return &tracingBalanceReader{reader: reader}
+}
+
+func (r *tracingBalanceReader) GetBatchBalance(ctx context.Context, address string, tokenIDs []*big.Int) ([]*big.Int, error) {
+	opts, span := tracedCall(&bind.CallOpts{Context: ctx}, "GetBatchBalance", r.reader.GetContractAddress(),
+		tracing.AddressKey.String(address), attribute.Int("token.count", len(tokenIDs)))
+	balances, err := r.reader.GetBatchBalance(opts.Context, address, tokenIDs)
+	tracing.End(span, err)
+	return balances, err
+}
+
+func (r *tracingBalanceReader) GetContractAddress() common.Address {
+	return r.reader.GetContractAddress()
+}
+
+type tracingDelegationReader struct {
+	reader   DelegationReader
+	contract common.Address
+}
+
+// WithDelegationTracing wraps reader, a binding of the delegation contract
+// at contract, so every read is recorded as a span
+func WithDelegationTracing(reader DelegationReader, contract common.Address) DelegationReader {
+	return &tracingDelegationReader{reader: reader, contract: contract}
+}
+
+func (r *tracingDelegationReader) GetIncomingDelegations(opts *bind.CallOpts, to common.Address) ([]delegation.IDelegateRegistryDelegation, error) {
+	opts, span := tracedCall(opts, "GetIncomingDelegations", r.contract, tracing.AddressKey.String(to.Hex()))
+	delegations, err := r.reader.GetIncomingDelegations(opts, to)
+	if err == nil {
+		span.SetAttributes(tracing.DelegationCountKey.Int(len(delegations)))
+	}
+	tracing.End(span, err)
+	return delegations, err
+}
+
+func (r *tracingDelegationReader) CheckDelegateForERC1155(opts *bind.CallOpts, to common.Address, from common.Address, contract common.Address, tokenID *big.Int, rights [32]byte) (*big.Int, error) {
+	opts, span := tracedCall(opts, "CheckDelegateForERC1155", r.contract,
+		tracing.AddressKey.String(to.Hex()), attribute.String("delegator.address", from.Hex()), attribute.String("token.id", tokenID.String()))
+	amount, err := r.reader.CheckDelegateForERC1155(opts, to, from, contract, tokenID, rights)
+	tracing.End(span, err)
+	return amount, err
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OperatorActivity summarises a client's heartbeat history over a window
+type OperatorActivity struct {
+	Address           string `bson:"_id"`
+	Heartbeats        int64  `bson:"heartbeats"`
+	Incidents         int64  `bson:"incidents"`
+	CommissionChanges int64  `bson:"commission_changes"`
+}
+
+// GetOperatorActivity counts, per client since the given time, the heartbeat
+// gaps long enough to take it Offline and the number of commission changes.
+// A client that is Offline right now counts one more, ongoing incident.
+func (d *Database) GetOperatorActivity(ctx context.Context, since time.Time) (map[string]OperatorActivity, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	gapMillis := int64(OfflineAfter / time.Millisecond)
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: since}}},
+		}}},
+
+		bson.D{{Key: "$setWindowFields", Value: bson.D{
+			{Key: "partitionBy", Value: "$client_address"},
+			{Key: "sortBy", Value: bson.D{{Key: "timestamp", Value: 1}}},
+			{Key: "output", Value: bson.D{
+				{Key: "previous_timestamp", Value: bson.D{{Key: "$shift", Value: bson.D{
+					{Key: "output", Value: "$timestamp"},
+					{Key: "by", Value: -1},
+				}}}},
+				{Key: "previous_commission_rate", Value: bson.D{{Key: "$shift", Value: bson.D{
+					{Key: "output", Value: "$commission_rate"},
+					{Key: "by", Value: -1},
+				}}}},
+			}},
+		}}},
+
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$client_address"},
+			{Key: "heartbeats", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "incidents", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$and", Value: bson.A{
+					bson.D{{Key: "$ne", Value: bson.A{"$previous_timestamp", nil}}},
+					bson.D{{Key: "$gt", Value: bson.A{
+						bson.D{{Key: "$subtract", Value: bson.A{"$timestamp", "$previous_timestamp"}}},
+						gapMillis,
+					}}},
+				}}},
+				1, 0,
+			}}}}}},
+			// Heartbeats written before commission rates were recorded have no
+			// commission_rate and must not count as a change
+			{Key: "commission_changes", Value: bson.D{{Key: "$sum", Value: bson.D{{Key: "$cond", Value: bson.A{
+				bson.D{{Key: "$and", Value: bson.A{
+					bson.D{{Key: "$ne", Value: bson.A{bson.D{{Key: "$type", Value: "$commission_rate"}}, "missing"}}},
+					bson.D{{Key: "$ne", Value: bson.A{bson.D{{Key: "$type", Value: "$previous_commission_rate"}}, "missing"}}},
+					bson.D{{Key: "$ne", Value: bson.A{"$previous_commission_rate", nil}}},
+					bson.D{{Key: "$ne", Value: bson.A{"$commission_rate", "$previous_commission_rate"}}},
+				}}},
+				1, 0,
+			}}}}}},
+		}}},
+	}
+
+	opts := options.Aggregate().SetAllowDiskUse(true)
+	cursor, err := d.heartbeats.Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	activity := make(map[string]OperatorActivity)
+	for cursor.Next(ctx) {
+		var record OperatorActivity
+		if err := cursor.Decode(&record); err != nil {
+			return nil, err
+		}
+		activity[record.Address] = record
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	lastHeartbeats, err := d.GetLastHeartbeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for address, lastHeartbeat := range lastHeartbeats {
+		if now.Sub(lastHeartbeat) > OfflineAfter {
+			record := activity[address]
+			record.Address = address
+			record.Incidents++
+			activity[address] = record
+		}
+	}
+
+	return activity, nil
+}
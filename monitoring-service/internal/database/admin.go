@@ -0,0 +1,237 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BlacklistEntry bars an address from registering or sending heartbeats
+type BlacklistEntry struct {
+	Address   string    `bson:"address" json:"address"`
+	Reason    string    `bson:"reason" json:"reason"`
+	CreatedBy string    `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+}
+
+// StatusOverride replaces a client's derived status until it expires or is
+// cleared, e.g. to keep a client Active through an outage on our side
+type StatusOverride struct {
+	Status string    `bson:"status" json:"status"`
+	Reason string    `bson:"reason" json:"reason"`
+	SetBy  string    `bson:"set_by" json:"set_by"`
+	SetAt  time.Time `bson:"set_at" json:"set_at"`
+	// ExpiresAt is nil for overrides that stay until cleared
+	ExpiresAt *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// ActiveAt reports whether the override applies at the given time
+func (o *StatusOverride) ActiveAt(now time.Time) bool {
+	return o != nil && (o.ExpiresAt == nil || now.Before(*o.ExpiresAt))
+}
+
+// Incident is an operator-facing note about a client, such as an outage
+// and its cause
+type Incident struct {
+	ID            string    `bson:"_id" json:"id"`
+	ClientAddress string    `bson:"client_address" json:"client_address"`
+	Severity      string    `bson:"severity" json:"severity"`
+	Summary       string    `bson:"summary" json:"summary"`
+	StartedAt     time.Time `bson:"started_at" json:"started_at"`
+	// EndedAt is nil while the incident is ongoing
+	EndedAt   *time.Time `bson:"ended_at,omitempty" json:"ended_at,omitempty"`
+	CreatedBy string     `bson:"created_by" json:"created_by"`
+	CreatedAt time.Time  `bson:"created_at" json:"created_at"`
+}
+
+// AuditRetention is how long audit log entries are kept
+const AuditRetention = 365 * 24 * time.Hour
+
+// AuditEntry records one mutating admin call
+type AuditEntry struct {
+	Timestamp  time.Time `bson:"timestamp" json:"timestamp"`
+	Actor      string    `bson:"actor" json:"actor"`
+	Role       string    `bson:"role" json:"role"`
+	AuthMethod string    `bson:"auth_method" json:"auth_method"`
+	Action     string    `bson:"action" json:"action"`
+	Method     string    `bson:"method" json:"method"`
+	Path       string    `bson:"path" json:"path"`
+	// Target is the address the call acted on, when it names one
+	Target     string `bson:"target,omitempty" json:"target,omitempty"`
+	Request    string `bson:"request,omitempty" json:"request,omitempty"`
+	StatusCode int    `bson:"status_code" json:"status_code"`
+	RemoteAddr string `bson:"remote_addr" json:"remote_addr"`
+}
+
+// EffectiveStatus is the status derived from the last heartbeat, Degraded
+// when that heartbeat showed the light client behind the chain, unless an
+// active override replaces it
+func EffectiveStatus(lastHeartbeat time.Time, liveness *Liveness, override *StatusOverride, now time.Time) string {
+	if override.ActiveAt(now) {
+		return override.Status
+	}
+	status := ClientStatus(lastHeartbeat, now)
+	if status == StatusActive && liveness != nil && liveness.Degraded {
+		return StatusDegraded
+	}
+	return status
+}
+
+func (d *Database) AddToBlacklist(ctx context.Context, entry BlacklistEntry) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	entry.Address = strings.ToLower(entry.Address)
+	_, err := d.blacklist.UpdateOne(ctx,
+		bson.M{"address": entry.Address},
+		bson.M{"$set": entry},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (d *Database) RemoveFromBlacklist(ctx context.Context, address string) (bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	result, err := d.blacklist.DeleteOne(ctx, bson.M{"address": strings.ToLower(address)})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
+
+func (d *Database) IsBlacklisted(ctx context.Context, address string) (bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	count, err := d.blacklist.CountDocuments(ctx, bson.M{"address": strings.ToLower(address)})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (d *Database) GetBlacklist(ctx context.Context) ([]BlacklistEntry, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	cursor, err := d.blacklist.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []BlacklistEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (d *Database) SetStatusOverride(ctx context.Context, address string, override *StatusOverride) (bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$unset": bson.M{"status_override": ""}}
+	if override != nil {
+		update = bson.M{"$set": bson.M{"status_override": override}}
+	}
+
+	result, err := d.clients.UpdateOne(ctx, bson.M{"address": strings.ToLower(address)}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (d *Database) GetStatusOverrides(ctx context.Context) (map[string]StatusOverride, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"address": 1, "status_override": 1})
+	cursor, err := d.clients.Find(ctx, bson.M{"status_override": bson.M{"$exists": true}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	overrides := make(map[string]StatusOverride)
+	for cursor.Next(ctx) {
+		var client ClientInfo
+		if err := cursor.Decode(&client); err != nil {
+			return nil, err
+		}
+		if client.StatusOverride != nil {
+			overrides[client.Address] = *client.StatusOverride
+		}
+	}
+	return overrides, cursor.Err()
+}
+
+func (d *Database) AddIncident(ctx context.Context, incident Incident) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	incident.ClientAddress = strings.ToLower(incident.ClientAddress)
+	_, err := d.incidents.InsertOne(ctx, incident)
+	return err
+}
+
+func (d *Database) GetIncidents(ctx context.Context, address string, tr TimeRange) ([]Incident, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	filter := bson.M{}
+	if address != "" {
+		filter["client_address"] = strings.ToLower(address)
+	}
+	if bounds := tr.filter(); len(bounds) > 0 {
+		filter["started_at"] = bounds
+	}
+
+	cursor, err := d.incidents.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "started_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	incidents := []Incident{}
+	if err := cursor.All(ctx, &incidents); err != nil {
+		return nil, err
+	}
+	return incidents, nil
+}
+
+func (d *Database) AddAuditEntry(ctx context.Context, entry AuditEntry) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.auditLog.InsertOne(ctx, entry)
+	return err
+}
+
+func (d *Database) GetAuditLog(ctx context.Context, limit int) ([]AuditEntry, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}})
+	if limit > 0 {
+		opts.SetLimit(int64(limit))
+	}
+
+	cursor, err := d.auditLog.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	entries := []AuditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+const (
+	// ClaimRetention is how long a heartbeat's response is kept for retries
+	// sent with its idempotency key
+	ClaimRetention = 24 * time.Hour
+	// PendingClaimTimeout is how long a claim may go unanswered before a
+	// retry takes it over, e.g. after the instance handling it crashed
+	PendingClaimTimeout = time.Minute
+)
+
+// HeartbeatClaim reserves an idempotency key for one heartbeat of a client.
+// Once the heartbeat is answered the claim holds the response, which is
+// replayed to every retry with the same key.
+type HeartbeatClaim struct {
+	Address   string    `bson:"address"`
+	Key       string    `bson:"key"`
+	ClaimedAt time.Time `bson:"claimed_at"`
+	Completed bool      `bson:"completed"`
+	// StatusCode and Body are the response, set when Completed
+	StatusCode int    `bson:"status_code,omitempty"`
+	Body       []byte `bson:"body,omitempty"`
+}
+
+// Pending reports whether the claim's heartbeat is still being processed
+func (c HeartbeatClaim) Pending(now time.Time) bool {
+	return !c.Completed && now.Sub(c.ClaimedAt) < PendingClaimTimeout
+}
+
+// ClaimHeartbeat reserves key for a heartbeat of address. It returns nil when
+// the key is newly claimed, or the earlier claim of the key, which is
+// Pending while the first heartbeat is processed. An abandoned pending claim
+// is taken over.
+func (d *Database) ClaimHeartbeat(ctx context.Context, address, key string, now time.Time) (*HeartbeatClaim, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	claim := HeartbeatClaim{Address: strings.ToLower(address), Key: key, ClaimedAt: now}
+	_, err := d.heartbeatClaims.InsertOne(ctx, claim)
+	if err == nil {
+		return nil, nil
+	}
+	if !mongo.IsDuplicateKeyError(err) {
+		return nil, err
+	}
+
+	var existing HeartbeatClaim
+	filter := bson.M{"address": claim.Address, "key": key}
+	if err := d.heartbeatClaims.FindOne(ctx, filter).Decode(&existing); err != nil {
+		return nil, err
+	}
+	if existing.Completed || existing.Pending(now) {
+		return &existing, nil
+	}
+
+	// Only one retry wins the takeover; the others see it pending
+	filter["completed"] = false
+	filter["claimed_at"] = existing.ClaimedAt
+	result, err := d.heartbeatClaims.UpdateOne(ctx, filter, bson.M{"$set": bson.M{"claimed_at": now}})
+	if err != nil {
+		return nil, err
+	}
+	if result.ModifiedCount == 1 {
+		return nil, nil
+	}
+	existing.ClaimedAt = now
+	return &existing, nil
+}
+
+// CompleteHeartbeat stores the response to a claimed heartbeat
+func (d *Database) CompleteHeartbeat(ctx context.Context, address, key string, statusCode int, body []byte) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.heartbeatClaims.UpdateOne(ctx,
+		bson.M{"address": strings.ToLower(address), "key": key},
+		bson.M{"$set": bson.M{"completed": true, "status_code": statusCode, "body": body}},
+	)
+	return err
+}
+
+// ReleaseHeartbeat drops a claim so the heartbeat can be sent again, after a
+// failure the client should retry
+func (d *Database) ReleaseHeartbeat(ctx context.Context, address, key string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.heartbeatClaims.DeleteOne(ctx, bson.M{
+		"address":   strings.ToLower(address),
+		"key":       key,
+		"completed": false,
+	})
+	return err
+}
@@ -3,13 +3,16 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"monitoring-service/internal/database/migrations"
 	"monitoring-service/internal/uptime"
 )
 
@@ -21,14 +24,51 @@ const (
 	HasDelegation                        // 2
 )
 
+const (
+	StatusActive   = "Active"
+	StatusInactive = "Inactive"
+	StatusOffline  = "Offline"
+	// StatusDegraded clients heartbeat on time but their light client has
+	// fallen too far behind the Avail chain
+	StatusDegraded = "Degraded"
+)
+
+const (
+	// A client is Inactive once its last heartbeat is older than InactiveAfter,
+	// and Offline once it is older than OfflineAfter
+	InactiveAfter = 5 * time.Minute
+	OfflineAfter  = 10 * time.Minute
+)
+
 type Database struct {
-	client          *mongo.Client
-	clients         *mongo.Collection
-	heartbeats      *mongo.Collection
-	delegations     *mongo.Collection
-	logger          *log.Logger
+	client      *mongo.Client
+	db          *mongo.Database
+	clients     *mongo.Collection
+	heartbeats  *mongo.Collection
+	delegations *mongo.Collection
+	rewards     *mongo.Collection
+	logger      *slog.Logger
+
+	heartbeatCoverage *mongo.Collection
+	retentionState    *mongo.Collection
+	blacklist         *mongo.Collection
+	incidents         *mongo.Collection
+	auditLog          *mongo.Collection
+	clientSources     *mongo.Collection
+	rateLimits        *mongo.Collection
+	probes            *mongo.Collection
+	versionHistory    *mongo.Collection
+	heartbeatClaims   *mongo.Collection
+
+	// uptimePolicy holds the uptime.Policy set with SetUptimePolicy
+	uptimePolicy atomic.Value
+	// timeout is the time.Duration set with SetTimeout
+	timeout atomic.Int64
 }
 
+// DefaultTimeout bounds each database operation until SetTimeout changes it
+const DefaultTimeout = 5 * time.Second
+
 type OperationPointRecord struct {
 	Amount         int64     `bson:"amount"`
 	Timestamp     time.Time  `bson:"timestamp"`
@@ -56,6 +96,20 @@ type ClientInfo struct {
 	WeeklyUptimePercentage  float64   `bson:"weekly_uptime_percentage"`
 	OperatorName           string    `bson:"operator_name"`
 	RewardCollectorAddress  string    `bson:"reward_collector_address"`
+	// StatusOverride is set by operator support to replace the derived status
+	StatusOverride *StatusOverride `bson:"status_override,omitempty"`
+	// Liveness is the light client's sync state from the last heartbeat that
+	// reported one
+	Liveness *Liveness `bson:"liveness,omitempty"`
+	// ProbeURL is the light client's public HTTP API, probed when set
+	ProbeURL string `bson:"probe_url,omitempty"`
+	// Version is the light client build the last heartbeat reported
+	Version *ClientVersion `bson:"version,omitempty"`
+	// LastSequence and LastSentAt are the highest sequence number and
+	// client timestamp heartbeats have carried; later heartbeats must exceed
+	// them
+	LastSequence int64     `bson:"last_sequence,omitempty"`
+	LastSentAt   time.Time `bson:"last_sent_at,omitempty"`
 }
 
 type HeartbeatRecord struct {
@@ -63,6 +117,7 @@ type HeartbeatRecord struct {
 	Timestamp      time.Time `bson:"timestamp"`
 	Duration       int64     `bson:"duration"`
 	Amount         int64     `bson:"amount"`
+	CommissionRate float64   `bson:"commission_rate"`
 }
 
 type DelegationRecord struct {
@@ -73,11 +128,13 @@ type DelegationRecord struct {
 	Timestamp      time.Time `bson:"timestamp"`
 }
 
-func NewDatabase(mongoURI, dbName string, logger *log.Logger) (*Database, error) {
+func NewDatabase(mongoURI, dbName string, logger *slog.Logger) (*Database, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI))
+	// Every command is traced as a span of the operation that ran it
+	tracer := &commandTracer{}
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(mongoURI).SetMonitor(tracer.monitor()))
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to MongoDB: %v", err)
 	}
@@ -88,58 +145,67 @@ func NewDatabase(mongoURI, dbName string, logger *log.Logger) (*Database, error)
 	}
 
 	db := client.Database(dbName)
-	
-	// Check if heartbeats collection exists before creating it
-	collections, err := db.ListCollectionNames(ctx, bson.M{"name": "heartbeats"})
-	if err != nil {
-		return nil, fmt.Errorf("failed to list collections: %v", err)
-	}
-	
-	// Only create collection if it doesn't exist
-	if len(collections) == 0 {
-		err = db.CreateCollection(ctx, "heartbeats", options.CreateCollection().SetTimeSeriesOptions(
-			options.TimeSeries().
-				SetTimeField("timestamp").
-				SetMetaField("client_address").
-				SetGranularity("minutes"),
-		))
-		if err != nil {
-			return nil, fmt.Errorf("failed to create heartbeats collection: %v", err)
-		}
-		logger.Println("Created time series collection: heartbeats")
-	} else {
-		logger.Println("Heartbeats collection already exists, skipping creation")
-	}
-
-	// Get collection using the provided database name
-	collection := db.Collection("clients")
-
-	// Create unique index on address if it doesn't exist
-	_, err = collection.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys:    bson.D{{Key: "address", Value: 1}},
-		Options: options.Index().SetUnique(true),
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create index: %v", err)
-	}
 
 	return &Database{
 		client:      client,
-		clients:     collection,
+		db:          db,
+		clients:     db.Collection("clients"),
 		heartbeats:  db.Collection("heartbeats"),
 		delegations: db.Collection("delegations"),
+		rewards:     db.Collection("rewards"),
 		logger:      logger,
+
+		heartbeatCoverage: db.Collection("heartbeat_coverage"),
+		retentionState:    db.Collection("retention_state"),
+		blacklist:         db.Collection("blacklist"),
+		incidents:         db.Collection("incidents"),
+		auditLog:          db.Collection("audit_log"),
+		clientSources:     db.Collection("client_sources"),
+		rateLimits:        db.Collection("rate_limits"),
+		probes:            db.Collection("probes"),
+		versionHistory:    db.Collection("version_history"),
+		heartbeatClaims:   db.Collection("heartbeat_claims"),
 	}, nil
 }
 
+// SetTimeout sets how long each database operation may take. Streams run
+// for as long as their context allows.
+func (d *Database) SetTimeout(timeout time.Duration) {
+	d.timeout.Store(int64(timeout))
+}
+
+// withTimeout bounds an operation by the database timeout, within the
+// deadline and cancellation of the caller's context
+func (d *Database) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(d.timeout.Load())
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// Migrations returns a migrator for the service's schema. Collections and
+// indexes are created by migrations, not by NewDatabase.
+func (d *Database) Migrations() *migrations.Migrator {
+	return migrations.New(d.db, migrations.All, d.logger)
+}
+
+// Ping checks that the primary, which takes every write, is reachable
+func (d *Database) Ping(ctx context.Context) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+	return d.client.Ping(ctx, readpref.Primary())
+}
+
 func (d *Database) Close() error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	return d.client.Disconnect(ctx)
 }
 
-func (d *Database) RegisterClient(address string, operationPoints OperationPointRecord, totalTime int64, operatorName string, rewardCollectorAddress string) error {
-	ctx := context.Background()
+func (d *Database) RegisterClient(ctx context.Context, address string, operationPoints OperationPointRecord, totalTime int64, operatorName string, rewardCollectorAddress string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	now := time.Now()
 
 	
@@ -169,8 +235,9 @@ func (d *Database) RegisterClient(address string, operationPoints OperationPoint
 			Timestamp:     now,
 			Duration:      operationPoints.Time,
 			Amount:        operationPoints.Amount,
+			CommissionRate: operationPoints.CommissionRate,
 		}
-		if _, err := d.heartbeats.InsertOne(ctx, heartbeat); err != nil {
+		if err := d.AddHeartbeat(ctx, heartbeat); err != nil {
 			return err
 		}
 	}
@@ -184,8 +251,9 @@ func (d *Database) RegisterClient(address string, operationPoints OperationPoint
 	return err
 }
 
-func (d *Database) RegisterDelegation(address string, delegationPoints DelegationPointRecord) error {
-	ctx := context.Background()
+func (d *Database) RegisterDelegation(ctx context.Context, address string, delegationPoints DelegationPointRecord) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	now := time.Now()
 	
 	
@@ -216,8 +284,8 @@ func (d *Database) RegisterDelegation(address string, delegationPoints Delegatio
 	return err
 }
 
-func (d *Database) ClientExists(address string) (bool, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (d *Database) ClientExists(ctx context.Context, address string) (bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
 	defer cancel()
 	
 	
@@ -230,8 +298,9 @@ func (d *Database) ClientExists(address string) (bool, error) {
 	return count > 0, nil
 }
 
-func (d *Database) GetClient(address string) (*ClientInfo, error) {
-	ctx := context.Background()
+func (d *Database) GetClient(ctx context.Context, address string) (*ClientInfo, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	var client ClientInfo
 	
 	
@@ -248,119 +317,128 @@ func (d *Database) GetClient(address string) (*ClientInfo, error) {
 	return &client, nil
 }
 
-func (d *Database) GetAllClients() ([]ClientInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+func (d *Database) GetAllClients(ctx context.Context) ([]ClientInfo, error) {
+	ctx, cancel := d.withTimeout(ctx)
 	defer cancel()
 
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
 	cursor, err := d.clients.Find(ctx, bson.M{}, opts)
 	if err != nil {
-		d.logger.Printf("Error querying clients: %v", err)
+		d.logger.ErrorContext(ctx, "Failed to query clients", "error", err)
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
 	var clients []ClientInfo
 	if err = cursor.All(ctx, &clients); err != nil {
-		d.logger.Printf("Error decoding clients: %v", err)
+		d.logger.ErrorContext(ctx, "Failed to decode clients", "error", err)
 		return nil, err
 	}
 
 	// Create uptime calculator
-	uptimeCalc := uptime.NewCalculator(d.heartbeats)
+	uptimeCalc := uptime.NewCalculator(d, d.currentUptimePolicy())
 
 	// Calculate uptime percentages and status for each client
-	for i, client := range clients {
-		// Calculate uptime percentages (all-time and weekly)
-		allUptimePercentage, weeklyUptimePercentage, err := uptimeCalc.GetUptimePercentages(
-			ctx, 
-			client.Address,
-			client.CreatedAt,
-		)
-		
-		if err != nil {
-			d.logger.Printf("Error calculating uptime for client %s: %v", client.Address, err)
+	for i := range clients {
+		if err := PopulateUptime(ctx, uptimeCalc, &clients[i], time.Now()); err != nil {
+			d.logger.ErrorContext(ctx, "Failed to calculate uptime", "client", clients[i].Address, "error", err)
 			// Continue with next client instead of failing entirely
 			continue
 		}
-		
-		// Update client with calculated percentages
-		clients[i].AllUptimePercentage = allUptimePercentage
-		clients[i].WeeklyUptimePercentage = weeklyUptimePercentage
-
-		// Set status based on last heartbeat
-		if time.Since(client.LastHeartbeat) > 10 * time.Minute {
-			clients[i].Status = "Offline"
-		} else if time.Since(client.LastHeartbeat) > 5 * time.Minute {
-			clients[i].Status = "Inactive"
-		} else {
-			clients[i].Status = "Active"
-		}
 	}
 
 	return clients, nil
 }
 
-func (d *Database) setupIndexes(ctx context.Context) error {
-	_, err := d.heartbeats.Indexes().CreateOne(ctx, mongo.IndexModel{
-		Keys: bson.D{{Key: "timestamp", Value: 1}},
-		Options: options.Index().SetExpireAfterSeconds(60 * 60 * 24 * 30),
-	})
-	return err
+// ClientStatus derives a client's liveness status from its last heartbeat
+func ClientStatus(lastHeartbeat time.Time, now time.Time) string {
+	if now.Sub(lastHeartbeat) > OfflineAfter {
+		return StatusOffline
+	} else if now.Sub(lastHeartbeat) > InactiveAfter {
+		return StatusInactive
+	}
+	return StatusActive
 }
 
-func (d *Database) GetClientWithHistory(address string) (*ClientInfo, []HeartbeatRecord, []DelegationRecord, error) {
-	ctx := context.Background()
+// GetLastHeartbeats returns the last heartbeat time of every client, keyed by address
+func (d *Database) GetLastHeartbeats(ctx context.Context) (map[string]time.Time, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"address": 1, "last_heartbeat": 1})
+	cursor, err := d.clients.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	lastHeartbeats := make(map[string]time.Time)
+	for cursor.Next(ctx) {
+		var client ClientInfo
+		if err := cursor.Decode(&client); err != nil {
+			return nil, err
+		}
+		lastHeartbeats[client.Address] = client.LastHeartbeat
+	}
+	return lastHeartbeats, cursor.Err()
+}
+
+func (d *Database) GetFromDelegationsByAddress(ctx context.Context, address string) ([]DelegationRecord, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	
 	
 	address = strings.ToLower(address)
-	
-	// Get client info
-	client, err := d.GetClient(address)
-	if err != nil {
-		return nil, nil, nil, err
-	}
 
-	// Get recent heartbeats (last 24h)
-	cutoff := time.Now().Add(-24 * time.Hour)
-	heartbeatCursor, err := d.heartbeats.Find(ctx, bson.M{
-		"client_address": address,
-		"timestamp": bson.M{"$gte": cutoff},
+	cursor, err := d.delegations.Find(ctx, bson.M{
+		"from_address": address,
 	})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
-	var heartbeats []HeartbeatRecord
-	if err = heartbeatCursor.All(ctx, &heartbeats); err != nil {
-		return nil, nil, nil, err
+	defer cursor.Close(ctx)
+
+	var delegations []DelegationRecord
+	if err = cursor.All(ctx, &delegations); err != nil {
+		return nil, err
 	}
 
-	// Get delegations
-	delegationCursor, err := d.delegations.Find(ctx, bson.M{
-		"$or": []bson.M{
-			{"from_address": address},
-			{"to_address": address},
-		},
+	return delegations, nil
+}
+
+func (d *Database) GetToDelegationsByAddress(ctx context.Context, address string) ([]DelegationRecord, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	address = strings.ToLower(address)
+
+	cursor, err := d.delegations.Find(ctx, bson.M{
+		"to_address": address,
 	})
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
+	defer cursor.Close(ctx)
+
 	var delegations []DelegationRecord
-	if err = delegationCursor.All(ctx, &delegations); err != nil {
-		return nil, nil, nil, err
+	if err = cursor.All(ctx, &delegations); err != nil {
+		return nil, err
 	}
 
-	return client, heartbeats, delegations, nil
+	return delegations, nil
 }
 
-func (d *Database) GetFromDelegationsByAddress(address string) ([]DelegationRecord, error) {
-	ctx := context.Background()
-	
-	
+func (d *Database) GetDelegations(ctx context.Context, address string) ([]DelegationRecord, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
 	address = strings.ToLower(address)
 
 	cursor, err := d.delegations.Find(ctx, bson.M{
-		"from_address": address,
+		"$or": []bson.M{
+			{"from_address": address},
+			{"to_address": address},
+		},
 	})
 	if err != nil {
 		return nil, err
@@ -377,8 +455,9 @@ func (d *Database) GetFromDelegationsByAddress(address string) ([]DelegationReco
 
 // ClearDelegationsForAddress removes all delegation records for a specific address
 // that are no longer valid based on the current blockchain state
-func (d *Database) ClearDelegationsForAddress(address string, validFromAddresses []string) error {
-	ctx := context.Background()
+func (d *Database) ClearDelegationsForAddress(ctx context.Context, address string, validFromAddresses []string) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
 	
 	
 	address = strings.ToLower(address)
@@ -407,3 +486,82 @@ func (d *Database) ClearDelegationsForAddress(address string, validFromAddresses
 	
 	return err
 }
+
+// ReplaceDelegations makes the delegations to address exactly the given
+// delegators and amounts, in a single ordered bulk write. A write cut short
+// leaves delegations the next heartbeat replaces again, never uptime.
+func (d *Database) ReplaceDelegations(ctx context.Context, address string, delegators map[string]int64, commissionRate float64) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	address = strings.ToLower(address)
+	valid := make([]string, 0, len(delegators))
+	for from := range delegators {
+		valid = append(valid, strings.ToLower(from))
+	}
+
+	// Stale delegations go first, then each delegator is upserted
+	writes := []mongo.WriteModel{mongo.NewDeleteManyModel().SetFilter(bson.M{
+		"to_address":   address,
+		"from_address": bson.M{"$nin": valid},
+	})}
+	for from, amount := range delegators {
+		from = strings.ToLower(from)
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"from_address": from, "to_address": address}).
+			SetUpdate(bson.M{"$set": DelegationRecord{
+				FromAddress:    from,
+				ToAddress:      address,
+				Amount:         amount,
+				CommissionRate: commissionRate,
+				Timestamp:      now,
+			}}).
+			SetUpsert(true))
+	}
+
+	_, err := d.delegations.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(true))
+	return err
+}
+
+func (d *Database) UpsertClient(ctx context.Context, client ClientInfo) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	address := strings.ToLower(client.Address)
+	_, err := d.clients.UpdateOne(ctx,
+		bson.M{"address": address},
+		bson.M{"$set": bson.M{
+			"address":                  address,
+			"total_time":               client.TotalTime,
+			"last_heartbeat":           client.LastHeartbeat,
+			"created_at":               client.CreatedAt,
+			"nft_amount":               client.NFTAmount,
+			"commission_rate":          client.CommissionRate,
+			"operator_name":            client.OperatorName,
+			"reward_collector_address": strings.ToLower(client.RewardCollectorAddress),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (d *Database) UpsertDelegation(ctx context.Context, delegation DelegationRecord) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	delegation.FromAddress = strings.ToLower(delegation.FromAddress)
+	delegation.ToAddress = strings.ToLower(delegation.ToAddress)
+	_, err := d.delegations.UpdateOne(ctx,
+		bson.M{"from_address": delegation.FromAddress, "to_address": delegation.ToAddress},
+		bson.M{"$set": delegation},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// IsTimeout reports whether err comes from an operation that ran out of
+// time, including the driver's own server selection and socket timeouts
+func IsTimeout(err error) bool {
+	return mongo.IsTimeout(err)
+}
@@ -0,0 +1,138 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/database/storetest"
+	"monitoring-service/internal/logging"
+)
+
+// TestStore runs the conformance suite against MongoDB at MONGO_TEST_URI.
+// Every subtest gets a migrated database of its own, dropped afterwards.
+func TestStore(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	admin, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to %s: %v", uri, err)
+	}
+	t.Cleanup(func() { admin.Disconnect(ctx) })
+
+	run := time.Now().UnixNano()
+	n := 0
+	storetest.Run(t, func(t *testing.T) database.Store {
+		n++
+		name := fmt.Sprintf("storetest_%d_%d", run, n)
+		t.Cleanup(func() {
+			if err := admin.Database(name).Drop(ctx); err != nil {
+				t.Errorf("drop %s: %v", name, err)
+			}
+		})
+
+		db, err := database.NewDatabase(uri, name, logging.Discard())
+		if err != nil {
+			t.Fatalf("NewDatabase: %v", err)
+		}
+		if _, err := db.Migrations().Up(ctx, 0); err != nil {
+			t.Fatalf("migrate %s: %v", name, err)
+		}
+		return db
+	})
+}
+
+// TestMigrations applies the schema history to an unmigrated database at
+// MONGO_TEST_URI holding addresses written before they were lowercased,
+// then rolls back the last migration and applies it again
+func TestMigrations(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	admin, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to %s: %v", uri, err)
+	}
+	t.Cleanup(func() { admin.Disconnect(ctx) })
+
+	name := fmt.Sprintf("migrations_%d", time.Now().UnixNano())
+	legacy := admin.Database(name)
+	t.Cleanup(func() {
+		if err := legacy.Drop(ctx); err != nil {
+			t.Errorf("drop %s: %v", name, err)
+		}
+	})
+
+	// 0xAB is a legacy duplicate of the 0xab record the service updated
+	_, err = legacy.Collection("clients").InsertMany(ctx, []interface{}{
+		bson.M{"address": "0xAB", "reward_collector_address": "0xCD", "operator_name": "legacy"},
+		bson.M{"address": "0xab", "reward_collector_address": "0xcd", "operator_name": "current"},
+		bson.M{"address": "0xEF", "reward_collector_address": "0xEF", "operator_name": "renamed"},
+	})
+	if err != nil {
+		t.Fatalf("insert legacy clients: %v", err)
+	}
+	_, err = legacy.Collection("delegations").InsertMany(ctx, []interface{}{
+		bson.M{"from_address": "0xAA", "to_address": "0xAB", "amount": 1, "timestamp": time.Now()},
+		bson.M{"from_address": "0xaa", "to_address": "0xab", "amount": 2, "timestamp": time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("insert legacy delegations: %v", err)
+	}
+
+	db, err := database.NewDatabase(uri, name, logging.Discard())
+	if err != nil {
+		t.Fatalf("NewDatabase: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator := db.Migrations()
+
+	applied, err := migrator.Up(ctx, 0)
+	if err != nil || len(applied) != migrator.Latest() {
+		t.Fatalf("Up = %d migrations, %v; want %d", len(applied), err, migrator.Latest())
+	}
+
+	var clients []bson.M
+	cursor, err := legacy.Collection("clients").Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"address": 1}))
+	if err != nil || cursor.All(ctx, &clients) != nil {
+		t.Fatalf("read clients: %v", err)
+	}
+	var got []string
+	for _, client := range clients {
+		got = append(got, fmt.Sprintf("%s %s %s", client["address"], client["reward_collector_address"], client["operator_name"]))
+	}
+	if want := []string{"0xab 0xcd current", "0xef 0xef renamed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("clients after migrating = %v, want %v", got, want)
+	}
+	delegations, err := legacy.Collection("delegations").CountDocuments(ctx, bson.M{"from_address": "0xaa", "to_address": "0xab"})
+	if err != nil || delegations != 1 {
+		t.Errorf("0xaa to 0xab delegations after migrating = %d, %v; want 1", delegations, err)
+	}
+
+	reverted, err := migrator.Down(ctx, 1)
+	if err != nil || len(reverted) != 1 || reverted[0].Version != migrator.Latest() {
+		t.Fatalf("Down 1 = %v, %v; want the latest migration", reverted, err)
+	}
+	applied, err = migrator.Up(ctx, 0)
+	if err != nil || len(applied) != 1 || applied[0].Version != migrator.Latest() {
+		t.Fatalf("Up after Down = %v, %v; want the latest migration", applied, err)
+	}
+	pending, err := migrator.Pending(ctx)
+	if err != nil || len(pending) != 0 {
+		t.Errorf("Pending = %v, %v; want none", pending, err)
+	}
+}
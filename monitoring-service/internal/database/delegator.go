@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"monitoring-service/internal/uptime"
+)
+
+// DelegatorPosition is one operator a holder backs, as seen by the holder
+type DelegatorPosition struct {
+	OperatorAddress        string    `bson:"operator_address" json:"operator_address"`
+	OperatorName           string    `bson:"operator_name" json:"operator_name"`
+	DelegatedAmount        int64     `bson:"delegated_amount" json:"delegated_amount"`
+	CommissionRate         float64   `bson:"commission_rate" json:"commission_rate"`
+	Status                 string    `bson:"-" json:"status"`
+	AllUptimePercentage    float64   `bson:"-" json:"all_uptime_percentage"`
+	WeeklyUptimePercentage float64   `bson:"-" json:"weekly_uptime_percentage"`
+	LastHeartbeat          time.Time `bson:"last_heartbeat" json:"last_heartbeat"`
+	DelegatedAt            time.Time `bson:"delegated_at" json:"delegated_at"`
+	// OperatorRewards are the reward points recorded for the operator, nil
+	// when it has none. Reward records are per operator, so the holder's own
+	// share of them is not known.
+	OperatorRewards *int64 `bson:"operator_rewards" json:"operator_rewards"`
+
+	CreatedAt      time.Time       `bson:"created_at" json:"-"`
+	StatusOverride *StatusOverride `bson:"status_override" json:"-"`
+	Liveness       *Liveness       `bson:"liveness" json:"-"`
+}
+
+// GetDelegatorPositions returns every registered operator the address has
+// delegated to, joined with the operator's client record and reward points in
+// one aggregation. Status is derived afterwards and uptime is counted per
+// operator, as for the client listing.
+func (d *Database) GetDelegatorPositions(ctx context.Context, address string) ([]DelegatorPosition, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	address = strings.ToLower(address)
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{{Key: "from_address", Value: address}}}},
+
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$to_address"},
+			{Key: "delegated_amount", Value: bson.D{{Key: "$sum", Value: "$amount"}}},
+			{Key: "delegated_at", Value: bson.D{{Key: "$max", Value: "$timestamp"}}},
+		}}},
+
+		// Operators without a client record are no longer registered
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: d.clients.Name()},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "address"},
+			{Key: "as", Value: "client"},
+		}}},
+		bson.D{{Key: "$unwind", Value: "$client"}},
+
+		bson.D{{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: d.rewards.Name()},
+			{Key: "let", Value: bson.D{{Key: "operator", Value: "$_id"}}},
+			{Key: "pipeline", Value: mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "$expr", Value: bson.D{{Key: "$eq", Value: bson.A{"$address", "$$operator"}}}},
+				}}},
+				bson.D{{Key: "$group", Value: bson.D{
+					{Key: "_id", Value: nil},
+					{Key: "points", Value: bson.D{{Key: "$sum", Value: "$points"}}},
+				}}},
+			}},
+			{Key: "as", Value: "rewards"},
+		}}},
+
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "_id", Value: 0},
+			{Key: "operator_address", Value: "$_id"},
+			{Key: "operator_name", Value: "$client.operator_name"},
+			{Key: "delegated_amount", Value: 1},
+			{Key: "delegated_at", Value: 1},
+			{Key: "commission_rate", Value: "$client.commission_rate"},
+			{Key: "last_heartbeat", Value: "$client.last_heartbeat"},
+			{Key: "created_at", Value: "$client.created_at"},
+			{Key: "status_override", Value: "$client.status_override"},
+			{Key: "liveness", Value: "$client.liveness"},
+			{Key: "operator_rewards", Value: bson.D{{Key: "$first", Value: "$rewards.points"}}},
+		}}},
+
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "delegated_amount", Value: -1}, {Key: "operator_address", Value: 1}}}},
+	}
+
+	cursor, err := d.delegations.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var positions []DelegatorPosition
+	if err := cursor.All(ctx, &positions); err != nil {
+		return nil, err
+	}
+
+	uptimeCalc := uptime.NewCalculator(d, d.currentUptimePolicy())
+	now := time.Now()
+	for i := range positions {
+		positions[i].Status = EffectiveStatus(positions[i].LastHeartbeat, positions[i].Liveness, positions[i].StatusOverride, now)
+
+		allUptimePercentage, weeklyUptimePercentage, err := uptimeCalc.GetUptimePercentages(ctx, positions[i].OperatorAddress, positions[i].CreatedAt)
+		if err != nil {
+			d.logger.ErrorContext(ctx, "Failed to calculate uptime", "client", positions[i].OperatorAddress, "error", err)
+			continue
+		}
+		positions[i].AllUptimePercentage = allUptimePercentage
+		positions[i].WeeklyUptimePercentage = weeklyUptimePercentage
+	}
+
+	return positions, nil
+}
@@ -0,0 +1,298 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AddHeartbeat inserts a single heartbeat record
+func (d *Database) AddHeartbeat(ctx context.Context, heartbeat HeartbeatRecord) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	heartbeat.ClientAddress = strings.ToLower(heartbeat.ClientAddress)
+	_, err := d.heartbeats.InsertOne(ctx, heartbeat)
+	return err
+}
+
+// ErrHeartbeatOutOfOrder is returned by RecordHeartbeat for a heartbeat whose
+// sequence or timestamp is not after the last one recorded for the client
+var ErrHeartbeatOutOfOrder = errors.New("heartbeat is not newer than the last one recorded")
+
+// ErrHeartbeatIncomplete is returned by RecordHeartbeat when the client
+// record was updated but its heartbeat record or version change was not
+// written. The heartbeat is counted all the same.
+var ErrHeartbeatIncomplete = errors.New("heartbeat recorded without its history")
+
+// ClientHeartbeat is an accepted heartbeat as RecordHeartbeat applies it
+type ClientHeartbeat struct {
+	Amount         int64
+	CommissionRate float64
+	// OperatorName and RewardCollectorAddress keep the stored values when empty
+	OperatorName           string
+	RewardCollectorAddress string
+	// MaxGap is the longest time since the previous heartbeat that still
+	// counts as uptime
+	MaxGap time.Duration
+	// Sequence and SentAt are the client's sequence number and timestamp.
+	// When set they must be after the client's LastSequence and LastSentAt,
+	// which they replace.
+	Sequence int64
+	SentAt   time.Time
+	// Liveness and Version replace the stored sync state and build, and
+	// clear them when nil
+	Liveness *Liveness
+	Version  *ClientVersion
+	// ProbeURL keeps the stored URL when empty
+	ProbeURL string
+}
+
+// Record returns the heartbeat record for the time since the previous
+// heartbeat, and false when that time does not count as uptime
+func (h ClientHeartbeat) Record(address string, previous, now time.Time) (HeartbeatRecord, bool) {
+	elapsed := now.Sub(previous)
+	seconds := int64(elapsed.Seconds())
+	if h.Amount <= 0 || seconds <= 0 || elapsed > h.MaxGap {
+		return HeartbeatRecord{}, false
+	}
+	return HeartbeatRecord{
+		ClientAddress:  address,
+		Timestamp:      now,
+		Duration:       seconds,
+		Amount:         h.Amount,
+		CommissionRate: h.CommissionRate,
+	}, true
+}
+
+// RecordHeartbeat registers the client or refreshes its record, then records
+// a heartbeat for the time since the previous one when it counts as uptime.
+// The client is read and updated in one atomic operation, so concurrent
+// heartbeats for an address never count the same time twice: each one adds
+// only the time since the heartbeat applied before it. Liveness, version
+// and probe URL are part of that update. The sequence and timestamp are
+// checked by the same update, so of two heartbeats racing with the same
+// sequence only one is recorded; the other gets ErrHeartbeatOutOfOrder.
+//
+// The version change and the heartbeat record are written after the client
+// and outside of it. If either fails, the heartbeat has still been applied
+// to the client and ErrHeartbeatIncomplete is returned, so callers do not
+// have the client retry a heartbeat that would now be out of order.
+func (d *Database) RecordHeartbeat(ctx context.Context, address string, heartbeat ClientHeartbeat) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	now := time.Now()
+	address = strings.ToLower(address)
+
+	// Time since the previous heartbeat in milliseconds, never negative when
+	// replicas' clocks disagree
+	elapsed := bson.D{{Key: "$max", Value: bson.A{
+		0,
+		bson.D{{Key: "$subtract", Value: bson.A{now, bson.D{{Key: "$ifNull", Value: bson.A{"$last_heartbeat", now}}}}}},
+	}}}
+	update := mongo.Pipeline{bson.D{{Key: "$set", Value: bson.D{
+		{Key: "total_time", Value: bson.D{{Key: "$add", Value: bson.A{
+			bson.D{{Key: "$ifNull", Value: bson.A{"$total_time", int64(0)}}},
+			bson.D{{Key: "$toLong", Value: bson.D{{Key: "$floor", Value: bson.D{{Key: "$divide", Value: bson.A{elapsed, 1000}}}}}}},
+		}}}},
+		{Key: "last_heartbeat", Value: bson.D{{Key: "$max", Value: bson.A{now, "$last_heartbeat"}}}},
+		{Key: "nft_amount", Value: heartbeat.Amount},
+		{Key: "commission_rate", Value: heartbeat.CommissionRate},
+		{Key: "operator_name", Value: keepUnlessSet("$operator_name", heartbeat.OperatorName)},
+		{Key: "reward_collector_address", Value: keepUnlessSet("$reward_collector_address", strings.ToLower(heartbeat.RewardCollectorAddress))},
+		{Key: "created_at", Value: bson.D{{Key: "$ifNull", Value: bson.A{"$created_at", now}}}},
+		{Key: "liveness", Value: literalOrRemove(heartbeat.Liveness)},
+		{Key: "version", Value: literalOrRemove(heartbeat.Version)},
+	}}}}
+	if heartbeat.ProbeURL != "" {
+		update = append(update, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "probe_url", Value: bson.D{{Key: "$literal", Value: heartbeat.ProbeURL}}},
+		}}})
+	}
+	// Only a client whose last sequence and timestamp are older matches.
+	// $not also matches clients that never sent them.
+	filter := bson.M{"address": address}
+	if heartbeat.Sequence > 0 {
+		filter["last_sequence"] = bson.M{"$not": bson.M{"$gte": heartbeat.Sequence}}
+		update = append(update, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "last_sequence", Value: heartbeat.Sequence},
+		}}})
+	}
+	if !heartbeat.SentAt.IsZero() {
+		filter["last_sent_at"] = bson.M{"$not": bson.M{"$gte": heartbeat.SentAt}}
+		update = append(update, bson.D{{Key: "$set", Value: bson.D{
+			{Key: "last_sent_at", Value: heartbeat.SentAt},
+		}}})
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.Before)
+	var previous ClientInfo
+	err := d.clients.FindOneAndUpdate(ctx, filter, update, opts).Decode(&previous)
+	if mongo.IsDuplicateKeyError(err) {
+		// The client exists but is ahead of this heartbeat, so the upsert
+		// tried to insert a second document for the address
+		return ErrHeartbeatOutOfOrder
+	}
+	// A new client has no time to count yet
+	created := err == mongo.ErrNoDocuments
+	if err != nil && !created {
+		return err
+	}
+
+	var errs []error
+	if version := heartbeat.Version; version != nil && !version.SameBuild(previous.Version) {
+		_, err := d.versionHistory.InsertOne(ctx, VersionChange{
+			ClientAddress: address,
+			Version:       version.Version,
+			Network:       version.Network,
+			OS:            version.OS,
+			Arch:          version.Arch,
+			Timestamp:     version.ReportedAt,
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("record version change: %w", err))
+		}
+	}
+	if record, ok := heartbeat.Record(address, previous.LastHeartbeat, now); ok && !created {
+		if err := d.AddHeartbeat(ctx, record); err != nil {
+			errs = append(errs, fmt.Errorf("add heartbeat: %w", err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrHeartbeatIncomplete, errors.Join(errs...))
+	}
+	return nil
+}
+
+// literalOrRemove is an update pipeline expression that stores value as is,
+// without reading strings in it as field paths, or removes the field when
+// value is nil
+func literalOrRemove[T any](value *T) interface{} {
+	if value == nil {
+		return "$$REMOVE"
+	}
+	return bson.D{{Key: "$literal", Value: value}}
+}
+
+// keepUnlessSet is an update pipeline expression for value, or for the
+// stored field when value is empty. Values are literals, so user input
+// starting with $ is not read as a field path.
+func keepUnlessSet(field, value string) interface{} {
+	if value == "" {
+		return bson.D{{Key: "$ifNull", Value: bson.A{field, ""}}}
+	}
+	return bson.D{{Key: "$literal", Value: value}}
+}
+
+// GetHeartbeats returns a client's heartbeats since the given time, oldest first
+func (d *Database) GetHeartbeats(ctx context.Context, address string, since time.Time) ([]HeartbeatRecord, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	cursor, err := d.heartbeats.Find(ctx, bson.M{
+		"client_address": strings.ToLower(address),
+		"timestamp":      bson.M{"$gte": since},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var heartbeats []HeartbeatRecord
+	if err = cursor.All(ctx, &heartbeats); err != nil {
+		return nil, err
+	}
+	return heartbeats, nil
+}
+
+// coverageSince matches a client's coverage intervals from the one since
+// falls in, like the raw heartbeats since then. The interval since falls in
+// counts only if one of its heartbeats was at or after since.
+func coverageSince(clientAddress string, since time.Time) bson.D {
+	return bson.D{
+		{Key: "client_address", Value: clientAddress},
+		{Key: "interval_start", Value: bson.D{{Key: "$gte", Value: since.Truncate(CoverageInterval)}}},
+		{Key: "last_heartbeat", Value: bson.D{{Key: "$gte", Value: since}}},
+	}
+}
+
+// CountHeartbeatIntervals counts the distinct intervals since the given time
+// that contain at least one heartbeat from the client, raw or compacted.
+// interval must be a multiple of CoverageInterval for compacted history.
+func (d *Database) CountHeartbeatIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration) (int64, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		// Stage 1: Match documents by client and time range
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "client_address", Value: clientAddress},
+			{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: since}}},
+		}}},
+
+		// Stage 2: Project only necessary fields with pre-calculated interval bucket
+		bson.D{{Key: "$project", Value: bson.D{
+			{Key: "interval_bucket", Value: bson.D{
+				{Key: "$floor", Value: bson.D{
+					{Key: "$divide", Value: bson.A{
+						bson.D{{Key: "$toLong", Value: "$timestamp"}},
+						int64(interval / time.Millisecond),
+					}},
+				}},
+			}},
+		}}},
+
+		// Stage 3: Add the intervals of heartbeats that were compacted away
+		bson.D{{Key: "$unionWith", Value: bson.D{
+			{Key: "coll", Value: d.heartbeatCoverage.Name()},
+			{Key: "pipeline", Value: mongo.Pipeline{
+				bson.D{{Key: "$match", Value: coverageSince(clientAddress, since)}},
+				bson.D{{Key: "$project", Value: bson.D{
+					{Key: "interval_bucket", Value: bson.D{
+						{Key: "$floor", Value: bson.D{
+							{Key: "$divide", Value: bson.A{
+								bson.D{{Key: "$toLong", Value: "$interval_start"}},
+								int64(interval / time.Millisecond),
+							}},
+						}},
+					}},
+				}}},
+			}},
+		}}},
+
+		// Stage 4: Group by the interval bucket to count unique intervals
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$interval_bucket"},
+		}}},
+
+		// Stage 5: Count total intervals
+		bson.D{{Key: "$count", Value: "total_intervals"}},
+	}
+
+	opts := options.Aggregate().SetMaxTime(3 * time.Second)
+
+	cursor, err := d.heartbeats.Aggregate(ctx, pipeline, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		TotalIntervals int64 `bson:"total_intervals"`
+	}
+
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.TotalIntervals, cursor.Err()
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Liveness is what a client's last heartbeat reported about the light client
+// behind it, checked against the Avail chain
+type Liveness struct {
+	BlockNumber uint64 `bson:"block_number" json:"block_number"`
+	BlockHash   string `bson:"block_hash,omitempty" json:"block_hash,omitempty"`
+	PeerID      string `bson:"peer_id,omitempty" json:"peer_id,omitempty"`
+	// Verified is false when the Avail RPC is not configured or could not
+	// be reached, in which case the report is taken as is
+	Verified bool `bson:"verified" json:"verified"`
+	// ChainHead is the finalized block on the Avail RPC at check time
+	ChainHead uint64 `bson:"chain_head,omitempty" json:"chain_head,omitempty"`
+	// Lag is how many blocks the light client is behind ChainHead
+	Lag uint64 `bson:"lag" json:"lag"`
+	// Degraded clients are heartbeating but too far behind the chain
+	Degraded  bool      `bson:"degraded" json:"degraded"`
+	CheckedAt time.Time `bson:"checked_at" json:"checked_at"`
+}
+
+func (d *Database) SetLiveness(ctx context.Context, address string, liveness *Liveness) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$unset": bson.M{"liveness": ""}}
+	if liveness != nil {
+		update = bson.M{"$set": bson.M{"liveness": liveness}}
+	}
+
+	_, err := d.clients.UpdateOne(ctx, bson.M{"address": strings.ToLower(address)}, update)
+	return err
+}
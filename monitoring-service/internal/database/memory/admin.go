@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+func (s *Store) AddToBlacklist(ctx context.Context, entry database.BlacklistEntry) error {
+	entry.Address = strings.ToLower(entry.Address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blacklist[entry.Address] = entry
+	return nil
+}
+
+func (s *Store) RemoveFromBlacklist(ctx context.Context, address string) (bool, error) {
+	address = strings.ToLower(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.blacklist[address]
+	delete(s.blacklist, address)
+	return ok, nil
+}
+
+func (s *Store) IsBlacklisted(ctx context.Context, address string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.blacklist[strings.ToLower(address)]
+	return ok, nil
+}
+
+func (s *Store) GetBlacklist(ctx context.Context) ([]database.BlacklistEntry, error) {
+	s.mu.RLock()
+	entries := make([]database.BlacklistEntry, 0, len(s.blacklist))
+	for _, entry := range s.blacklist {
+		entries = append(entries, entry)
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.After(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+func (s *Store) SetStatusOverride(ctx context.Context, address string, override *database.StatusOverride) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[strings.ToLower(address)]
+	if !ok {
+		return false, nil
+	}
+	if override != nil {
+		copied := *override
+		override = &copied
+	}
+	client.StatusOverride = override
+	return true, nil
+}
+
+func (s *Store) GetStatusOverrides(ctx context.Context) (map[string]database.StatusOverride, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	overrides := make(map[string]database.StatusOverride)
+	for address, client := range s.clients {
+		if client.StatusOverride != nil {
+			overrides[address] = *client.StatusOverride
+		}
+	}
+	return overrides, nil
+}
+
+func (s *Store) AddIncident(ctx context.Context, incident database.Incident) error {
+	incident.ClientAddress = strings.ToLower(incident.ClientAddress)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.incidents = append(s.incidents, incident)
+	return nil
+}
+
+func (s *Store) GetIncidents(ctx context.Context, address string, tr database.TimeRange) ([]database.Incident, error) {
+	address = strings.ToLower(address)
+
+	s.mu.RLock()
+	incidents := []database.Incident{}
+	for _, incident := range s.incidents {
+		if address != "" && incident.ClientAddress != address {
+			continue
+		}
+		if !tr.From.IsZero() && incident.StartedAt.Before(tr.From) {
+			continue
+		}
+		if !tr.To.IsZero() && !incident.StartedAt.Before(tr.To) {
+			continue
+		}
+		incidents = append(incidents, incident)
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(incidents, func(i, j int) bool {
+		return incidents[i].StartedAt.After(incidents[j].StartedAt)
+	})
+	return incidents, nil
+}
+
+func (s *Store) AddAuditEntry(ctx context.Context, entry database.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Like the TTL index, forget entries after the retention period
+	cutoff := time.Now().Add(-database.AuditRetention)
+	kept := s.auditLog[:0]
+	for _, existing := range s.auditLog {
+		if existing.Timestamp.After(cutoff) {
+			kept = append(kept, existing)
+		}
+	}
+	s.auditLog = append(kept, entry)
+	return nil
+}
+
+func (s *Store) GetAuditLog(ctx context.Context, limit int) ([]database.AuditEntry, error) {
+	s.mu.RLock()
+	entries := append([]database.AuditEntry(nil), s.auditLog...)
+	s.mu.RUnlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.After(entries[j].Timestamp)
+	})
+	if limit > 0 && len(entries) > limit {
+		entries = entries[:limit]
+	}
+	if entries == nil {
+		entries = []database.AuditEntry{}
+	}
+	return entries, nil
+}
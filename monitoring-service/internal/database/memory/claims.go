@@ -0,0 +1,55 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+func (s *Store) ClaimHeartbeat(ctx context.Context, address, key string, now time.Time) (*database.HeartbeatClaim, error) {
+	address = strings.ToLower(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Like the TTL index, forget responses after the retention period
+	for k, claim := range s.claims {
+		if now.Sub(claim.ClaimedAt) >= database.ClaimRetention {
+			delete(s.claims, k)
+		}
+	}
+
+	k := claimKey{address: address, key: key}
+	if existing, ok := s.claims[k]; ok && (existing.Completed || existing.Pending(now)) {
+		return &existing, nil
+	}
+	s.claims[k] = database.HeartbeatClaim{Address: address, Key: key, ClaimedAt: now}
+	return nil, nil
+}
+
+func (s *Store) CompleteHeartbeat(ctx context.Context, address, key string, statusCode int, body []byte) error {
+	k := claimKey{address: strings.ToLower(address), key: key}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if claim, ok := s.claims[k]; ok {
+		claim.Completed = true
+		claim.StatusCode = statusCode
+		claim.Body = append([]byte(nil), body...)
+		s.claims[k] = claim
+	}
+	return nil
+}
+
+func (s *Store) ReleaseHeartbeat(ctx context.Context, address, key string) error {
+	k := claimKey{address: strings.ToLower(address), key: key}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if claim, ok := s.claims[k]; ok && !claim.Completed {
+		delete(s.claims, k)
+	}
+	return nil
+}
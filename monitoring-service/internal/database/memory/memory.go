@@ -0,0 +1,799 @@
+package memory
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/uptime"
+)
+
+// Store is an in-process implementation of database.Store for tests and
+// local development. It mirrors the MongoDB behaviour, including address
+// normalisation, and passes the same storetest conformance suite.
+type Store struct {
+	mu          sync.RWMutex
+	clients     map[string]*database.ClientInfo
+	heartbeats  []database.HeartbeatRecord
+	delegations map[delegationKey]database.DelegationRecord
+	rewards     map[string]int64
+	logger      *slog.Logger
+
+	coverage       map[coverageKey]database.HeartbeatCoverage
+	compactedUntil time.Time
+
+	sources   map[sourceKey]database.ClientSource
+	blacklist map[string]database.BlacklistEntry
+	incidents []database.Incident
+	auditLog  []database.AuditEntry
+
+	probes       []database.ProbeRecord
+	uptimePolicy uptime.Policy
+
+	versionHistory []database.VersionChange
+	claims         map[claimKey]database.HeartbeatClaim
+}
+
+type claimKey struct {
+	address string
+	key     string
+}
+
+type coverageKey struct {
+	address       string
+	intervalStart int64
+}
+
+type sourceKey struct {
+	address string
+	ip      string
+}
+
+type delegationKey struct {
+	from string
+	to   string
+}
+
+var _ database.Store = (*Store)(nil)
+
+// New creates an empty in-memory store
+func New(logger *slog.Logger) *Store {
+	return &Store{
+		clients:     make(map[string]*database.ClientInfo),
+		delegations: make(map[delegationKey]database.DelegationRecord),
+		rewards:     make(map[string]int64),
+		logger:      logger,
+		coverage:    make(map[coverageKey]database.HeartbeatCoverage),
+		sources:     make(map[sourceKey]database.ClientSource),
+		blacklist:   make(map[string]database.BlacklistEntry),
+		claims:      make(map[claimKey]database.HeartbeatClaim),
+	}
+}
+
+func (s *Store) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Store) Close() error {
+	return nil
+}
+
+func (s *Store) RegisterClient(ctx context.Context, address string, operationPoints database.OperationPointRecord, totalTime int64, operatorName string, rewardCollectorAddress string) error {
+	now := time.Now()
+	address = strings.ToLower(address)
+
+	// Record heartbeat only if amount > 0 and time > 0.
+	if operationPoints.Amount > 0 && operationPoints.Time > 0 {
+		if err := s.AddHeartbeat(ctx, database.HeartbeatRecord{
+			ClientAddress:  address,
+			Timestamp:      now,
+			Duration:       operationPoints.Time,
+			Amount:         operationPoints.Amount,
+			CommissionRate: operationPoints.CommissionRate,
+		}); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[address]
+	if !ok {
+		client = &database.ClientInfo{CreatedAt: now}
+		s.clients[address] = client
+	}
+	client.Address = address
+	client.TotalTime = totalTime
+	client.LastHeartbeat = now
+	client.NFTAmount = operationPoints.Amount
+	client.CommissionRate = operationPoints.CommissionRate
+	client.OperatorName = operatorName
+	client.RewardCollectorAddress = strings.ToLower(rewardCollectorAddress)
+	return nil
+}
+
+func (s *Store) RecordHeartbeat(ctx context.Context, address string, heartbeat database.ClientHeartbeat) error {
+	now := time.Now()
+	address = strings.ToLower(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[address]
+	if !ok {
+		s.clients[address] = &database.ClientInfo{
+			Address:                address,
+			LastHeartbeat:          now,
+			CreatedAt:              now,
+			NFTAmount:              heartbeat.Amount,
+			CommissionRate:         heartbeat.CommissionRate,
+			OperatorName:           heartbeat.OperatorName,
+			RewardCollectorAddress: strings.ToLower(heartbeat.RewardCollectorAddress),
+			LastSequence:           heartbeat.Sequence,
+			LastSentAt:             heartbeat.SentAt,
+		}
+		s.applyHeartbeatState(s.clients[address], heartbeat)
+		return nil
+	}
+
+	if heartbeat.Sequence > 0 && heartbeat.Sequence <= client.LastSequence {
+		return database.ErrHeartbeatOutOfOrder
+	}
+	if !heartbeat.SentAt.IsZero() && !heartbeat.SentAt.After(client.LastSentAt) {
+		return database.ErrHeartbeatOutOfOrder
+	}
+
+	previous := client.LastHeartbeat
+	if elapsed := now.Sub(previous); elapsed > 0 {
+		client.TotalTime += int64(elapsed.Seconds())
+		client.LastHeartbeat = now
+	}
+	client.NFTAmount = heartbeat.Amount
+	client.CommissionRate = heartbeat.CommissionRate
+	if heartbeat.OperatorName != "" {
+		client.OperatorName = heartbeat.OperatorName
+	}
+	if heartbeat.RewardCollectorAddress != "" {
+		client.RewardCollectorAddress = strings.ToLower(heartbeat.RewardCollectorAddress)
+	}
+	if heartbeat.Sequence > 0 {
+		client.LastSequence = heartbeat.Sequence
+	}
+	if !heartbeat.SentAt.IsZero() {
+		client.LastSentAt = heartbeat.SentAt
+	}
+	s.applyHeartbeatState(client, heartbeat)
+
+	if record, ok := heartbeat.Record(address, previous, now); ok {
+		s.addHeartbeat(record)
+	}
+	return nil
+}
+
+// applyHeartbeatState stores the liveness, version and probe URL a heartbeat
+// carries. Callers hold s.mu.
+func (s *Store) applyHeartbeatState(client *database.ClientInfo, heartbeat database.ClientHeartbeat) {
+	client.Liveness = heartbeat.Liveness
+	if heartbeat.ProbeURL != "" {
+		client.ProbeURL = heartbeat.ProbeURL
+	}
+	s.setVersion(client, heartbeat.Version)
+}
+
+func (s *Store) ClientExists(ctx context.Context, address string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.clients[strings.ToLower(address)]
+	return ok, nil
+}
+
+func (s *Store) GetClient(ctx context.Context, address string) (*database.ClientInfo, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	client, ok := s.clients[strings.ToLower(address)]
+	if !ok {
+		return nil, nil
+	}
+	copied := *client
+	return &copied, nil
+}
+
+func (s *Store) GetAllClients(ctx context.Context) ([]database.ClientInfo, error) {
+	clients := s.sortedClients(func(a, b database.ClientInfo) bool {
+		return a.CreatedAt.After(b.CreatedAt)
+	})
+
+	uptimeCalc := uptime.NewCalculator(s, s.currentUptimePolicy())
+	for i := range clients {
+		if err := database.PopulateUptime(context.Background(), uptimeCalc, &clients[i], time.Now()); err != nil {
+			s.logger.Error("Failed to calculate uptime", "client", clients[i].Address, "error", err)
+		}
+	}
+	return clients, nil
+}
+
+func (s *Store) GetLastHeartbeats(ctx context.Context) (map[string]time.Time, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	lastHeartbeats := make(map[string]time.Time, len(s.clients))
+	for address, client := range s.clients {
+		lastHeartbeats[address] = client.LastHeartbeat
+	}
+	return lastHeartbeats, nil
+}
+
+func (s *Store) UpsertClient(ctx context.Context, client database.ClientInfo) error {
+	client.Address = strings.ToLower(client.Address)
+	client.RewardCollectorAddress = strings.ToLower(client.RewardCollectorAddress)
+	client.Status = ""
+	client.AllUptimePercentage = 0
+	client.WeeklyUptimePercentage = 0
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Like the Mongo upsert, leave fields set through other methods alone
+	client.StatusOverride = nil
+	client.Liveness = nil
+	client.ProbeURL = ""
+	client.Version = nil
+	client.LastSequence = 0
+	client.LastSentAt = time.Time{}
+	if existing, ok := s.clients[client.Address]; ok {
+		client.StatusOverride = existing.StatusOverride
+		client.Liveness = existing.Liveness
+		client.ProbeURL = existing.ProbeURL
+		client.Version = existing.Version
+		client.LastSequence = existing.LastSequence
+		client.LastSentAt = existing.LastSentAt
+	}
+	s.clients[client.Address] = &client
+	return nil
+}
+
+func (s *Store) SetLiveness(ctx context.Context, address string, liveness *database.Liveness) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client, ok := s.clients[strings.ToLower(address)]; ok {
+		client.Liveness = liveness
+	}
+	return nil
+}
+
+func (s *Store) SetClientVersion(ctx context.Context, address string, version *database.ClientVersion) error {
+	address = strings.ToLower(address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if client, ok := s.clients[address]; ok {
+		s.setVersion(client, version)
+	}
+	return nil
+}
+
+// setVersion stores the client's version and records a change of build.
+// Callers hold s.mu.
+func (s *Store) setVersion(client *database.ClientInfo, version *database.ClientVersion) {
+	previous := client.Version
+	client.Version = version
+	if version != nil && !version.SameBuild(previous) {
+		s.versionHistory = append(s.versionHistory, database.VersionChange{
+			ClientAddress: client.Address,
+			Version:       version.Version,
+			Network:       version.Network,
+			OS:            version.OS,
+			Arch:          version.Arch,
+			Timestamp:     version.ReportedAt,
+		})
+	}
+}
+
+func (s *Store) GetVersionHistory(ctx context.Context, address string) ([]database.VersionChange, error) {
+	address = strings.ToLower(address)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	changes := []database.VersionChange{}
+	for _, change := range s.versionHistory {
+		if change.ClientAddress == address {
+			changes = append(changes, change)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].Timestamp.Before(changes[j].Timestamp) })
+	return changes, nil
+}
+
+func (s *Store) GetClientVersions(ctx context.Context) (map[string]database.ClientVersion, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := make(map[string]database.ClientVersion)
+	for address, client := range s.clients {
+		if client.Version != nil {
+			versions[address] = *client.Version
+		}
+	}
+	return versions, nil
+}
+
+func (s *Store) RecordClientSource(ctx context.Context, address, ip string, seenAt time.Time) error {
+	key := sourceKey{address: strings.ToLower(address), ip: ip}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	source, ok := s.sources[key]
+	if !ok {
+		source = database.ClientSource{ClientAddress: key.address, IP: ip, FirstSeen: seenAt, LastSeen: seenAt}
+	}
+	if seenAt.Before(source.FirstSeen) {
+		source.FirstSeen = seenAt
+	}
+	if seenAt.After(source.LastSeen) {
+		source.LastSeen = seenAt
+	}
+	source.Heartbeats++
+	s.sources[key] = source
+	return nil
+}
+
+func (s *Store) GetClientSources(ctx context.Context, since time.Time) ([]database.ClientSource, error) {
+	s.mu.RLock()
+	sources := []database.ClientSource{}
+	for _, source := range s.sources {
+		if !source.LastSeen.Before(since) {
+			sources = append(sources, source)
+		}
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(sources, func(i, j int) bool {
+		if sources[i].IP != sources[j].IP {
+			return sources[i].IP < sources[j].IP
+		}
+		return sources[i].ClientAddress < sources[j].ClientAddress
+	})
+	return sources, nil
+}
+
+func (s *Store) StreamClients(ctx context.Context, tr database.TimeRange, fn func(database.ClientInfo) error) error {
+	clients := s.sortedClients(func(a, b database.ClientInfo) bool {
+		return a.CreatedAt.Before(b.CreatedAt)
+	})
+
+	uptimeCalc := uptime.NewCalculator(s, s.currentUptimePolicy())
+	now := time.Now()
+	for _, client := range clients {
+		if !tr.From.IsZero() && client.LastHeartbeat.Before(tr.From) {
+			continue
+		}
+		if !tr.To.IsZero() && !client.CreatedAt.Before(tr.To) {
+			continue
+		}
+		if err := database.PopulateUptime(ctx, uptimeCalc, &client, now); err != nil {
+			s.logger.ErrorContext(ctx, "Failed to calculate uptime", "client", client.Address, "error", err)
+		}
+		if err := fn(client); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) AddHeartbeat(ctx context.Context, heartbeat database.HeartbeatRecord) error {
+	heartbeat.ClientAddress = strings.ToLower(heartbeat.ClientAddress)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addHeartbeat(heartbeat)
+	return nil
+}
+
+// addHeartbeat inserts a heartbeat, keeping them ordered by timestamp. The
+// caller holds s.mu.
+func (s *Store) addHeartbeat(heartbeat database.HeartbeatRecord) {
+	i := sort.Search(len(s.heartbeats), func(i int) bool {
+		return s.heartbeats[i].Timestamp.After(heartbeat.Timestamp)
+	})
+	s.heartbeats = append(s.heartbeats, database.HeartbeatRecord{})
+	copy(s.heartbeats[i+1:], s.heartbeats[i:])
+	s.heartbeats[i] = heartbeat
+}
+
+func (s *Store) GetHeartbeats(ctx context.Context, address string, since time.Time) ([]database.HeartbeatRecord, error) {
+	address = strings.ToLower(address)
+
+	var heartbeats []database.HeartbeatRecord
+	s.eachHeartbeat(database.TimeRange{From: since}, func(heartbeat database.HeartbeatRecord) {
+		if heartbeat.ClientAddress == address {
+			heartbeats = append(heartbeats, heartbeat)
+		}
+	})
+	return heartbeats, nil
+}
+
+func (s *Store) CountHeartbeatIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration) (int64, error) {
+	return int64(len(s.heartbeatBuckets(clientAddress, since, interval))), nil
+}
+
+// heartbeatBuckets returns the intervals with a raw or compacted heartbeat
+func (s *Store) heartbeatBuckets(clientAddress string, since time.Time, interval time.Duration) map[int64]struct{} {
+	buckets := make(map[int64]struct{})
+	s.eachHeartbeat(database.TimeRange{From: since}, func(heartbeat database.HeartbeatRecord) {
+		if heartbeat.ClientAddress == clientAddress {
+			buckets[heartbeat.Timestamp.UnixMilli()/interval.Milliseconds()] = struct{}{}
+		}
+	})
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	from := since.Truncate(database.CoverageInterval)
+	for _, coverage := range s.coverage {
+		if coverage.ClientAddress == clientAddress && !coverage.IntervalStart.Before(from) && !coverage.LastHeartbeat.Before(since) {
+			buckets[coverage.IntervalStart.UnixMilli()/interval.Milliseconds()] = struct{}{}
+		}
+	}
+	return buckets
+}
+
+func (s *Store) StreamHeartbeats(ctx context.Context, address string, tr database.TimeRange, fn func(database.HeartbeatRecord) error) error {
+	address = strings.ToLower(address)
+
+	var heartbeats []database.HeartbeatRecord
+	s.eachHeartbeat(tr, func(heartbeat database.HeartbeatRecord) {
+		if address == "" || heartbeat.ClientAddress == address {
+			heartbeats = append(heartbeats, heartbeat)
+		}
+	})
+
+	for _, heartbeat := range heartbeats {
+		if err := fn(heartbeat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetOperatorActivity(ctx context.Context, since time.Time) (map[string]database.OperatorActivity, error) {
+	activity := make(map[string]database.OperatorActivity)
+	previous := make(map[string]database.HeartbeatRecord)
+
+	s.eachHeartbeat(database.TimeRange{From: since}, func(heartbeat database.HeartbeatRecord) {
+		record := activity[heartbeat.ClientAddress]
+		record.Address = heartbeat.ClientAddress
+		record.Heartbeats++
+
+		if last, ok := previous[heartbeat.ClientAddress]; ok {
+			if heartbeat.Timestamp.Sub(last.Timestamp) > database.OfflineAfter {
+				record.Incidents++
+			}
+			if heartbeat.CommissionRate != last.CommissionRate {
+				record.CommissionChanges++
+			}
+		}
+
+		previous[heartbeat.ClientAddress] = heartbeat
+		activity[heartbeat.ClientAddress] = record
+	})
+
+	lastHeartbeats, err := s.GetLastHeartbeats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for address, lastHeartbeat := range lastHeartbeats {
+		if now.Sub(lastHeartbeat) > database.OfflineAfter {
+			record := activity[address]
+			record.Address = address
+			record.Incidents++
+			activity[address] = record
+		}
+	}
+
+	return activity, nil
+}
+
+func (s *Store) CompactHeartbeats(ctx context.Context, before time.Time) (database.CompactionReport, error) {
+	before = before.Truncate(database.CoverageInterval)
+	report := database.CompactionReport{To: before}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	start := s.compactedUntil
+	if start.IsZero() {
+		if len(s.heartbeats) == 0 {
+			report.From = before
+			return report, nil
+		}
+		start = s.heartbeats[0].Timestamp.Truncate(database.CoverageInterval)
+	}
+	report.From = start
+
+	for windowStart := start; windowStart.Before(before); {
+		windowEnd := windowStart.Add(database.CompactionWindow)
+		if windowEnd.After(before) {
+			windowEnd = before
+		}
+
+		intervals := make(map[coverageKey]bool)
+		kept := s.heartbeats[:0]
+		for _, heartbeat := range s.heartbeats {
+			if heartbeat.Timestamp.Before(windowStart) || !heartbeat.Timestamp.Before(windowEnd) {
+				kept = append(kept, heartbeat)
+				continue
+			}
+
+			intervalStart := heartbeat.Timestamp.Truncate(database.CoverageInterval)
+			key := coverageKey{address: heartbeat.ClientAddress, intervalStart: intervalStart.UnixMilli()}
+			coverage, ok := s.coverage[key]
+			if !ok {
+				coverage = database.HeartbeatCoverage{
+					ClientAddress:  heartbeat.ClientAddress,
+					IntervalStart:  intervalStart,
+					FirstHeartbeat: heartbeat.Timestamp,
+				}
+			}
+			coverage.Heartbeats++
+			if heartbeat.Timestamp.Before(coverage.FirstHeartbeat) {
+				coverage.FirstHeartbeat = heartbeat.Timestamp
+			}
+			if heartbeat.Timestamp.After(coverage.LastHeartbeat) {
+				coverage.LastHeartbeat = heartbeat.Timestamp
+			}
+			s.coverage[key] = coverage
+			intervals[key] = true
+			report.HeartbeatsDeleted++
+		}
+		s.heartbeats = kept
+
+		report.CoverageIntervals += int64(len(intervals))
+		report.Windows++
+		s.compactedUntil = windowEnd
+		windowStart = windowEnd
+	}
+
+	return report, nil
+}
+
+func (s *Store) RegisterDelegation(ctx context.Context, address string, delegationPoints database.DelegationPointRecord) error {
+	address = strings.ToLower(address)
+	from := strings.ToLower(delegationPoints.Address)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delegations[delegationKey{from: from, to: address}] = database.DelegationRecord{
+		FromAddress:    from,
+		ToAddress:      address,
+		Amount:         delegationPoints.Amount,
+		CommissionRate: delegationPoints.CommissionRate,
+		Timestamp:      time.Now(),
+	}
+	return nil
+}
+
+func (s *Store) GetFromDelegationsByAddress(ctx context.Context, address string) ([]database.DelegationRecord, error) {
+	address = strings.ToLower(address)
+	return s.filterDelegations(func(d database.DelegationRecord) bool {
+		return d.FromAddress == address
+	}), nil
+}
+
+func (s *Store) GetToDelegationsByAddress(ctx context.Context, address string) ([]database.DelegationRecord, error) {
+	address = strings.ToLower(address)
+	return s.filterDelegations(func(d database.DelegationRecord) bool {
+		return d.ToAddress == address
+	}), nil
+}
+
+func (s *Store) GetDelegations(ctx context.Context, address string) ([]database.DelegationRecord, error) {
+	address = strings.ToLower(address)
+	return s.filterDelegations(func(d database.DelegationRecord) bool {
+		return d.FromAddress == address || d.ToAddress == address
+	}), nil
+}
+
+func (s *Store) ClearDelegationsForAddress(ctx context.Context, address string, validFromAddresses []string) error {
+	address = strings.ToLower(address)
+	valid := make(map[string]bool, len(validFromAddresses))
+	for _, addr := range validFromAddresses {
+		valid[strings.ToLower(addr)] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.delegations {
+		if key.to == address && !valid[key.from] {
+			delete(s.delegations, key)
+		}
+	}
+	return nil
+}
+
+func (s *Store) ReplaceDelegations(ctx context.Context, address string, delegators map[string]int64, commissionRate float64) error {
+	now := time.Now()
+	address = strings.ToLower(address)
+	current := make(map[string]int64, len(delegators))
+	for from, amount := range delegators {
+		current[strings.ToLower(from)] = amount
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.delegations {
+		if _, ok := current[key.from]; key.to == address && !ok {
+			delete(s.delegations, key)
+		}
+	}
+	for from, amount := range current {
+		s.delegations[delegationKey{from: from, to: address}] = database.DelegationRecord{
+			FromAddress:    from,
+			ToAddress:      address,
+			Amount:         amount,
+			CommissionRate: commissionRate,
+			Timestamp:      now,
+		}
+	}
+	return nil
+}
+
+func (s *Store) UpsertDelegation(ctx context.Context, delegation database.DelegationRecord) error {
+	delegation.FromAddress = strings.ToLower(delegation.FromAddress)
+	delegation.ToAddress = strings.ToLower(delegation.ToAddress)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delegations[delegationKey{from: delegation.FromAddress, to: delegation.ToAddress}] = delegation
+	return nil
+}
+
+func (s *Store) StreamDelegations(ctx context.Context, address string, tr database.TimeRange, fn func(database.DelegationRecord) error) error {
+	address = strings.ToLower(address)
+	delegations := s.filterDelegations(func(d database.DelegationRecord) bool {
+		if address != "" && d.FromAddress != address && d.ToAddress != address {
+			return false
+		}
+		if !tr.From.IsZero() && d.Timestamp.Before(tr.From) {
+			return false
+		}
+		return tr.To.IsZero() || d.Timestamp.Before(tr.To)
+	})
+
+	for _, delegation := range delegations {
+		if err := fn(delegation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetDelegatorPositions(ctx context.Context, address string) ([]database.DelegatorPosition, error) {
+	address = strings.ToLower(address)
+	delegations, _ := s.GetFromDelegationsByAddress(ctx, address)
+
+	byOperator := make(map[string]*database.DelegatorPosition)
+	var positions []database.DelegatorPosition
+
+	s.mu.RLock()
+	for _, delegation := range delegations {
+		client, ok := s.clients[delegation.ToAddress]
+		if !ok {
+			// Operators without a client record are no longer registered
+			continue
+		}
+
+		position, ok := byOperator[delegation.ToAddress]
+		if !ok {
+			position = &database.DelegatorPosition{
+				OperatorAddress: delegation.ToAddress,
+				OperatorName:    client.OperatorName,
+				CommissionRate:  client.CommissionRate,
+				LastHeartbeat:   client.LastHeartbeat,
+				CreatedAt:       client.CreatedAt,
+				StatusOverride:  client.StatusOverride,
+				Liveness:        client.Liveness,
+			}
+			if points, ok := s.rewards[delegation.ToAddress]; ok {
+				position.OperatorRewards = &points
+			}
+			byOperator[delegation.ToAddress] = position
+		}
+		position.DelegatedAmount += delegation.Amount
+		if delegation.Timestamp.After(position.DelegatedAt) {
+			position.DelegatedAt = delegation.Timestamp
+		}
+	}
+	s.mu.RUnlock()
+
+	for _, position := range byOperator {
+		positions = append(positions, *position)
+	}
+	sort.Slice(positions, func(i, j int) bool {
+		if positions[i].DelegatedAmount != positions[j].DelegatedAmount {
+			return positions[i].DelegatedAmount > positions[j].DelegatedAmount
+		}
+		return positions[i].OperatorAddress < positions[j].OperatorAddress
+	})
+
+	uptimeCalc := uptime.NewCalculator(s, s.currentUptimePolicy())
+	now := time.Now()
+	for i := range positions {
+		positions[i].Status = database.EffectiveStatus(positions[i].LastHeartbeat, positions[i].Liveness, positions[i].StatusOverride, now)
+
+		allUptimePercentage, weeklyUptimePercentage, err := uptimeCalc.GetUptimePercentages(ctx, positions[i].OperatorAddress, positions[i].CreatedAt)
+		if err != nil {
+			continue
+		}
+		positions[i].AllUptimePercentage = allUptimePercentage
+		positions[i].WeeklyUptimePercentage = weeklyUptimePercentage
+	}
+
+	return positions, nil
+}
+
+// AddReward credits an operator with reward points, standing in for the
+// records the reward service writes
+func (s *Store) AddReward(operator string, points int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rewards[strings.ToLower(operator)] += points
+}
+
+func (s *Store) sortedClients(less func(a, b database.ClientInfo) bool) []database.ClientInfo {
+	s.mu.RLock()
+	clients := make([]database.ClientInfo, 0, len(s.clients))
+	for _, client := range s.clients {
+		clients = append(clients, *client)
+	}
+	s.mu.RUnlock()
+
+	sort.SliceStable(clients, func(i, j int) bool {
+		return less(clients[i], clients[j])
+	})
+	return clients
+}
+
+func (s *Store) eachHeartbeat(tr database.TimeRange, fn func(database.HeartbeatRecord)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, heartbeat := range s.heartbeats {
+		if !tr.From.IsZero() && heartbeat.Timestamp.Before(tr.From) {
+			continue
+		}
+		if !tr.To.IsZero() && !heartbeat.Timestamp.Before(tr.To) {
+			break
+		}
+		fn(heartbeat)
+	}
+}
+
+func (s *Store) filterDelegations(keep func(database.DelegationRecord) bool) []database.DelegationRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var delegations []database.DelegationRecord
+	for _, delegation := range s.delegations {
+		if keep(delegation) {
+			delegations = append(delegations, delegation)
+		}
+	}
+	sort.Slice(delegations, func(i, j int) bool {
+		if !delegations[i].Timestamp.Equal(delegations[j].Timestamp) {
+			return delegations[i].Timestamp.Before(delegations[j].Timestamp)
+		}
+		if delegations[i].ToAddress != delegations[j].ToAddress {
+			return delegations[i].ToAddress < delegations[j].ToAddress
+		}
+		return delegations[i].FromAddress < delegations[j].FromAddress
+	})
+	return delegations
+}
@@ -0,0 +1,16 @@
+package memory_test
+
+import (
+	"testing"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/database/memory"
+	"monitoring-service/internal/database/storetest"
+	"monitoring-service/internal/logging"
+)
+
+func TestStore(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) database.Store {
+		return memory.New(logging.Discard())
+	})
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/uptime"
+)
+
+func (s *Store) SetUptimePolicy(policy uptime.Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uptimePolicy = policy
+}
+
+func (s *Store) currentUptimePolicy() uptime.Policy {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.uptimePolicy == "" {
+		return uptime.PolicyPush
+	}
+	return s.uptimePolicy
+}
+
+func (s *Store) SetProbeURL(ctx context.Context, address, url string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[strings.ToLower(address)]
+	if !ok {
+		return false, nil
+	}
+	client.ProbeURL = url
+	return true, nil
+}
+
+func (s *Store) GetProbeTargets(ctx context.Context) (map[string]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	targets := make(map[string]string)
+	for address, client := range s.clients {
+		if client.ProbeURL != "" {
+			targets[address] = client.ProbeURL
+		}
+	}
+	return targets, nil
+}
+
+func (s *Store) AddProbe(ctx context.Context, probe database.ProbeRecord) error {
+	probe.ClientAddress = strings.ToLower(probe.ClientAddress)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.probes = append(s.probes, probe)
+	return nil
+}
+
+func (s *Store) GetProbes(ctx context.Context, address string, since time.Time) ([]database.ProbeRecord, error) {
+	address = strings.ToLower(address)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	probes := []database.ProbeRecord{}
+	for _, probe := range s.probes {
+		if probe.ClientAddress == address && !probe.Timestamp.Before(since) {
+			probes = append(probes, probe)
+		}
+	}
+	return probes, nil
+}
+
+func (s *Store) CountProbeIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration) (int64, error) {
+	return int64(len(s.probeBuckets(clientAddress, since, interval))), nil
+}
+
+func (s *Store) CountCombinedIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration, requireBoth bool) (int64, error) {
+	heartbeats := s.heartbeatBuckets(clientAddress, since, interval)
+	probes := s.probeBuckets(clientAddress, since, interval)
+
+	if requireBoth {
+		var count int64
+		for bucket := range heartbeats {
+			if _, ok := probes[bucket]; ok {
+				count++
+			}
+		}
+		return count, nil
+	}
+
+	for bucket := range probes {
+		heartbeats[bucket] = struct{}{}
+	}
+	return int64(len(heartbeats)), nil
+}
+
+// probeBuckets returns the intervals with a successful probe
+func (s *Store) probeBuckets(clientAddress string, since time.Time, interval time.Duration) map[int64]struct{} {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buckets := make(map[int64]struct{})
+	for _, probe := range s.probes {
+		if probe.ClientAddress == clientAddress && probe.Success && !probe.Timestamp.Before(since) {
+			buckets[probe.Timestamp.UnixMilli()/interval.Milliseconds()] = struct{}{}
+		}
+	}
+	return buckets
+}
@@ -0,0 +1,283 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CollectionName is where applied migrations are recorded
+const CollectionName = "schema_migrations"
+
+// lockID is the schema_migrations document held while migrations run
+const lockID = "lock"
+
+// lockTimeout is how long a lock may be held before another run may take it
+// over, in case the process holding it died
+const lockTimeout = 15 * time.Minute
+
+// ErrLocked is returned when another process is migrating the database
+var ErrLocked = errors.New("migrations are locked by another process")
+
+// ErrIrreversible is returned when rolling back a migration without a Down step
+var ErrIrreversible = errors.New("migration cannot be rolled back")
+
+// Migration is one versioned schema change. Up must be safe to re-run
+// against a database where the change was made before migrations were
+// tracked. Down may be nil for changes that cannot be undone.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, db *mongo.Database) error
+	Down    func(ctx context.Context, db *mongo.Database) error
+}
+
+// Status is a migration and when it was applied, if it was
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+type appliedMigration struct {
+	Version   int       `bson:"_id"`
+	Name      string    `bson:"name"`
+	AppliedAt time.Time `bson:"applied_at"`
+}
+
+// ledger records which migrations are applied and holds the migration lock
+type ledger interface {
+	applied(ctx context.Context) (map[int]appliedMigration, error)
+	record(ctx context.Context, migration appliedMigration) error
+	remove(ctx context.Context, version int) error
+	// lock takes the lock for owner, or over from a holder that took it
+	// before staleBefore. It returns ErrLocked while another owner holds it.
+	lock(ctx context.Context, owner string, now, staleBefore time.Time) error
+	unlock(ctx context.Context) error
+}
+
+// Migrator applies and rolls back migrations against a database
+type Migrator struct {
+	db         *mongo.Database
+	ledger     ledger
+	migrations []Migration
+	logger     *slog.Logger
+	now        func() time.Time
+}
+
+// New creates a migrator for the given migrations, which are sorted by version
+func New(db *mongo.Database, migrations []Migration, logger *slog.Logger) *Migrator {
+	return newMigrator(db, mongoLedger{db.Collection(CollectionName)}, migrations, logger)
+}
+
+func newMigrator(db *mongo.Database, l ledger, migrations []Migration, logger *slog.Logger) *Migrator {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	return &Migrator{
+		db:         db,
+		ledger:     l,
+		migrations: sorted,
+		logger:     logger,
+		now:        time.Now,
+	}
+}
+
+// Latest returns the highest known migration version
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Status lists every known migration with when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied, err := m.ledger.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		status := Status{Version: migration.Version, Name: migration.Name}
+		if record, ok := applied[migration.Version]; ok {
+			appliedAt := record.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations that have not been applied, in order
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	applied, err := m.ledger.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, migration := range m.migrations {
+		if _, ok := applied[migration.Version]; !ok {
+			pending = append(pending, migration)
+		}
+	}
+	return pending, nil
+}
+
+// Up applies pending migrations up to and including target, or all of them
+// when target is 0. It returns the migrations it applied.
+func (m *Migrator) Up(ctx context.Context, target int) ([]Migration, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	pending, err := m.Pending(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, migration := range pending {
+		if target > 0 && migration.Version > target {
+			break
+		}
+
+		m.logger.InfoContext(ctx, "Applying migration", "version", migration.Version, "name", migration.Name)
+		if err := migration.Up(ctx, m.db); err != nil {
+			return done, fmt.Errorf("migration %d %s failed: %v", migration.Version, migration.Name, err)
+		}
+
+		err := m.ledger.record(ctx, appliedMigration{
+			Version:   migration.Version,
+			Name:      migration.Name,
+			AppliedAt: m.now(),
+		})
+		if err != nil {
+			return done, fmt.Errorf("failed to record migration %d: %v", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// Down rolls back the given number of most recently applied migrations and
+// returns the migrations it rolled back
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	if err := m.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	applied, err := m.ledger.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		migration := m.migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+		if migration.Down == nil {
+			return done, fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, ErrIrreversible)
+		}
+
+		m.logger.InfoContext(ctx, "Rolling back migration", "version", migration.Version, "name", migration.Name)
+		if err := migration.Down(ctx, m.db); err != nil {
+			return done, fmt.Errorf("rollback of migration %d %s failed: %v", migration.Version, migration.Name, err)
+		}
+
+		if err := m.ledger.remove(ctx, migration.Version); err != nil {
+			return done, fmt.Errorf("failed to record rollback of migration %d: %v", migration.Version, err)
+		}
+		done = append(done, migration)
+	}
+	return done, nil
+}
+
+// lock takes the migration lock so concurrent deploys do not migrate twice.
+// A lock older than lockTimeout is considered abandoned and taken over.
+func (m *Migrator) lock(ctx context.Context) error {
+	host, _ := os.Hostname()
+	now := m.now()
+	return m.ledger.lock(ctx, fmt.Sprintf("%s/%d", host, os.Getpid()), now, now.Add(-lockTimeout))
+}
+
+func (m *Migrator) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := m.ledger.unlock(ctx); err != nil {
+		m.logger.Error("Failed to release migration lock", "error", err)
+	}
+}
+
+// mongoLedger keeps the ledger in the schema_migrations collection: a
+// document per applied migration keyed by its version, and the lock
+// document
+type mongoLedger struct {
+	collection *mongo.Collection
+}
+
+func (l mongoLedger) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	cursor, err := l.collection.Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var records []appliedMigration
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+
+	applied := make(map[int]appliedMigration, len(records))
+	for _, record := range records {
+		applied[record.Version] = record
+	}
+	return applied, nil
+}
+
+func (l mongoLedger) record(ctx context.Context, migration appliedMigration) error {
+	_, err := l.collection.InsertOne(ctx, migration)
+	return err
+}
+
+func (l mongoLedger) remove(ctx context.Context, version int) error {
+	_, err := l.collection.DeleteOne(ctx, bson.M{"_id": version})
+	return err
+}
+
+// lock upserts the lock document. While another owner holds a lock newer
+// than staleBefore the filter does not match it, and the upsert fails on
+// its _id.
+func (l mongoLedger) lock(ctx context.Context, owner string, now, staleBefore time.Time) error {
+	_, err := l.collection.UpdateOne(ctx,
+		bson.M{"_id": lockID, "acquired_at": bson.M{"$lt": staleBefore}},
+		bson.M{"$set": bson.M{"owner": owner, "acquired_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	return err
+}
+
+func (l mongoLedger) unlock(ctx context.Context) error {
+	_, err := l.collection.DeleteOne(ctx, bson.M{"_id": lockID})
+	return err
+}
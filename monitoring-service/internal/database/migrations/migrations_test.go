@@ -0,0 +1,424 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"monitoring-service/internal/logging"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// fakeLedger keeps the ledger in memory, shared by the migrators of one test
+// as schema_migrations is by the service's replicas
+type fakeLedger struct {
+	mu        sync.Mutex
+	records   map[int]appliedMigration
+	owner     string
+	lockedAt  time.Time
+	locks     int
+	unlocks   int
+	recordErr error
+}
+
+func newFakeLedger() *fakeLedger {
+	return &fakeLedger{records: make(map[int]appliedMigration)}
+}
+
+func (l *fakeLedger) applied(ctx context.Context) (map[int]appliedMigration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	applied := make(map[int]appliedMigration, len(l.records))
+	for version, record := range l.records {
+		applied[version] = record
+	}
+	return applied, nil
+}
+
+func (l *fakeLedger) record(ctx context.Context, migration appliedMigration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.recordErr != nil {
+		return l.recordErr
+	}
+	l.records[migration.Version] = migration
+	return nil
+}
+
+func (l *fakeLedger) remove(ctx context.Context, version int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.records, version)
+	return nil
+}
+
+func (l *fakeLedger) lock(ctx context.Context, owner string, now, staleBefore time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.owner != "" && !l.lockedAt.Before(staleBefore) {
+		return ErrLocked
+	}
+	l.owner, l.lockedAt = owner, now
+	l.locks++
+	return nil
+}
+
+func (l *fakeLedger) unlock(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.owner = ""
+	l.unlocks++
+	return nil
+}
+
+func (l *fakeLedger) locked() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.owner != ""
+}
+
+// schema builds migrations that add and remove their version from state, in
+// place of the collections and indexes a real migration changes
+type schema struct {
+	mu    sync.Mutex
+	state map[int]bool
+	// ran lists migrations as they run, negative for a rollback
+	ran []int
+}
+
+func newSchema() *schema {
+	return &schema{state: make(map[int]bool)}
+}
+
+func (s *schema) migration(version int) Migration {
+	return Migration{
+		Version: version,
+		Name:    "migration",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.state[version] = true
+			s.ran = append(s.ran, version)
+			return nil
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(s.state, version)
+			s.ran = append(s.ran, -version)
+			return nil
+		},
+	}
+}
+
+func (s *schema) migrations(versions ...int) []Migration {
+	migrations := make([]Migration, len(versions))
+	for i, version := range versions {
+		migrations[i] = s.migration(version)
+	}
+	return migrations
+}
+
+func newTestMigrator(l ledger, migrations []Migration) *Migrator {
+	m := newMigrator(nil, l, migrations, logging.Discard())
+	m.now = func() time.Time { return start }
+	return m
+}
+
+func versions(migrations []Migration) []int {
+	var versions []int
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	return versions
+}
+
+func TestUp(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("InOrder", func(t *testing.T) {
+		s := newSchema()
+		l := newFakeLedger()
+		// Listed out of order, applied by version
+		m := newTestMigrator(l, s.migrations(3, 1, 2))
+
+		if m.Latest() != 3 {
+			t.Errorf("Latest = %d, want 3", m.Latest())
+		}
+		applied, err := m.Up(ctx, 0)
+		if err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+		if got := versions(applied); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+			t.Errorf("applied %v, want [1 2 3]", got)
+		}
+		if !reflect.DeepEqual(s.ran, []int{1, 2, 3}) {
+			t.Errorf("ran %v, want [1 2 3]", s.ran)
+		}
+		if l.locked() || l.locks != 1 || l.unlocks != 1 {
+			t.Errorf("lock taken %d times and released %d times, want once each", l.locks, l.unlocks)
+		}
+
+		// Nothing is left to apply
+		applied, err = m.Up(ctx, 0)
+		if err != nil || len(applied) != 0 {
+			t.Errorf("second Up = %v, %v; want nothing applied", versions(applied), err)
+		}
+	})
+
+	t.Run("Target", func(t *testing.T) {
+		s := newSchema()
+		m := newTestMigrator(newFakeLedger(), s.migrations(1, 2, 3))
+
+		applied, err := m.Up(ctx, 2)
+		if err != nil || !reflect.DeepEqual(versions(applied), []int{1, 2}) {
+			t.Fatalf("Up to 2 = %v, %v; want [1 2]", versions(applied), err)
+		}
+		pending, err := m.Pending(ctx)
+		if err != nil || !reflect.DeepEqual(versions(pending), []int{3}) {
+			t.Errorf("Pending = %v, %v; want [3]", versions(pending), err)
+		}
+	})
+
+	t.Run("SkipsApplied", func(t *testing.T) {
+		s := newSchema()
+		l := newFakeLedger()
+		// A migration added between two that shipped still runs
+		if _, err := newTestMigrator(l, s.migrations(1, 3)).Up(ctx, 0); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+		applied, err := newTestMigrator(l, s.migrations(1, 2, 3)).Up(ctx, 0)
+		if err != nil || !reflect.DeepEqual(versions(applied), []int{2}) {
+			t.Errorf("Up = %v, %v; want [2]", versions(applied), err)
+		}
+	})
+
+	t.Run("StopsAtFailure", func(t *testing.T) {
+		s := newSchema()
+		l := newFakeLedger()
+		failing := s.migration(2)
+		failing.Up = func(ctx context.Context, db *mongo.Database) error {
+			return errors.New("index build failed")
+		}
+		m := newTestMigrator(l, []Migration{s.migration(1), failing, s.migration(3)})
+
+		applied, err := m.Up(ctx, 0)
+		if err == nil || err.Error() != "migration 2 migration failed: index build failed" {
+			t.Errorf("Up error = %v, want migration 2's failure", err)
+		}
+		if !reflect.DeepEqual(versions(applied), []int{1}) || !reflect.DeepEqual(s.ran, []int{1}) {
+			t.Errorf("applied %v and ran %v, want only [1]", versions(applied), s.ran)
+		}
+		if l.locked() {
+			t.Error("lock held after a failed migration")
+		}
+
+		pending, _ := m.Pending(ctx)
+		if !reflect.DeepEqual(versions(pending), []int{2, 3}) {
+			t.Errorf("Pending = %v, want [2 3]", versions(pending))
+		}
+	})
+
+	t.Run("RecordFails", func(t *testing.T) {
+		s := newSchema()
+		l := newFakeLedger()
+		l.recordErr = errors.New("connection reset")
+		m := newTestMigrator(l, s.migrations(1, 2))
+
+		applied, err := m.Up(ctx, 0)
+		if err == nil || len(applied) != 0 {
+			t.Errorf("Up = %v, %v; want an error and nothing recorded", versions(applied), err)
+		}
+		if l.locked() {
+			t.Error("lock held after failing to record a migration")
+		}
+	})
+}
+
+func TestDown(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("RoundTrip", func(t *testing.T) {
+		s := newSchema()
+		l := newFakeLedger()
+		m := newTestMigrator(l, s.migrations(1, 2, 3))
+		if _, err := m.Up(ctx, 0); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+
+		reverted, err := m.Down(ctx, 2)
+		if err != nil || !reflect.DeepEqual(versions(reverted), []int{3, 2}) {
+			t.Fatalf("Down 2 = %v, %v; want [3 2]", versions(reverted), err)
+		}
+		if !reflect.DeepEqual(s.state, map[int]bool{1: true}) {
+			t.Errorf("schema after Down = %v, want only 1", s.state)
+		}
+		pending, _ := m.Pending(ctx)
+		if !reflect.DeepEqual(versions(pending), []int{2, 3}) {
+			t.Errorf("Pending = %v, want [2 3]", versions(pending))
+		}
+
+		applied, err := m.Up(ctx, 0)
+		if err != nil || !reflect.DeepEqual(versions(applied), []int{2, 3}) {
+			t.Fatalf("Up after Down = %v, %v; want [2 3]", versions(applied), err)
+		}
+		if want := []int{1, 2, 3, -3, -2, 2, 3}; !reflect.DeepEqual(s.ran, want) {
+			t.Errorf("ran %v, want %v", s.ran, want)
+		}
+		if !reflect.DeepEqual(s.state, map[int]bool{1: true, 2: true, 3: true}) {
+			t.Errorf("schema after round trip = %v, want 1, 2 and 3", s.state)
+		}
+		if l.locked() || l.locks != 3 || l.unlocks != 3 {
+			t.Errorf("lock taken %d times and released %d times, want 3 each", l.locks, l.unlocks)
+		}
+	})
+
+	t.Run("MoreStepsThanApplied", func(t *testing.T) {
+		s := newSchema()
+		m := newTestMigrator(newFakeLedger(), s.migrations(1, 2, 3))
+		if _, err := m.Up(ctx, 2); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+
+		// Migration 3 was never applied, so is not rolled back
+		reverted, err := m.Down(ctx, 5)
+		if err != nil || !reflect.DeepEqual(versions(reverted), []int{2, 1}) {
+			t.Errorf("Down 5 = %v, %v; want [2 1]", versions(reverted), err)
+		}
+		if len(s.state) != 0 {
+			t.Errorf("schema after Down = %v, want empty", s.state)
+		}
+	})
+
+	t.Run("Irreversible", func(t *testing.T) {
+		s := newSchema()
+		l := newFakeLedger()
+		irreversible := s.migration(2)
+		irreversible.Down = nil
+		m := newTestMigrator(l, []Migration{s.migration(1), irreversible, s.migration(3)})
+		if _, err := m.Up(ctx, 0); err != nil {
+			t.Fatalf("Up: %v", err)
+		}
+
+		reverted, err := m.Down(ctx, 3)
+		if !errors.Is(err, ErrIrreversible) {
+			t.Errorf("Down error = %v, want ErrIrreversible", err)
+		}
+		// Rolling back stops before the irreversible migration
+		if !reflect.DeepEqual(versions(reverted), []int{3}) || !reflect.DeepEqual(s.state, map[int]bool{1: true, 2: true}) {
+			t.Errorf("reverted %v leaving %v, want [3] leaving 1 and 2", versions(reverted), s.state)
+		}
+		if l.locked() {
+			t.Error("lock held after a failed rollback")
+		}
+	})
+}
+
+func TestStatus(t *testing.T) {
+	ctx := context.Background()
+	s := newSchema()
+	m := newTestMigrator(newFakeLedger(), s.migrations(1, 2))
+	if _, err := m.Up(ctx, 1); err != nil {
+		t.Fatalf("Up: %v", err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status: %v", err)
+	}
+	appliedAt := start
+	want := []Status{
+		{Version: 1, Name: "migration", AppliedAt: &appliedAt},
+		{Version: 2, Name: "migration"},
+	}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("Status = %+v, want %+v", statuses, want)
+	}
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Contention", func(t *testing.T) {
+		s := newSchema()
+		l := newFakeLedger()
+
+		// The first replica is in the middle of migration 1
+		inMigration, finish := make(chan struct{}), make(chan struct{})
+		slow := s.migration(1)
+		up := slow.Up
+		slow.Up = func(ctx context.Context, db *mongo.Database) error {
+			close(inMigration)
+			<-finish
+			return up(ctx, db)
+		}
+		first := newTestMigrator(l, []Migration{slow, s.migration(2)})
+		second := newTestMigrator(l, s.migrations(1, 2))
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := first.Up(ctx, 0)
+			done <- err
+		}()
+		<-inMigration
+
+		if applied, err := second.Up(ctx, 0); err != ErrLocked || len(applied) != 0 {
+			t.Errorf("Up while locked = %v, %v; want ErrLocked", versions(applied), err)
+		}
+		if reverted, err := second.Down(ctx, 1); err != ErrLocked || len(reverted) != 0 {
+			t.Errorf("Down while locked = %v, %v; want ErrLocked", versions(reverted), err)
+		}
+
+		close(finish)
+		if err := <-done; err != nil {
+			t.Fatalf("first Up: %v", err)
+		}
+
+		// Once the lock is released the second replica finds nothing to do
+		applied, err := second.Up(ctx, 0)
+		if err != nil || len(applied) != 0 {
+			t.Errorf("Up after the lock was released = %v, %v; want nothing applied", versions(applied), err)
+		}
+		if !reflect.DeepEqual(s.ran, []int{1, 2}) {
+			t.Errorf("ran %v, want each migration once", s.ran)
+		}
+	})
+
+	t.Run("StaleLockTakenOver", func(t *testing.T) {
+		s := newSchema()
+		l := newFakeLedger()
+		// A process died holding the lock
+		l.owner, l.lockedAt = "crashed/1", start
+
+		m := newTestMigrator(l, s.migrations(1))
+		m.now = func() time.Time { return start.Add(lockTimeout - time.Second) }
+		if _, err := m.Up(ctx, 0); err != ErrLocked {
+			t.Errorf("Up before the lock timed out = %v, want ErrLocked", err)
+		}
+
+		m.now = func() time.Time { return start.Add(lockTimeout + time.Second) }
+		applied, err := m.Up(ctx, 0)
+		if err != nil || !reflect.DeepEqual(versions(applied), []int{1}) {
+			t.Errorf("Up after the lock timed out = %v, %v; want [1]", versions(applied), err)
+		}
+		if l.locked() {
+			t.Error("lock held after Up")
+		}
+	})
+}
+
+func TestAll(t *testing.T) {
+	for i, migration := range All {
+		if migration.Version != i+1 {
+			t.Errorf("migration %d %s has version %d; versions must run 1, 2, 3 and so on", i, migration.Name, migration.Version)
+		}
+		if migration.Name == "" || migration.Up == nil {
+			t.Errorf("migration %d needs a name and an Up step", migration.Version)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"monitoring-service/internal/uptime"
+)
+
+// All is the service's schema history. Append new migrations with the next
+// version; never edit or renumber one that has shipped.
+var All = []Migration{
+	{
+		Version: 1,
+		Name:    "create_heartbeats_timeseries",
+		Up:      createHeartbeatsTimeSeries,
+		// Dropping the collection would delete all uptime history
+		Down: nil,
+	},
+	{
+		Version: 2,
+		Name:    "clients_address_unique_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("clients"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "address", Value: 1}},
+				Options: options.Index().SetName("address_1").SetUnique(true),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndex(ctx, db.Collection("clients"), "address_1")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "lowercase_legacy_addresses",
+		Up:      lowercaseLegacyAddresses,
+		// The original casing is not kept
+		Down: nil,
+	},
+	{
+		Version: 4,
+		Name:    "delegations_address_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("delegations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "to_address", Value: 1}, {Key: "from_address", Value: 1}},
+					Options: options.Index().SetName("to_address_1_from_address_1"),
+				},
+				{
+					Keys:    bson.D{{Key: "from_address", Value: 1}},
+					Options: options.Index().SetName("from_address_1"),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndex(ctx, db.Collection("delegations"), "to_address_1_from_address_1"); err != nil {
+				return err
+			}
+			return dropIndex(ctx, db.Collection("delegations"), "from_address_1")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "heartbeat_coverage_index",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("heartbeat_coverage"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "client_address", Value: 1}, {Key: "interval_start", Value: 1}},
+				Options: options.Index().SetName("client_address_1_interval_start_1").SetUnique(true),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndex(ctx, db.Collection("heartbeat_coverage"), "client_address_1_interval_start_1")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "admin_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			if err := createIndex(ctx, db.Collection("blacklist"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "address", Value: 1}},
+				Options: options.Index().SetName("address_1").SetUnique(true),
+			}); err != nil {
+				return err
+			}
+			if err := createIndex(ctx, db.Collection("incidents"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "client_address", Value: 1}, {Key: "started_at", Value: -1}},
+				Options: options.Index().SetName("client_address_1_started_at_-1"),
+			}); err != nil {
+				return err
+			}
+			return createIndex(ctx, db.Collection("audit_log"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "timestamp", Value: -1}},
+				Options: options.Index().SetName("timestamp_-1"),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndex(ctx, db.Collection("blacklist"), "address_1"); err != nil {
+				return err
+			}
+			if err := dropIndex(ctx, db.Collection("incidents"), "client_address_1_started_at_-1"); err != nil {
+				return err
+			}
+			return dropIndex(ctx, db.Collection("audit_log"), "timestamp_-1")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "client_sources_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("client_sources").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "client_address", Value: 1}, {Key: "ip", Value: 1}},
+					Options: options.Index().SetName("client_address_1_ip_1").SetUnique(true),
+				},
+				{
+					Keys:    bson.D{{Key: "last_seen", Value: 1}},
+					Options: options.Index().SetName("last_seen_1"),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndex(ctx, db.Collection("client_sources"), "client_address_1_ip_1"); err != nil {
+				return err
+			}
+			return dropIndex(ctx, db.Collection("client_sources"), "last_seen_1")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "rate_limits_ttl",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("rate_limits"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "expires_at", Value: 1}},
+				Options: options.Index().SetName("expires_at_ttl").SetExpireAfterSeconds(0),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndex(ctx, db.Collection("rate_limits"), "expires_at_ttl")
+		},
+	},
+	{
+		Version: 9,
+		Name:    "probes_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("probes").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "client_address", Value: 1}, {Key: "timestamp", Value: 1}},
+					Options: options.Index().SetName("client_address_1_timestamp_1"),
+				},
+				{
+					// Probes are only needed for the longest uptime window
+					Keys:    bson.D{{Key: "timestamp", Value: 1}},
+					Options: options.Index().SetName("timestamp_ttl").SetExpireAfterSeconds(int32(uptime.MaxAllTimeHistoryDuration / time.Second)),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndex(ctx, db.Collection("probes"), "client_address_1_timestamp_1"); err != nil {
+				return err
+			}
+			return dropIndex(ctx, db.Collection("probes"), "timestamp_ttl")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "version_history_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndex(ctx, db.Collection("version_history"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "client_address", Value: 1}, {Key: "timestamp", Value: 1}},
+				Options: options.Index().SetName("client_address_1_timestamp_1"),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			return dropIndex(ctx, db.Collection("version_history"), "client_address_1_timestamp_1")
+		},
+	},
+	{
+		Version: 11,
+		Name:    "delegations_pair_unique_index",
+		// Concurrent heartbeats upsert the same delegation; a unique pair
+		// lets the server retry the losing upsert instead of inserting twice
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			collection := db.Collection("delegations")
+			if err := dedupeDelegations(ctx, collection); err != nil {
+				return err
+			}
+			if err := dropIndex(ctx, collection, "to_address_1_from_address_1"); err != nil {
+				return err
+			}
+			return createIndex(ctx, collection, mongo.IndexModel{
+				Keys:    bson.D{{Key: "to_address", Value: 1}, {Key: "from_address", Value: 1}},
+				Options: options.Index().SetName("to_address_1_from_address_1").SetUnique(true),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			collection := db.Collection("delegations")
+			if err := dropIndex(ctx, collection, "to_address_1_from_address_1"); err != nil {
+				return err
+			}
+			return createIndex(ctx, collection, mongo.IndexModel{
+				Keys:    bson.D{{Key: "to_address", Value: 1}, {Key: "from_address", Value: 1}},
+				Options: options.Index().SetName("to_address_1_from_address_1"),
+			})
+		},
+	},
+	{
+		Version: 12,
+		Name:    "heartbeat_claims_indexes",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			_, err := db.Collection("heartbeat_claims").Indexes().CreateMany(ctx, []mongo.IndexModel{
+				{
+					Keys:    bson.D{{Key: "address", Value: 1}, {Key: "key", Value: 1}},
+					Options: options.Index().SetName("address_1_key_1").SetUnique(true),
+				},
+				{
+					// Responses are replayed for a day, database.ClaimRetention
+					Keys:    bson.D{{Key: "claimed_at", Value: 1}},
+					Options: options.Index().SetName("claimed_at_ttl").SetExpireAfterSeconds(int32(24 * time.Hour / time.Second)),
+				},
+			})
+			return err
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			if err := dropIndex(ctx, db.Collection("heartbeat_claims"), "address_1_key_1"); err != nil {
+				return err
+			}
+			return dropIndex(ctx, db.Collection("heartbeat_claims"), "claimed_at_ttl")
+		},
+	},
+	{
+		Version: 13,
+		Name:    "audit_log_ttl_index",
+		// Entries expire after a year, database.AuditRetention. The TTL index
+		// replaces the plain one and also serves the newest-first sort.
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			collection := db.Collection("audit_log")
+			if err := dropIndex(ctx, collection, "timestamp_-1"); err != nil {
+				return err
+			}
+			return createIndex(ctx, collection, mongo.IndexModel{
+				Keys:    bson.D{{Key: "timestamp", Value: -1}},
+				Options: options.Index().SetName("timestamp_ttl").SetExpireAfterSeconds(int32(365 * 24 * time.Hour / time.Second)),
+			})
+		},
+		Down: func(ctx context.Context, db *mongo.Database) error {
+			collection := db.Collection("audit_log")
+			if err := dropIndex(ctx, collection, "timestamp_ttl"); err != nil {
+				return err
+			}
+			return createIndex(ctx, collection, mongo.IndexModel{
+				Keys:    bson.D{{Key: "timestamp", Value: -1}},
+				Options: options.Index().SetName("timestamp_-1"),
+			})
+		},
+	},
+}
+
+func createHeartbeatsTimeSeries(ctx context.Context, db *mongo.Database) error {
+	collections, err := db.ListCollectionNames(ctx, bson.M{"name": "heartbeats"})
+	if err != nil {
+		return fmt.Errorf("failed to list collections: %v", err)
+	}
+	// Databases created before migrations already have it
+	if len(collections) > 0 {
+		return nil
+	}
+
+	return db.CreateCollection(ctx, "heartbeats", options.CreateCollection().SetTimeSeriesOptions(
+		options.TimeSeries().
+			SetTimeField("timestamp").
+			SetMetaField("client_address").
+			SetGranularity("minutes"),
+	))
+}
+
+// lowercaseLegacyAddresses normalises addresses written before the service
+// lowercased them. Where a lowercase record already exists it is the one the
+// service has been updating, so the legacy duplicate is removed instead.
+func lowercaseLegacyAddresses(ctx context.Context, db *mongo.Database) error {
+	if err := lowercaseField(ctx, db.Collection("clients"), "address", true); err != nil {
+		return err
+	}
+	if err := lowercaseField(ctx, db.Collection("clients"), "reward_collector_address", false); err != nil {
+		return err
+	}
+	if err := lowercaseDelegations(ctx, db.Collection("delegations")); err != nil {
+		return err
+	}
+
+	// Time-series collections only allow updating the meta field with
+	// update operators, so rewrite one address at a time
+	heartbeats := db.Collection("heartbeats")
+	addresses, err := heartbeats.Distinct(ctx, "client_address", upperCaseFilter("client_address"))
+	if err != nil {
+		return err
+	}
+	for _, value := range addresses {
+		address, ok := value.(string)
+		if !ok {
+			continue
+		}
+		_, err := heartbeats.UpdateMany(ctx,
+			bson.M{"client_address": address},
+			bson.M{"$set": bson.M{"client_address": strings.ToLower(address)}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func lowercaseField(ctx context.Context, collection *mongo.Collection, field string, unique bool) error {
+	cursor, err := collection.Find(ctx, upperCaseFilter(field))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc bson.M
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		value, _ := doc[field].(string)
+		lower := strings.ToLower(value)
+
+		if unique {
+			count, err := collection.CountDocuments(ctx, bson.M{field: lower})
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				if _, err := collection.DeleteOne(ctx, bson.M{"_id": doc["_id"]}); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+
+		if _, err := collection.UpdateOne(ctx, bson.M{"_id": doc["_id"]}, bson.M{"$set": bson.M{field: lower}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func lowercaseDelegations(ctx context.Context, collection *mongo.Collection) error {
+	cursor, err := collection.Find(ctx, bson.M{"$or": bson.A{
+		upperCaseFilter("from_address"),
+		upperCaseFilter("to_address"),
+	}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID          interface{} `bson:"_id"`
+			FromAddress string      `bson:"from_address"`
+			ToAddress   string      `bson:"to_address"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return err
+		}
+		from, to := strings.ToLower(doc.FromAddress), strings.ToLower(doc.ToAddress)
+
+		count, err := collection.CountDocuments(ctx, bson.M{"from_address": from, "to_address": to})
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			if _, err := collection.DeleteOne(ctx, bson.M{"_id": doc.ID}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		_, err = collection.UpdateOne(ctx,
+			bson.M{"_id": doc.ID},
+			bson.M{"$set": bson.M{"from_address": from, "to_address": to}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// dedupeDelegations keeps the newest record of each delegator and operator
+// pair
+func dedupeDelegations(ctx context.Context, collection *mongo.Collection) error {
+	cursor, err := collection.Aggregate(ctx, mongo.Pipeline{
+		bson.D{{Key: "$sort", Value: bson.D{{Key: "timestamp", Value: -1}}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{{Key: "to", Value: "$to_address"}, {Key: "from", Value: "$from_address"}}},
+			{Key: "ids", Value: bson.D{{Key: "$push", Value: "$_id"}}},
+		}}},
+		bson.D{{Key: "$match", Value: bson.D{{Key: "ids.1", Value: bson.D{{Key: "$exists", Value: true}}}}}},
+	})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var group struct {
+			IDs []interface{} `bson:"ids"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return err
+		}
+		if _, err := collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": group.IDs[1:]}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func upperCaseFilter(field string) bson.M {
+	return bson.M{field: primitive.Regex{Pattern: "[A-F]"}}
+}
+
+func createIndex(ctx context.Context, collection *mongo.Collection, model mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateOne(ctx, model)
+	return err
+}
+
+func dropIndex(ctx context.Context, collection *mongo.Collection, name string) error {
+	_, err := collection.Indexes().DropOne(ctx, name)
+	// Already gone
+	if cmdErr, ok := err.(mongo.CommandError); ok && cmdErr.Code == 27 {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"monitoring-service/internal/uptime"
+)
+
+// ProbeRecord is one call the prober made to a client's light client API
+type ProbeRecord struct {
+	ClientAddress string    `bson:"client_address" json:"client_address"`
+	Timestamp     time.Time `bson:"timestamp" json:"timestamp"`
+	Success       bool      `bson:"success" json:"success"`
+	// LatencyMs is how long the light client took to answer
+	LatencyMs  int64  `bson:"latency_ms" json:"latency_ms"`
+	StatusCode int    `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string `bson:"error,omitempty" json:"error,omitempty"`
+	// Version and LatestBlock are what the light client reported
+	Version     string `bson:"version,omitempty" json:"version,omitempty"`
+	LatestBlock uint64 `bson:"latest_block,omitempty" json:"latest_block,omitempty"`
+}
+
+// SetUptimePolicy sets which heartbeat sources count towards uptime
+func (d *Database) SetUptimePolicy(policy uptime.Policy) {
+	d.uptimePolicy.Store(policy)
+}
+
+func (d *Database) currentUptimePolicy() uptime.Policy {
+	policy, _ := d.uptimePolicy.Load().(uptime.Policy)
+	if policy == "" {
+		return uptime.PolicyPush
+	}
+	return policy
+}
+
+func (d *Database) SetProbeURL(ctx context.Context, address, url string) (bool, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	update := bson.M{"$unset": bson.M{"probe_url": ""}}
+	if url != "" {
+		update = bson.M{"$set": bson.M{"probe_url": url}}
+	}
+
+	result, err := d.clients.UpdateOne(ctx, bson.M{"address": strings.ToLower(address)}, update)
+	if err != nil {
+		return false, err
+	}
+	return result.MatchedCount > 0, nil
+}
+
+func (d *Database) GetProbeTargets(ctx context.Context) (map[string]string, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"address": 1, "probe_url": 1})
+	cursor, err := d.clients.Find(ctx, bson.M{"probe_url": bson.M{"$exists": true, "$ne": ""}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	targets := make(map[string]string)
+	for cursor.Next(ctx) {
+		var client ClientInfo
+		if err := cursor.Decode(&client); err != nil {
+			return nil, err
+		}
+		targets[client.Address] = client.ProbeURL
+	}
+	return targets, cursor.Err()
+}
+
+func (d *Database) AddProbe(ctx context.Context, probe ProbeRecord) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	probe.ClientAddress = strings.ToLower(probe.ClientAddress)
+	_, err := d.probes.InsertOne(ctx, probe)
+	return err
+}
+
+func (d *Database) GetProbes(ctx context.Context, address string, since time.Time) ([]ProbeRecord, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	cursor, err := d.probes.Find(ctx, bson.M{
+		"client_address": strings.ToLower(address),
+		"timestamp":      bson.M{"$gte": since},
+	}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	probes := []ProbeRecord{}
+	if err := cursor.All(ctx, &probes); err != nil {
+		return nil, err
+	}
+	return probes, nil
+}
+
+// CountProbeIntervals counts the distinct intervals since the given time
+// with at least one successful probe
+func (d *Database) CountProbeIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration) (int64, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "client_address", Value: clientAddress},
+			{Key: "success", Value: true},
+			{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: since}}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: intervalBucket("$timestamp", interval)},
+		}}},
+		bson.D{{Key: "$count", Value: "total_intervals"}},
+	}
+	return countIntervals(ctx, d.probes, pipeline)
+}
+
+// CountCombinedIntervals counts the distinct intervals since the given time
+// with a heartbeat, kept raw or compacted, or a successful probe. With
+// requireBoth only intervals that have both are counted.
+func (d *Database) CountCombinedIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration, requireBoth bool) (int64, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	source := func(name string, field string) bson.D {
+		return bson.D{{Key: "$project", Value: bson.D{
+			{Key: "interval_bucket", Value: intervalBucket(field, interval)},
+			{Key: "source", Value: bson.D{{Key: "$literal", Value: name}}},
+		}}}
+	}
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "client_address", Value: clientAddress},
+			{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: since}}},
+		}}},
+		source("push", "$timestamp"),
+
+		bson.D{{Key: "$unionWith", Value: bson.D{
+			{Key: "coll", Value: d.heartbeatCoverage.Name()},
+			{Key: "pipeline", Value: mongo.Pipeline{
+				bson.D{{Key: "$match", Value: coverageSince(clientAddress, since)}},
+				source("push", "$interval_start"),
+			}},
+		}}},
+
+		bson.D{{Key: "$unionWith", Value: bson.D{
+			{Key: "coll", Value: d.probes.Name()},
+			{Key: "pipeline", Value: mongo.Pipeline{
+				bson.D{{Key: "$match", Value: bson.D{
+					{Key: "client_address", Value: clientAddress},
+					{Key: "success", Value: true},
+					{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: since}}},
+				}}},
+				source("pull", "$timestamp"),
+			}},
+		}}},
+
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: "$interval_bucket"},
+			{Key: "sources", Value: bson.D{{Key: "$addToSet", Value: "$source"}}},
+		}}},
+	}
+	if requireBoth {
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{
+			{Key: "sources.1", Value: bson.D{{Key: "$exists", Value: true}}},
+		}}})
+	}
+	pipeline = append(pipeline, bson.D{{Key: "$count", Value: "total_intervals"}})
+
+	return countIntervals(ctx, d.heartbeats, pipeline)
+}
+
+// intervalBucket is the index of the epoch aligned interval a date falls in
+func intervalBucket(field string, interval time.Duration) bson.D {
+	return bson.D{{Key: "$floor", Value: bson.D{
+		{Key: "$divide", Value: bson.A{
+			bson.D{{Key: "$toLong", Value: field}},
+			int64(interval / time.Millisecond),
+		}},
+	}}}
+}
+
+func countIntervals(ctx context.Context, collection *mongo.Collection, pipeline mongo.Pipeline) (int64, error) {
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetMaxTime(3*time.Second))
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var result struct {
+		TotalIntervals int64 `bson:"total_intervals"`
+	}
+	if cursor.Next(ctx) {
+		if err := cursor.Decode(&result); err != nil {
+			return 0, err
+		}
+	}
+	return result.TotalIntervals, cursor.Err()
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TakeToken removes one token from the shared token bucket for key, which
+// holds up to burst tokens and refills at rate tokens per second. The
+// refill and take happen in one update, so replicas sharing the database
+// share the bucket. When no token is left it returns how long until one is.
+func (d *Database) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, time.Duration, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	refilled := bson.M{"$min": bson.A{
+		float64(burst),
+		bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", float64(burst)}},
+			bson.M{"$multiply": bson.A{
+				rate,
+				bson.M{"$max": bson.A{
+					0,
+					bson.M{"$divide": bson.A{
+						bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}},
+						1000,
+					}},
+				}},
+			}},
+		}},
+	}}
+	// A replica whose clock is behind must not move the refill time back,
+	// or the next take would be credited the difference
+	updated := bson.M{"$max": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}}
+	// An idle bucket is full again after burst/rate seconds, so it can go
+	refillTime := time.Duration(float64(burst) / rate * float64(time.Second))
+
+	pipeline := bson.A{
+		bson.M{"$set": bson.M{"tokens": refilled, "updated_at": updated, "expires_at": now.Add(refillTime)}},
+		bson.M{"$set": bson.M{"allowed": bson.M{"$gte": bson.A{"$tokens", 1}}}},
+		bson.M{"$set": bson.M{"tokens": bson.M{"$cond": bson.A{"$allowed", bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}}}},
+	}
+
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := d.rateLimits.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&bucket)
+	if err != nil {
+		return false, 0, err
+	}
+
+	if bucket.Allowed {
+		return true, 0, nil
+	}
+	wait := math.Ceil((1 - bucket.Tokens) / rate * float64(time.Second))
+	return false, time.Duration(wait), nil
+}
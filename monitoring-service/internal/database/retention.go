@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"monitoring-service/internal/uptime"
+)
+
+// CoverageInterval is the resolution raw heartbeats are compacted to. Uptime
+// is counted in intervals of the same size, so compaction keeps it exact.
+const CoverageInterval = uptime.IntervalDuration
+
+// CompactionWindow is how much heartbeat history is compacted per step.
+// Progress is saved after every window, so an interrupted run resumes there.
+const CompactionWindow = 24 * time.Hour
+
+// HeartbeatCoverage records that a client heartbeated within one interval.
+// It replaces the raw heartbeats of that interval once they are compacted.
+type HeartbeatCoverage struct {
+	ClientAddress  string    `bson:"client_address"`
+	IntervalStart  time.Time `bson:"interval_start"`
+	Heartbeats     int64     `bson:"heartbeats"`
+	FirstHeartbeat time.Time `bson:"first_heartbeat"`
+	LastHeartbeat  time.Time `bson:"last_heartbeat"`
+}
+
+// CompactionReport describes what a compaction run did
+type CompactionReport struct {
+	From              time.Time `json:"from"`
+	To                time.Time `json:"to"`
+	Windows           int       `json:"windows"`
+	CoverageIntervals int64     `json:"coverage_intervals"`
+	HeartbeatsDeleted int64     `json:"heartbeats_deleted"`
+}
+
+type retentionState struct {
+	ID             string           `bson:"_id"`
+	CompactedUntil time.Time        `bson:"compacted_until"`
+	LastReport     CompactionReport `bson:"last_report"`
+	UpdatedAt      time.Time        `bson:"updated_at"`
+}
+
+const heartbeatRetentionStateID = "heartbeats"
+
+// CompactHeartbeats compacts raw heartbeats older than before into coverage
+// documents and deletes them, one CompactionWindow at a time. It resumes from
+// where the previous run stopped; re-running a window is harmless.
+func (d *Database) CompactHeartbeats(ctx context.Context, before time.Time) (CompactionReport, error) {
+	before = before.Truncate(CoverageInterval)
+	report := CompactionReport{To: before}
+
+	var state retentionState
+	err := d.retentionState.FindOne(ctx, bson.M{"_id": heartbeatRetentionStateID}).Decode(&state)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return report, err
+	}
+
+	start := state.CompactedUntil
+	if start.IsZero() {
+		var oldest HeartbeatRecord
+		err := d.heartbeats.FindOne(ctx, bson.M{}, options.FindOne().SetSort(bson.D{{Key: "timestamp", Value: 1}})).Decode(&oldest)
+		if err == mongo.ErrNoDocuments {
+			report.From = before
+			return report, nil
+		}
+		if err != nil {
+			return report, err
+		}
+		start = oldest.Timestamp.Truncate(CoverageInterval)
+	}
+	report.From = start
+
+	for windowStart := start; windowStart.Before(before); {
+		windowEnd := windowStart.Add(CompactionWindow)
+		if windowEnd.After(before) {
+			windowEnd = before
+		}
+
+		intervals, deleted, err := d.compactHeartbeatWindow(ctx, windowStart, windowEnd)
+		report.CoverageIntervals += intervals
+		report.HeartbeatsDeleted += deleted
+		if err != nil {
+			return report, err
+		}
+		report.Windows++
+
+		_, err = d.retentionState.UpdateOne(ctx,
+			bson.M{"_id": heartbeatRetentionStateID},
+			bson.M{"$set": bson.M{
+				"compacted_until": windowEnd,
+				"last_report":     report,
+				"updated_at":      time.Now(),
+			}},
+			options.Update().SetUpsert(true),
+		)
+		if err != nil {
+			return report, err
+		}
+		windowStart = windowEnd
+	}
+
+	return report, nil
+}
+
+func (d *Database) compactHeartbeatWindow(ctx context.Context, from, to time.Time) (int64, int64, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	intervalMillis := int64(CoverageInterval / time.Millisecond)
+
+	pipeline := mongo.Pipeline{
+		bson.D{{Key: "$match", Value: bson.D{
+			{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}}},
+		}}},
+		bson.D{{Key: "$group", Value: bson.D{
+			{Key: "_id", Value: bson.D{
+				{Key: "client_address", Value: "$client_address"},
+				{Key: "interval_start", Value: bson.D{{Key: "$toDate", Value: bson.D{{Key: "$subtract", Value: bson.A{
+					bson.D{{Key: "$toLong", Value: "$timestamp"}},
+					bson.D{{Key: "$mod", Value: bson.A{bson.D{{Key: "$toLong", Value: "$timestamp"}}, intervalMillis}}},
+				}}}}}},
+			}},
+			{Key: "heartbeats", Value: bson.D{{Key: "$sum", Value: 1}}},
+			{Key: "first_heartbeat", Value: bson.D{{Key: "$min", Value: "$timestamp"}}},
+			{Key: "last_heartbeat", Value: bson.D{{Key: "$max", Value: "$timestamp"}}},
+		}}},
+	}
+
+	cursor, err := d.heartbeats.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var models []mongo.WriteModel
+	for cursor.Next(ctx) {
+		var group struct {
+			ID struct {
+				ClientAddress string    `bson:"client_address"`
+				IntervalStart time.Time `bson:"interval_start"`
+			} `bson:"_id"`
+			Heartbeats     int64     `bson:"heartbeats"`
+			FirstHeartbeat time.Time `bson:"first_heartbeat"`
+			LastHeartbeat  time.Time `bson:"last_heartbeat"`
+		}
+		if err := cursor.Decode(&group); err != nil {
+			return 0, 0, err
+		}
+
+		// $min/$max keep a re-run of a partially deleted window from
+		// shrinking coverage that was already written
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{
+				"client_address": group.ID.ClientAddress,
+				"interval_start": group.ID.IntervalStart,
+			}).
+			SetUpdate(bson.M{
+				"$max": bson.M{"heartbeats": group.Heartbeats, "last_heartbeat": group.LastHeartbeat},
+				"$min": bson.M{"first_heartbeat": group.FirstHeartbeat},
+			}).
+			SetUpsert(true))
+	}
+	if err := cursor.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	if len(models) > 0 {
+		if _, err := d.heartbeatCoverage.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false)); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	result, err := d.heartbeats.DeleteMany(ctx, bson.M{
+		"timestamp": bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return int64(len(models)), 0, err
+	}
+	return int64(len(models)), result.DeletedCount, nil
+}
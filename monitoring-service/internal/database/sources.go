@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ClientSource is an IP address heartbeats for a client were sent from
+type ClientSource struct {
+	ClientAddress string    `bson:"client_address" json:"client_address"`
+	IP            string    `bson:"ip" json:"ip"`
+	FirstSeen     time.Time `bson:"first_seen" json:"first_seen"`
+	LastSeen      time.Time `bson:"last_seen" json:"last_seen"`
+	Heartbeats    int64     `bson:"heartbeats" json:"heartbeats"`
+}
+
+func (d *Database) RecordClientSource(ctx context.Context, address, ip string, seenAt time.Time) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	_, err := d.clientSources.UpdateOne(ctx,
+		bson.M{"client_address": strings.ToLower(address), "ip": ip},
+		bson.M{
+			"$min": bson.M{"first_seen": seenAt},
+			"$max": bson.M{"last_seen": seenAt},
+			"$inc": bson.M{"heartbeats": 1},
+		},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func (d *Database) GetClientSources(ctx context.Context, since time.Time) ([]ClientSource, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "ip", Value: 1}, {Key: "client_address", Value: 1}})
+	cursor, err := d.clientSources.Find(ctx, bson.M{"last_seen": bson.M{"$gte": since}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sources := []ClientSource{}
+	if err := cursor.All(ctx, &sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
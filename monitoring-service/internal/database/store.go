@@ -0,0 +1,171 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"monitoring-service/internal/uptime"
+)
+
+// ClientStore persists registered light clients
+type ClientStore interface {
+	// RegisterClient upserts the client and records a heartbeat when the
+	// operation points carry both an amount and a time
+	RegisterClient(ctx context.Context, address string, operationPoints OperationPointRecord, totalTime int64, operatorName string, rewardCollectorAddress string) error
+	// RecordHeartbeat registers the client or refreshes its record and
+	// records a heartbeat for the time since the previous one, safely under
+	// concurrent heartbeats for the same address. ErrHeartbeatIncomplete
+	// means the client was updated but its history was not.
+	RecordHeartbeat(ctx context.Context, address string, heartbeat ClientHeartbeat) error
+	ClientExists(ctx context.Context, address string) (bool, error)
+	// GetClient returns nil without error when the client does not exist
+	GetClient(ctx context.Context, address string) (*ClientInfo, error)
+	// GetAllClients returns every client, newest first, with uptime and status
+	GetAllClients(ctx context.Context) ([]ClientInfo, error)
+	GetLastHeartbeats(ctx context.Context) (map[string]time.Time, error)
+	// UpsertClient writes a client record as is, for imports and repairs.
+	// Derived fields (status and uptime) are not stored.
+	UpsertClient(ctx context.Context, client ClientInfo) error
+	// RecordClientSource notes that a heartbeat for the client was sent from ip
+	RecordClientSource(ctx context.Context, address, ip string, seenAt time.Time) error
+	// GetClientSources returns every client and source IP pair last seen
+	// since the given time
+	GetClientSources(ctx context.Context, since time.Time) ([]ClientSource, error)
+	// SetLiveness stores, or with nil clears, the light client's sync state
+	SetLiveness(ctx context.Context, address string, liveness *Liveness) error
+	// SetClientVersion stores, or with nil clears, the client's light client
+	// build, adding to its version history when the build changed
+	SetClientVersion(ctx context.Context, address string, version *ClientVersion) error
+	// GetVersionHistory returns a client's build changes, oldest first
+	GetVersionHistory(ctx context.Context, address string) ([]VersionChange, error)
+	// GetClientVersions returns the stored version of every client that has one
+	GetClientVersions(ctx context.Context) (map[string]ClientVersion, error)
+	StreamClients(ctx context.Context, tr TimeRange, fn func(ClientInfo) error) error
+}
+
+// HeartbeatStore persists the heartbeat time series
+type HeartbeatStore interface {
+	uptime.IntervalCounter
+
+	AddHeartbeat(ctx context.Context, heartbeat HeartbeatRecord) error
+	// GetHeartbeats returns a client's heartbeats since the given time, oldest first
+	GetHeartbeats(ctx context.Context, address string, since time.Time) ([]HeartbeatRecord, error)
+	StreamHeartbeats(ctx context.Context, address string, tr TimeRange, fn func(HeartbeatRecord) error) error
+	GetOperatorActivity(ctx context.Context, since time.Time) (map[string]OperatorActivity, error)
+	// CompactHeartbeats replaces raw heartbeats older than before with
+	// per-interval coverage, resuming from where the last run stopped
+	CompactHeartbeats(ctx context.Context, before time.Time) (CompactionReport, error)
+	// ClaimHeartbeat reserves an idempotency key for a heartbeat of address.
+	// It returns nil when the key is newly claimed, or the earlier claim.
+	ClaimHeartbeat(ctx context.Context, address, key string, now time.Time) (*HeartbeatClaim, error)
+	// CompleteHeartbeat stores the response to a claimed heartbeat
+	CompleteHeartbeat(ctx context.Context, address, key string, statusCode int, body []byte) error
+	// ReleaseHeartbeat drops an unanswered claim so the heartbeat can be retried
+	ReleaseHeartbeat(ctx context.Context, address, key string) error
+}
+
+// DelegationStore persists the delegations backing each client
+type DelegationStore interface {
+	RegisterDelegation(ctx context.Context, address string, delegationPoints DelegationPointRecord) error
+	GetFromDelegationsByAddress(ctx context.Context, address string) ([]DelegationRecord, error)
+	GetToDelegationsByAddress(ctx context.Context, address string) ([]DelegationRecord, error)
+	// GetDelegations returns delegations from or to the address
+	GetDelegations(ctx context.Context, address string) ([]DelegationRecord, error)
+	ClearDelegationsForAddress(ctx context.Context, address string, validFromAddresses []string) error
+	// ReplaceDelegations makes the delegations to address exactly the given
+	// delegators and amounts
+	ReplaceDelegations(ctx context.Context, address string, delegators map[string]int64, commissionRate float64) error
+	// UpsertDelegation writes a delegation record as is, for imports and repairs
+	UpsertDelegation(ctx context.Context, delegation DelegationRecord) error
+	StreamDelegations(ctx context.Context, address string, tr TimeRange, fn func(DelegationRecord) error) error
+	GetDelegatorPositions(ctx context.Context, address string) ([]DelegatorPosition, error)
+}
+
+// ProbeStore persists the results of probing clients' light client APIs
+type ProbeStore interface {
+	// SetProbeURL sets, or with "" clears, the client's light client API
+	// address. It reports whether the client exists.
+	SetProbeURL(ctx context.Context, address, url string) (bool, error)
+	// GetProbeTargets returns the probe URL of every client that has one
+	GetProbeTargets(ctx context.Context) (map[string]string, error)
+	AddProbe(ctx context.Context, probe ProbeRecord) error
+	// GetProbes returns a client's probes since the given time, oldest first
+	GetProbes(ctx context.Context, address string, since time.Time) ([]ProbeRecord, error)
+	// SetUptimePolicy sets which heartbeat sources count towards uptime
+	SetUptimePolicy(policy uptime.Policy)
+}
+
+// AdminStore persists the data managed through the admin API
+type AdminStore interface {
+	// AddToBlacklist adds or replaces the entry for an address
+	AddToBlacklist(ctx context.Context, entry BlacklistEntry) error
+	// RemoveFromBlacklist reports whether the address was blacklisted
+	RemoveFromBlacklist(ctx context.Context, address string) (bool, error)
+	IsBlacklisted(ctx context.Context, address string) (bool, error)
+	// GetBlacklist returns every entry, newest first
+	GetBlacklist(ctx context.Context) ([]BlacklistEntry, error)
+	// SetStatusOverride sets, or with nil clears, a client's status
+	// override. It reports whether the client exists.
+	SetStatusOverride(ctx context.Context, address string, override *StatusOverride) (bool, error)
+	// GetStatusOverrides returns every override, expired or not, by address
+	GetStatusOverrides(ctx context.Context) (map[string]StatusOverride, error)
+	AddIncident(ctx context.Context, incident Incident) error
+	// GetIncidents returns incidents started within the range, newest first.
+	// An empty address returns incidents of all clients.
+	GetIncidents(ctx context.Context, address string, tr TimeRange) ([]Incident, error)
+	AddAuditEntry(ctx context.Context, entry AuditEntry) error
+	// GetAuditLog returns the most recent entries first, at most limit of
+	// them when limit is positive
+	GetAuditLog(ctx context.Context, limit int) ([]AuditEntry, error)
+}
+
+// Store is the complete storage backend used by the service
+type Store interface {
+	ClientStore
+	HeartbeatStore
+	DelegationStore
+	ProbeStore
+	AdminStore
+	// Ping checks that the backend can serve requests
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+var _ Store = (*Database)(nil)
+
+// ClientHistoryWindow is how much heartbeat history GetClientWithHistory returns
+const ClientHistoryWindow = 24 * time.Hour
+
+// GetClientWithHistory returns a client with its recent heartbeats and all
+// delegations from or to it
+func GetClientWithHistory(ctx context.Context, store Store, address string) (*ClientInfo, []HeartbeatRecord, []DelegationRecord, error) {
+	client, err := store.GetClient(ctx, address)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	heartbeats, err := store.GetHeartbeats(ctx, address, time.Now().Add(-ClientHistoryWindow))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	delegations, err := store.GetDelegations(ctx, address)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return client, heartbeats, delegations, nil
+}
+
+// PopulateUptime fills in a client's uptime percentages and status
+func PopulateUptime(ctx context.Context, calc *uptime.Calculator, client *ClientInfo, now time.Time) error {
+	allUptimePercentage, weeklyUptimePercentage, err := calc.GetUptimePercentages(ctx, client.Address, client.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	client.AllUptimePercentage = allUptimePercentage
+	client.WeeklyUptimePercentage = weeklyUptimePercentage
+	client.Status = EffectiveStatus(client.LastHeartbeat, client.Liveness, client.StatusOverride, now)
+	return nil
+}
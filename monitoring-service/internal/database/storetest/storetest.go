@@ -0,0 +1,1316 @@
+// Package storetest is a conformance suite for database.Store implementations.
+// Every backend must pass it so handlers behave the same against any of them.
+// Each backend runs it from its own package, as memory does:
+//
+//	func TestStore(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) database.Store {
+//			return memory.New(logging.Discard())
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/uptime"
+)
+
+const (
+	operator  = "0xAAAA000000000000000000000000000000000001"
+	operator2 = "0xAAAA000000000000000000000000000000000002"
+	holder    = "0xBBBB000000000000000000000000000000000001"
+	holder2   = "0xBBBB000000000000000000000000000000000002"
+)
+
+// Run runs the conformance suite. newStore must return an empty store that
+// is not shared with other subtests.
+func Run(t *testing.T, newStore func(t *testing.T) database.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store database.Store)
+	}{
+		{"Ping", testPing},
+		{"RegisterClient", testRegisterClient},
+		{"RegisterClientWithoutPoints", testRegisterClientWithoutPoints},
+		{"RecordHeartbeat", testRecordHeartbeat},
+		{"HeartbeatState", testHeartbeatState},
+		{"ConcurrentHeartbeats", testConcurrentHeartbeats},
+		{"HeartbeatSequence", testHeartbeatSequence},
+		{"HeartbeatClaims", testHeartbeatClaims},
+		{"GetClientMissing", testGetClientMissing},
+		{"GetAllClients", testGetAllClients},
+		{"GetLastHeartbeats", testGetLastHeartbeats},
+		{"Heartbeats", testHeartbeats},
+		{"CountHeartbeatIntervals", testCountHeartbeatIntervals},
+		{"OperatorActivity", testOperatorActivity},
+		{"CompactHeartbeats", testCompactHeartbeats},
+		{"Delegations", testDelegations},
+		{"ClearDelegations", testClearDelegations},
+		{"ReplaceDelegations", testReplaceDelegations},
+		{"DelegatorPositions", testDelegatorPositions},
+		{"Streams", testStreams},
+		{"GetClientWithHistory", testGetClientWithHistory},
+		{"Upsert", testUpsert},
+		{"Blacklist", testBlacklist},
+		{"StatusOverride", testStatusOverride},
+		{"Incidents", testIncidents},
+		{"AuditLog", testAuditLog},
+		{"ClientSources", testClientSources},
+		{"Liveness", testLiveness},
+		{"Probes", testProbes},
+		{"ClientVersions", testClientVersions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newStore(t)
+			t.Cleanup(func() {
+				if err := store.Close(); err != nil {
+					t.Errorf("Close: %v", err)
+				}
+			})
+			tt.fn(t, store)
+		})
+	}
+}
+
+func points(amount int64, commission float64) database.OperationPointRecord {
+	return database.OperationPointRecord{Amount: amount, Time: 60, CommissionRate: commission}
+}
+
+func mustRegister(t *testing.T, store database.Store, address string, record database.OperationPointRecord) {
+	t.Helper()
+	if err := store.RegisterClient(context.Background(), address, record, 60, "operator", "0xCCCC000000000000000000000000000000000001"); err != nil {
+		t.Fatalf("RegisterClient(%s): %v", address, err)
+	}
+}
+
+func mustGetClient(t *testing.T, store database.Store, address string) *database.ClientInfo {
+	t.Helper()
+	client, err := store.GetClient(context.Background(), address)
+	if err != nil {
+		t.Fatalf("GetClient(%s): %v", address, err)
+	}
+	if client == nil {
+		t.Fatalf("GetClient(%s) returned nil", address)
+	}
+	return client
+}
+
+func testRegisterClient(t *testing.T, store database.Store) {
+	mustRegister(t, store, operator, points(3, 5))
+	first := mustGetClient(t, store, operator)
+
+	if first.Address != "0xaaaa000000000000000000000000000000000001" {
+		t.Errorf("address not normalised: %s", first.Address)
+	}
+	if first.NFTAmount != 3 || first.CommissionRate != 5 || first.TotalTime != 60 {
+		t.Errorf("unexpected client: %+v", first)
+	}
+	if first.RewardCollectorAddress != "0xcccc000000000000000000000000000000000001" {
+		t.Errorf("reward collector not normalised: %s", first.RewardCollectorAddress)
+	}
+
+	exists, err := store.ClientExists(context.Background(), holder)
+	if err != nil || exists {
+		t.Errorf("ClientExists(unknown) = %v, %v", exists, err)
+	}
+	exists, err = store.ClientExists(context.Background(), operator)
+	if err != nil || !exists {
+		t.Errorf("ClientExists(registered) = %v, %v", exists, err)
+	}
+
+	mustRegister(t, store, operator, points(4, 6))
+	second := mustGetClient(t, store, operator)
+	if second.NFTAmount != 4 || second.CommissionRate != 6 {
+		t.Errorf("client not updated: %+v", second)
+	}
+	if !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("created_at changed on update: %v -> %v", first.CreatedAt, second.CreatedAt)
+	}
+
+	heartbeats, err := store.GetHeartbeats(context.Background(), operator, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetHeartbeats: %v", err)
+	}
+	if len(heartbeats) != 2 {
+		t.Fatalf("expected 2 heartbeats, got %d", len(heartbeats))
+	}
+	if heartbeats[0].Amount != 3 || heartbeats[1].Amount != 4 || heartbeats[1].CommissionRate != 6 {
+		t.Errorf("unexpected heartbeats: %+v", heartbeats)
+	}
+}
+
+func testRegisterClientWithoutPoints(t *testing.T, store database.Store) {
+	mustRegister(t, store, operator, database.OperationPointRecord{Amount: 0, Time: 60})
+	mustGetClient(t, store, operator)
+
+	heartbeats, err := store.GetHeartbeats(context.Background(), operator, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetHeartbeats: %v", err)
+	}
+	if len(heartbeats) != 0 {
+		t.Errorf("expected no heartbeats without points, got %d", len(heartbeats))
+	}
+}
+
+// backdate moves a client's last heartbeat into the past
+func backdate(t *testing.T, store database.Store, address string, ago time.Duration, totalTime int64) {
+	t.Helper()
+	client := mustGetClient(t, store, address)
+	client.LastHeartbeat = time.Now().Add(-ago)
+	client.TotalTime = totalTime
+	if err := store.UpsertClient(context.Background(), *client); err != nil {
+		t.Fatalf("UpsertClient(%s): %v", address, err)
+	}
+}
+
+func testRecordHeartbeat(t *testing.T, store database.Store) {
+	heartbeat := database.ClientHeartbeat{
+		Amount:                 3,
+		CommissionRate:         5,
+		OperatorName:           "operator",
+		RewardCollectorAddress: "0xCCCC000000000000000000000000000000000001",
+		MaxGap:                 5 * time.Minute,
+	}
+	if err := store.RecordHeartbeat(context.Background(), operator, heartbeat); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	first := mustGetClient(t, store, operator)
+	if first.NFTAmount != 3 || first.CommissionRate != 5 || first.TotalTime != 0 || first.CreatedAt.IsZero() {
+		t.Errorf("unexpected new client: %+v", first)
+	}
+	if first.RewardCollectorAddress != "0xcccc000000000000000000000000000000000001" {
+		t.Errorf("reward collector not normalised: %s", first.RewardCollectorAddress)
+	}
+
+	// Counted: the previous heartbeat is within the gap. Names left empty
+	// keep the stored ones.
+	backdate(t, store, operator, 90*time.Second, 100)
+	heartbeat.Amount, heartbeat.OperatorName, heartbeat.RewardCollectorAddress = 4, "", ""
+	if err := store.RecordHeartbeat(context.Background(), operator, heartbeat); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	second := mustGetClient(t, store, operator)
+	if second.TotalTime < 190 || second.TotalTime > 191 || second.NFTAmount != 4 {
+		t.Errorf("client after 90s = %+v, want total_time 190 and nft_amount 4", second)
+	}
+	if second.OperatorName != "operator" || second.RewardCollectorAddress != first.RewardCollectorAddress {
+		t.Errorf("empty names overwrote stored ones: %+v", second)
+	}
+	if !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("created_at changed on update: %v -> %v", first.CreatedAt, second.CreatedAt)
+	}
+
+	// Not counted as uptime: the previous heartbeat is beyond the gap
+	backdate(t, store, operator, 10*time.Minute, 0)
+	if err := store.RecordHeartbeat(context.Background(), operator, heartbeat); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+
+	heartbeats, err := store.GetHeartbeats(context.Background(), operator, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetHeartbeats: %v", err)
+	}
+	if len(heartbeats) != 1 || heartbeats[0].Duration < 90 || heartbeats[0].Duration > 91 || heartbeats[0].Amount != 4 {
+		t.Errorf("heartbeats = %+v, want one of 90s", heartbeats)
+	}
+}
+
+// testHeartbeatState checks that the liveness, version and probe URL a
+// heartbeat carries are stored with it
+func testHeartbeatState(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	version := &database.ClientVersion{Version: "1.12.0", Network: "mainnet", ReportedAt: time.Now().Truncate(time.Millisecond), RewardEligible: true}
+	heartbeat := database.ClientHeartbeat{
+		Amount:   1,
+		MaxGap:   5 * time.Minute,
+		Liveness: &database.Liveness{BlockNumber: 900, PeerID: "$peer", Verified: true, ChainHead: 1000, Lag: 100},
+		Version:  version,
+		ProbeURL: "https://lc.example.com",
+	}
+	if err := store.RecordHeartbeat(ctx, operator, heartbeat); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	client := mustGetClient(t, store, operator)
+	if client.Liveness == nil || client.Liveness.BlockNumber != 900 || client.Liveness.PeerID != "$peer" {
+		t.Errorf("liveness = %+v, want block 900 from peer $peer", client.Liveness)
+	}
+	if client.Version == nil || client.Version.Version != "1.12.0" {
+		t.Errorf("version = %+v, want 1.12.0", client.Version)
+	}
+	if client.ProbeURL != "https://lc.example.com" {
+		t.Errorf("probe URL = %q", client.ProbeURL)
+	}
+
+	// The same build again is not a version change
+	if err := store.RecordHeartbeat(ctx, operator, heartbeat); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	history, err := store.GetVersionHistory(ctx, operator)
+	if err != nil {
+		t.Fatalf("GetVersionHistory: %v", err)
+	}
+	if len(history) != 1 || history[0].Version != "1.12.0" {
+		t.Errorf("version history = %+v, want the first report only", history)
+	}
+
+	// Without a report the sync state and version are cleared; the probe URL is kept
+	if err := store.RecordHeartbeat(ctx, operator, database.ClientHeartbeat{Amount: 1, MaxGap: 5 * time.Minute}); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	client = mustGetClient(t, store, operator)
+	if client.Liveness != nil || client.Version != nil {
+		t.Errorf("liveness and version after an empty report = %+v, %+v, want none", client.Liveness, client.Version)
+	}
+	if client.ProbeURL != "https://lc.example.com" {
+		t.Errorf("probe URL after a heartbeat without one = %q, want it kept", client.ProbeURL)
+	}
+}
+
+// testConcurrentHeartbeats hammers one address with simultaneous heartbeats.
+// The time since the previous heartbeat must be counted exactly once.
+func testConcurrentHeartbeats(t *testing.T, store database.Store) {
+	const workers = 32
+	heartbeat := database.ClientHeartbeat{Amount: 2, CommissionRate: 5, MaxGap: 5 * time.Minute}
+	delegators := map[string]int64{holder: 1, holder2: 1}
+	if err := store.RecordHeartbeat(context.Background(), operator, heartbeat); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	backdate(t, store, operator, time.Minute, 0)
+
+	start := make(chan struct{})
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			<-start
+			err := store.RecordHeartbeat(context.Background(), operator, heartbeat)
+			if err == nil {
+				err = store.ReplaceDelegations(context.Background(), operator, delegators, 5)
+			}
+			errs <- err
+		}()
+	}
+	close(start)
+	for i := 0; i < workers; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent heartbeat: %v", err)
+		}
+	}
+
+	client := mustGetClient(t, store, operator)
+	if client.TotalTime < 60 || client.TotalTime > 62 {
+		t.Errorf("total_time after %d concurrent heartbeats = %d, want 60", workers, client.TotalTime)
+	}
+	heartbeats, err := store.GetHeartbeats(context.Background(), operator, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetHeartbeats: %v", err)
+	}
+	if len(heartbeats) != 1 || heartbeats[0].Duration < 60 || heartbeats[0].Duration > 61 {
+		t.Errorf("heartbeats after %d concurrent heartbeats = %+v, want one of 60s", workers, heartbeats)
+	}
+	clients, err := store.GetAllClients(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllClients: %v", err)
+	}
+	if len(clients) != 1 {
+		t.Errorf("clients after concurrent heartbeats = %d, want 1", len(clients))
+	}
+	delegations, err := store.GetToDelegationsByAddress(context.Background(), operator)
+	if err != nil {
+		t.Fatalf("GetToDelegationsByAddress: %v", err)
+	}
+	if len(delegations) != len(delegators) {
+		t.Errorf("delegations after concurrent heartbeats = %+v, want %d", delegations, len(delegators))
+	}
+}
+
+func testHeartbeatSequence(t *testing.T, store database.Store) {
+	sentAt := time.Now().Add(-time.Minute).Truncate(time.Millisecond)
+	heartbeat := database.ClientHeartbeat{Amount: 1, MaxGap: 5 * time.Minute, Sequence: 5, SentAt: sentAt}
+	if err := store.RecordHeartbeat(context.Background(), operator, heartbeat); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+
+	// Values that are not newer are refused, without touching the client
+	for _, stale := range []database.ClientHeartbeat{
+		{Amount: 2, MaxGap: 5 * time.Minute, Sequence: 5},
+		{Amount: 2, MaxGap: 5 * time.Minute, Sequence: 3},
+		{Amount: 2, MaxGap: 5 * time.Minute, Sequence: 6, SentAt: sentAt},
+		{Amount: 2, MaxGap: 5 * time.Minute, SentAt: sentAt.Add(-time.Minute)},
+	} {
+		if err := store.RecordHeartbeat(context.Background(), operator, stale); !errors.Is(err, database.ErrHeartbeatOutOfOrder) {
+			t.Errorf("RecordHeartbeat(sequence %d, sent %v) = %v, want ErrHeartbeatOutOfOrder", stale.Sequence, stale.SentAt, err)
+		}
+	}
+	if client := mustGetClient(t, store, operator); client.NFTAmount != 1 {
+		t.Errorf("nft_amount after refused heartbeats = %d, want 1", client.NFTAmount)
+	}
+
+	// Heartbeats without them never lower the stored ones
+	if err := store.RecordHeartbeat(context.Background(), operator, database.ClientHeartbeat{Amount: 1, MaxGap: 5 * time.Minute}); err != nil {
+		t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	client := mustGetClient(t, store, operator)
+	if client.LastSequence != 5 || !client.LastSentAt.Equal(sentAt) {
+		t.Errorf("last sequence and timestamp = %d, %v; want 5, %v", client.LastSequence, client.LastSentAt, sentAt)
+	}
+
+	// Of heartbeats racing with the same sequence, exactly one is recorded
+	const workers = 16
+	start := make(chan struct{})
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			<-start
+			errs <- store.RecordHeartbeat(context.Background(), operator, database.ClientHeartbeat{Amount: 1, MaxGap: 5 * time.Minute, Sequence: 7})
+		}()
+	}
+	close(start)
+	recorded := 0
+	for i := 0; i < workers; i++ {
+		switch err := <-errs; {
+		case err == nil:
+			recorded++
+		case !errors.Is(err, database.ErrHeartbeatOutOfOrder):
+			t.Errorf("racing heartbeat: %v", err)
+		}
+	}
+	if recorded != 1 {
+		t.Errorf("racing heartbeats with sequence 7 recorded %d times, want 1", recorded)
+	}
+	client = mustGetClient(t, store, operator)
+	if client.LastSequence != 7 {
+		t.Errorf("last sequence after the race = %d, want 7", client.LastSequence)
+	}
+
+	// Imports and repairs keep them
+	if err := store.UpsertClient(context.Background(), *client); err != nil {
+		t.Fatalf("UpsertClient: %v", err)
+	}
+	if client := mustGetClient(t, store, operator); client.LastSequence != 7 {
+		t.Errorf("last sequence after UpsertClient = %d, want 7", client.LastSequence)
+	}
+}
+
+func testHeartbeatClaims(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	now := time.Now()
+
+	claim, err := store.ClaimHeartbeat(ctx, operator, "key:a", now)
+	if err != nil || claim != nil {
+		t.Fatalf("first ClaimHeartbeat = %+v, %v; want nil, nil", claim, err)
+	}
+	claim, err = store.ClaimHeartbeat(ctx, operator, "key:a", now)
+	if err != nil || claim == nil || !claim.Pending(now) {
+		t.Fatalf("ClaimHeartbeat while pending = %+v, %v; want the pending claim", claim, err)
+	}
+	// Keys are per client
+	if claim, err := store.ClaimHeartbeat(ctx, operator2, "key:a", now); err != nil || claim != nil {
+		t.Errorf("ClaimHeartbeat(other client) = %+v, %v; want nil, nil", claim, err)
+	}
+
+	body := []byte(`{"status":"success"}`)
+	if err := store.CompleteHeartbeat(ctx, operator, "key:a", 200, body); err != nil {
+		t.Fatalf("CompleteHeartbeat: %v", err)
+	}
+	// A completed claim is not released
+	if err := store.ReleaseHeartbeat(ctx, operator, "key:a"); err != nil {
+		t.Fatalf("ReleaseHeartbeat: %v", err)
+	}
+	claim, err = store.ClaimHeartbeat(ctx, "0xaaaa000000000000000000000000000000000001", "key:a", now)
+	if err != nil || claim == nil || !claim.Completed || claim.StatusCode != 200 || string(claim.Body) != string(body) {
+		t.Errorf("ClaimHeartbeat after completion = %+v, %v; want the stored response", claim, err)
+	}
+
+	// Released claims and abandoned ones can be claimed again
+	if _, err := store.ClaimHeartbeat(ctx, operator, "key:b", now); err != nil {
+		t.Fatalf("ClaimHeartbeat: %v", err)
+	}
+	if err := store.ReleaseHeartbeat(ctx, operator, "key:b"); err != nil {
+		t.Fatalf("ReleaseHeartbeat: %v", err)
+	}
+	if claim, err := store.ClaimHeartbeat(ctx, operator, "key:b", now); err != nil || claim != nil {
+		t.Errorf("ClaimHeartbeat after release = %+v, %v; want nil, nil", claim, err)
+	}
+	later := now.Add(database.PendingClaimTimeout)
+	if claim, err := store.ClaimHeartbeat(ctx, operator, "key:b", later); err != nil || claim != nil {
+		t.Errorf("ClaimHeartbeat of an abandoned claim = %+v, %v; want nil, nil", claim, err)
+	}
+	if claim, err := store.ClaimHeartbeat(ctx, operator, "key:b", later); err != nil || claim == nil {
+		t.Errorf("ClaimHeartbeat after takeover = %+v, %v; want the pending claim", claim, err)
+	}
+}
+
+func testPing(t *testing.T, store database.Store) {
+	if err := store.Ping(context.Background()); err != nil {
+		t.Errorf("Ping = %v, want nil", err)
+	}
+}
+
+func testGetClientMissing(t *testing.T, store database.Store) {
+	client, err := store.GetClient(context.Background(), operator)
+	if err != nil || client != nil {
+		t.Errorf("GetClient(unknown) = %v, %v; want nil, nil", client, err)
+	}
+}
+
+func testGetAllClients(t *testing.T, store database.Store) {
+	mustRegister(t, store, operator, points(1, 5))
+	time.Sleep(5 * time.Millisecond)
+	mustRegister(t, store, operator2, points(1, 5))
+
+	clients, err := store.GetAllClients(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllClients: %v", err)
+	}
+	if len(clients) != 2 {
+		t.Fatalf("expected 2 clients, got %d", len(clients))
+	}
+	if mustGetClient(t, store, operator2).Address != clients[0].Address {
+		t.Errorf("clients not newest first: %s, %s", clients[0].Address, clients[1].Address)
+	}
+	for _, client := range clients {
+		if client.Status != database.StatusActive {
+			t.Errorf("client %s status = %q, want %q", client.Address, client.Status, database.StatusActive)
+		}
+		if client.AllUptimePercentage <= 0 {
+			t.Errorf("client %s has no uptime", client.Address)
+		}
+	}
+}
+
+func testGetLastHeartbeats(t *testing.T, store database.Store) {
+	mustRegister(t, store, operator, points(1, 5))
+
+	lastHeartbeats, err := store.GetLastHeartbeats(context.Background())
+	if err != nil {
+		t.Fatalf("GetLastHeartbeats: %v", err)
+	}
+	client := mustGetClient(t, store, operator)
+	if last, ok := lastHeartbeats[client.Address]; !ok || !last.Equal(client.LastHeartbeat) {
+		t.Errorf("last heartbeat = %v, want %v", last, client.LastHeartbeat)
+	}
+}
+
+func testHeartbeats(t *testing.T, store database.Store) {
+	now := time.Now().Truncate(time.Millisecond)
+	for _, age := range []time.Duration{time.Minute, 3 * time.Hour, 2 * time.Minute} {
+		if err := store.AddHeartbeat(context.Background(), database.HeartbeatRecord{
+			ClientAddress: operator,
+			Timestamp:     now.Add(-age),
+			Duration:      60,
+			Amount:        1,
+		}); err != nil {
+			t.Fatalf("AddHeartbeat: %v", err)
+		}
+	}
+
+	heartbeats, err := store.GetHeartbeats(context.Background(), operator, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("GetHeartbeats: %v", err)
+	}
+	if len(heartbeats) != 2 {
+		t.Fatalf("expected 2 heartbeats in window, got %d", len(heartbeats))
+	}
+	if !heartbeats[0].Timestamp.Before(heartbeats[1].Timestamp) {
+		t.Errorf("heartbeats not oldest first: %v, %v", heartbeats[0].Timestamp, heartbeats[1].Timestamp)
+	}
+}
+
+func testCountHeartbeatIntervals(t *testing.T, store database.Store) {
+	interval := uptime.IntervalDuration
+	base := time.Now().Add(-time.Hour).Truncate(interval)
+
+	// Two heartbeats share the first interval, the third lands in another
+	for _, offset := range []time.Duration{time.Second, 2 * time.Minute, interval + time.Second} {
+		if err := store.AddHeartbeat(context.Background(), database.HeartbeatRecord{
+			ClientAddress: operator,
+			Timestamp:     base.Add(offset),
+			Amount:        1,
+		}); err != nil {
+			t.Fatalf("AddHeartbeat: %v", err)
+		}
+	}
+
+	client := "0xaaaa000000000000000000000000000000000001"
+	count, err := store.CountHeartbeatIntervals(context.Background(), client, base, interval)
+	if err != nil {
+		t.Fatalf("CountHeartbeatIntervals: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("CountHeartbeatIntervals = %d, want 2", count)
+	}
+
+	count, err = store.CountHeartbeatIntervals(context.Background(), client, base.Add(interval), interval)
+	if err != nil {
+		t.Fatalf("CountHeartbeatIntervals: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("CountHeartbeatIntervals since second interval = %d, want 1", count)
+	}
+}
+
+func testOperatorActivity(t *testing.T, store database.Store) {
+	now := time.Now()
+	heartbeats := []struct {
+		age        time.Duration
+		commission float64
+	}{
+		{20 * time.Minute, 5},
+		{19 * time.Minute, 5},
+		// 14 minute gap counts as an incident
+		{5 * time.Minute, 7},
+	}
+	for _, hb := range heartbeats {
+		if err := store.AddHeartbeat(context.Background(), database.HeartbeatRecord{
+			ClientAddress:  operator,
+			Timestamp:      now.Add(-hb.age),
+			Amount:         1,
+			CommissionRate: hb.commission,
+		}); err != nil {
+			t.Fatalf("AddHeartbeat: %v", err)
+		}
+	}
+	mustRegister(t, store, operator, points(1, 7))
+
+	activity, err := store.GetOperatorActivity(context.Background(), now.Add(-2*time.Hour))
+	if err != nil {
+		t.Fatalf("GetOperatorActivity: %v", err)
+	}
+	record, ok := activity["0xaaaa000000000000000000000000000000000001"]
+	if !ok {
+		t.Fatalf("no activity for operator: %+v", activity)
+	}
+	if record.Heartbeats != 4 {
+		t.Errorf("Heartbeats = %d, want 4", record.Heartbeats)
+	}
+	if record.Incidents != 1 {
+		t.Errorf("Incidents = %d, want 1", record.Incidents)
+	}
+	if record.CommissionChanges != 1 {
+		t.Errorf("CommissionChanges = %d, want 1", record.CommissionChanges)
+	}
+}
+
+func testCompactHeartbeats(t *testing.T, store database.Store) {
+	ctx := context.Background()
+	now := time.Now()
+	old := now.Add(-10 * 24 * time.Hour).Truncate(database.CoverageInterval)
+
+	// Three heartbeats share one interval, the fourth lands in the next
+	for _, timestamp := range []time.Time{
+		old.Add(time.Second),
+		old.Add(2 * time.Second),
+		old.Add(3 * time.Second),
+		old.Add(database.CoverageInterval + time.Second),
+		now.Add(-time.Hour),
+	} {
+		if err := store.AddHeartbeat(ctx, database.HeartbeatRecord{ClientAddress: operator, Timestamp: timestamp, Amount: 1}); err != nil {
+			t.Fatalf("AddHeartbeat: %v", err)
+		}
+	}
+
+	client := "0xaaaa000000000000000000000000000000000001"
+	since := now.Add(-30 * 24 * time.Hour)
+	countIntervals := func() int64 {
+		t.Helper()
+		count, err := store.CountHeartbeatIntervals(ctx, client, since, uptime.IntervalDuration)
+		if err != nil {
+			t.Fatalf("CountHeartbeatIntervals: %v", err)
+		}
+		return count
+	}
+	before := countIntervals()
+
+	// An interval that straddles since counts only if it has a heartbeat
+	// at or after since, compacted or not
+	boundaries := []struct {
+		since time.Time
+		want  int64
+	}{
+		{old, 3},
+		{old.Add(2500 * time.Millisecond), 3},
+		{old.Add(4 * time.Second), 2},
+		{old.Add(database.CoverageInterval), 2},
+	}
+	checkBoundaries := func(when string) {
+		t.Helper()
+		for _, boundary := range boundaries {
+			count, err := store.CountHeartbeatIntervals(ctx, client, boundary.since, uptime.IntervalDuration)
+			if err != nil {
+				t.Fatalf("CountHeartbeatIntervals: %v", err)
+			}
+			if count != boundary.want {
+				t.Errorf("intervals %s since +%v = %d, want %d", when, boundary.since.Sub(old), count, boundary.want)
+			}
+		}
+	}
+	checkBoundaries("before compaction")
+
+	report, err := store.CompactHeartbeats(ctx, now.Add(-2*24*time.Hour))
+	if err != nil {
+		t.Fatalf("CompactHeartbeats: %v", err)
+	}
+	if report.HeartbeatsDeleted != 4 || report.CoverageIntervals != 2 {
+		t.Errorf("report = %+v, want 4 heartbeats deleted into 2 intervals", report)
+	}
+
+	if after := countIntervals(); after != before {
+		t.Errorf("intervals after compaction = %d, want %d", after, before)
+	}
+	checkBoundaries("after compaction")
+
+	// Compacted intervals still respect since within the interval
+	count, err := store.CountHeartbeatIntervals(ctx, client, old.Add(database.CoverageInterval), uptime.IntervalDuration)
+	if err != nil {
+		t.Fatalf("CountHeartbeatIntervals: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("intervals since second compacted interval = %d, want 2", count)
+	}
+
+	heartbeats, err := store.GetHeartbeats(ctx, operator, since)
+	if err != nil {
+		t.Fatalf("GetHeartbeats: %v", err)
+	}
+	if len(heartbeats) != 1 {
+		t.Errorf("raw heartbeats after compaction = %d, want 1", len(heartbeats))
+	}
+
+	// A second run resumes where the first stopped and finds nothing to do
+	report, err = store.CompactHeartbeats(ctx, now.Add(-2*24*time.Hour))
+	if err != nil {
+		t.Fatalf("CompactHeartbeats: %v", err)
+	}
+	if report.HeartbeatsDeleted != 0 || report.Windows != 0 {
+		t.Errorf("second report = %+v, want no work", report)
+	}
+}
+
+func testDelegations(t *testing.T, store database.Store) {
+	for _, d := range []struct {
+		to, from string
+		amount   int64
+	}{
+		{operator, holder, 2},
+		{operator, holder2, 3},
+		{operator2, holder, 1},
+	} {
+		if err := store.RegisterDelegation(context.Background(), d.to, database.DelegationPointRecord{Address: d.from, Amount: d.amount, CommissionRate: 5}); err != nil {
+			t.Fatalf("RegisterDelegation: %v", err)
+		}
+	}
+
+	// Re-registering the same pair replaces the previous record
+	if err := store.RegisterDelegation(context.Background(), operator, database.DelegationPointRecord{Address: holder, Amount: 4, CommissionRate: 5}); err != nil {
+		t.Fatalf("RegisterDelegation: %v", err)
+	}
+
+	to, err := store.GetToDelegationsByAddress(context.Background(), operator)
+	if err != nil {
+		t.Fatalf("GetToDelegationsByAddress: %v", err)
+	}
+	if len(to) != 2 || sumAmounts(to) != 7 {
+		t.Errorf("delegations to operator = %+v", to)
+	}
+
+	from, err := store.GetFromDelegationsByAddress(context.Background(), holder)
+	if err != nil {
+		t.Fatalf("GetFromDelegationsByAddress: %v", err)
+	}
+	if len(from) != 2 || sumAmounts(from) != 5 {
+		t.Errorf("delegations from holder = %+v", from)
+	}
+
+	all, err := store.GetDelegations(context.Background(), holder)
+	if err != nil {
+		t.Fatalf("GetDelegations: %v", err)
+	}
+	if len(all) != 2 {
+		t.Errorf("GetDelegations(holder) returned %d records, want 2", len(all))
+	}
+}
+
+func testClearDelegations(t *testing.T, store database.Store) {
+	for _, from := range []string{holder, holder2} {
+		if err := store.RegisterDelegation(context.Background(), operator, database.DelegationPointRecord{Address: from, Amount: 1}); err != nil {
+			t.Fatalf("RegisterDelegation: %v", err)
+		}
+	}
+	if err := store.RegisterDelegation(context.Background(), operator2, database.DelegationPointRecord{Address: holder2, Amount: 1}); err != nil {
+		t.Fatalf("RegisterDelegation: %v", err)
+	}
+
+	if err := store.ClearDelegationsForAddress(context.Background(), operator, []string{holder}); err != nil {
+		t.Fatalf("ClearDelegationsForAddress: %v", err)
+	}
+
+	to, err := store.GetToDelegationsByAddress(context.Background(), operator)
+	if err != nil {
+		t.Fatalf("GetToDelegationsByAddress: %v", err)
+	}
+	if len(to) != 1 || to[0].FromAddress != "0xbbbb000000000000000000000000000000000001" {
+		t.Errorf("delegations after clear = %+v", to)
+	}
+
+	other, err := store.GetToDelegationsByAddress(context.Background(), operator2)
+	if err != nil {
+		t.Fatalf("GetToDelegationsByAddress: %v", err)
+	}
+	if len(other) != 1 {
+		t.Errorf("clearing one operator touched another: %+v", other)
+	}
+}
+
+func testReplaceDelegations(t *testing.T, store database.Store) {
+	if err := store.ReplaceDelegations(context.Background(), operator, map[string]int64{holder: 1, holder2: 2}, 5); err != nil {
+		t.Fatalf("ReplaceDelegations: %v", err)
+	}
+	if err := store.ReplaceDelegations(context.Background(), operator2, map[string]int64{holder2: 1}, 5); err != nil {
+		t.Fatalf("ReplaceDelegations: %v", err)
+	}
+
+	// holder2 withdrew and holder added to the delegation
+	if err := store.ReplaceDelegations(context.Background(), operator, map[string]int64{holder: 3}, 6); err != nil {
+		t.Fatalf("ReplaceDelegations: %v", err)
+	}
+	to, err := store.GetToDelegationsByAddress(context.Background(), operator)
+	if err != nil {
+		t.Fatalf("GetToDelegationsByAddress: %v", err)
+	}
+	if len(to) != 1 || to[0].FromAddress != "0xbbbb000000000000000000000000000000000001" || to[0].Amount != 3 || to[0].CommissionRate != 6 {
+		t.Errorf("delegations after replace = %+v", to)
+	}
+
+	other, err := store.GetToDelegationsByAddress(context.Background(), operator2)
+	if err != nil {
+		t.Fatalf("GetToDelegationsByAddress: %v", err)
+	}
+	if len(other) != 1 {
+		t.Errorf("replacing one operator's delegations touched another: %+v", other)
+	}
+
+	if err := store.ReplaceDelegations(context.Background(), operator, nil, 6); err != nil {
+		t.Fatalf("ReplaceDelegations(none): %v", err)
+	}
+	if to, err := store.GetToDelegationsByAddress(context.Background(), operator); err != nil || len(to) != 0 {
+		t.Errorf("delegations after replacing with none = %+v, %v", to, err)
+	}
+}
+
+func testDelegatorPositions(t *testing.T, store database.Store) {
+	mustRegister(t, store, operator, points(1, 5))
+	for _, to := range []string{operator, operator2} {
+		if err := store.RegisterDelegation(context.Background(), to, database.DelegationPointRecord{Address: holder, Amount: 2, CommissionRate: 5}); err != nil {
+			t.Fatalf("RegisterDelegation: %v", err)
+		}
+	}
+
+	positions, err := store.GetDelegatorPositions(context.Background(), holder)
+	if err != nil {
+		t.Fatalf("GetDelegatorPositions: %v", err)
+	}
+	// operator2 never registered so it is left out
+	if len(positions) != 1 {
+		t.Fatalf("expected 1 position, got %+v", positions)
+	}
+	position := positions[0]
+	if position.OperatorAddress != "0xaaaa000000000000000000000000000000000001" || position.DelegatedAmount != 2 {
+		t.Errorf("unexpected position: %+v", position)
+	}
+	if position.Status != database.StatusActive || position.CommissionRate != 5 {
+		t.Errorf("position not joined with client: %+v", position)
+	}
+	if position.OperatorRewards != nil {
+		t.Errorf("OperatorRewards = %d, want nil", *position.OperatorRewards)
+	}
+}
+
+func testStreams(t *testing.T, store database.Store) {
+	mustRegister(t, store, operator, points(1, 5))
+	mustRegister(t, store, operator2, points(1, 5))
+	if err := store.RegisterDelegation(context.Background(), operator, database.DelegationPointRecord{Address: holder, Amount: 1}); err != nil {
+		t.Fatalf("RegisterDelegation: %v", err)
+	}
+
+	ctx := context.Background()
+	var clients, heartbeats, delegations int
+	if err := store.StreamClients(ctx, database.TimeRange{}, func(database.ClientInfo) error {
+		clients++
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamClients: %v", err)
+	}
+	if err := store.StreamHeartbeats(ctx, operator, database.TimeRange{}, func(database.HeartbeatRecord) error {
+		heartbeats++
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamHeartbeats: %v", err)
+	}
+	if err := store.StreamDelegations(ctx, "", database.TimeRange{}, func(database.DelegationRecord) error {
+		delegations++
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamDelegations: %v", err)
+	}
+	if clients != 2 || heartbeats != 1 || delegations != 1 {
+		t.Errorf("streamed %d clients, %d heartbeats, %d delegations; want 2, 1, 1", clients, heartbeats, delegations)
+	}
+
+	future := database.TimeRange{From: time.Now().Add(time.Hour)}
+	if err := store.StreamHeartbeats(ctx, "", future, func(database.HeartbeatRecord) error {
+		t.Error("heartbeat streamed outside of time range")
+		return nil
+	}); err != nil {
+		t.Fatalf("StreamHeartbeats: %v", err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := store.StreamClients(ctx, database.TimeRange{}, func(database.ClientInfo) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("StreamClients did not stop on callback error: err=%v calls=%d", err, calls)
+	}
+}
+
+func testGetClientWithHistory(t *testing.T, store database.Store) {
+	mustRegister(t, store, operator, points(1, 5))
+	if err := store.RegisterDelegation(context.Background(), operator, database.DelegationPointRecord{Address: holder, Amount: 1}); err != nil {
+		t.Fatalf("RegisterDelegation: %v", err)
+	}
+
+	client, heartbeats, delegations, err := database.GetClientWithHistory(context.Background(), store, operator)
+	if err != nil {
+		t.Fatalf("GetClientWithHistory: %v", err)
+	}
+	if client == nil || len(heartbeats) != 1 || len(delegations) != 1 {
+		t.Errorf("GetClientWithHistory = %v, %d heartbeats, %d delegations", client, len(heartbeats), len(delegations))
+	}
+}
+
+func sumAmounts(delegations []database.DelegationRecord) int64 {
+	var total int64
+	for _, d := range delegations {
+		total += d.Amount
+	}
+	return total
+}
+
+func testUpsert(t *testing.T, store database.Store) {
+	lastHeartbeat := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	createdAt := lastHeartbeat.Add(-24 * time.Hour)
+
+	if err := store.UpsertClient(context.Background(), database.ClientInfo{
+		Address:                operator,
+		TotalTime:              120,
+		LastHeartbeat:          lastHeartbeat,
+		CreatedAt:              createdAt,
+		NFTAmount:              2,
+		CommissionRate:         3,
+		OperatorName:           "imported",
+		RewardCollectorAddress: holder,
+	}); err != nil {
+		t.Fatalf("UpsertClient: %v", err)
+	}
+
+	client := mustGetClient(t, store, operator)
+	if !client.LastHeartbeat.Equal(lastHeartbeat) || !client.CreatedAt.Equal(createdAt) {
+		t.Errorf("timestamps not kept: %+v", client)
+	}
+	if client.NFTAmount != 2 || client.TotalTime != 120 || client.OperatorName != "imported" {
+		t.Errorf("unexpected client: %+v", client)
+	}
+	if client.RewardCollectorAddress != "0xbbbb000000000000000000000000000000000001" {
+		t.Errorf("reward collector not normalised: %s", client.RewardCollectorAddress)
+	}
+
+	if err := store.UpsertDelegation(context.Background(), database.DelegationRecord{
+		FromAddress: holder,
+		ToAddress:   operator,
+		Amount:      2,
+		Timestamp:   lastHeartbeat,
+	}); err != nil {
+		t.Fatalf("UpsertDelegation: %v", err)
+	}
+	if err := store.UpsertDelegation(context.Background(), database.DelegationRecord{
+		FromAddress: holder,
+		ToAddress:   operator,
+		Amount:      5,
+		Timestamp:   lastHeartbeat,
+	}); err != nil {
+		t.Fatalf("UpsertDelegation: %v", err)
+	}
+
+	delegations, err := store.GetToDelegationsByAddress(context.Background(), operator)
+	if err != nil {
+		t.Fatalf("GetToDelegationsByAddress: %v", err)
+	}
+	if len(delegations) != 1 || delegations[0].Amount != 5 || !delegations[0].Timestamp.Equal(lastHeartbeat) {
+		t.Errorf("delegations after upsert = %+v", delegations)
+	}
+}
+
+func testBlacklist(t *testing.T, store database.Store) {
+	now := time.Now().Truncate(time.Millisecond)
+	for i, address := range []string{operator, operator2} {
+		if err := store.AddToBlacklist(context.Background(), database.BlacklistEntry{
+			Address:   address,
+			Reason:    "sybil",
+			CreatedBy: "admin",
+			CreatedAt: now.Add(time.Duration(i) * time.Minute),
+		}); err != nil {
+			t.Fatalf("AddToBlacklist(%s): %v", address, err)
+		}
+	}
+
+	blacklisted, err := store.IsBlacklisted(context.Background(), "0xaaaa000000000000000000000000000000000001")
+	if err != nil || !blacklisted {
+		t.Errorf("IsBlacklisted = %v, %v; want true", blacklisted, err)
+	}
+
+	entries, err := store.GetBlacklist(context.Background())
+	if err != nil {
+		t.Fatalf("GetBlacklist: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Address != "0xaaaa000000000000000000000000000000000002" {
+		t.Errorf("GetBlacklist = %+v, want both entries newest first", entries)
+	}
+
+	removed, err := store.RemoveFromBlacklist(context.Background(), operator)
+	if err != nil || !removed {
+		t.Errorf("RemoveFromBlacklist = %v, %v; want true", removed, err)
+	}
+	removed, err = store.RemoveFromBlacklist(context.Background(), operator)
+	if err != nil || removed {
+		t.Errorf("second RemoveFromBlacklist = %v, %v; want false", removed, err)
+	}
+	if blacklisted, _ := store.IsBlacklisted(context.Background(), operator); blacklisted {
+		t.Error("address still blacklisted after removal")
+	}
+}
+
+func testStatusOverride(t *testing.T, store database.Store) {
+	exists, err := store.SetStatusOverride(context.Background(), operator, &database.StatusOverride{Status: database.StatusActive})
+	if err != nil || exists {
+		t.Errorf("SetStatusOverride on missing client = %v, %v; want false", exists, err)
+	}
+
+	mustRegister(t, store, operator, points(1, 5))
+	mustRegister(t, store, operator2, points(1, 5))
+
+	expired := time.Now().Add(-time.Minute)
+	for address, override := range map[string]*database.StatusOverride{
+		operator:  {Status: database.StatusOffline, Reason: "maintenance", SetBy: "support", SetAt: time.Now()},
+		operator2: {Status: database.StatusOffline, SetBy: "support", SetAt: time.Now(), ExpiresAt: &expired},
+	} {
+		exists, err := store.SetStatusOverride(context.Background(), address, override)
+		if err != nil || !exists {
+			t.Fatalf("SetStatusOverride(%s) = %v, %v; want true", address, exists, err)
+		}
+	}
+
+	clients, err := store.GetAllClients(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllClients: %v", err)
+	}
+	for _, client := range clients {
+		want := database.StatusActive
+		if client.Address == "0xaaaa000000000000000000000000000000000001" {
+			want = database.StatusOffline
+		}
+		if client.Status != want {
+			t.Errorf("status of %s = %s, want %s", client.Address, client.Status, want)
+		}
+	}
+
+	overrides, err := store.GetStatusOverrides(context.Background())
+	if err != nil {
+		t.Fatalf("GetStatusOverrides: %v", err)
+	}
+	if len(overrides) != 2 || overrides["0xaaaa000000000000000000000000000000000001"].Reason != "maintenance" {
+		t.Errorf("GetStatusOverrides = %+v", overrides)
+	}
+
+	// Heartbeats do not clear an override
+	mustRegister(t, store, operator, points(1, 5))
+	if client := mustGetClient(t, store, operator); client.StatusOverride == nil {
+		t.Error("override lost on heartbeat")
+	}
+
+	if _, err := store.SetStatusOverride(context.Background(), operator, nil); err != nil {
+		t.Fatalf("clear override: %v", err)
+	}
+	if client := mustGetClient(t, store, operator); client.StatusOverride != nil {
+		t.Errorf("override not cleared: %+v", client.StatusOverride)
+	}
+}
+
+func testIncidents(t *testing.T, store database.Store) {
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Millisecond)
+	ended := start.Add(30 * time.Minute)
+	incidents := []database.Incident{
+		{ID: "a", ClientAddress: operator, Severity: "major", Summary: "RPC outage", StartedAt: start, EndedAt: &ended},
+		{ID: "b", ClientAddress: operator, Severity: "minor", Summary: "restart", StartedAt: start.Add(time.Hour)},
+		{ID: "c", ClientAddress: operator2, Severity: "minor", Summary: "restart", StartedAt: start.Add(time.Hour)},
+	}
+	for _, incident := range incidents {
+		if err := store.AddIncident(context.Background(), incident); err != nil {
+			t.Fatalf("AddIncident(%s): %v", incident.ID, err)
+		}
+	}
+
+	ctx := context.Background()
+	got, err := store.GetIncidents(ctx, operator, database.TimeRange{})
+	if err != nil {
+		t.Fatalf("GetIncidents: %v", err)
+	}
+	if len(got) != 2 || got[0].ID != "b" || got[1].ID != "a" {
+		t.Fatalf("GetIncidents = %+v, want b then a", got)
+	}
+	if got[1].EndedAt == nil || !got[1].EndedAt.Equal(ended) {
+		t.Errorf("EndedAt = %v, want %v", got[1].EndedAt, ended)
+	}
+
+	got, err = store.GetIncidents(ctx, "", database.TimeRange{From: start.Add(time.Minute)})
+	if err != nil {
+		t.Fatalf("GetIncidents: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("GetIncidents in range = %+v, want b and c", got)
+	}
+}
+
+func testAuditLog(t *testing.T, store database.Store) {
+	now := time.Now().Truncate(time.Millisecond)
+	for i := 0; i < 3; i++ {
+		if err := store.AddAuditEntry(context.Background(), database.AuditEntry{
+			Timestamp:  now.Add(time.Duration(i) * time.Second),
+			Actor:      "admin",
+			Action:     "addToBlacklist",
+			StatusCode: 200 + i,
+		}); err != nil {
+			t.Fatalf("AddAuditEntry: %v", err)
+		}
+	}
+
+	entries, err := store.GetAuditLog(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("GetAuditLog: %v", err)
+	}
+	if len(entries) != 2 || entries[0].StatusCode != 202 || entries[1].StatusCode != 201 {
+		t.Errorf("GetAuditLog = %+v, want the two newest entries", entries)
+	}
+}
+
+func testClientSources(t *testing.T, store database.Store) {
+	now := time.Now().Truncate(time.Millisecond)
+	for _, seen := range []struct {
+		address string
+		ip      string
+		at      time.Time
+	}{
+		{"0xAAAA", "10.0.0.1", now.Add(-time.Hour)},
+		{"0xaaaa", "10.0.0.1", now},
+		{"0xbbbb", "10.0.0.1", now.Add(-2 * time.Hour)},
+		{"0xcccc", "10.0.0.2", now.Add(-48 * time.Hour)},
+	} {
+		if err := store.RecordClientSource(context.Background(), seen.address, seen.ip, seen.at); err != nil {
+			t.Fatalf("RecordClientSource: %v", err)
+		}
+	}
+
+	sources, err := store.GetClientSources(context.Background(), now.Add(-24*time.Hour))
+	if err != nil {
+		t.Fatalf("GetClientSources: %v", err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("GetClientSources = %+v, want the two sources seen in the last day", sources)
+	}
+
+	first := sources[0]
+	if first.ClientAddress != "0xaaaa" || first.IP != "10.0.0.1" || first.Heartbeats != 2 {
+		t.Errorf("first source = %+v, want 0xaaaa from 10.0.0.1 with 2 heartbeats", first)
+	}
+	if !first.FirstSeen.Equal(now.Add(-time.Hour)) || !first.LastSeen.Equal(now) {
+		t.Errorf("first source seen %v..%v, want %v..%v", first.FirstSeen, first.LastSeen, now.Add(-time.Hour), now)
+	}
+}
+
+func testLiveness(t *testing.T, store database.Store) {
+	const operator = "0xabc"
+	mustRegister(t, store, operator, points(1, 5))
+
+	if err := store.SetLiveness(context.Background(), operator, &database.Liveness{BlockNumber: 900, Verified: true, ChainHead: 1000, Lag: 100, Degraded: true}); err != nil {
+		t.Fatalf("SetLiveness: %v", err)
+	}
+	client := mustGetClient(t, store, operator)
+	if client.Liveness == nil || client.Liveness.BlockNumber != 900 || !client.Liveness.Degraded {
+		t.Fatalf("Liveness = %+v, want the degraded report", client.Liveness)
+	}
+
+	clients, err := store.GetAllClients(context.Background())
+	if err != nil {
+		t.Fatalf("GetAllClients: %v", err)
+	}
+	if len(clients) != 1 || clients[0].Status != database.StatusDegraded {
+		t.Errorf("GetAllClients = %+v, want one Degraded client", clients)
+	}
+
+	// Imports and repairs leave the sync state alone
+	client.OperatorName = "renamed"
+	if err := store.UpsertClient(context.Background(), *client); err != nil {
+		t.Fatalf("UpsertClient: %v", err)
+	}
+	if got := mustGetClient(t, store, operator); got.Liveness == nil {
+		t.Error("UpsertClient cleared liveness")
+	}
+
+	if err := store.SetLiveness(context.Background(), operator, nil); err != nil {
+		t.Fatalf("SetLiveness(nil): %v", err)
+	}
+	if got := mustGetClient(t, store, operator); got.Liveness != nil {
+		t.Errorf("Liveness = %+v after clearing, want nil", got.Liveness)
+	}
+}
+
+func testProbes(t *testing.T, store database.Store) {
+	const operator = "0xabc"
+	ctx := context.Background()
+
+	exists, err := store.SetProbeURL(ctx, operator, "https://lc.example.com")
+	if err != nil || exists {
+		t.Fatalf("SetProbeURL on a missing client = %v, %v, want false", exists, err)
+	}
+	mustRegister(t, store, operator, points(1, 5))
+	if exists, err := store.SetProbeURL(ctx, operator, "https://lc.example.com"); err != nil || !exists {
+		t.Fatalf("SetProbeURL = %v, %v", exists, err)
+	}
+	targets, err := store.GetProbeTargets(ctx)
+	if err != nil {
+		t.Fatalf("GetProbeTargets: %v", err)
+	}
+	if len(targets) != 1 || targets[operator] != "https://lc.example.com" {
+		t.Errorf("GetProbeTargets = %v, want the registered URL", targets)
+	}
+
+	// Probes in two intervals, one of which failed, and heartbeats in the
+	// successful probe's interval and a third one. Registering added a
+	// heartbeat an hour later, in a fourth.
+	interval := 5 * time.Minute
+	base := time.Now().Truncate(interval).Add(-time.Hour)
+	for _, probe := range []database.ProbeRecord{
+		{ClientAddress: operator, Timestamp: base.Add(time.Minute), Success: true, LatencyMs: 40},
+		{ClientAddress: operator, Timestamp: base.Add(interval + time.Minute), Success: false, Error: "timeout"},
+	} {
+		if err := store.AddProbe(ctx, probe); err != nil {
+			t.Fatalf("AddProbe: %v", err)
+		}
+	}
+	for _, at := range []time.Time{base.Add(2 * time.Minute), base.Add(2*interval + time.Minute)} {
+		if err := store.AddHeartbeat(ctx, database.HeartbeatRecord{ClientAddress: operator, Timestamp: at, Duration: 60, Amount: 1}); err != nil {
+			t.Fatalf("AddHeartbeat: %v", err)
+		}
+	}
+
+	probes, err := store.GetProbes(ctx, operator, base)
+	if err != nil {
+		t.Fatalf("GetProbes: %v", err)
+	}
+	if len(probes) != 2 || !probes[0].Success || probes[0].LatencyMs != 40 {
+		t.Errorf("GetProbes = %+v, want both probes oldest first", probes)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		count func() (int64, error)
+		want  int64
+	}{
+		{"probe", func() (int64, error) { return store.CountProbeIntervals(ctx, operator, base, interval) }, 1},
+		{"either", func() (int64, error) { return store.CountCombinedIntervals(ctx, operator, base, interval, false) }, 3},
+		{"both", func() (int64, error) { return store.CountCombinedIntervals(ctx, operator, base, interval, true) }, 1},
+	} {
+		got, err := tt.count()
+		if err != nil {
+			t.Fatalf("%s intervals: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s intervals = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testClientVersions(t *testing.T, store database.Store) {
+	const operator = "0xABC"
+	mustRegister(t, store, operator, points(1, 5))
+
+	// Mongo keeps millisecond precision
+	start := time.Now().Truncate(time.Millisecond)
+	outdatedSince := start
+	for i, version := range []*database.ClientVersion{
+		{Version: "1.11.0", Network: "mainnet", OS: "linux", Arch: "amd64", ReportedAt: start,
+			Outdated: true, OutdatedSince: &outdatedSince, RewardEligible: true},
+		// Same build again, no history entry
+		{Version: "1.11.0", Network: "mainnet", OS: "linux", Arch: "amd64", ReportedAt: start.Add(time.Minute),
+			Outdated: true, OutdatedSince: &outdatedSince},
+		{Version: "1.12.0", Network: "mainnet", OS: "linux", Arch: "amd64", ReportedAt: start.Add(2 * time.Minute),
+			RewardEligible: true},
+	} {
+		if err := store.SetClientVersion(context.Background(), operator, version); err != nil {
+			t.Fatalf("SetClientVersion #%d: %v", i, err)
+		}
+	}
+
+	client := mustGetClient(t, store, operator)
+	if client.Version == nil || client.Version.Version != "1.12.0" || !client.RewardEligible() {
+		t.Fatalf("Version = %+v, want the eligible 1.12.0 build", client.Version)
+	}
+
+	history, err := store.GetVersionHistory(context.Background(), operator)
+	if err != nil {
+		t.Fatalf("GetVersionHistory: %v", err)
+	}
+	if len(history) != 2 || history[0].Version != "1.11.0" || history[1].Version != "1.12.0" ||
+		history[0].ClientAddress != "0xabc" || !history[1].Timestamp.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("GetVersionHistory = %+v, want the 1.11.0 and 1.12.0 changes", history)
+	}
+
+	versions, err := store.GetClientVersions(context.Background())
+	if err != nil {
+		t.Fatalf("GetClientVersions: %v", err)
+	}
+	if len(versions) != 1 || versions["0xabc"].Version != "1.12.0" {
+		t.Errorf("GetClientVersions = %+v, want the current build", versions)
+	}
+
+	// Imports and repairs leave the version alone
+	client.OperatorName = "renamed"
+	if err := store.UpsertClient(context.Background(), *client); err != nil {
+		t.Fatalf("UpsertClient: %v", err)
+	}
+	if got := mustGetClient(t, store, operator); got.Version == nil {
+		t.Error("UpsertClient cleared the version")
+	}
+
+	if err := store.SetClientVersion(context.Background(), operator, nil); err != nil {
+		t.Fatalf("SetClientVersion(nil): %v", err)
+	}
+	if got := mustGetClient(t, store, operator); got.Version != nil || !got.RewardEligible() {
+		t.Errorf("Version = %+v after clearing, want nil", got.Version)
+	}
+
+	// Clients that do not exist are not created
+	if err := store.SetClientVersion(context.Background(), "0xdef", &database.ClientVersion{Version: "1.12.0"}); err != nil {
+		t.Fatalf("SetClientVersion on a missing client: %v", err)
+	}
+	if history, _ := store.GetVersionHistory(context.Background(), "0xdef"); len(history) != 0 {
+		t.Errorf("GetVersionHistory(missing) = %+v, want none", history)
+	}
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"monitoring-service/internal/uptime"
+)
+
+// streamBatchSize bounds how many documents a cursor holds in memory at once
+const streamBatchSize = 500
+
+// TimeRange filters records by time. Zero bounds are open.
+type TimeRange struct {
+	From time.Time
+	To   time.Time
+}
+
+func (tr TimeRange) filter() bson.M {
+	bounds := bson.M{}
+	if !tr.From.IsZero() {
+		bounds["$gte"] = tr.From
+	}
+	if !tr.To.IsZero() {
+		bounds["$lt"] = tr.To
+	}
+	return bounds
+}
+
+// StreamClients calls fn for every client that heartbeated within the range,
+// oldest first, with uptime and status filled in as GetAllClients does.
+func (d *Database) StreamClients(ctx context.Context, tr TimeRange, fn func(ClientInfo) error) error {
+	filter := bson.M{}
+	if !tr.From.IsZero() {
+		filter["last_heartbeat"] = bson.M{"$gte": tr.From}
+	}
+	if !tr.To.IsZero() {
+		filter["created_at"] = bson.M{"$lt": tr.To}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetBatchSize(streamBatchSize)
+	cursor, err := d.clients.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	uptimeCalc := uptime.NewCalculator(d, d.currentUptimePolicy())
+	now := time.Now()
+
+	for cursor.Next(ctx) {
+		var client ClientInfo
+		if err := cursor.Decode(&client); err != nil {
+			return err
+		}
+
+		if err := PopulateUptime(ctx, uptimeCalc, &client, now); err != nil {
+			d.logger.ErrorContext(ctx, "Failed to calculate uptime", "client", client.Address, "error", err)
+		}
+
+		if err := fn(client); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// StreamHeartbeats calls fn for every heartbeat in the range, oldest first.
+// An empty address streams heartbeats of all clients.
+func (d *Database) StreamHeartbeats(ctx context.Context, address string, tr TimeRange, fn func(HeartbeatRecord) error) error {
+	filter := bson.M{}
+	if address != "" {
+		filter["client_address"] = strings.ToLower(address)
+	}
+	if bounds := tr.filter(); len(bounds) > 0 {
+		filter["timestamp"] = bounds
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}}).
+		SetBatchSize(streamBatchSize)
+	cursor, err := d.heartbeats.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	return streamCursor(ctx, cursor, fn)
+}
+
+// StreamDelegations calls fn for every delegation last updated within the
+// range. An empty address streams all delegations, otherwise those from or to it.
+func (d *Database) StreamDelegations(ctx context.Context, address string, tr TimeRange, fn func(DelegationRecord) error) error {
+	filter := bson.M{}
+	if address != "" {
+		address = strings.ToLower(address)
+		filter["$or"] = []bson.M{
+			{"from_address": address},
+			{"to_address": address},
+		}
+	}
+	if bounds := tr.filter(); len(bounds) > 0 {
+		filter["timestamp"] = bounds
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: 1}, {Key: "_id", Value: 1}}).
+		SetBatchSize(streamBatchSize)
+	cursor, err := d.delegations.Find(ctx, filter, opts)
+	if err != nil {
+		return err
+	}
+
+	return streamCursor(ctx, cursor, fn)
+}
+
+func streamCursor[T any](ctx context.Context, cursor *mongo.Cursor, fn func(T) error) error {
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var record T
+		if err := cursor.Decode(&record); err != nil {
+			return err
+		}
+		if err := fn(record); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
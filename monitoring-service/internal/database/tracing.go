@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/event"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"monitoring-service/internal/tracing"
+)
+
+// commandTracer records every MongoDB command as a span, a child of the
+// span in the context the operation ran with
+type commandTracer struct {
+	spans sync.Map // request ID to trace.Span
+}
+
+func (t *commandTracer) monitor() *event.CommandMonitor {
+	return &event.CommandMonitor{
+		Started:   t.started,
+		Succeeded: t.succeeded,
+		Failed:    t.failed,
+	}
+}
+
+func (t *commandTracer) started(ctx context.Context, evt *event.CommandStartedEvent) {
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "mongodb"),
+		attribute.String("db.name", evt.DatabaseName),
+		attribute.String("db.operation", evt.CommandName),
+	}
+	// The command's first field names the collection it runs on
+	collection, ok := evt.Command.Index(0).Value().StringValueOK()
+	name := "mongodb." + evt.CommandName
+	if ok {
+		attrs = append(attrs, attribute.String("db.mongodb.collection", collection))
+		name += " " + collection
+	}
+	_, span := tracing.Tracer().Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+	t.spans.Store(evt.RequestID, span)
+}
+
+func (t *commandTracer) succeeded(_ context.Context, evt *event.CommandSucceededEvent) {
+	if span, ok := t.spans.LoadAndDelete(evt.RequestID); ok {
+		span.(trace.Span).End()
+	}
+}
+
+func (t *commandTracer) failed(_ context.Context, evt *event.CommandFailedEvent) {
+	if span, ok := t.spans.LoadAndDelete(evt.RequestID); ok {
+		span := span.(trace.Span)
+		span.SetStatus(codes.Error, evt.Failure)
+		span.End()
+	}
+}
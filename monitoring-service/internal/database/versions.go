@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ClientVersion is the light client build a client's last heartbeat
+// reported, with its standing against the minimum version policy
+type ClientVersion struct {
+	Version    string    `bson:"version,omitempty" json:"version,omitempty"`
+	Network    string    `bson:"network,omitempty" json:"network,omitempty"`
+	OS         string    `bson:"os,omitempty" json:"os,omitempty"`
+	Arch       string    `bson:"arch,omitempty" json:"arch,omitempty"`
+	ReportedAt time.Time `bson:"reported_at" json:"reported_at"`
+	// Outdated clients run a version below the configured minimum
+	Outdated      bool       `bson:"outdated" json:"outdated"`
+	OutdatedSince *time.Time `bson:"outdated_since,omitempty" json:"outdated_since,omitempty"`
+	// RewardEligible is false once an outdated client's grace period is over
+	RewardEligible bool `bson:"reward_eligible" json:"reward_eligible"`
+}
+
+// SameBuild reports whether two versions name the same build on the same
+// network and platform
+func (v *ClientVersion) SameBuild(o *ClientVersion) bool {
+	if v == nil || o == nil {
+		return v == o
+	}
+	return v.Version == o.Version && v.Network == o.Network && v.OS == o.OS && v.Arch == o.Arch
+}
+
+// RewardEligible reports whether the client's version lets it earn rewards.
+// Clients without a stored version are eligible.
+func (c ClientInfo) RewardEligible() bool {
+	return c.Version == nil || c.Version.RewardEligible
+}
+
+// VersionChange records a client switching to another build
+type VersionChange struct {
+	ClientAddress string    `bson:"client_address" json:"client_address"`
+	Version       string    `bson:"version,omitempty" json:"version,omitempty"`
+	Network       string    `bson:"network,omitempty" json:"network,omitempty"`
+	OS            string    `bson:"os,omitempty" json:"os,omitempty"`
+	Arch          string    `bson:"arch,omitempty" json:"arch,omitempty"`
+	Timestamp     time.Time `bson:"timestamp" json:"timestamp"`
+}
+
+func (d *Database) SetClientVersion(ctx context.Context, address string, version *ClientVersion) error {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	address = strings.ToLower(address)
+	update := bson.M{"$unset": bson.M{"version": ""}}
+	if version != nil {
+		update = bson.M{"$set": bson.M{"version": version}}
+	}
+
+	var previous ClientInfo
+	opts := options.FindOneAndUpdate().
+		SetProjection(bson.M{"version": 1}).
+		SetReturnDocument(options.Before)
+	err := d.clients.FindOneAndUpdate(ctx, bson.M{"address": address}, update, opts).Decode(&previous)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if version == nil || version.SameBuild(previous.Version) {
+		return nil
+	}
+	_, err = d.versionHistory.InsertOne(ctx, VersionChange{
+		ClientAddress: address,
+		Version:       version.Version,
+		Network:       version.Network,
+		OS:            version.OS,
+		Arch:          version.Arch,
+		Timestamp:     version.ReportedAt,
+	})
+	return err
+}
+
+func (d *Database) GetVersionHistory(ctx context.Context, address string) ([]VersionChange, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}})
+	cursor, err := d.versionHistory.Find(ctx, bson.M{"client_address": strings.ToLower(address)}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	changes := []VersionChange{}
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (d *Database) GetClientVersions(ctx context.Context) (map[string]ClientVersion, error) {
+	ctx, cancel := d.withTimeout(ctx)
+	defer cancel()
+
+	opts := options.Find().SetProjection(bson.M{"address": 1, "version": 1})
+	cursor, err := d.clients.Find(ctx, bson.M{"version": bson.M{"$exists": true}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	versions := make(map[string]ClientVersion)
+	for cursor.Next(ctx) {
+		var client ClientInfo
+		if err := cursor.Decode(&client); err != nil {
+			return nil, err
+		}
+		if client.Version != nil {
+			versions[client.Address] = *client.Version
+		}
+	}
+	return versions, cursor.Err()
+}
@@ -0,0 +1,10 @@
+// Package e2e drives the service end to end: light client heartbeats,
+// delegations and revocations go through the real router over HTTP and
+// results are read back from /clients and /delegations.
+//
+// The ERC-1155 and DelegateRegistry contracts in testdata are deployed on
+// go-ethereum's simulated backend, and the service reads them through the
+// generated delegation binding and nft.NFTChecker as it would from a node.
+// MongoDB is stood in for by the in-memory store. The harness and the
+// scenarios live in the package's tests.
+package e2e
@@ -0,0 +1,212 @@
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/handlers"
+	"monitoring-service/internal/readiness"
+)
+
+// TestFlow drives the register → delegate → heartbeat → uptime → revoke
+// flow against contracts deployed on a simulated chain
+func TestFlow(t *testing.T) {
+	h := New(t)
+
+	operator := common.HexToAddress("0x00000000000000000000000000000000000a0001")
+	holderKey, strangerKey := h.Account(), h.Account()
+	holder := crypto.PubkeyToAddress(holderKey.PublicKey)
+	stranger := crypto.PubkeyToAddress(strangerKey.PublicKey)
+	operatorKey := strings.ToLower(operator.Hex())
+
+	h.Mint(holder, 1, 3)
+	h.Mint(stranger, 2, 4)
+
+	t.Run("RejectsWithoutDelegations", func(t *testing.T) {
+		status, code := h.Heartbeat(operator, "5")
+		if status != http.StatusForbidden || code != handlers.ErrCodeNoDelegations {
+			t.Fatalf("heartbeat = %d %s, want %d %s", status, code, http.StatusForbidden, handlers.ErrCodeNoDelegations)
+		}
+		if h.Client(operator) != nil {
+			t.Fatal("operator registered without delegations")
+		}
+	})
+
+	t.Run("LegacyRejection", func(t *testing.T) {
+		// The unversioned route answers rejections with 200 and an error status
+		body := `{"address":"` + operator.Hex() + `","commission_rate":"5"}`
+		resp, err := http.Post(h.Server.URL+"/check-nft", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("post heartbeat: %v", err)
+		}
+		defer resp.Body.Close()
+
+		var legacy handlers.CheckNFTResponse
+		if err := json.NewDecoder(resp.Body).Decode(&legacy); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK || legacy.Status != "error" || legacy.Message == "" {
+			t.Errorf("/check-nft = %d %+v, want 200 with status error and a message", resp.StatusCode, legacy)
+		}
+	})
+
+	t.Run("RegistersOnDelegation", func(t *testing.T) {
+		// Delegates more than the holder owns, so the amount is capped
+		h.Delegate(holderKey, operator, 1, 5)
+		// Rights the service does not accept are ignored
+		h.DelegateWithRights(strangerKey, operator, 2, [32]byte{31: 0x02}, 4)
+
+		if status, code := h.Heartbeat(operator, "5"); status != http.StatusOK {
+			t.Fatalf("heartbeat = %d %s, want 200", status, code)
+		}
+
+		client := h.Client(operator)
+		if client == nil {
+			t.Fatal("operator not listed in /clients")
+		}
+		if client.NFTAmount != 3 || client.CommissionRate != 5 || client.Status != database.StatusActive {
+			t.Errorf("unexpected client: %+v", client)
+		}
+		if delegated := h.Delegations(holder); delegated[operatorKey] != 3 {
+			t.Errorf("/delegations for holder = %v, want %s: 3", delegated, operatorKey)
+		}
+		if delegated := h.Delegations(stranger); len(delegated) != 0 {
+			t.Errorf("/delegations for stranger = %v, want none", delegated)
+		}
+	})
+
+	t.Run("HeartbeatsAccrueUptime", func(t *testing.T) {
+		// Heartbeats carry the whole seconds since the previous one and only
+		// count towards uptime when that is non-zero
+		time.Sleep(1100 * time.Millisecond)
+		if status, code := h.Heartbeat(operator, "6"); status != http.StatusOK {
+			t.Fatalf("heartbeat = %d %s, want 200", status, code)
+		}
+
+		client := h.Client(operator)
+		if client == nil {
+			t.Fatal("operator not listed in /clients")
+		}
+		if client.AllUptimePercentage <= 0 || client.WeeklyUptimePercentage <= 0 {
+			t.Errorf("uptime not recorded: all=%v weekly=%v", client.AllUptimePercentage, client.WeeklyUptimePercentage)
+		}
+		if client.CommissionRate != 6 || client.TotalTime < 1 {
+			t.Errorf("unexpected client: %+v", client)
+		}
+	})
+
+	t.Run("RevocationClearsDelegation", func(t *testing.T) {
+		h.Revoke(holderKey, operator, 1)
+
+		if status, code := h.Heartbeat(operator, "6"); status != http.StatusOK {
+			t.Fatalf("heartbeat = %d %s, want 200", status, code)
+		}
+
+		if client := h.Client(operator); client == nil || client.NFTAmount != 0 {
+			t.Errorf("client after revocation = %+v, want NFT amount 0", client)
+		}
+		if delegated := h.Delegations(holder); len(delegated) != 0 {
+			t.Errorf("/delegations for holder after revocation = %v, want none", delegated)
+		}
+	})
+
+	t.Run("ChainFailure", func(t *testing.T) {
+		h.Faults.FailNext(MethodGetIncomingDelegations, errors.New("connection refused"))
+		status, code := h.Heartbeat(operator, "6")
+		if status != http.StatusBadGateway || code != handlers.ErrCodeChainUnavailable {
+			t.Errorf("heartbeat = %d %s, want %d %s", status, code, http.StatusBadGateway, handlers.ErrCodeChainUnavailable)
+		}
+	})
+
+	t.Run("ChainTimeout", func(t *testing.T) {
+		h.Faults.SetLatency(MethodGetIncomingDelegations, time.Minute)
+		defer h.Faults.SetLatency(MethodGetIncomingDelegations, 0)
+
+		start := time.Now()
+		status, code := h.Heartbeat(operator, "6")
+		if status != http.StatusGatewayTimeout || code != handlers.ErrCodeTimeout {
+			t.Errorf("heartbeat = %d %s, want %d %s", status, code, http.StatusGatewayTimeout, handlers.ErrCodeTimeout)
+		}
+		if elapsed := time.Since(start); elapsed > h.Settings.Get().ChainTimeout+time.Second {
+			t.Errorf("heartbeat took %v, want the chain timeout of %v", elapsed, h.Settings.Get().ChainTimeout)
+		}
+	})
+
+	t.Run("RetriesAreIdempotent", func(t *testing.T) {
+		send := func(req handlers.CheckNFTRequest) (int, handlers.ErrorCode) {
+			req.Address, req.CommissionRate = operator.Hex(), "6"
+			return h.Send(req)
+		}
+
+		if status, code := send(handlers.CheckNFTRequest{IdempotencyKey: "heartbeat-1"}); status != http.StatusOK {
+			t.Fatalf("heartbeat = %d %s, want 200", status, code)
+		}
+		before, err := h.Store.GetClient(context.Background(), operatorKey)
+		if err != nil || before == nil {
+			t.Fatalf("GetClient = %v, %v", before, err)
+		}
+		if status, code := send(handlers.CheckNFTRequest{IdempotencyKey: "heartbeat-1"}); status != http.StatusOK {
+			t.Errorf("retried heartbeat = %d %s, want the original 200", status, code)
+		}
+		after, err := h.Store.GetClient(context.Background(), operatorKey)
+		if err != nil || after == nil {
+			t.Fatalf("GetClient = %v, %v", after, err)
+		}
+		if !after.LastHeartbeat.Equal(before.LastHeartbeat) || after.TotalTime != before.TotalTime {
+			t.Errorf("retry was counted: last heartbeat %v -> %v, total time %d -> %d",
+				before.LastHeartbeat, after.LastHeartbeat, before.TotalTime, after.TotalTime)
+		}
+
+		if status, code := send(handlers.CheckNFTRequest{Sequence: 10}); status != http.StatusOK {
+			t.Fatalf("heartbeat with sequence 10 = %d %s, want 200", status, code)
+		}
+		if status, code := send(handlers.CheckNFTRequest{Sequence: 10}); status != http.StatusOK {
+			t.Errorf("retried sequence 10 = %d %s, want the original 200", status, code)
+		}
+		if status, code := send(handlers.CheckNFTRequest{Sequence: 9}); status != http.StatusConflict || code != handlers.ErrCodeHeartbeatOutOfOrder {
+			t.Errorf("sequence 9 after 10 = %d %s, want %d %s", status, code, http.StatusConflict, handlers.ErrCodeHeartbeatOutOfOrder)
+		}
+
+		future := time.Now().Add(time.Hour)
+		if status, code := send(handlers.CheckNFTRequest{Timestamp: &future}); status != http.StatusBadRequest || code != handlers.ErrCodeTimestampInFuture {
+			t.Errorf("heartbeat from the future = %d %s, want %d %s", status, code, http.StatusBadRequest, handlers.ErrCodeTimestampInFuture)
+		}
+		sent := time.Now()
+		if status, code := send(handlers.CheckNFTRequest{Timestamp: &sent}); status != http.StatusOK {
+			t.Fatalf("timestamped heartbeat = %d %s, want 200", status, code)
+		}
+		earlier := sent.Add(-time.Second)
+		if status, code := send(handlers.CheckNFTRequest{Timestamp: &earlier}); status != http.StatusConflict || code != handlers.ErrCodeHeartbeatOutOfOrder {
+			t.Errorf("earlier timestamp = %d %s, want %d %s", status, code, http.StatusConflict, handlers.ErrCodeHeartbeatOutOfOrder)
+		}
+	})
+
+	t.Run("Readiness", func(t *testing.T) {
+		if status, report := h.Ready(); status != http.StatusOK || !report.Ready() {
+			t.Errorf("/readyz = %d %+v, want %d ready", status, report, http.StatusOK)
+		}
+
+		h.Faults.FailNext(MethodBlockNumber, errors.New("connection refused"))
+		status, report := h.Ready()
+		if status != http.StatusServiceUnavailable || report.Status != readiness.StatusNotReady {
+			t.Errorf("/readyz with the RPC down = %d %s, want %d %s", status, report.Status, http.StatusServiceUnavailable, readiness.StatusNotReady)
+		}
+		for _, check := range report.Checks {
+			want := readiness.StatusUp
+			if check.Name == "rpc" {
+				want = readiness.StatusDown
+			}
+			if check.Status != want {
+				t.Errorf("%s check = %s, want %s", check.Name, check.Status, want)
+			}
+		}
+	})
+}
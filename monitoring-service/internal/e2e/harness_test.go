@@ -0,0 +1,489 @@
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient/simulated"
+	"github.com/ethereum/go-ethereum/params"
+	"monitoring-service/internal/access"
+	availfake "monitoring-service/internal/avail/fake"
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/blockchain/delegation"
+	"monitoring-service/internal/blockchain/nft"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/database/memory"
+	"monitoring-service/internal/events"
+	"monitoring-service/internal/handlers"
+	"monitoring-service/internal/liveness"
+	"monitoring-service/internal/logging"
+	"monitoring-service/internal/ratelimit"
+	"monitoring-service/internal/readiness"
+	"monitoring-service/internal/router"
+	"monitoring-service/pkg/config"
+)
+
+// The contracts in testdata, compiled with testdata/compile.js
+var (
+	//go:embed testdata/TestERC1155.abi
+	erc1155ABI string
+	//go:embed testdata/TestERC1155.bin
+	erc1155Bin string
+	//go:embed testdata/TestDelegateRegistry.bin
+	registryBin string
+)
+
+// Rights are the delegation rights the service is configured to accept
+var Rights = [32]byte{31: 0x01}
+
+// AvailFinalized is the Avail chain's finalized head when the harness starts
+const AvailFinalized = 1000
+
+// Calls Faults can script. Contract calls are named after their ABI method.
+const (
+	MethodGetIncomingDelegations = "getIncomingDelegations"
+	MethodBlockNumber            = "eth_blockNumber"
+)
+
+// Harness is a running service reading contracts deployed on a simulated
+// chain, with an in-memory store
+type Harness struct {
+	t       testing.TB
+	Backend *simulated.Backend
+	// Faults scripts errors and latency into the service's chain reads
+	Faults   *Faults
+	NFT      common.Address
+	Registry common.Address
+	Store    *memory.Store
+	Broker   *events.Broker
+	// Policy starts from the BLOCKLIST and ALLOWLIST env and can be Set by tests
+	Policy *access.Policy
+	// Avail is the chain liveness reports are checked against
+	Avail *availfake.Chain
+	// Settings is the running config. Tests can change the environment and
+	// Reload it.
+	Settings *config.Live
+	Server   *httptest.Server
+
+	chainID  *big.Int
+	deployer *ecdsa.PrivateKey
+	erc1155  *bind.BoundContract
+	registry *delegation.DelegationTransactor
+}
+
+// New deploys the contracts and starts the service. Both are shut down when
+// the test finishes.
+func New(t testing.TB) *Harness {
+	t.Helper()
+
+	deployer, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("generate deployer key: %v", err)
+	}
+	backend := simulated.NewBackend(types.GenesisAlloc{
+		crypto.PubkeyToAddress(deployer.PublicKey): {Balance: new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.Ether))},
+	})
+	t.Cleanup(func() { backend.Close() })
+	client := backend.Client()
+
+	h := &Harness{t: t, Backend: backend, deployer: deployer}
+	h.chainID, err = client.ChainID(context.Background())
+	if err != nil {
+		t.Fatalf("read chain ID: %v", err)
+	}
+
+	erc1155, err := abi.JSON(strings.NewReader(erc1155ABI))
+	if err != nil {
+		t.Fatalf("parse ERC-1155 ABI: %v", err)
+	}
+	registryABI, err := delegation.DelegationMetaData.GetAbi()
+	if err != nil {
+		t.Fatalf("parse DelegateRegistry ABI: %v", err)
+	}
+	var tx *types.Transaction
+	h.NFT, tx, h.erc1155, err = bind.DeployContract(h.transactor(deployer), erc1155, common.FromHex(strings.TrimSpace(erc1155Bin)), client)
+	h.mine("deploy ERC-1155", tx, err)
+	h.Registry, tx, _, err = bind.DeployContract(h.transactor(deployer), *registryABI, common.FromHex(strings.TrimSpace(registryBin)), client)
+	h.mine("deploy DelegateRegistry", tx, err)
+	h.registry, err = delegation.NewDelegationTransactor(h.Registry, client)
+	if err != nil {
+		t.Fatalf("bind DelegateRegistry transactor: %v", err)
+	}
+
+	// The configuration is loaded once from the environment, as at startup
+	env := map[string]string{
+		"MONGO_URI":                 "memory://",
+		"MONGO_DB":                  "e2e",
+		"RPC_URL":                   "simulated://",
+		"NFT_CONTRACT_ADDRESS":      h.NFT.Hex(),
+		"DELEGATE_CONTRACT_ADDRESS": h.Registry.Hex(),
+		"RIGHTS":                    common.Bytes2Hex(Rights[:]),
+		"CHECK_NFT_INTERVAL":        "5",
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	// Scenarios send heartbeats back to back, so rate limits are off unless
+	// the test sets them
+	for _, key := range []string{"RATE_LIMIT_ADDRESS_PER_MINUTE", "RATE_LIMIT_IP_PER_MINUTE"} {
+		if _, ok := os.LookupEnv(key); !ok {
+			t.Setenv(key, "0")
+		}
+	}
+	// A short chain timeout keeps timeout scenarios quick
+	if _, ok := os.LookupEnv("CHAIN_TIMEOUT_SECONDS"); !ok {
+		t.Setenv("CHAIN_TIMEOUT_SECONDS", "1")
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	h.Faults = newFaults(client, erc1155, *registryABI)
+	delegateRegistry, err := delegation.NewDelegationCaller(h.Registry, h.Faults)
+	if err != nil {
+		t.Fatalf("bind delegate registry: %v", err)
+	}
+	nftChecker := nft.NewNFTCheckerWithCaller(h.Faults, h.NFT.Hex())
+
+	h.Store = memory.New(logging.Discard())
+	h.Store.SetUptimePolicy(cfg.UptimePolicy)
+	h.Broker = events.NewBroker(events.DefaultHistorySize, events.DefaultBufferSize)
+	h.Policy = access.NewPolicy(cfg.Blocklist, cfg.Allowlist)
+	limiter := ratelimit.FromConfig(cfg.RateLimit, nil, logging.Discard())
+	h.Avail = availfake.New(AvailFinalized)
+	livenessChecker := liveness.NewChecker(h.Avail, cfg.AvailMaxBlockLag, logging.Discard())
+	livenessChecker.SetTimeout(cfg.ChainTimeout)
+	h.Settings = config.NewLive(cfg)
+	h.Settings.OnReload(func(cfg *config.Config) {
+		h.Policy.Set(cfg.Blocklist, cfg.Allowlist)
+		limiter.SetLimits(ratelimit.Limits(cfg.RateLimit))
+		livenessChecker.SetMaxLag(cfg.AvailMaxBlockLag)
+		h.Store.SetUptimePolicy(cfg.UptimePolicy)
+	})
+	// Chain reads time out as in production but are not retried, so
+	// scenarios can script failures one call at a time
+	chainPolicy := blockchain.RetryPolicy{Attempts: 1, Timeout: cfg.ChainTimeout}
+	handler, err := router.New(h.Settings, []router.Network{{
+		ID:          cfg.NetworkID,
+		Store:       h.Store,
+		Balances:    blockchain.WithBalanceTracing(blockchain.WithBalanceRetry(nftChecker, chainPolicy)),
+		Delegations: blockchain.WithDelegationTracing(blockchain.WithDelegationRetry(delegateRegistry, chainPolicy), h.Registry),
+		Head:        h.Faults,
+		Broker:      h.Broker,
+	}}, h.Policy, limiter, livenessChecker)
+	if err != nil {
+		t.Fatalf("create router: %v", err)
+	}
+	h.Server = httptest.NewServer(handler)
+
+	t.Cleanup(func() {
+		h.Server.Close()
+		h.Broker.Close()
+		h.Store.Close()
+	})
+
+	return h
+}
+
+// Account returns a new externally owned account funded with ether for gas
+func (h *Harness) Account() *ecdsa.PrivateKey {
+	h.t.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		h.t.Fatalf("generate key: %v", err)
+	}
+	to := crypto.PubkeyToAddress(key.PublicKey)
+
+	client := h.Backend.Client()
+	ctx := context.Background()
+	nonce, err := client.PendingNonceAt(ctx, crypto.PubkeyToAddress(h.deployer.PublicKey))
+	if err != nil {
+		h.t.Fatalf("read deployer nonce: %v", err)
+	}
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		h.t.Fatalf("suggest gas price: %v", err)
+	}
+	tx, err := types.SignNewTx(h.deployer, types.LatestSignerForChainID(h.chainID), &types.LegacyTx{
+		Nonce:    nonce,
+		To:       &to,
+		Value:    big.NewInt(params.Ether),
+		Gas:      params.TxGas,
+		GasPrice: gasPrice,
+	})
+	if err == nil {
+		err = client.SendTransaction(ctx, tx)
+	}
+	h.mine("fund account", tx, err)
+	return key
+}
+
+// Mint gives owner amount of the NFT with tokenID
+func (h *Harness) Mint(owner common.Address, tokenID, amount int64) {
+	h.t.Helper()
+	tx, err := h.erc1155.Transact(h.transactor(h.deployer), "mint", owner, big.NewInt(tokenID), big.NewInt(amount))
+	h.mine("mint", tx, err)
+}
+
+// Delegate delegates amount of tokenID from holder to operator with the
+// rights the service accepts
+func (h *Harness) Delegate(holder *ecdsa.PrivateKey, operator common.Address, tokenID, amount int64) {
+	h.t.Helper()
+	h.DelegateWithRights(holder, operator, tokenID, Rights, amount)
+}
+
+// DelegateWithRights delegates amount of tokenID from holder to operator
+// with the given rights
+func (h *Harness) DelegateWithRights(holder *ecdsa.PrivateKey, operator common.Address, tokenID int64, rights [32]byte, amount int64) {
+	h.t.Helper()
+	tx, err := h.registry.DelegateERC1155(h.transactor(holder), operator, h.NFT, big.NewInt(tokenID), rights, big.NewInt(amount))
+	h.mine("delegate", tx, err)
+}
+
+// Revoke removes the delegation of tokenID from holder to operator, as the
+// registry does for an amount of 0
+func (h *Harness) Revoke(holder *ecdsa.PrivateKey, operator common.Address, tokenID int64) {
+	h.t.Helper()
+	h.Delegate(holder, operator, tokenID, 0)
+}
+
+func (h *Harness) transactor(key *ecdsa.PrivateKey) *bind.TransactOpts {
+	h.t.Helper()
+	opts, err := bind.NewKeyedTransactorWithChainID(key, h.chainID)
+	if err != nil {
+		h.t.Fatalf("create transactor: %v", err)
+	}
+	return opts
+}
+
+// mine commits the block holding tx and fails the test if tx was not sent
+// or reverted
+func (h *Harness) mine(what string, tx *types.Transaction, err error) {
+	h.t.Helper()
+	if err != nil {
+		h.t.Fatalf("%s: %v", what, err)
+	}
+	h.Backend.Commit()
+
+	receipt, err := h.Backend.Client().TransactionReceipt(context.Background(), tx.Hash())
+	if err != nil {
+		h.t.Fatalf("%s: read receipt: %v", what, err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		h.t.Fatalf("%s: transaction reverted", what)
+	}
+}
+
+// Heartbeat posts a light client heartbeat to /check-nft and returns the
+// response status with the error code, if any
+func (h *Harness) Heartbeat(operator common.Address, commissionRate string) (int, handlers.ErrorCode) {
+	h.t.Helper()
+	return h.Send(handlers.CheckNFTRequest{
+		Address:        operator.Hex(),
+		CommissionRate: commissionRate,
+		OperatorName:   "e2e-" + operator.Hex()[2:8],
+	})
+}
+
+// Send posts a heartbeat request as is and returns the status code and, on
+// failure, the error code
+func (h *Harness) Send(req handlers.CheckNFTRequest) (int, handlers.ErrorCode) {
+	h.t.Helper()
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		h.t.Fatalf("encode heartbeat: %v", err)
+	}
+
+	resp, err := http.Post(h.Server.URL+"/v1/check-nft", "application/json", bytes.NewReader(body))
+	if err != nil {
+		h.t.Fatalf("post heartbeat: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return resp.StatusCode, ""
+	}
+	var errResp handlers.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		h.t.Fatalf("decode heartbeat error (status %d): %v", resp.StatusCode, err)
+	}
+	return resp.StatusCode, errResp.Code
+}
+
+// Clients returns the /clients listing
+func (h *Harness) Clients() []database.ClientInfo {
+	h.t.Helper()
+
+	var resp handlers.GetClientsResponse
+	h.get("/clients", &resp)
+	return resp.Data
+}
+
+// Client returns one client from the /clients listing, or nil
+func (h *Harness) Client(operator common.Address) *database.ClientInfo {
+	h.t.Helper()
+
+	address := strings.ToLower(operator.Hex())
+	for _, client := range h.Clients() {
+		if client.Address == address {
+			return &client
+		}
+	}
+	return nil
+}
+
+// Delegations returns the /delegations view for holder, keyed by operator
+func (h *Harness) Delegations(holder common.Address) map[string]int64 {
+	h.t.Helper()
+
+	var resp handlers.GetDelegationsResponse
+	h.get("/delegations?address="+holder.Hex(), &resp)
+
+	delegated := make(map[string]int64, len(resp.Clients))
+	for _, client := range resp.Clients {
+		delegated[client.ClientInfo.Address] = client.ClientInfo.NFTAmount
+	}
+	return delegated
+}
+
+// Ready returns the /readyz status code and report
+func (h *Harness) Ready() (int, readiness.Report) {
+	h.t.Helper()
+
+	resp, err := http.Get(h.Server.URL + "/readyz")
+	if err != nil {
+		h.t.Fatalf("GET /readyz: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var report readiness.Report
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		h.t.Fatalf("GET /readyz: decode response: %v", err)
+	}
+	return resp.StatusCode, report
+}
+
+func (h *Harness) get(path string, v interface{}) {
+	h.t.Helper()
+
+	resp, err := http.Get(h.Server.URL + path)
+	if err != nil {
+		h.t.Fatalf("GET %s: %v", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		h.t.Fatalf("GET %s: status %d: %s", path, resp.StatusCode, body)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		h.t.Fatalf("GET %s: decode response: %v", path, err)
+	}
+}
+
+// Faults is the service's view of the simulated chain. Calls go through to
+// the chain unless a failure or latency has been scripted for them.
+type Faults struct {
+	client  simulated.Client
+	methods map[[4]byte]string
+
+	mu       sync.Mutex
+	failures map[string][]error
+	latency  map[string]time.Duration
+}
+
+var (
+	_ bind.ContractCaller     = (*Faults)(nil)
+	_ ethereum.ContractCaller = (*Faults)(nil)
+	_ blockchain.HeadReader   = (*Faults)(nil)
+)
+
+func newFaults(client simulated.Client, contracts ...abi.ABI) *Faults {
+	methods := make(map[[4]byte]string)
+	for _, contract := range contracts {
+		for _, method := range contract.Methods {
+			methods[[4]byte(method.ID)] = method.RawName
+		}
+	}
+	return &Faults{
+		client:   client,
+		methods:  methods,
+		failures: make(map[string][]error),
+		latency:  make(map[string]time.Duration),
+	}
+}
+
+// FailNext makes the next len(errs) calls to method fail with errs, in order
+func (f *Faults) FailNext(method string, errs ...error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures[method] = append(f.failures[method], errs...)
+}
+
+// SetLatency delays every call to method by d
+func (f *Faults) SetLatency(method string, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency[method] = d
+}
+
+// call applies the scripted latency and returns the next scripted error for
+// method, if any. Like an RPC, it gives up when ctx is done during the
+// latency.
+func (f *Faults) call(ctx context.Context, method string) error {
+	f.mu.Lock()
+	latency := f.latency[method]
+	var err error
+	if queued := f.failures[method]; len(queued) > 0 {
+		err, f.failures[method] = queued[0], queued[1:]
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-time.After(latency):
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f *Faults) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
+	return f.client.CodeAt(ctx, contract, blockNumber)
+}
+
+func (f *Faults) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	if len(call.Data) >= 4 {
+		if err := f.call(ctx, f.methods[[4]byte(call.Data[:4])]); err != nil {
+			return nil, err
+		}
+	}
+	return f.client.CallContract(ctx, call, blockNumber)
+}
+
+func (f *Faults) BlockNumber(ctx context.Context) (uint64, error) {
+	if err := f.call(ctx, MethodBlockNumber); err != nil {
+		return 0, err
+	}
+	return f.client.BlockNumber(ctx)
+}
@@ -0,0 +1,212 @@
+// SPDX-License-Identifier: MIT
+pragma solidity 0.8.21;
+
+/// @notice Implements the delegation and lookup functions of the
+/// DelegateRegistry v2 ABI in internal/blockchain/abi/delegation_registry.json
+/// for the end-to-end tests. Calls are encoded as against the deployed
+/// registry, and lookups follow its rules: an empty rights value matches
+/// any rights asked for, and a delegation for all or for the contract covers
+/// every token. Storage is a plain list. multicall, sweep and the raw
+/// storage reads are left out.
+contract TestDelegateRegistry {
+    enum DelegationType {
+        NONE,
+        ALL,
+        CONTRACT,
+        ERC721,
+        ERC20,
+        ERC1155
+    }
+
+    struct Delegation {
+        DelegationType type_;
+        address to;
+        address from;
+        bytes32 rights;
+        address contract_;
+        uint256 tokenId;
+        uint256 amount;
+    }
+
+    event DelegateAll(address indexed from, address indexed to, bytes32 rights, bool enable);
+    event DelegateContract(address indexed from, address indexed to, address indexed contract_, bytes32 rights, bool enable);
+    event DelegateERC721(address indexed from, address indexed to, address indexed contract_, uint256 tokenId, bytes32 rights, bool enable);
+    event DelegateERC20(address indexed from, address indexed to, address indexed contract_, bytes32 rights, uint256 amount);
+    event DelegateERC1155(address indexed from, address indexed to, address indexed contract_, uint256 tokenId, bytes32 rights, uint256 amount);
+
+    Delegation[] private _delegations;
+    /// @dev Position of each delegation in _delegations, plus one
+    mapping(bytes32 => uint256) private _positions;
+
+    function delegateAll(address to, bytes32 rights, bool enable) external payable returns (bytes32 hash) {
+        hash = _store(Delegation(DelegationType.ALL, to, msg.sender, rights, address(0), 0, 0), enable);
+        emit DelegateAll(msg.sender, to, rights, enable);
+    }
+
+    function delegateContract(address to, address contract_, bytes32 rights, bool enable)
+        external
+        payable
+        returns (bytes32 hash)
+    {
+        hash = _store(Delegation(DelegationType.CONTRACT, to, msg.sender, rights, contract_, 0, 0), enable);
+        emit DelegateContract(msg.sender, to, contract_, rights, enable);
+    }
+
+    function delegateERC721(address to, address contract_, uint256 tokenId, bytes32 rights, bool enable)
+        external
+        payable
+        returns (bytes32 hash)
+    {
+        hash = _store(Delegation(DelegationType.ERC721, to, msg.sender, rights, contract_, tokenId, 0), enable);
+        emit DelegateERC721(msg.sender, to, contract_, tokenId, rights, enable);
+    }
+
+    function delegateERC20(address to, address contract_, bytes32 rights, uint256 amount)
+        external
+        payable
+        returns (bytes32 hash)
+    {
+        hash = _store(Delegation(DelegationType.ERC20, to, msg.sender, rights, contract_, 0, amount), amount != 0);
+        emit DelegateERC20(msg.sender, to, contract_, rights, amount);
+    }
+
+    /// @notice An amount of 0 revokes the delegation
+    function delegateERC1155(address to, address contract_, uint256 tokenId, bytes32 rights, uint256 amount)
+        external
+        payable
+        returns (bytes32 hash)
+    {
+        hash = _store(Delegation(DelegationType.ERC1155, to, msg.sender, rights, contract_, tokenId, amount), amount != 0);
+        emit DelegateERC1155(msg.sender, to, contract_, tokenId, rights, amount);
+    }
+
+    function getIncomingDelegations(address to) external view returns (Delegation[] memory delegations_) {
+        return _select(to, true);
+    }
+
+    function getOutgoingDelegations(address from) external view returns (Delegation[] memory delegations_) {
+        return _select(from, false);
+    }
+
+    function checkDelegateForAll(address to, address from, bytes32 rights) public view returns (bool) {
+        return _find(DelegationType.ALL, to, from, rights, address(0), 0) != 0;
+    }
+
+    function checkDelegateForContract(address to, address from, address contract_, bytes32 rights)
+        public
+        view
+        returns (bool)
+    {
+        return checkDelegateForAll(to, from, rights)
+            || _find(DelegationType.CONTRACT, to, from, rights, contract_, 0) != 0;
+    }
+
+    function checkDelegateForERC721(address to, address from, address contract_, uint256 tokenId, bytes32 rights)
+        external
+        view
+        returns (bool)
+    {
+        return checkDelegateForContract(to, from, contract_, rights)
+            || _find(DelegationType.ERC721, to, from, rights, contract_, tokenId) != 0;
+    }
+
+    function checkDelegateForERC20(address to, address from, address contract_, bytes32 rights)
+        external
+        view
+        returns (uint256)
+    {
+        if (checkDelegateForContract(to, from, contract_, rights)) {
+            return type(uint256).max;
+        }
+        return _find(DelegationType.ERC20, to, from, rights, contract_, 0);
+    }
+
+    function checkDelegateForERC1155(address to, address from, address contract_, uint256 tokenId, bytes32 rights)
+        external
+        view
+        returns (uint256)
+    {
+        if (checkDelegateForContract(to, from, contract_, rights)) {
+            return type(uint256).max;
+        }
+        return _find(DelegationType.ERC1155, to, from, rights, contract_, tokenId);
+    }
+
+    function supportsInterface(bytes4 interfaceId) external pure returns (bool) {
+        return interfaceId == 0x01ffc9a7;
+    }
+
+    function _hash(Delegation memory d) private pure returns (bytes32) {
+        return keccak256(abi.encode(d.type_, d.to, d.from, d.rights, d.contract_, d.tokenId));
+    }
+
+    /// @dev Adds or updates the delegation, or removes it when enable is false
+    function _store(Delegation memory d, bool enable) private returns (bytes32 hash) {
+        hash = _hash(d);
+        uint256 position = _positions[hash];
+        if (enable) {
+            if (d.type_ != DelegationType.ERC20 && d.type_ != DelegationType.ERC1155) {
+                d.amount = 0;
+            }
+            if (position == 0) {
+                _delegations.push(d);
+                _positions[hash] = _delegations.length;
+            } else {
+                _delegations[position - 1] = d;
+            }
+            return hash;
+        }
+        if (position == 0) {
+            return hash;
+        }
+        Delegation memory last = _delegations[_delegations.length - 1];
+        _delegations[position - 1] = last;
+        _positions[_hash(last)] = position;
+        _delegations.pop();
+        delete _positions[hash];
+    }
+
+    /// @dev The amount delegated, or max for delegations without one. A
+    /// delegation with empty rights counts for any rights, and the larger of
+    /// the two amounts is returned.
+    function _find(DelegationType type_, address to, address from, bytes32 rights, address contract_, uint256 tokenId)
+        private
+        view
+        returns (uint256 amount)
+    {
+        amount = _amount(Delegation(type_, to, from, "", contract_, tokenId, 0));
+        if (rights != "") {
+            uint256 withRights = _amount(Delegation(type_, to, from, rights, contract_, tokenId, 0));
+            if (withRights > amount) {
+                amount = withRights;
+            }
+        }
+    }
+
+    function _amount(Delegation memory d) private view returns (uint256) {
+        uint256 position = _positions[_hash(d)];
+        if (position == 0) {
+            return 0;
+        }
+        if (d.type_ != DelegationType.ERC20 && d.type_ != DelegationType.ERC1155) {
+            return type(uint256).max;
+        }
+        return _delegations[position - 1].amount;
+    }
+
+    function _select(address account, bool incoming) private view returns (Delegation[] memory selected) {
+        uint256 count;
+        for (uint256 i = 0; i < _delegations.length; i++) {
+            if ((incoming ? _delegations[i].to : _delegations[i].from) == account) {
+                count++;
+            }
+        }
+        selected = new Delegation[](count);
+        count = 0;
+        for (uint256 i = 0; i < _delegations.length; i++) {
+            if ((incoming ? _delegations[i].to : _delegations[i].from) == account) {
+                selected[count++] = _delegations[i];
+            }
+        }
+    }
+}
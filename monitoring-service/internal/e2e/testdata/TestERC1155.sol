@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: MIT
+pragma solidity 0.8.21;
+
+/// @notice Minimal ERC-1155 for the end-to-end tests. It has the balance
+/// reads nft.NFTChecker makes, and anyone can mint or burn.
+contract TestERC1155 {
+    event TransferSingle(address indexed operator, address indexed from, address indexed to, uint256 id, uint256 value);
+
+    mapping(uint256 => mapping(address => uint256)) private _balances;
+
+    function balanceOf(address account, uint256 id) public view returns (uint256) {
+        return _balances[id][account];
+    }
+
+    function balanceOfBatch(address[] calldata accounts, uint256[] calldata ids)
+        external
+        view
+        returns (uint256[] memory balances)
+    {
+        require(accounts.length == ids.length, "TestERC1155: length mismatch");
+        balances = new uint256[](accounts.length);
+        for (uint256 i = 0; i < accounts.length; i++) {
+            balances[i] = _balances[ids[i]][accounts[i]];
+        }
+    }
+
+    function mint(address to, uint256 id, uint256 amount) external {
+        _balances[id][to] += amount;
+        emit TransferSingle(msg.sender, address(0), to, id, amount);
+    }
+
+    function burn(address from, uint256 id, uint256 amount) external {
+        _balances[id][from] -= amount;
+        emit TransferSingle(msg.sender, from, address(0), id, amount);
+    }
+
+    function supportsInterface(bytes4 interfaceId) external pure returns (bool) {
+        // ERC-165 and ERC-1155
+        return interfaceId == 0x01ffc9a7 || interfaceId == 0xd9b67a26;
+    }
+}
@@ -0,0 +1,37 @@
+// Compiles every .sol file in a directory to <Contract>.bin and
+// <Contract>.abi next to it, with the given solc-js build:
+//
+//	node compile.js ./soljson-v0.8.21+commit.d9974bed.js .
+//
+const fs = require('fs');
+const path = require('path');
+const soljson = require(path.resolve(process.argv[2]));
+const compile = soljson.cwrap('solidity_compile', 'string', ['string', 'number', 'number']);
+const dir = process.argv[3];
+const sources = {};
+for (const f of fs.readdirSync(dir).filter(f => f.endsWith('.sol'))) {
+  sources[f] = { content: fs.readFileSync(path.join(dir, f), 'utf8') };
+}
+const input = {
+  language: 'Solidity',
+  sources,
+  settings: {
+    optimizer: { enabled: true, runs: 200 },
+    evmVersion: 'shanghai',
+    outputSelection: { '*': { '*': ['abi', 'evm.bytecode.object'] } },
+  },
+};
+const out = JSON.parse(compile(JSON.stringify(input), 0, 0));
+let failed = false;
+for (const e of out.errors || []) {
+  console.error(e.formattedMessage);
+  if (e.severity === 'error') failed = true;
+}
+if (failed) process.exit(1);
+for (const f in out.contracts) {
+  for (const name in out.contracts[f]) {
+    const c = out.contracts[f][name];
+    fs.writeFileSync(path.join(dir, name + '.bin'), c.evm.bytecode.object + '\n');
+    fs.writeFileSync(path.join(dir, name + '.abi'), JSON.stringify(c.abi) + '\n');
+  }
+}
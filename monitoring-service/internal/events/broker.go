@@ -0,0 +1,208 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+type Type string
+
+const (
+	HeartbeatAccepted Type = "heartbeat-accepted"
+	StatusChanged     Type = "status-changed"
+	DelegationUpdated Type = "delegation-updated"
+)
+
+const (
+	// Events kept for Last-Event-ID resumption
+	DefaultHistorySize = 1024
+	// Events buffered per subscriber before it is considered too slow
+	DefaultBufferSize = 64
+)
+
+type Event struct {
+	ID        uint64      `json:"id"`
+	Type      Type        `json:"type"`
+	Address   string      `json:"address"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Filter selects the events a subscriber receives. Empty fields match everything.
+type Filter struct {
+	Addresses []string
+	Types     []Type
+}
+
+func (f Filter) matches(e Event) bool {
+	if len(f.Addresses) > 0 && !containsString(f.Addresses, e.Address) {
+		return false
+	}
+	if len(f.Types) > 0 {
+		for _, t := range f.Types {
+			if t == e.Type {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Subscription delivers matching events on C. C is closed when the subscriber
+// falls behind, unsubscribes, or the broker is closed; Lagged reports whether
+// events were dropped so the client should reconnect with Last-Event-ID.
+type Subscription struct {
+	C      <-chan Event
+	ch     chan Event
+	filter Filter
+	lagged bool
+}
+
+func (s *Subscription) Lagged() bool {
+	return s.lagged
+}
+
+// Broker is an in-process pub/sub for live client events. Publish never
+// blocks: a subscriber whose buffer is full is disconnected instead.
+type Broker struct {
+	mu          sync.Mutex
+	nextID      uint64
+	history     []Event
+	historySize int
+	bufferSize  int
+	subscribers map[*Subscription]struct{}
+	closed      bool
+}
+
+// NewBroker creates a broker keeping historySize events for resumption
+func NewBroker(historySize, bufferSize int) *Broker {
+	return &Broker{
+		// Seed IDs from the clock so they keep increasing across restarts
+		nextID:      uint64(time.Now().UnixMicro()),
+		historySize: historySize,
+		bufferSize:  bufferSize,
+		subscribers: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish assigns the event an ID, records it and fans it out to subscribers
+func (b *Broker) Publish(typ Type, address string, data interface{}) Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextID++
+	event := Event{
+		ID:        b.nextID,
+		Type:      typ,
+		Address:   strings.ToLower(address),
+		Timestamp: time.Now(),
+		Data:      data,
+	}
+
+	if b.closed {
+		return event
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- event:
+		default:
+			sub.lagged = true
+			b.remove(sub)
+		}
+	}
+
+	return event
+}
+
+// Subscribe registers a subscriber. When lastEventID is non-zero, retained
+// events after it that match the filter are returned for replay.
+func (b *Broker) Subscribe(filter Filter, lastEventID uint64) (*Subscription, []Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, addr := range filter.Addresses {
+		filter.Addresses[i] = strings.ToLower(addr)
+	}
+
+	ch := make(chan Event, b.bufferSize)
+	sub := &Subscription{C: ch, ch: ch, filter: filter}
+
+	var replay []Event
+	if lastEventID > 0 {
+		for _, event := range b.history {
+			if event.ID > lastEventID && filter.matches(event) {
+				replay = append(replay, event)
+			}
+		}
+	}
+
+	if b.closed {
+		close(ch)
+		return sub, replay
+	}
+
+	b.subscribers[sub] = struct{}{}
+	return sub, replay
+}
+
+// Unsubscribe removes the subscriber and closes its channel
+func (b *Broker) Unsubscribe(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remove(sub)
+}
+
+// Close disconnects every subscriber so long-lived streams end on shutdown
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subscribers {
+		b.remove(sub)
+	}
+}
+
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subscribers[sub]; !ok {
+		return
+	}
+	delete(b.subscribers, sub)
+	close(sub.ch)
+}
+
+func containsString(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
+
+type HeartbeatPayload struct {
+	NFTAmount      int64   `json:"nft_amount"`
+	CommissionRate float64 `json:"commission_rate"`
+	OperatorName   string  `json:"operator_name"`
+}
+
+type StatusChangePayload struct {
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+type DelegationPayload struct {
+	Delegators  map[string]int64 `json:"delegators"`
+	TotalAmount int64            `json:"total_amount"`
+}
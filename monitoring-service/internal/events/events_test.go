@@ -0,0 +1,200 @@
+package events
+
+import (
+	"testing"
+	"time"
+)
+
+const (
+	operator = "0x00000000000000000000000000000000000a0001"
+	other    = "0x00000000000000000000000000000000000a0002"
+)
+
+// receive returns the next event on sub, failing the test if none arrives
+// or C is closed
+func receive(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case event, ok := <-sub.C:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+		return Event{}
+	}
+}
+
+func TestPublishFilters(t *testing.T) {
+	b := NewBroker(DefaultHistorySize, DefaultBufferSize)
+	defer b.Close()
+
+	// Addresses are matched case-insensitively
+	byAddress, _ := b.Subscribe(Filter{Addresses: []string{"0x00000000000000000000000000000000000A0001"}}, 0)
+	byType, _ := b.Subscribe(Filter{Types: []Type{StatusChanged}}, 0)
+	all, _ := b.Subscribe(Filter{}, 0)
+
+	b.Publish(HeartbeatAccepted, other, nil)
+	heartbeat := b.Publish(HeartbeatAccepted, "0x00000000000000000000000000000000000A0001", nil)
+	status := b.Publish(StatusChanged, other, nil)
+
+	if got := receive(t, byAddress); got.ID != heartbeat.ID || got.Address != operator {
+		t.Errorf("address subscriber got %+v, want event %d for %s", got, heartbeat.ID, operator)
+	}
+	if got := receive(t, byType); got.ID != status.ID {
+		t.Errorf("type subscriber got %+v, want event %d", got, status.ID)
+	}
+	for i := 0; i < 3; i++ {
+		receive(t, all)
+	}
+
+	for name, sub := range map[string]*Subscription{"address": byAddress, "type": byType, "all": all} {
+		select {
+		case event := <-sub.C:
+			t.Errorf("%s subscriber got unexpected event %+v", name, event)
+		default:
+		}
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	b := NewBroker(DefaultHistorySize, 2)
+	defer b.Close()
+
+	blocked, _ := b.Subscribe(Filter{}, 0)
+	reading, _ := b.Subscribe(Filter{}, 0)
+
+	// Nothing reads blocked, so its buffer fills after two events
+	published := make(chan struct{})
+	go func() {
+		defer close(published)
+		for i := 0; i < 5; i++ {
+			b.Publish(HeartbeatAccepted, operator, nil)
+			<-reading.C
+		}
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish blocked on a full subscriber")
+	}
+
+	// The buffered events are still delivered, then C is closed
+	for i := 0; i < 2; i++ {
+		if _, ok := <-blocked.C; !ok {
+			t.Fatalf("C closed after %d events, want 2", i)
+		}
+	}
+	if _, ok := <-blocked.C; ok {
+		t.Fatal("C still open after the subscriber fell behind")
+	}
+	if !blocked.Lagged() {
+		t.Error("Lagged = false for a subscriber that fell behind")
+	}
+	if reading.Lagged() {
+		t.Error("Lagged = true for a subscriber that kept up")
+	}
+
+	// Unsubscribing after being dropped is harmless
+	b.Unsubscribe(blocked)
+}
+
+func TestReplay(t *testing.T) {
+	b := NewBroker(4, DefaultBufferSize)
+	defer b.Close()
+
+	var published []Event
+	for i := 0; i < 3; i++ {
+		published = append(published, b.Publish(HeartbeatAccepted, operator, nil))
+		b.Publish(HeartbeatAccepted, other, nil)
+	}
+	// History keeps the last 4 events: operator 2, other 2, operator 3, other 3
+	evicted := published[0]
+
+	tests := []struct {
+		name        string
+		filter      Filter
+		lastEventID uint64
+		want        []uint64
+	}{
+		{
+			name: "NoLastEventID",
+		},
+		{
+			name:        "AfterID",
+			filter:      Filter{Addresses: []string{operator}},
+			lastEventID: published[1].ID,
+			want:        []uint64{published[2].ID},
+		},
+		{
+			name:        "Latest",
+			lastEventID: published[2].ID + 1,
+		},
+		{
+			// Events evicted from the history are lost; replay starts at
+			// the oldest one retained
+			name:        "OlderThanHistory",
+			filter:      Filter{Addresses: []string{operator}},
+			lastEventID: evicted.ID - 1,
+			want:        []uint64{published[1].ID, published[2].ID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, replay := b.Subscribe(tt.filter, tt.lastEventID)
+			defer b.Unsubscribe(sub)
+
+			if len(replay) != len(tt.want) {
+				t.Fatalf("replayed %d events %+v, want IDs %v", len(replay), replay, tt.want)
+			}
+			for i, event := range replay {
+				if event.ID != tt.want[i] {
+					t.Errorf("replay[%d] = %d, want %d", i, event.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReplayFullHistory(t *testing.T) {
+	b := NewBroker(DefaultHistorySize, DefaultBufferSize)
+	defer b.Close()
+
+	first := b.Publish(HeartbeatAccepted, operator, nil)
+	var last Event
+	for i := 0; i < DefaultHistorySize+10; i++ {
+		last = b.Publish(HeartbeatAccepted, operator, nil)
+	}
+
+	_, replay := b.Subscribe(Filter{}, first.ID)
+	if len(replay) != DefaultHistorySize {
+		t.Fatalf("replayed %d events, want the %d retained", len(replay), DefaultHistorySize)
+	}
+	if oldest := last.ID - DefaultHistorySize + 1; replay[0].ID != oldest {
+		t.Errorf("replay starts at %d, want the oldest retained event %d", replay[0].ID, oldest)
+	}
+	if replay[len(replay)-1].ID != last.ID {
+		t.Errorf("replay ends at %d, want %d", replay[len(replay)-1].ID, last.ID)
+	}
+}
+
+func TestClose(t *testing.T) {
+	b := NewBroker(DefaultHistorySize, DefaultBufferSize)
+	sub, _ := b.Subscribe(Filter{}, 0)
+	b.Close()
+
+	if _, ok := <-sub.C; ok {
+		t.Error("C still open after Close")
+	}
+	if sub.Lagged() {
+		t.Error("Lagged = true after Close")
+	}
+
+	// Later subscriptions are closed at once
+	late, _ := b.Subscribe(Filter{}, 0)
+	if _, ok := <-late.C; ok {
+		t.Error("C open for a subscription after Close")
+	}
+}
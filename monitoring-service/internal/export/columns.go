@@ -0,0 +1,45 @@
+package export
+
+import (
+	"monitoring-service/internal/database"
+)
+
+// Column orders below are part of the export contract: append new columns at
+// the end so downstream scripts reading by position keep working.
+
+var ClientColumns = []Column[database.ClientInfo]{
+	{Name: "address", Value: func(c database.ClientInfo) interface{} { return c.Address }},
+	{Name: "operator_name", Value: func(c database.ClientInfo) interface{} { return c.OperatorName }},
+	{Name: "reward_collector_address", Value: func(c database.ClientInfo) interface{} { return c.RewardCollectorAddress }},
+	{Name: "status", Value: func(c database.ClientInfo) interface{} { return c.Status }},
+	{Name: "nft_amount", Value: func(c database.ClientInfo) interface{} { return c.NFTAmount }},
+	{Name: "commission_rate", Value: func(c database.ClientInfo) interface{} { return c.CommissionRate }},
+	{Name: "total_time", Value: func(c database.ClientInfo) interface{} { return c.TotalTime }},
+	{Name: "all_uptime_percentage", Value: func(c database.ClientInfo) interface{} { return c.AllUptimePercentage }},
+	{Name: "weekly_uptime_percentage", Value: func(c database.ClientInfo) interface{} { return c.WeeklyUptimePercentage }},
+	{Name: "last_heartbeat", Value: func(c database.ClientInfo) interface{} { return c.LastHeartbeat }},
+	{Name: "created_at", Value: func(c database.ClientInfo) interface{} { return c.CreatedAt }},
+	{Name: "client_version", Value: func(c database.ClientInfo) interface{} {
+		if c.Version == nil {
+			return ""
+		}
+		return c.Version.Version
+	}},
+	{Name: "reward_eligible", Value: func(c database.ClientInfo) interface{} { return c.RewardEligible() }},
+}
+
+var HeartbeatColumns = []Column[database.HeartbeatRecord]{
+	{Name: "client_address", Value: func(h database.HeartbeatRecord) interface{} { return h.ClientAddress }},
+	{Name: "timestamp", Value: func(h database.HeartbeatRecord) interface{} { return h.Timestamp }},
+	{Name: "duration", Value: func(h database.HeartbeatRecord) interface{} { return h.Duration }},
+	{Name: "amount", Value: func(h database.HeartbeatRecord) interface{} { return h.Amount }},
+	{Name: "commission_rate", Value: func(h database.HeartbeatRecord) interface{} { return h.CommissionRate }},
+}
+
+var DelegationColumns = []Column[database.DelegationRecord]{
+	{Name: "from_address", Value: func(d database.DelegationRecord) interface{} { return d.FromAddress }},
+	{Name: "to_address", Value: func(d database.DelegationRecord) interface{} { return d.ToAddress }},
+	{Name: "amount", Value: func(d database.DelegationRecord) interface{} { return d.Amount }},
+	{Name: "commission_rate", Value: func(d database.DelegationRecord) interface{} { return d.CommissionRate }},
+	{Name: "timestamp", Value: func(d database.DelegationRecord) interface{} { return d.Timestamp }},
+}
@@ -0,0 +1,180 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	CSV    Format = "csv"
+	NDJSON Format = "ndjson"
+)
+
+// ParseFormat validates a format name, defaulting to CSV
+func ParseFormat(name string) (Format, error) {
+	switch Format(strings.ToLower(name)) {
+	case "", CSV:
+		return CSV, nil
+	case NDJSON:
+		return NDJSON, nil
+	}
+	return "", fmt.Errorf("unsupported format %q", name)
+}
+
+// ContentType returns the MIME type for the format
+func (f Format) ContentType() string {
+	if f == NDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+// Column extracts one exported field from a record
+type Column[T any] struct {
+	Name  string
+	Value func(T) interface{}
+}
+
+// SelectColumns returns the named columns in the canonical order of all, so
+// output stays stable however the caller lists them. No names selects all.
+func SelectColumns[T any](all []Column[T], names []string) ([]Column[T], error) {
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[strings.TrimSpace(name)] = true
+	}
+
+	var selected []Column[T]
+	for _, column := range all {
+		if wanted[column.Name] {
+			selected = append(selected, column)
+			delete(wanted, column.Name)
+		}
+	}
+
+	if len(wanted) > 0 {
+		var unknown []string
+		for _, name := range names {
+			if wanted[strings.TrimSpace(name)] {
+				unknown = append(unknown, strings.TrimSpace(name))
+			}
+		}
+		return nil, fmt.Errorf("unknown columns: %s", strings.Join(unknown, ", "))
+	}
+
+	return selected, nil
+}
+
+// Writer streams records in the chosen format, one row per record
+type Writer[T any] struct {
+	out     io.Writer
+	format  Format
+	columns []Column[T]
+	csv     *csv.Writer
+	header  bool
+}
+
+// NewWriter creates a writer for the given columns
+func NewWriter[T any](out io.Writer, format Format, columns []Column[T]) *Writer[T] {
+	w := &Writer[T]{
+		out:     out,
+		format:  format,
+		columns: columns,
+	}
+	if format == CSV {
+		w.csv = csv.NewWriter(out)
+	}
+	return w
+}
+
+// Write encodes a single record
+func (w *Writer[T]) Write(record T) error {
+	if w.format == CSV {
+		if !w.header {
+			names := make([]string, len(w.columns))
+			for i, column := range w.columns {
+				names[i] = column.Name
+			}
+			if err := w.csv.Write(names); err != nil {
+				return err
+			}
+			w.header = true
+		}
+
+		row := make([]string, len(w.columns))
+		for i, column := range w.columns {
+			row[i] = formatCSV(column.Value(record))
+		}
+		return w.csv.Write(row)
+	}
+
+	// Build the object by hand to keep keys in column order
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, column := range w.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(column.Name)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(column.Value(record))
+		if err != nil {
+			return err
+		}
+		buf.Write(value)
+	}
+	buf.WriteString("}\n")
+
+	_, err := w.out.Write(buf.Bytes())
+	return err
+}
+
+// Flush writes any buffered rows. A CSV export with no rows still gets its header.
+func (w *Writer[T]) Flush() error {
+	if w.format != CSV {
+		return nil
+	}
+	if !w.header {
+		names := make([]string, len(w.columns))
+		for i, column := range w.columns {
+			names[i] = column.Name
+		}
+		if err := w.csv.Write(names); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+func formatCSV(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
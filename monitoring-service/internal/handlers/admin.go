@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"monitoring-service/internal/auth"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/sybil"
+	"monitoring-service/pkg/config"
+)
+
+// Incident severities accepted by CreateIncident
+const (
+	SeverityMinor    = "minor"
+	SeverityMajor    = "major"
+	SeverityCritical = "critical"
+)
+
+// maxAuditedBody is how much of a request body is kept in the audit log
+const maxAuditedBody = 64 << 10
+
+// AdminResponse acknowledges an admin call that returns no data
+type AdminResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+type WhoAmIResponse struct {
+	Status  string         `json:"status"`
+	Message string         `json:"message"`
+	Data    auth.Principal `json:"data"`
+}
+
+type AddToBlacklistRequest struct {
+	Address string `json:"address"`
+	Reason  string `json:"reason"`
+}
+
+type BlacklistResponse struct {
+	Status  string                    `json:"status"`
+	Message string                    `json:"message"`
+	Data    []database.BlacklistEntry `json:"data"`
+}
+
+type BlacklistEntryResponse struct {
+	Status  string                  `json:"status"`
+	Message string                  `json:"message"`
+	Data    database.BlacklistEntry `json:"data"`
+}
+
+type SetStatusOverrideRequest struct {
+	// Status is Active, Inactive or Offline
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	// ExpiresAt ends the override; omit it to keep the override until cleared
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type StatusOverrideResponse struct {
+	Status  string                  `json:"status"`
+	Message string                  `json:"message"`
+	Data    database.StatusOverride `json:"data"`
+}
+
+type StatusOverridesResponse struct {
+	Status  string                             `json:"status"`
+	Message string                             `json:"message"`
+	Data    map[string]database.StatusOverride `json:"data"`
+}
+
+type CreateIncidentRequest struct {
+	ClientAddress string `json:"client_address"`
+	// Severity is minor, major or critical
+	Severity string `json:"severity"`
+	Summary  string `json:"summary"`
+	// StartedAt defaults to now
+	StartedAt *time.Time `json:"started_at,omitempty"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+}
+
+type IncidentResponse struct {
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Data    database.Incident `json:"data"`
+}
+
+type IncidentsResponse struct {
+	Status  string              `json:"status"`
+	Message string              `json:"message"`
+	Data    []database.Incident `json:"data"`
+}
+
+type AuditLogResponse struct {
+	Status  string                `json:"status"`
+	Message string                `json:"message"`
+	Data    []database.AuditEntry `json:"data"`
+}
+
+// authorize rejects requests without valid credentials for at least the
+// given role, and passes the caller on in the request context
+func authorize(authenticator *auth.Authenticator, role auth.Role, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticator.Authenticate(r)
+		if err != nil {
+			// Refused calls are only logged, without their body, so anonymous
+			// callers cannot fill the audit log
+			slog.WarnContext(r.Context(), "Admin call refused", "path", r.URL.Path, "remote_addr", r.RemoteAddr, "error", err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			message := "Invalid credentials"
+			if errors.Is(err, auth.ErrNoCredentials) {
+				message = "Authentication required"
+			}
+			writeError(w, http.StatusUnauthorized, ErrCodeUnauthorized, message)
+			return
+		}
+		if !principal.Role.Allows(role) {
+			slog.WarnContext(r.Context(), "Admin call refused", "path", r.URL.Path, "principal", principal.Subject, "role", principal.Role)
+			writeError(w, http.StatusForbidden, ErrCodeForbidden, "This operation requires the "+string(role)+" role")
+			return
+		}
+
+		next(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.statusCode = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+// audited writes every authorized call to the audit log once it has been
+// handled, whether it succeeded or failed. It runs inside authorize, so
+// refused calls never reach it.
+func audited(db database.AdminStore, action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body []byte
+		if r.Body != nil {
+			body, _ = io.ReadAll(io.LimitReader(r.Body, maxAuditedBody))
+			r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		next(recorder, r)
+
+		principal, _ := auth.PrincipalFrom(r.Context())
+		target := strings.ToLower(r.PathValue("address"))
+		if target == "" {
+			var named struct {
+				Address       string `json:"address"`
+				ClientAddress string `json:"client_address"`
+			}
+			if json.Unmarshal(body, &named) == nil {
+				target = strings.ToLower(named.Address + named.ClientAddress)
+			}
+		}
+
+		// The call has taken effect, so it is recorded even when the caller
+		// has gone away
+		ctx := context.WithoutCancel(r.Context())
+		err := db.AddAuditEntry(ctx, database.AuditEntry{
+			Timestamp:  time.Now(),
+			Actor:      principal.Subject,
+			Role:       string(principal.Role),
+			AuthMethod: principal.Method,
+			Action:     action,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Target:     target,
+			Request:    string(body),
+			StatusCode: recorder.statusCode,
+			RemoteAddr: r.RemoteAddr,
+		})
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to write audit log entry", "action", action, "principal", principal.Subject, "error", err)
+		}
+	}
+}
+
+// WhoAmI returns the authenticated caller
+func WhoAmI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFrom(r.Context())
+		sendJSON(w, WhoAmIResponse{
+			Status:  "success",
+			Message: "Authenticated",
+			Data:    principal,
+		})
+	}
+}
+
+// GetBlacklist lists blacklisted addresses
+func GetBlacklist(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		entries, err := db.GetBlacklist(r.Context())
+		if err != nil {
+			databaseError(w, err, "Failed to fetch blacklist")
+			return
+		}
+
+		sendJSON(w, BlacklistResponse{
+			Status:  "success",
+			Message: "Blacklist retrieved successfully",
+			Data:    entries,
+		})
+	}
+}
+
+// AddToBlacklist bars an address from registering and sending heartbeats
+func AddToBlacklist(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req AddToBlacklistRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+			return
+		}
+		if req.Address == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeAddressRequired, "Address is required")
+			return
+		}
+		if !common.IsHexAddress(req.Address) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAddress, "Address must be a hex encoded Ethereum address")
+			return
+		}
+
+		principal, _ := auth.PrincipalFrom(r.Context())
+		entry := database.BlacklistEntry{
+			Address:   strings.ToLower(req.Address),
+			Reason:    req.Reason,
+			CreatedBy: principal.Subject,
+			CreatedAt: time.Now(),
+		}
+		if err := db.AddToBlacklist(r.Context(), entry); err != nil {
+			databaseError(w, err, "Failed to update blacklist")
+			return
+		}
+
+		sendJSON(w, BlacklistEntryResponse{
+			Status:  "success",
+			Message: "Address blacklisted",
+			Data:    entry,
+		})
+	}
+}
+
+// RemoveFromBlacklist lifts a blacklisting
+func RemoveFromBlacklist(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		removed, err := db.RemoveFromBlacklist(r.Context(), r.PathValue("address"))
+		if err != nil {
+			databaseError(w, err, "Failed to update blacklist")
+			return
+		}
+		if !removed {
+			writeError(w, http.StatusNotFound, ErrCodeNotBlacklisted, "Address is not blacklisted")
+			return
+		}
+
+		sendJSON(w, AdminResponse{
+			Status:  "success",
+			Message: "Address removed from blacklist",
+		})
+	}
+}
+
+// GetStatusOverrides lists every client status override by address
+func GetStatusOverrides(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		overrides, err := db.GetStatusOverrides(r.Context())
+		if err != nil {
+			databaseError(w, err, "Failed to fetch status overrides")
+			return
+		}
+
+		sendJSON(w, StatusOverridesResponse{
+			Status:  "success",
+			Message: "Status overrides retrieved successfully",
+			Data:    overrides,
+		})
+	}
+}
+
+// SetStatusOverride replaces a client's derived status
+func SetStatusOverride(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req SetStatusOverrideRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+			return
+		}
+		switch req.Status {
+		case database.StatusActive, database.StatusDegraded, database.StatusInactive, database.StatusOffline:
+		default:
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidStatus,
+				"Status must be one of "+database.StatusActive+", "+database.StatusDegraded+", "+database.StatusInactive+" or "+database.StatusOffline)
+			return
+		}
+		if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidTimeRange, "expires_at must be in the future")
+			return
+		}
+
+		principal, _ := auth.PrincipalFrom(r.Context())
+		override := database.StatusOverride{
+			Status:    req.Status,
+			Reason:    req.Reason,
+			SetBy:     principal.Subject,
+			SetAt:     time.Now(),
+			ExpiresAt: req.ExpiresAt,
+		}
+		exists, err := db.SetStatusOverride(r.Context(), r.PathValue("address"), &override)
+		if err != nil {
+			databaseError(w, err, "Failed to set status override")
+			return
+		}
+		if !exists {
+			writeError(w, http.StatusNotFound, ErrCodeClientNotFound, "Client not found")
+			return
+		}
+
+		sendJSON(w, StatusOverrideResponse{
+			Status:  "success",
+			Message: "Status override set",
+			Data:    override,
+		})
+	}
+}
+
+// ClearStatusOverride returns a client to its derived status
+func ClearStatusOverride(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		exists, err := db.SetStatusOverride(r.Context(), r.PathValue("address"), nil)
+		if err != nil {
+			databaseError(w, err, "Failed to clear status override")
+			return
+		}
+		if !exists {
+			writeError(w, http.StatusNotFound, ErrCodeClientNotFound, "Client not found")
+			return
+		}
+
+		sendJSON(w, AdminResponse{
+			Status:  "success",
+			Message: "Status override cleared",
+		})
+	}
+}
+
+// GetIncidents lists incident annotations, newest first
+func GetIncidents(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		tr, err := parseTimeRange(query.Get("from"), query.Get("to"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidTimeRange, err.Error())
+			return
+		}
+
+		incidents, err := db.GetIncidents(r.Context(), query.Get("address"), tr)
+		if err != nil {
+			databaseError(w, err, "Failed to fetch incidents")
+			return
+		}
+
+		sendJSON(w, IncidentsResponse{
+			Status:  "success",
+			Message: "Incidents retrieved successfully",
+			Data:    incidents,
+		})
+	}
+}
+
+// CreateIncident annotates a client with an incident
+func CreateIncident(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req CreateIncidentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+			return
+		}
+		if req.ClientAddress == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeAddressRequired, "Address is required")
+			return
+		}
+		if !common.IsHexAddress(req.ClientAddress) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidAddress, "Address must be a hex encoded Ethereum address")
+			return
+		}
+		switch req.Severity {
+		case SeverityMinor, SeverityMajor, SeverityCritical:
+		default:
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidSeverity,
+				"Severity must be one of "+SeverityMinor+", "+SeverityMajor+" or "+SeverityCritical)
+			return
+		}
+
+		now := time.Now()
+		startedAt := now
+		if req.StartedAt != nil {
+			startedAt = *req.StartedAt
+		}
+		if req.EndedAt != nil && req.EndedAt.Before(startedAt) {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidTimeRange, "ended_at must not be before started_at")
+			return
+		}
+
+		id := make([]byte, 12)
+		if _, err := rand.Read(id); err != nil {
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to create incident")
+			return
+		}
+
+		principal, _ := auth.PrincipalFrom(r.Context())
+		incident := database.Incident{
+			ID:            hex.EncodeToString(id),
+			ClientAddress: strings.ToLower(req.ClientAddress),
+			Severity:      req.Severity,
+			Summary:       req.Summary,
+			StartedAt:     startedAt,
+			EndedAt:       req.EndedAt,
+			CreatedBy:     principal.Subject,
+			CreatedAt:     now,
+		}
+		if err := db.AddIncident(r.Context(), incident); err != nil {
+			databaseError(w, err, "Failed to create incident")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		sendJSON(w, IncidentResponse{
+			Status:  "success",
+			Message: "Incident created",
+			Data:    incident,
+		})
+	}
+}
+
+// GetAuditLog returns the most recent audit log entries
+func GetAuditLog(db database.AdminStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 100
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidLimit, "Limit must be a positive integer")
+				return
+			}
+			limit = parsed
+		}
+
+		entries, err := db.GetAuditLog(r.Context(), limit)
+		if err != nil {
+			databaseError(w, err, "Failed to fetch audit log")
+			return
+		}
+
+		sendJSON(w, AuditLogResponse{
+			Status:  "success",
+			Message: "Audit log retrieved successfully",
+			Data:    entries,
+		})
+	}
+}
+
+// SybilFlagsResponse is the latest sybil heuristics report
+type SybilFlagsResponse struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message"`
+	Data    sybil.Report `json:"data"`
+}
+
+// GetSybilFlags runs the sybil heuristics and returns the flagged operators.
+// Flags are only for review; nothing is blocked from here.
+func GetSybilFlags(db database.Store, settings *config.Live) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		opts := sybil.Options{MinClusterSize: settings.Get().SybilMinClusterSize}
+		report, err := sybil.Detect(r.Context(), db, opts, time.Now())
+		if err != nil {
+			databaseError(w, err, "Failed to compute sybil flags")
+			return
+		}
+
+		sendJSON(w, SybilFlagsResponse{
+			Status:  "success",
+			Message: "Sybil flags computed successfully",
+			Data:    report,
+		})
+	}
+}
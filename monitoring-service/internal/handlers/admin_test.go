@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"monitoring-service/internal/database"
+)
+
+// cancellableAuditStore fails audit writes whose context is done, as
+// MongoDB does
+type cancellableAuditStore struct {
+	database.Store
+}
+
+func (s cancellableAuditStore) AddAuditEntry(ctx context.Context, entry database.AuditEntry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.Store.AddAuditEntry(ctx, entry)
+}
+
+func TestAuditLog(t *testing.T) {
+	s := newTestServerWith(t, func(store database.Store) database.Store {
+		return cancellableAuditStore{Store: store}
+	})
+	body := `{"address":"0x00000000000000000000000000000000000c0001","reason":"spam"}`
+
+	// Refused calls are not written to the audit log
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/admin/blacklist", strings.NewReader(body)))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("unauthenticated status = %d, want 401", rec.Code)
+	}
+	entries, err := s.store.GetAuditLog(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("GetAuditLog: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("refused call was audited: %+v", entries)
+	}
+
+	// An authorized call is recorded even when the caller has gone away
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodPost, "/v1/admin/blacklist", strings.NewReader(body)).WithContext(ctx)
+	req.Header.Set("X-API-Key", testAdminKey)
+	cancel()
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("authorized status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	entries, err = s.store.GetAuditLog(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("GetAuditLog: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "test" || entries[0].Action != "addToBlacklist" || entries[0].Request != body {
+		t.Errorf("audit log = %+v, want the authorized call", entries)
+	}
+}
@@ -2,13 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
-	"fmt"
+	"log/slog"
 	"math/big"
 	"net/http"
 
-	"monitoring-service/internal/blockchain/delegation"
-	"monitoring-service/internal/blockchain/nft"
+	"monitoring-service/internal/blockchain"
 
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 )
 
@@ -29,16 +29,16 @@ type CheckDelegationResponse struct {
 	} `json:"details"`
 }
 
-func CheckDelegation(nftChecker *nft.NFTChecker, delegateRegistry *delegation.DelegationCaller) http.HandlerFunc {
+func CheckDelegation(nftChecker blockchain.BalanceReader, delegateRegistry blockchain.DelegationReader) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w)
 			return
 		}
 
 		var req CheckDelegationRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
 			return
 		}
 
@@ -49,16 +49,12 @@ func CheckDelegation(nftChecker *nft.NFTChecker, delegateRegistry *delegation.De
 
 		// Validate required fields
 		if req.Address == "" {
-			response.Status = "error"
-			response.Message = "Address is required"
-			sendJSON(w, response)
+			writeError(w, http.StatusBadRequest, ErrCodeAddressRequired, "Address is required")
 			return
 		}
 
 		if req.TokenID == "" {
-			response.Status = "error"
-			response.Message = "Token ID is required"
-			sendJSON(w, response)
+			writeError(w, http.StatusBadRequest, ErrCodeTokenIDRequired, "Token ID is required")
 			return
 		}
 
@@ -66,9 +62,7 @@ func CheckDelegation(nftChecker *nft.NFTChecker, delegateRegistry *delegation.De
 		tokenID := new(big.Int)
 		tokenID, success := tokenID.SetString(req.TokenID, 10)
 		if !success {
-			response.Status = "error"
-			response.Message = "Invalid Token ID format"
-			sendJSON(w, response)
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidTokenID, "Invalid Token ID format")
 			return
 		}
 
@@ -78,9 +72,13 @@ func CheckDelegation(nftChecker *nft.NFTChecker, delegateRegistry *delegation.De
 		var rights [32]byte // Zero rights for basic delegation check
 
 		// Check ERC1155 delegation amount
-		amount, err := delegateRegistry.CheckDelegateForERC1155(nil, checksumAddr, ownerAddr, contractAddr, tokenID, rights)
+		amount, err := delegateRegistry.CheckDelegateForERC1155(&bind.CallOpts{Context: r.Context()}, checksumAddr, ownerAddr, contractAddr, tokenID, rights)
+		if timedOut(err) {
+			chainError(w, err, "Failed to check ERC1155 delegation")
+			return
+		}
 		if err != nil {
-			fmt.Printf("Error checking ERC1155 delegation: %v\n", err)
+			slog.ErrorContext(r.Context(), "Failed to check ERC1155 delegation", "error", err)
 		} else if amount != nil {
 			response.Details.ERC1155Amount = amount.String()
 		}
@@ -2,17 +2,26 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"math/big"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
-	"monitoring-service/internal/blockchain/delegation"
-	"monitoring-service/internal/blockchain/nft"
+
+	"go.opentelemetry.io/otel/trace"
+	"monitoring-service/internal/access"
+	"monitoring-service/internal/blockchain"
 	"monitoring-service/internal/database"
+	"monitoring-service/internal/events"
+	"monitoring-service/internal/liveness"
+	"monitoring-service/internal/probe"
+	"monitoring-service/internal/ratelimit"
+	"monitoring-service/internal/tracing"
+	"monitoring-service/internal/verification"
+	"monitoring-service/internal/versions"
 	"monitoring-service/pkg/config"
-
-	"github.com/ethereum/go-ethereum/common"
 )
 
 type CheckNFTRequest struct {
@@ -20,109 +29,58 @@ type CheckNFTRequest struct {
 	CommissionRate       string `json:"commission_rate"`
 	OperatorName         string `json:"operator_name"`
 	RewardCollectorAddress string `json:"reward_collector_address"`
+	// Optional sync state of the light client, checked against the Avail chain
+	FinalizedBlockNumber uint64 `json:"finalized_block_number,omitempty"`
+	FinalizedBlockHash   string `json:"finalized_block_hash,omitempty"`
+	PeerID               string `json:"peer_id,omitempty"`
+	// Optional public HTTP API of the light client, for active probing.
+	// Omitting it keeps the registered one.
+	ProbeURL string `json:"probe_url,omitempty"`
+	// Optional light client build: its semantic version, the Avail network
+	// it follows and the platform it runs on
+	ClientVersion string `json:"client_version,omitempty"`
+	ClientNetwork string `json:"client_network,omitempty"`
+	ClientOS      string `json:"client_os,omitempty"`
+	ClientArch    string `json:"client_arch,omitempty"`
+	// Optional retry protection. A heartbeat sent again with the same
+	// idempotency key, or without one but with the same sequence number, is
+	// answered with the original response. The key can also be sent in the
+	// Idempotency-Key header.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	// Sequence and Timestamp, when sent, must increase from one heartbeat of
+	// the client to the next
+	Sequence  int64      `json:"sequence,omitempty"`
+	Timestamp *time.Time `json:"timestamp,omitempty"`
 }
 
+// MaxClockSkew is how far ahead of the server's clock a heartbeat's
+// timestamp may be
+const MaxClockSkew = 2 * time.Minute
+
 type CheckNFTResponse struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
 }
 
-func updateOwnershipClientRegistration(db *database.Database, address string, totalAmount int64, checkNFTInterval int, commissionRate string, operatorName string, rewardCollectorAddress string) error {
-	exists, err := db.ClientExists(address)
-	if err != nil {
-		return err
-	}
-
-	var commissionRateFloat float64
-	var clientRecord *database.ClientInfo
-
-	// Always use the new commission rate if provided
-	if commissionRate != "" {
-		commissionRateFloat, err = strconv.ParseFloat(commissionRate, 64)
-		if err != nil {
-			return err
+// CheckNFT verifies a heartbeat against the chain of the network with the
+// given ID and records it, with the settings current when it arrives
+func CheckNFT(settings *config.Live, networkID string, db database.Store, delegateRegistry blockchain.DelegationReader, nftChecker blockchain.BalanceReader, broker *events.Broker, policy *access.Policy, limiter *ratelimit.Limiter, livenessChecker *liveness.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w)
+			return
 		}
-	}
 
-	if exists {
-		clientRecord, err = db.GetClient(address)
+		cfg, err := settings.Get().ForNetwork(networkID)
 		if err != nil {
-			return err
-		}
-		
-		// Only use existing commission rate if new one wasn't provided
-		if commissionRate == "" {
-			commissionRateFloat = clientRecord.CommissionRate
-		}
-		
-		// Use existing values if new ones are not provided
-		if operatorName == "" {
-			operatorName = clientRecord.OperatorName
-		}
-		if rewardCollectorAddress == "" {
-			rewardCollectorAddress = clientRecord.RewardCollectorAddress
-		}
-	}
-
-	totalTime := 0
-	operationPoints := database.OperationPointRecord{
-		Amount:         totalAmount,
-		Timestamp:      time.Now(),
-		CommissionRate: commissionRateFloat,
-		Time:           0,
-	}
-
-	if exists {
-		totalTime = int(clientRecord.TotalTime) + int(time.Since(clientRecord.LastHeartbeat).Seconds())
-		if time.Since(clientRecord.LastHeartbeat) <= time.Duration(checkNFTInterval)*time.Minute {
-			operationPoints.Time = int64(time.Since(clientRecord.LastHeartbeat).Seconds())
-		} else {
-			operationPoints.Time = 0
-		}
-	}
-
-	return db.RegisterClient(address, operationPoints, int64(totalTime), operatorName, rewardCollectorAddress)
-}
-
-func updateDelegationClientRegistration(db *database.Database, address string, totalAmount int64, delegationAddress string, commissionRate string) error {
-	// convert commission rate to float64
-	commissionRateFloat, err := strconv.ParseFloat(commissionRate, 64)
-	if err != nil {
-		return err
-	}
-
-	// Get client to check last heartbeat time
-	exists, err := db.ClientExists(address)
-	if err != nil {
-		return err
-	}
-
-	var timeValue int64 = 0
-	if exists {
-		client, err := db.GetClient(address)
-		if err != nil {
-			return err
+			writeError(w, http.StatusInternalServerError, ErrCodeInternal, "Failed to load config")
+			return
 		}
-		
-		// Calculate time since last heartbeat
-		timeSinceHeartbeat := time.Since(client.LastHeartbeat).Seconds()
-		timeValue = int64(timeSinceHeartbeat)
-	}
-
-	delegationPoints := database.DelegationPointRecord{
-		Address:        delegationAddress,
-		Amount:         totalAmount,
-		Timestamp:      time.Now(),
-		CommissionRate: commissionRateFloat,
-		Time:           timeValue,
-	}
-	return db.RegisterDelegation(address, delegationPoints)
-}
 
-func CheckNFT(db *database.Database, delegateRegistry *delegation.DelegationCaller, nftChecker *nft.NFTChecker) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		// Throttled requests are turned away before any chain call or write,
+		// so they never touch uptime
+		if ok, retryAfter := limiter.AllowIP(r.Context(), access.ClientIP(r, cfg.TrustForwardedFor), time.Now()); !ok {
+			rateLimited(w, retryAfter, "Too many requests from this IP")
 			return
 		}
 
@@ -133,163 +91,270 @@ func CheckNFT(db *database.Database, delegateRegistry *delegation.DelegationCall
 	
 		var req CheckNFTRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
 			return
 		}
 
 		// Validate required fields
 		if req.Address == "" {
-			fmt.Println("Validation Error: Address is required")
-			response.Status = "error"
-			response.Message = "Address is required"
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
+			slog.DebugContext(r.Context(), "Heartbeat rejected", "reason", "address is required")
+			writeError(w, http.StatusBadRequest, ErrCodeAddressRequired, "Address is required")
 			return
 		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(tracing.AddressKey.String(req.Address))
 
 		if req.CommissionRate == "" {
-			fmt.Println("Validation Error: Commission rate is required")
-			response.Status = "error"
-			response.Message = "Commission rate is required"
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
+			slog.DebugContext(r.Context(), "Heartbeat rejected", "address", req.Address, "reason", "commission rate is required")
+			writeError(w, http.StatusBadRequest, ErrCodeCommissionRequired, "Commission rate is required")
 			return
 		}
 
 		// Check: commission rate must be between 0 and 10
 		commission, err := strconv.ParseFloat(req.CommissionRate, 64)
 		if err != nil {
-			fmt.Println("Validation Error: Invalid commission rate format")
-			response.Status = "error"
-			response.Message = "Invalid commission rate format"
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
+			slog.DebugContext(r.Context(), "Heartbeat rejected", "address", req.Address, "reason", "invalid commission rate format")
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidCommission, "Invalid commission rate format")
 			return
 		}
 		if commission < 0 || commission > 10 {
-			fmt.Println("Validation Error: Commission rate must be between 0 and 10")
-			response.Status = "error"
-			response.Message = "Commission rate must be between 0 and 10"
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
+			slog.DebugContext(r.Context(), "Heartbeat rejected", "address", req.Address, "reason", "commission rate out of range")
+			writeError(w, http.StatusBadRequest, ErrCodeCommissionOutOfRange, "Commission rate must be between 0 and 10")
 			return
 		}
 
-		// Load configuration
-		cfg, err := config.LoadConfig()
+		if req.ProbeURL != "" {
+			if err := probe.ValidateURL(req.ProbeURL); err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidProbeURL, err.Error())
+				return
+			}
+		}
+
+		versionReport := versions.Report{
+			Version: req.ClientVersion,
+			Network: req.ClientNetwork,
+			OS:      req.ClientOS,
+			Arch:    req.ClientArch,
+		}
+		if err := versionReport.Validate(); err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidVersion, err.Error())
+			return
+		}
+
+		now := time.Now()
+		if req.Sequence < 0 {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidSequence, "Sequence must not be negative")
+			return
+		}
+		if req.Timestamp != nil && req.Timestamp.After(now.Add(MaxClockSkew)) {
+			writeError(w, http.StatusBadRequest, ErrCodeTimestampInFuture,
+				fmt.Sprintf("Timestamp is more than %s ahead of the server clock", MaxClockSkew))
+			return
+		}
+
+		// A retry of an accepted heartbeat gets the original response and is
+		// not counted again. Rejected heartbeats are processed afresh.
+		key, err := heartbeatKey(r, req)
 		if err != nil {
-			http.Error(w, "Failed to load config", http.StatusInternalServerError)
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidIdempotency, err.Error())
+			return
+		}
+		if key != "" {
+			claim, err := db.ClaimHeartbeat(r.Context(), req.Address, key, now)
+			if err != nil {
+				databaseError(w, err, "Failed to check idempotency key")
+				return
+			}
+			if claim != nil {
+				slog.InfoContext(r.Context(), "Heartbeat replayed", "address", req.Address, "key", key)
+				replayHeartbeat(w, claim)
+				return
+			}
+			recorder := newResponseRecorder(w)
+			w = recorder
+			defer finishHeartbeat(r.Context(), db, req.Address, key, recorder)
+		}
+
+		if ok, retryAfter := limiter.AllowAddress(r.Context(), networkID+":"+strings.ToLower(req.Address), time.Now()); !ok {
+			rateLimited(w, retryAfter, "Heartbeats for this address are arriving faster than the heartbeat interval")
 			return
 		}
 
-		incommingDelegation, err := delegateRegistry.GetIncomingDelegations(nil, common.HexToAddress(req.Address))
+		// The admin blacklist is checked first, then the configured
+		// blocklist and allowlist
+		blacklisted, err := db.IsBlacklisted(r.Context(), req.Address)
 		if err != nil {
-			http.Error(w, "Failed to get incoming delegations", http.StatusInternalServerError)
+			databaseError(w, err, "Failed to check blacklist")
+			return
+		}
+		if blacklisted {
+			writeError(w, http.StatusForbidden, ErrCodeAddressBlacklisted, "Address is blacklisted")
 			return
 		}
 
-		if len(incommingDelegation) > 0 {
-			fmt.Println("Incoming delegations found, processing...")
-			var delegations []delegation.IDelegateRegistryDelegation
-			delegatorBalances := make(map[string]int64)
-
-			// First collect all delegations and check delegator balances
-			for _, delegation := range incommingDelegation {
-				delegationRights := [32]byte(delegation.Rights)
-				configRights := [32]byte(cfg.Rights)
-				if delegationRights == configRights && delegation.Contract == common.HexToAddress(cfg.NFTContractAddr) && delegation.Type == 5 {
-					// Check delegator's NFT balance
-					balance, err := nftChecker.GetBatchBalance(delegation.From.String(), []*big.Int{delegation.TokenId})
-					if err != nil {
-						fmt.Printf("Failed to check NFT balance for delegator %s: %v\n", delegation.From.String(), err)
-						http.Error(w, "Failed to check NFT balance", http.StatusInternalServerError)
-						return
-					}
-
-					fmt.Printf("Delegation Check - From: %s, To: %s, TokenID: %s, DelegatedAmount: %d, ActualBalance: %d\n",
-						delegation.From.String(),
-						delegation.To.String(),
-						delegation.TokenId.String(),
-						delegation.Amount.Int64(),
-						balance[0].Int64())
-
-					if len(balance) > 0 && balance[0].Int64() > 0 {
-						delegations = append(delegations, delegation)
-						delegatorBalances[delegation.From.String()] += balance[0].Int64()
-					}
-				}
-			}
+		switch policy.Check(req.Address) {
+		case access.Blocked:
+			writeError(w, http.StatusForbidden, ErrCodeAddressBlocklisted, "Address is blocklisted")
+			return
+		case access.NotAllowed:
+			writeError(w, http.StatusForbidden, ErrCodeAddressNotAllowed, "Address is not on the allowlist")
+			return
+		}
 
-			// get map From address to token id and amount
-			tokenIdMap := make(map[string]int64)
-			for _, delegation := range delegations {
-				// Only count delegation amount up to delegator's actual balance
-				availableBalance := delegatorBalances[delegation.From.String()]
-				delegationAmount := delegation.Amount.Int64()
-				if delegationAmount > availableBalance {
-					delegationAmount = availableBalance
-				}
-				
-				if delegationAmount > 0 {
-					tokenIdMap[delegation.From.String()] = tokenIdMap[delegation.From.String()] + delegationAmount
-				}
+		// Heartbeats without a sync report clear the stored one, so a client
+		// is only Degraded by what it last reported
+		var clientLiveness *database.Liveness
+		if req.FinalizedBlockNumber != 0 || req.FinalizedBlockHash != "" || req.PeerID != "" {
+			span.SetAttributes(tracing.BlockNumberKey.Int64(int64(req.FinalizedBlockNumber)))
+			clientLiveness, err = livenessChecker.Check(r.Context(), liveness.Report{
+				BlockNumber: req.FinalizedBlockNumber,
+				BlockHash:   req.FinalizedBlockHash,
+				PeerID:      req.PeerID,
+			}, time.Now())
+			if errors.Is(err, liveness.ErrInvalidReport) {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidLiveness, err.Error())
+				return
+			}
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeImplausibleLiveness, err.Error())
+				return
 			}
+		}
 
-			// sum up all the amounts
-			var totalAmount int64
-			for _, amount := range tokenIdMap {
-				totalAmount += amount
+		verified, err := verification.Verify(r.Context(), cfg, delegateRegistry, nftChecker, req.Address)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "Heartbeat verification failed", "address", req.Address, "error", err)
+			message := "Failed to get incoming delegations"
+			if errors.Is(err, verification.ErrBalanceLookup) {
+				message = "Failed to check NFT balance"
 			}
+			chainError(w, err, message)
+			return
+		}
 
-			// Check if this client already exists in the DB
-			exists, err := db.ClientExists(req.Address)
+		span.SetAttributes(tracing.DelegationCountKey.Int(verified.Incoming))
+		if verified.Incoming > 0 {
+			slog.DebugContext(r.Context(), "Incoming delegations found", "address", req.Address,
+				"incoming", verified.Incoming, "delegators", len(verified.Delegators), "total", verified.Total)
+			tokenIdMap := verified.Delegators
+			totalAmount := verified.Total
+
+			// Check if this client already exists in the DB. Its stored
+			// version carries the start of an outdated client's grace period.
+			client, err := db.GetClient(r.Context(), req.Address)
 			if err != nil {
-				http.Error(w, "Failed to check client existence", http.StatusInternalServerError)
+				databaseError(w, err, "Failed to check client existence")
 				return
 			}
 
 			// If client exists OR totalAmount > 0 (new client with non-zero delegation), update the record.
-			if exists || totalAmount > 0 {
-				if err := updateOwnershipClientRegistration(db, req.Address, totalAmount, cfg.CheckNFTInterval, req.CommissionRate, req.OperatorName, req.RewardCollectorAddress); err != nil {
-					http.Error(w, "Failed to update client registration", http.StatusInternalServerError)
-					return
+			if client != nil || totalAmount > 0 {
+				var sentAt time.Time
+				if req.Timestamp != nil {
+					sentAt = *req.Timestamp
+				}
+				var previousVersion *database.ClientVersion
+				if client != nil {
+					previousVersion = client.Version
 				}
-				
-				// Collect valid delegator addresses
-				var validDelegators []string
-				for fromAddr := range tokenIdMap {
-					validDelegators = append(validDelegators, fromAddr)
+
+				previousDelegations, err := db.GetToDelegationsByAddress(r.Context(), req.Address)
+				if err != nil {
+					databaseError(w, err, "Failed to fetch delegations")
+					return
 				}
 
-				// Clear any delegations that are no longer valid
-				if err := db.ClearDelegationsForAddress(req.Address, validDelegators); err != nil {
-					http.Error(w, "Failed to clear invalid delegations", http.StatusInternalServerError)
+				// The client record, its uptime, liveness, version and probe
+				// URL are updated in one atomic write, so concurrent heartbeats
+				// never count time twice. Once that write is done the heartbeat
+				// is accepted: a retry would be out of order, so the writes
+				// after it are logged when they fail, not reported.
+				err = db.RecordHeartbeat(r.Context(), req.Address, database.ClientHeartbeat{
+					Amount:                 totalAmount,
+					CommissionRate:         commission,
+					OperatorName:           req.OperatorName,
+					RewardCollectorAddress: req.RewardCollectorAddress,
+					MaxGap:                 time.Duration(cfg.CheckNFTInterval) * time.Minute,
+					Sequence:               req.Sequence,
+					SentAt:                 sentAt,
+					Liveness:               clientLiveness,
+					// Outdated clients keep the time they were first seen
+					// outdated, which starts their grace period
+					Version:  cfg.VersionPolicy.Evaluate(versionReport, previousVersion, time.Now()),
+					ProbeURL: req.ProbeURL,
+				})
+				if errors.Is(err, database.ErrHeartbeatOutOfOrder) {
+					writeError(w, http.StatusConflict, ErrCodeHeartbeatOutOfOrder,
+						"Sequence or timestamp is not after the last accepted heartbeat")
+					return
+				}
+				if errors.Is(err, database.ErrHeartbeatIncomplete) {
+					slog.ErrorContext(r.Context(), "Heartbeat history not recorded", "address", req.Address, "error", err)
+				} else if err != nil {
+					databaseError(w, err, "Failed to update client registration")
 					return
 				}
 
-				// Then continue with updating the valid delegations
-				for fromAddr, amount := range tokenIdMap {
-					if err := updateDelegationClientRegistration(db, req.Address, amount, fromAddr, req.CommissionRate); err != nil {
-						http.Error(w, "Failed to update delegation registration", http.StatusInternalServerError)
-						return
-					}
+				// Delegations no longer on chain are dropped in the same write
+				// that stores the current ones. They are only written once the
+				// heartbeat is accepted, so one refused as out of order changes
+				// nothing, and a write that fails is redone by the next one.
+				if err := db.ReplaceDelegations(r.Context(), req.Address, tokenIdMap, commission); err != nil {
+					slog.ErrorContext(r.Context(), "Failed to update delegation registration", "address", req.Address, "error", err)
 				}
-				
+
+				publishHeartbeat(broker, req, totalAmount, commission, tokenIdMap, previousDelegations)
+
 				response.Status = "success"
 				response.Message = "Address has NFT or delegation for required NFT"
 			} else {
-				fmt.Println("No valid NFT or delegation found for the address.")
-				response.Status = "error"
-				response.Message = "Address does not own or have delegation for required NFT"
+				slog.InfoContext(r.Context(), "Heartbeat rejected", "address", req.Address, "reason", "no delegation backed by an NFT")
+				writeError(w, http.StatusForbidden, ErrCodeNFTNotFound, "Address does not own or have delegation for required NFT")
+				return
 			}
 		} else {
 			// No incoming delegation recorded: skip updating clients collection.
-			fmt.Println("No incoming delegations recorded.")
-			response.Status = "error"
-			response.Message = "Address does not have any incoming delegations"
+			slog.InfoContext(r.Context(), "Heartbeat rejected", "address", req.Address, "reason", "no incoming delegations")
+			writeError(w, http.StatusForbidden, ErrCodeNoDelegations, "Address does not have any incoming delegations")
+			return
+		}
+
+		// Source IPs feed the sybil heuristics; losing one is not worth
+		// failing the heartbeat over
+		if err := db.RecordClientSource(r.Context(), req.Address, access.ClientIP(r, cfg.TrustForwardedFor), time.Now()); err != nil {
+			slog.WarnContext(r.Context(), "Failed to record client source", "address", req.Address, "error", err)
+		}
+
+		sendJSON(w, response)
+	}
+}
+
+// publishHeartbeat announces an accepted heartbeat, and the new delegation set
+// when it differs from what was stored before this heartbeat
+func publishHeartbeat(broker *events.Broker, req CheckNFTRequest, totalAmount int64, commission float64, delegators map[string]int64, previous []database.DelegationRecord) {
+	broker.Publish(events.HeartbeatAccepted, req.Address, events.HeartbeatPayload{
+		NFTAmount:      totalAmount,
+		CommissionRate: commission,
+		OperatorName:   req.OperatorName,
+	})
+
+	current := make(map[string]int64, len(delegators))
+	for from, amount := range delegators {
+		current[strings.ToLower(from)] = amount
+	}
+
+	changed := len(previous) != len(current)
+	for _, delegation := range previous {
+		if amount, ok := current[delegation.FromAddress]; !ok || amount != delegation.Amount {
+			changed = true
+			break
 		}
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+	if changed {
+		broker.Publish(events.DelegationUpdated, req.Address, events.DelegationPayload{
+			Delegators:  current,
+			TotalAmount: totalAmount,
+		})
 	}
 }
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/blockchain/delegation"
+	"monitoring-service/internal/blockchain/fake"
+	"monitoring-service/internal/database"
+)
+
+// failingStore fails GetClient with err
+type failingStore struct {
+	database.Store
+	err error
+}
+
+func (s failingStore) GetClient(ctx context.Context, address string) (*database.ClientInfo, error) {
+	return nil, s.err
+}
+
+// failingHeartbeatStore fails RecordHeartbeat with err
+type failingHeartbeatStore struct {
+	database.Store
+	err error
+}
+
+func (s failingHeartbeatStore) RecordHeartbeat(ctx context.Context, address string, heartbeat database.ClientHeartbeat) error {
+	return s.err
+}
+
+// incompleteStore records heartbeats but reports their history as missing,
+// and fails ReplaceDelegations with err
+type incompleteStore struct {
+	database.Store
+	err error
+}
+
+func (s incompleteStore) RecordHeartbeat(ctx context.Context, address string, heartbeat database.ClientHeartbeat) error {
+	if err := s.Store.RecordHeartbeat(ctx, address, heartbeat); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %w", database.ErrHeartbeatIncomplete, s.err)
+}
+
+func (s incompleteStore) ReplaceDelegations(ctx context.Context, address string, delegators map[string]int64, commissionRate float64) error {
+	return s.err
+}
+
+func TestCheckNFT(t *testing.T) {
+	heartbeat := CheckNFTRequest{Address: testOperator.Hex(), CommissionRate: "5", OperatorName: "test"}
+
+	tests := []struct {
+		name string
+		// store wraps the handlers' store
+		store func(database.Store) database.Store
+		setup func(s *testServer)
+		body  interface{}
+
+		wantStatus int
+		wantCode   ErrorCode
+		// wantAmount is the NFT amount the client is registered with on success
+		wantAmount int64
+	}{
+		{
+			name:       "BadBody",
+			body:       `{"address":`,
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeInvalidRequestBody,
+		},
+		{
+			name:       "MissingAddress",
+			body:       CheckNFTRequest{CommissionRate: "5"},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeAddressRequired,
+		},
+		{
+			name:       "CommissionOutOfRange",
+			body:       CheckNFTRequest{Address: testOperator.Hex(), CommissionRate: "11"},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeCommissionOutOfRange,
+		},
+		{
+			name: "Blacklisted",
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+				err := s.store.AddToBlacklist(context.Background(), database.BlacklistEntry{Address: testOperator.Hex(), CreatedAt: time.Now()})
+				if err != nil {
+					s.t.Fatalf("AddToBlacklist: %v", err)
+				}
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodeAddressBlacklisted,
+		},
+		{
+			name: "Blocklisted",
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+				s.policy.Set([]string{testOperator.Hex()}, nil)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodeAddressBlocklisted,
+		},
+		{
+			name: "NotAllowlisted",
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+				s.policy.Set(nil, []string{testHolder.Hex()})
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodeAddressNotAllowed,
+		},
+		{
+			name:       "NoDelegations",
+			body:       heartbeat,
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodeNoDelegations,
+		},
+		{
+			name: "NoNFT",
+			setup: func(s *testServer) {
+				s.chain.DelegateERC1155(testHolder, testOperator, 1, testRights, 2)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodeNFTNotFound,
+		},
+		{
+			name: "RightsMismatch",
+			setup: func(s *testServer) {
+				s.chain.SetBalance(testHolder, 1, 2)
+				s.chain.DelegateERC1155(testHolder, testOperator, 1, [32]byte{31: 0x02}, 2)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodeNFTNotFound,
+		},
+		{
+			name: "WrongDelegationType",
+			setup: func(s *testServer) {
+				s.chain.SetBalance(testHolder, 1, 2)
+				s.chain.Delegate(delegation.IDelegateRegistryDelegation{
+					Type:     blockchain.DelegationTypeERC721,
+					To:       testOperator,
+					From:     testHolder,
+					Rights:   testRights,
+					Contract: testNFTContract,
+					TokenId:  big.NewInt(1),
+					Amount:   big.NewInt(2),
+				})
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusForbidden,
+			wantCode:   ErrCodeNFTNotFound,
+		},
+		{
+			name: "Delegated",
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusOK,
+			wantAmount: 2,
+		},
+		{
+			name: "CappedAtBalance",
+			setup: func(s *testServer) {
+				s.chain.SetBalance(testHolder, 1, 3)
+				s.chain.DelegateERC1155(testHolder, testOperator, 1, testRights, 5)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusOK,
+			wantAmount: 3,
+		},
+		{
+			name: "DatabaseError",
+			store: func(store database.Store) database.Store {
+				return failingStore{Store: store, err: errors.New("connection reset")}
+			},
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   ErrCodeDatabase,
+		},
+		{
+			name: "DatabaseTimeout",
+			store: func(store database.Store) database.Store {
+				return failingStore{Store: store, err: context.DeadlineExceeded}
+			},
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   ErrCodeTimeout,
+		},
+		{
+			// Liveness, version and probe URL are written with the heartbeat,
+			// so none of them is left behind when it fails
+			name: "RecordError",
+			store: func(store database.Store) database.Store {
+				return failingHeartbeatStore{Store: store, err: errors.New("connection reset")}
+			},
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+			},
+			body: CheckNFTRequest{Address: testOperator.Hex(), CommissionRate: "5",
+				ClientVersion: "1.12.0", ProbeURL: "https://lc.example.com"},
+			wantStatus: http.StatusInternalServerError,
+			wantCode:   ErrCodeDatabase,
+		},
+		{
+			// The client record was updated, so the heartbeat is accepted:
+			// a retry would be out of order
+			name: "HistoryError",
+			store: func(store database.Store) database.Store {
+				return incompleteStore{Store: store, err: errors.New("connection reset")}
+			},
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusOK,
+			wantAmount: 2,
+		},
+		{
+			name: "ChainError",
+			setup: func(s *testServer) {
+				s.chain.FailNext(fake.MethodGetIncomingDelegations, errors.New("connection refused"))
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusBadGateway,
+			wantCode:   ErrCodeChainUnavailable,
+		},
+		{
+			name: "BalanceError",
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+				s.chain.FailNext(fake.MethodGetBatchBalance, errors.New("connection refused"))
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusBadGateway,
+			wantCode:   ErrCodeChainUnavailable,
+		},
+		{
+			name: "ChainTimeout",
+			setup: func(s *testServer) {
+				s.delegate(testHolder, testOperator, 1, 2)
+				s.chain.SetLatency(fake.MethodGetIncomingDelegations, 5*time.Second)
+			},
+			body:       heartbeat,
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   ErrCodeTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServerWith(t, tt.store)
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+
+			rec := s.do(http.MethodPost, "/v1/check-nft", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			client, err := s.store.GetClient(context.Background(), testOperator.Hex())
+			if err != nil {
+				t.Fatalf("GetClient: %v", err)
+			}
+			if tt.wantStatus != http.StatusOK {
+				if code := errorCode(t, rec); code != tt.wantCode {
+					t.Errorf("code = %s, want %s", code, tt.wantCode)
+				}
+				if client != nil {
+					t.Errorf("rejected heartbeat registered the client: %+v", client)
+				}
+				return
+			}
+
+			if client == nil {
+				t.Fatal("client not registered")
+			}
+			if client.NFTAmount != tt.wantAmount {
+				t.Errorf("NFTAmount = %d, want %d", client.NFTAmount, tt.wantAmount)
+			}
+		})
+	}
+}
+
+// TestCheckNFTOutOfOrder checks that a heartbeat refused as out of order
+// leaves the stored delegations as they were
+func TestCheckNFTOutOfOrder(t *testing.T) {
+	s := newTestServer(t)
+	s.delegate(testHolder, testOperator, 1, 2)
+
+	rec := s.do(http.MethodPost, "/v1/check-nft", CheckNFTRequest{Address: testOperator.Hex(), CommissionRate: "5", Sequence: 5})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("heartbeat with sequence 5 = %d, want 200: %s", rec.Code, rec.Body)
+	}
+
+	// The chain changes, then a stale heartbeat arrives
+	secondHolder := common.HexToAddress("0x00000000000000000000000000000000000b0002")
+	s.delegate(secondHolder, testOperator, 1, 3)
+	rec = s.do(http.MethodPost, "/v1/check-nft", CheckNFTRequest{Address: testOperator.Hex(), CommissionRate: "7", Sequence: 4})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("heartbeat with sequence 4 = %d, want 409: %s", rec.Code, rec.Body)
+	}
+	if code := errorCode(t, rec); code != ErrCodeHeartbeatOutOfOrder {
+		t.Errorf("code = %s, want %s", code, ErrCodeHeartbeatOutOfOrder)
+	}
+
+	delegations, err := s.store.GetToDelegationsByAddress(context.Background(), testOperator.Hex())
+	if err != nil {
+		t.Fatalf("GetToDelegationsByAddress: %v", err)
+	}
+	if len(delegations) != 1 || delegations[0].Amount != 2 || delegations[0].CommissionRate != 5 {
+		t.Errorf("delegations after a refused heartbeat = %+v, want the one of 2 at 5%%", delegations)
+	}
+	client, err := s.store.GetClient(context.Background(), testOperator.Hex())
+	if err != nil || client == nil {
+		t.Fatalf("GetClient = %v, %v", client, err)
+	}
+	if client.CommissionRate != 5 || client.NFTAmount != 2 {
+		t.Errorf("client after a refused heartbeat = %+v, want commission 5 and 2 NFTs", client)
+	}
+}
@@ -1,8 +1,8 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
+	"time"
 
 	"monitoring-service/internal/database"
 )
@@ -17,21 +17,31 @@ type ClientWithHistoryResponse struct {
 	Client      *database.ClientInfo        `json:"client"`
 	Heartbeats  []database.HeartbeatRecord `json:"heartbeats"`
 	Delegations []database.DelegationRecord `json:"delegations"`
+	// Probes are the probes of the client's light client API in the same window
+	Probes []database.ProbeRecord `json:"probes"`
+	// VersionHistory lists every light client build the client has run
+	VersionHistory []database.VersionChange `json:"version_history"`
 }
 
-func GetClients(db *database.Database) http.HandlerFunc {
+type GetClientResponse struct {
+	Status  string                    `json:"status"`
+	Message string                    `json:"message"`
+	Data    ClientWithHistoryResponse `json:"data"`
+}
+
+func GetClients(db database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w)
 			return
 		}
 
 		// Check if client address is provided
 		address := r.URL.Query().Get("address")
 		if address != "" {
-			client, heartbeats, delegations, err := db.GetClientWithHistory(address)
+			client, heartbeats, delegations, err := database.GetClientWithHistory(r.Context(), db, address)
 			if err != nil {
-				http.Error(w, "Failed to fetch client", http.StatusInternalServerError)
+				databaseError(w, err, "Failed to fetch client")
 				return
 			}
 			
@@ -40,25 +50,89 @@ func GetClients(db *database.Database) http.HandlerFunc {
 				Heartbeats:  heartbeats,
 				Delegations: delegations,
 			}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
+			sendJSON(w, response)
+			return
+		}
+
+		listClients(w, r, db)
+	}
+}
+
+// ListClients returns all clients without history
+func ListClients(db database.ClientStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
 			return
 		}
 
-		// Get all clients without history
-		clients, err := db.GetAllClients()
+		listClients(w, r, db)
+	}
+}
+
+// GetClient returns a single client, addressed by path, with its recent history
+func GetClient(db database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		address := r.PathValue("address")
+		if address == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeAddressRequired, "Address is required")
+			return
+		}
+
+		client, heartbeats, delegations, err := database.GetClientWithHistory(r.Context(), db, address)
 		if err != nil {
-			http.Error(w, "Failed to fetch clients", http.StatusInternalServerError)
+			databaseError(w, err, "Failed to fetch client")
+			return
+		}
+		if client == nil {
+			writeError(w, http.StatusNotFound, ErrCodeClientNotFound, "Client not found")
 			return
 		}
 
-		response := GetClientsResponse{
-			Status:  "success",
-			Message: "Clients retrieved successfully",
-			Data:    clients,
+		probes, err := db.GetProbes(r.Context(), address, time.Now().Add(-database.ClientHistoryWindow))
+		if err != nil {
+			databaseError(w, err, "Failed to fetch probes")
+			return
+		}
+
+		versionHistory, err := db.GetVersionHistory(r.Context(), address)
+		if err != nil {
+			databaseError(w, err, "Failed to fetch version history")
+			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		sendJSON(w, GetClientResponse{
+			Status:  "success",
+			Message: "Client retrieved successfully",
+			Data: ClientWithHistoryResponse{
+				Client:         client,
+				Heartbeats:     heartbeats,
+				Delegations:    delegations,
+				Probes:         probes,
+				VersionHistory: versionHistory,
+			},
+		})
 	}
 }
+
+func listClients(w http.ResponseWriter, r *http.Request, db database.ClientStore) {
+	// Get all clients without history
+	clients, err := db.GetAllClients(r.Context())
+	if err != nil {
+		databaseError(w, err, "Failed to fetch clients")
+		return
+	}
+
+	response := GetClientsResponse{
+		Status:  "success",
+		Message: "Clients retrieved successfully",
+		Data:    clients,
+	}
+
+	sendJSON(w, response)
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestContract calls every route and checks the response against the
+// OpenAPI document generated from the route table, so a handler that drifts
+// from the published spec fails here
+func TestContract(t *testing.T) {
+	s := newTestServer(t)
+	s.delegate(testHolder, testOperator, 1, 2)
+	s.register(testOperator)
+
+	operator := testOperator.Hex()
+	tomorrow := time.Now().Add(24 * time.Hour)
+
+	// Routes with non-JSON success bodies are called with a request they
+	// reject, so their error body is checked instead
+	cases := []struct {
+		method string
+		path   string
+		target string
+		body   interface{}
+		status int
+	}{
+		{http.MethodGet, "/v1/health", "/v1/health", nil, http.StatusOK},
+		{http.MethodGet, "/v1/networks", "/v1/networks", nil, http.StatusOK},
+		{http.MethodGet, "/v1/clients", "/v1/clients", nil, http.StatusOK},
+		{http.MethodGet, "/v1/clients/{address}", "/v1/clients/" + operator, nil, http.StatusOK},
+		{http.MethodGet, "/v1/versions", "/v1/versions", nil, http.StatusOK},
+		{http.MethodGet, "/v1/delegators/{address}", "/v1/delegators/" + testHolder.Hex(), nil, http.StatusOK},
+		{http.MethodPost, "/v1/check-nft", "/v1/check-nft",
+			CheckNFTRequest{Address: operator, CommissionRate: "5", OperatorName: "test"}, http.StatusOK},
+		{http.MethodPost, "/v1/check-delegation", "/v1/check-delegation",
+			CheckDelegationRequest{Address: operator, Owner: testHolder.Hex(), TokenID: "1"}, http.StatusOK},
+		{http.MethodGet, "/v1/stream", "/v1/stream?last_event_id=latest", nil, http.StatusBadRequest},
+		{http.MethodGet, "/v1/export/{dataset}", "/v1/export/rewards", nil, http.StatusNotFound},
+		{http.MethodGet, "/v1/operators/ranking", "/v1/operators/ranking", nil, http.StatusOK},
+		{http.MethodGet, "/v1/admin/whoami", "/v1/admin/whoami", nil, http.StatusOK},
+		{http.MethodPost, "/v1/admin/blacklist", "/v1/admin/blacklist",
+			AddToBlacklistRequest{Address: "0x00000000000000000000000000000000000c0001", Reason: "spam"}, http.StatusOK},
+		{http.MethodGet, "/v1/admin/blacklist", "/v1/admin/blacklist", nil, http.StatusOK},
+		{http.MethodDelete, "/v1/admin/blacklist/{address}", "/v1/admin/blacklist/0x00000000000000000000000000000000000c0001", nil, http.StatusOK},
+		{http.MethodPut, "/v1/admin/clients/{address}/status", "/v1/admin/clients/" + operator + "/status",
+			SetStatusOverrideRequest{Status: "Offline", Reason: "maintenance", ExpiresAt: &tomorrow}, http.StatusOK},
+		{http.MethodGet, "/v1/admin/status-overrides", "/v1/admin/status-overrides", nil, http.StatusOK},
+		{http.MethodDelete, "/v1/admin/clients/{address}/status", "/v1/admin/clients/" + operator + "/status", nil, http.StatusOK},
+		{http.MethodPost, "/v1/admin/incidents", "/v1/admin/incidents",
+			CreateIncidentRequest{ClientAddress: operator, Severity: SeverityMinor, Summary: "missed heartbeats"}, http.StatusCreated},
+		{http.MethodGet, "/v1/admin/incidents", "/v1/admin/incidents", nil, http.StatusOK},
+		{http.MethodGet, "/v1/admin/audit-log", "/v1/admin/audit-log", nil, http.StatusOK},
+		{http.MethodGet, "/v1/admin/sybil-flags", "/v1/admin/sybil-flags", nil, http.StatusOK},
+	}
+
+	covered := make(map[string]bool)
+	for _, tc := range cases {
+		covered[tc.method+" "+tc.path] = true
+		t.Run(tc.method+" "+tc.path, func(t *testing.T) {
+			rec := s.do(tc.method, tc.target, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+			if err := s.doc.ValidateResponse(tc.method, tc.path, rec.Code, rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+
+	for _, route := range s.routes {
+		if !covered[route.Method+" "+route.Path] {
+			t.Errorf("no contract test for %s %s", route.Method, route.Path)
+		}
+	}
+}
+
+// TestContractErrors checks the error responses every route shares against
+// the spec: methods a path does not declare, and admin calls without
+// credentials
+func TestContractErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	for _, route := range s.routes {
+		t.Run(route.Method+" "+route.Path, func(t *testing.T) {
+			target := route.Path
+			for _, name := range pathParams(route.Path) {
+				target = strings.ReplaceAll(target, "{"+name+"}", testOperator.Hex())
+			}
+
+			rec := s.do(http.MethodPatch, target, nil)
+			if rec.Code != http.StatusMethodNotAllowed {
+				t.Fatalf("PATCH status = %d, want 405", rec.Code)
+			}
+			if err := s.doc.ValidateResponse(route.Method, route.Path, rec.Code, rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+
+			if route.Role == "" {
+				return
+			}
+			rec = httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(route.Method, target, nil))
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("unauthenticated status = %d, want 401", rec.Code)
+			}
+			if err := s.doc.ValidateResponse(route.Method, route.Path, rec.Code, rec.Body.Bytes()); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -1,7 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 	"monitoring-service/internal/database"
 )
@@ -16,34 +15,39 @@ type ClientWithDelegations struct {
 	ClientInfo *database.ClientInfo `json:"client"`
 }
 
-func GetDelegations(db *database.Database) http.HandlerFunc {
+func GetDelegations(db database.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
-			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			methodNotAllowed(w)
 			return
 		}
 
 		address := r.URL.Query().Get("address")
 		if address == "" {
-			http.Error(w, "Address is required", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, ErrCodeAddressRequired, "Address is required")
 			return
 		}
 
-		delegations, err := db.GetFromDelegationsByAddress(address)
+		delegations, err := db.GetFromDelegationsByAddress(r.Context(), address)
 		if err != nil {
-			http.Error(w, "Failed to fetch delegations", http.StatusInternalServerError)
+			databaseError(w, err, "Failed to fetch delegations")
 			return
 		}
 
 		var clientsWithDelegations []ClientWithDelegations
-		clientDelegationMap := make(map[string]int64) 
+		clientDelegationMap := make(map[string]int64)
+		clientMap := make(map[string]*database.ClientInfo)
 
 		for _, delegation := range delegations {
 			clientAddress := delegation.ToAddress
-			client, err := db.GetClient(clientAddress)
-			if err != nil {
-				http.Error(w, "Failed to fetch client", http.StatusInternalServerError)
-				return
+			client, fetched := clientMap[clientAddress]
+			if !fetched {
+				client, err = db.GetClient(r.Context(), clientAddress)
+				if err != nil {
+					databaseError(w, err, "Failed to fetch client")
+					return
+				}
+				clientMap[clientAddress] = client
 			}
 
 			if client != nil {
@@ -51,19 +55,14 @@ func GetDelegations(db *database.Database) http.HandlerFunc {
 			}
 		}
 
+		// Kept for the unversioned route: NFTAmount carries the delegated
+		// amount here. /v1/delegators/{address} reports it separately.
 		for clientAddress, totalDelegatedAmount := range clientDelegationMap {
-			client, err := db.GetClient(clientAddress)
-			if err != nil {
-				http.Error(w, "Failed to fetch client", http.StatusInternalServerError)
-				return
-			}
-
-			if client != nil {
-				client.NFTAmount = totalDelegatedAmount
-				clientsWithDelegations = append(clientsWithDelegations, ClientWithDelegations{
-					ClientInfo: client,
-				})
-			}
+			client := clientMap[clientAddress]
+			client.NFTAmount = totalDelegatedAmount
+			clientsWithDelegations = append(clientsWithDelegations, ClientWithDelegations{
+				ClientInfo: client,
+			})
 		}
 
 		response := GetDelegationsResponse{
@@ -72,7 +71,6 @@ func GetDelegations(db *database.Database) http.HandlerFunc {
 			Clients: clientsWithDelegations,
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		sendJSON(w, response)
 	}
 }
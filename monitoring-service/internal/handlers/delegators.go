@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"monitoring-service/internal/database"
+)
+
+type DelegatorView struct {
+	Address        string                       `json:"address"`
+	TotalDelegated int64                        `json:"total_delegated"`
+	Operators      []database.DelegatorPosition `json:"operators"`
+}
+
+type GetDelegatorResponse struct {
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Data    DelegatorView `json:"data"`
+}
+
+// GetDelegator returns every operator a holder backs, with the amount
+// delegated and the operator's status, uptime, commission and reward points
+func GetDelegator(db database.DelegationStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		address := r.PathValue("address")
+		if address == "" {
+			writeError(w, http.StatusBadRequest, ErrCodeAddressRequired, "Address is required")
+			return
+		}
+
+		positions, err := db.GetDelegatorPositions(r.Context(), address)
+		if err != nil {
+			databaseError(w, err, "Failed to fetch delegations")
+			return
+		}
+
+		view := DelegatorView{
+			Address:   strings.ToLower(address),
+			Operators: positions,
+		}
+		if view.Operators == nil {
+			view.Operators = []database.DelegatorPosition{}
+		}
+		for _, position := range positions {
+			view.TotalDelegated += position.DelegatedAmount
+		}
+
+		sendJSON(w, GetDelegatorResponse{
+			Status:  "success",
+			Message: "Delegations retrieved successfully",
+			Data:    view,
+		})
+	}
+}
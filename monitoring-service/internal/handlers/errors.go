@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+// ErrorCode is a machine-readable identifier for an API error
+type ErrorCode string
+
+const (
+	ErrCodeMethodNotAllowed     ErrorCode = "method_not_allowed"
+	ErrCodeInvalidRequestBody   ErrorCode = "invalid_request_body"
+	ErrCodeAddressRequired      ErrorCode = "address_required"
+	ErrCodeCommissionRequired   ErrorCode = "commission_rate_required"
+	ErrCodeInvalidCommission    ErrorCode = "invalid_commission_rate"
+	ErrCodeCommissionOutOfRange ErrorCode = "commission_rate_out_of_range"
+	ErrCodeTokenIDRequired      ErrorCode = "token_id_required"
+	ErrCodeInvalidTokenID       ErrorCode = "invalid_token_id"
+	ErrCodeNoDelegations        ErrorCode = "no_incoming_delegations"
+	ErrCodeNFTNotFound          ErrorCode = "nft_not_found"
+	ErrCodeClientNotFound       ErrorCode = "client_not_found"
+	ErrCodeInvalidEventID       ErrorCode = "invalid_event_id"
+	ErrCodeInvalidFormat        ErrorCode = "invalid_format"
+	ErrCodeInvalidTimeRange     ErrorCode = "invalid_time_range"
+	ErrCodeInvalidColumns       ErrorCode = "invalid_columns"
+	ErrCodeUnknownDataset       ErrorCode = "unknown_dataset"
+	ErrCodeInvalidLimit         ErrorCode = "invalid_limit"
+	ErrCodeInvalidAddress       ErrorCode = "invalid_address"
+	ErrCodeAddressBlacklisted   ErrorCode = "address_blacklisted"
+	ErrCodeNotBlacklisted       ErrorCode = "address_not_blacklisted"
+	ErrCodeAddressBlocklisted   ErrorCode = "address_blocklisted"
+	ErrCodeAddressNotAllowed    ErrorCode = "address_not_allowed"
+	ErrCodeInvalidStatus        ErrorCode = "invalid_status"
+	ErrCodeInvalidSeverity      ErrorCode = "invalid_severity"
+	ErrCodeUnauthorized         ErrorCode = "unauthorized"
+	ErrCodeForbidden            ErrorCode = "forbidden"
+	ErrCodeRateLimited          ErrorCode = "rate_limited"
+	ErrCodeInvalidLiveness      ErrorCode = "invalid_liveness"
+	ErrCodeImplausibleLiveness  ErrorCode = "implausible_liveness"
+	ErrCodeInvalidProbeURL      ErrorCode = "invalid_probe_url"
+	ErrCodeInvalidVersion       ErrorCode = "invalid_version"
+	ErrCodeInvalidIdempotency   ErrorCode = "invalid_idempotency_key"
+	ErrCodeInvalidSequence      ErrorCode = "invalid_sequence"
+	ErrCodeTimestampInFuture    ErrorCode = "timestamp_in_future"
+	ErrCodeHeartbeatOutOfOrder  ErrorCode = "heartbeat_out_of_order"
+	ErrCodeHeartbeatInProgress  ErrorCode = "heartbeat_in_progress"
+	ErrCodeUnknownNetwork       ErrorCode = "unknown_network"
+	ErrCodeChainUnavailable     ErrorCode = "chain_unavailable"
+	ErrCodeDatabase             ErrorCode = "database_error"
+	ErrCodeTimeout              ErrorCode = "timeout"
+	ErrCodeInternal             ErrorCode = "internal_error"
+)
+
+// ErrorCodes lists every code the API can return, for the OpenAPI enum
+var ErrorCodes = []ErrorCode{
+	ErrCodeMethodNotAllowed,
+	ErrCodeInvalidRequestBody,
+	ErrCodeAddressRequired,
+	ErrCodeCommissionRequired,
+	ErrCodeInvalidCommission,
+	ErrCodeCommissionOutOfRange,
+	ErrCodeTokenIDRequired,
+	ErrCodeInvalidTokenID,
+	ErrCodeNoDelegations,
+	ErrCodeNFTNotFound,
+	ErrCodeClientNotFound,
+	ErrCodeInvalidEventID,
+	ErrCodeInvalidFormat,
+	ErrCodeInvalidTimeRange,
+	ErrCodeInvalidColumns,
+	ErrCodeUnknownDataset,
+	ErrCodeInvalidLimit,
+	ErrCodeInvalidAddress,
+	ErrCodeAddressBlacklisted,
+	ErrCodeNotBlacklisted,
+	ErrCodeAddressBlocklisted,
+	ErrCodeAddressNotAllowed,
+	ErrCodeInvalidStatus,
+	ErrCodeInvalidSeverity,
+	ErrCodeUnauthorized,
+	ErrCodeForbidden,
+	ErrCodeRateLimited,
+	ErrCodeInvalidLiveness,
+	ErrCodeImplausibleLiveness,
+	ErrCodeInvalidProbeURL,
+	ErrCodeInvalidVersion,
+	ErrCodeInvalidIdempotency,
+	ErrCodeInvalidSequence,
+	ErrCodeTimestampInFuture,
+	ErrCodeHeartbeatOutOfOrder,
+	ErrCodeHeartbeatInProgress,
+	ErrCodeUnknownNetwork,
+	ErrCodeChainUnavailable,
+	ErrCodeDatabase,
+	ErrCodeTimeout,
+	ErrCodeInternal,
+}
+
+// ErrorResponse is the body returned by every endpoint on failure
+type ErrorResponse struct {
+	Status  string    `json:"status"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func writeError(w http.ResponseWriter, statusCode int, code ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	sendJSON(w, ErrorResponse{
+		Status:  "error",
+		Code:    code,
+		Message: message,
+	})
+}
+
+// databaseError rejects a request whose database operation failed, with 504
+// when it ran out of time
+func databaseError(w http.ResponseWriter, err error, message string) {
+	if timedOut(err) {
+		writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, message+": timed out")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, ErrCodeDatabase, message)
+}
+
+// chainError rejects a request whose chain read failed, with 504 when it ran
+// out of time
+func chainError(w http.ResponseWriter, err error, message string) {
+	if timedOut(err) {
+		writeError(w, http.StatusGatewayTimeout, ErrCodeTimeout, message+": timed out")
+		return
+	}
+	writeError(w, http.StatusBadGateway, ErrCodeChainUnavailable, message)
+}
+
+// timedOut reports whether a database or chain call ran out of time
+func timedOut(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || database.IsTimeout(err)
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed")
+}
+
+// rateLimited rejects a request with 429 and when to retry, in whole seconds
+func rateLimited(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int64(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	writeError(w, http.StatusTooManyRequests, ErrCodeRateLimited, message)
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/export"
+)
+
+// exportFlushEvery is how many rows are written between flushes to the client
+const exportFlushEvery = 500
+
+// Export streams clients, heartbeats or delegations as CSV or NDJSON.
+// Query parameters: format, from, to (RFC3339 or unix seconds), columns
+// (comma separated) and address.
+func Export(db database.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		query := r.URL.Query()
+
+		format, err := export.ParseFormat(query.Get("format"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidFormat, "Format must be csv or ndjson")
+			return
+		}
+
+		tr, err := parseTimeRange(query.Get("from"), query.Get("to"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidTimeRange, err.Error())
+			return
+		}
+
+		var columns []string
+		if value := query.Get("columns"); value != "" {
+			columns = strings.Split(value, ",")
+		}
+
+		dataset := r.PathValue("dataset")
+		address := query.Get("address")
+
+		var stream func(rc *http.ResponseController) error
+		switch dataset {
+		case "clients":
+			stream, err = exportStream(w, format, export.ClientColumns, columns, func(fn func(database.ClientInfo) error) error {
+				return db.StreamClients(r.Context(), tr, fn)
+			})
+		case "heartbeats":
+			stream, err = exportStream(w, format, export.HeartbeatColumns, columns, func(fn func(database.HeartbeatRecord) error) error {
+				return db.StreamHeartbeats(r.Context(), address, tr, fn)
+			})
+		case "delegations":
+			stream, err = exportStream(w, format, export.DelegationColumns, columns, func(fn func(database.DelegationRecord) error) error {
+				return db.StreamDelegations(r.Context(), address, tr, fn)
+			})
+		default:
+			writeError(w, http.StatusNotFound, ErrCodeUnknownDataset, "Dataset must be clients, heartbeats or delegations")
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusBadRequest, ErrCodeInvalidColumns, err.Error())
+			return
+		}
+
+		filename := fmt.Sprintf("%s-%s.%s", dataset, time.Now().UTC().Format("20060102T150405Z"), format)
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		w.WriteHeader(http.StatusOK)
+
+		// Headers are already sent, so a failure can only end the stream early
+		if err := stream(http.NewResponseController(w)); err != nil {
+			slog.WarnContext(r.Context(), "Export aborted", "dataset", dataset, "error", err)
+		}
+	}
+}
+
+// exportStream validates the column selection and returns a function that
+// streams every record produced by source through an export writer
+func exportStream[T any](w http.ResponseWriter, format export.Format, all []export.Column[T], names []string, source func(func(T) error) error) (func(*http.ResponseController) error, error) {
+	columns, err := export.SelectColumns(all, names)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(rc *http.ResponseController) error {
+		writer := export.NewWriter(w, format, columns)
+		rows := 0
+		err := source(func(record T) error {
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+			rows++
+			if rows%exportFlushEvery == 0 {
+				if err := writer.Flush(); err != nil {
+					return err
+				}
+				return rc.Flush()
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return writer.Flush()
+	}, nil
+}
+
+func parseTimeRange(from, to string) (database.TimeRange, error) {
+	var tr database.TimeRange
+	var err error
+
+	if from != "" {
+		if tr.From, err = parseTime(from); err != nil {
+			return tr, fmt.Errorf("invalid from: %v", err)
+		}
+	}
+	if to != "" {
+		if tr.To, err = parseTime(to); err != nil {
+			return tr, fmt.Errorf("invalid to: %v", err)
+		}
+	}
+	if !tr.From.IsZero() && !tr.To.IsZero() && !tr.From.Before(tr.To) {
+		return tr, fmt.Errorf("from must be before to")
+	}
+	return tr, nil
+}
+
+// parseTime accepts RFC3339 timestamps or unix seconds
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
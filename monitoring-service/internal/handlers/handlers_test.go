@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"monitoring-service/internal/access"
+	"monitoring-service/internal/auth"
+	availfake "monitoring-service/internal/avail/fake"
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/blockchain/fake"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/database/memory"
+	"monitoring-service/internal/events"
+	"monitoring-service/internal/liveness"
+	"monitoring-service/internal/logging"
+	"monitoring-service/internal/openapi"
+	"monitoring-service/internal/ratelimit"
+	"monitoring-service/pkg/config"
+)
+
+var (
+	testNFTContract = common.HexToAddress("0x00000000000000000000000000000000000e1155")
+	testRegistry    = common.HexToAddress("0x00000000000000447e69651d841bd8d104bed493")
+	testRights      = [32]byte{31: 0x01}
+
+	testOperator = common.HexToAddress("0x00000000000000000000000000000000000a0001")
+	testHolder   = common.HexToAddress("0x00000000000000000000000000000000000b0001")
+)
+
+// testAdminKey authenticates as an admin on the test server
+const testAdminKey = "test-admin-key"
+
+// testServer is the versioned API of one network, backed by the in-memory
+// store and a fake chain
+type testServer struct {
+	t        *testing.T
+	store    *memory.Store
+	chain    *fake.Chain
+	broker   *events.Broker
+	policy   *access.Policy
+	settings *config.Live
+	routes   []Route
+	doc      *openapi.Document
+	mux      *http.ServeMux
+}
+
+// newTestServer mounts the routes of a network configured from the
+// environment, with rate limits off and chain calls that time out after a
+// second without being retried
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	return newTestServerWith(t, nil)
+}
+
+// newTestServerWith is newTestServer with the handlers' store wrapped by
+// wrap, e.g. to inject database failures
+func newTestServerWith(t *testing.T, wrap func(database.Store) database.Store) *testServer {
+	t.Helper()
+
+	env := map[string]string{
+		"MONGO_URI":                     "memory://",
+		"MONGO_DB":                      "handlers",
+		"RPC_URL":                       "fake://",
+		"NFT_CONTRACT_ADDRESS":          testNFTContract.Hex(),
+		"DELEGATE_CONTRACT_ADDRESS":     testRegistry.Hex(),
+		"RIGHTS":                        common.Bytes2Hex(testRights[:]),
+		"CHECK_NFT_INTERVAL":            "5",
+		"CHAIN_TIMEOUT_SECONDS":         "1",
+		"RATE_LIMIT_ADDRESS_PER_MINUTE": "0",
+		"RATE_LIMIT_IP_PER_MINUTE":      "0",
+	}
+	for key, value := range env {
+		t.Setenv(key, value)
+	}
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+
+	chain := fake.New(testNFTContract)
+	store := memory.New(logging.Discard())
+	broker := events.NewBroker(events.DefaultHistorySize, events.DefaultBufferSize)
+	policy := access.NewPolicy(cfg.Blocklist, cfg.Allowlist)
+	limiter := ratelimit.FromConfig(cfg.RateLimit, nil, logging.Discard())
+	livenessChecker := liveness.NewChecker(availfake.New(1000), cfg.AvailMaxBlockLag, logging.Discard())
+	authenticator := auth.New([]auth.APIKey{{Name: "test", Role: auth.RoleAdmin, Key: testAdminKey}}, nil)
+	settings := config.NewLive(cfg)
+	t.Cleanup(func() {
+		broker.Close()
+		store.Close()
+	})
+
+	var db database.Store = store
+	if wrap != nil {
+		db = wrap(db)
+	}
+
+	chainPolicy := blockchain.RetryPolicy{Attempts: 1, Timeout: cfg.ChainTimeout}
+	routes := Routes(settings, cfg.NetworkID, access.FilterStore(db, policy),
+		blockchain.WithDelegationRetry(chain, chainPolicy), blockchain.WithBalanceRetry(chain, chainPolicy),
+		broker, authenticator, policy, limiter, livenessChecker)
+	mux := http.NewServeMux()
+	Mount(mux, routes, func(next http.Handler) http.Handler { return next })
+
+	return &testServer{
+		t:        t,
+		store:    store,
+		chain:    chain,
+		broker:   broker,
+		policy:   policy,
+		settings: settings,
+		routes:   routes,
+		doc:      OpenAPIDocument(routes),
+		mux:      mux,
+	}
+}
+
+// do serves a request, JSON encoding body unless it is nil or already a
+// string. Requests under /v1/admin are sent with the admin key.
+func (s *testServer) do(method, path string, body interface{}) *httptest.ResponseRecorder {
+	s.t.Helper()
+
+	var reader io.Reader
+	switch body := body.(type) {
+	case nil:
+	case string:
+		reader = bytes.NewBufferString(body)
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatalf("encode %s %s body: %v", method, path, err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req := httptest.NewRequest(method, path, reader)
+	if strings.HasPrefix(path, VersionedPath("/admin")) {
+		req.Header.Set("X-API-Key", testAdminKey)
+	}
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// delegate delegates amount of tokenID from holder to operator with the
+// accepted rights, and gives the holder that many tokens
+func (s *testServer) delegate(holder, operator common.Address, tokenID, amount int64) {
+	s.chain.SetBalance(holder, tokenID, amount)
+	s.chain.DelegateERC1155(holder, operator, tokenID, testRights, amount)
+}
+
+// register records a heartbeat for operator directly in the store
+func (s *testServer) register(operator common.Address) {
+	s.t.Helper()
+
+	err := s.store.RecordHeartbeat(context.Background(), operator.Hex(), database.ClientHeartbeat{
+		Amount:         1,
+		CommissionRate: 5,
+		OperatorName:   "test",
+		MaxGap:         5 * time.Minute,
+	})
+	if err != nil {
+		s.t.Fatalf("RecordHeartbeat: %v", err)
+	}
+	err = s.store.ReplaceDelegations(context.Background(), operator.Hex(), map[string]int64{testHolder.Hex(): 1}, 5)
+	if err != nil {
+		s.t.Fatalf("ReplaceDelegations: %v", err)
+	}
+}
+
+// errorCode decodes the code of an error response
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder) ErrorCode {
+	t.Helper()
+
+	var resp ErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode error response (status %d): %v", rec.Code, err)
+	}
+	return resp.Code
+}
@@ -1,9 +1,34 @@
 package handlers
 
-import "net/http"
+import (
+	"net/http"
+
+	"monitoring-service/internal/readiness"
+)
+
+type HealthResponse struct {
+	Status string `json:"status"`
+}
 
 func HealthCheck(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status": "healthy"}`))
+	sendJSON(w, HealthResponse{Status: "healthy"})
+}
+
+// Livez answers as long as the process serves HTTP. It checks no
+// dependencies, so an outage does not get the service restarted.
+func Livez(w http.ResponseWriter, r *http.Request) {
+	sendJSON(w, HealthResponse{Status: "alive"})
+}
+
+// Readyz reports the status and latency of every dependency, with 503 when
+// any of them is down
+func Readyz(checker *readiness.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checker.Check(r.Context())
+		if !report.Ready() {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		sendJSON(w, report)
+	}
 }
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"monitoring-service/internal/database"
+)
+
+const (
+	// IdempotencyKeyHeader carries a heartbeat's idempotency key when the
+	// body does not
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// ReplayedHeader marks the original response replayed to a retry
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+var idempotencyKeyPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// heartbeatKey returns what a heartbeat is deduplicated by: its idempotency
+// key, else its sequence number, else nothing
+func heartbeatKey(r *http.Request, req CheckNFTRequest) (string, error) {
+	key := req.IdempotencyKey
+	if key == "" {
+		key = r.Header.Get(IdempotencyKeyHeader)
+	}
+	if key != "" {
+		if !idempotencyKeyPattern.MatchString(key) {
+			return "", errors.New("Idempotency key must be 1 to 128 letters, digits, dots, underscores, colons or dashes")
+		}
+		return "key:" + key, nil
+	}
+	if req.Sequence > 0 {
+		return "seq:" + strconv.FormatInt(req.Sequence, 10), nil
+	}
+	return "", nil
+}
+
+// replayHeartbeat answers a retried heartbeat with the response to the
+// original, or with 409 while the original is still being processed
+func replayHeartbeat(w http.ResponseWriter, claim *database.HeartbeatClaim) {
+	if !claim.Completed {
+		writeError(w, http.StatusConflict, ErrCodeHeartbeatInProgress, "A heartbeat with this key is still being processed")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(ReplayedHeader, "true")
+	w.WriteHeader(claim.StatusCode)
+	w.Write(claim.Body)
+}
+
+// finishHeartbeat keeps the response to a claimed heartbeat for its retries
+// when the heartbeat was accepted. Any other response releases the key, so
+// the retry is processed afresh and is judged on the state at that time.
+func finishHeartbeat(ctx context.Context, db database.HeartbeatStore, address, key string, recorder *responseRecorder) {
+	// The response is kept even when the client has gone away
+	ctx = context.WithoutCancel(ctx)
+
+	var err error
+	if recorder.statusCode >= 200 && recorder.statusCode < 300 {
+		err = db.CompleteHeartbeat(ctx, address, key, recorder.statusCode, recorder.body.Bytes())
+	} else {
+		err = db.ReleaseHeartbeat(ctx, address, key)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to store heartbeat response", "address", address, "error", err)
+	}
+}
+
+// responseRecorder copies the response it writes
+type responseRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+}
+
+func (rec *responseRecorder) WriteHeader(code int) {
+	rec.statusCode = code
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
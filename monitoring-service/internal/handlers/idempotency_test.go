@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHeartbeatRetries(t *testing.T) {
+	s := newTestServer(t)
+	heartbeat := CheckNFTRequest{Address: testOperator.Hex(), CommissionRate: "5", IdempotencyKey: "heartbeat-1"}
+
+	// A rejected heartbeat is not kept, so its retry is judged afresh
+	rec := s.do(http.MethodPost, "/v1/check-nft", heartbeat)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("heartbeat without delegations = %d, want 403: %s", rec.Code, rec.Body)
+	}
+	s.delegate(testHolder, testOperator, 1, 2)
+	rec = s.do(http.MethodPost, "/v1/check-nft", heartbeat)
+	if rec.Code != http.StatusOK || rec.Header().Get(ReplayedHeader) != "" {
+		t.Fatalf("retry after delegating = %d (replayed %q), want a fresh 200: %s",
+			rec.Code, rec.Header().Get(ReplayedHeader), rec.Body)
+	}
+
+	// An accepted heartbeat is replayed to its retries
+	rec = s.do(http.MethodPost, "/v1/check-nft", heartbeat)
+	if rec.Code != http.StatusOK || rec.Header().Get(ReplayedHeader) != "true" {
+		t.Errorf("retry of an accepted heartbeat = %d (replayed %q), want the replayed 200",
+			rec.Code, rec.Header().Get(ReplayedHeader))
+	}
+
+	// Sequences are checked when the heartbeat is recorded
+	for _, tt := range []struct {
+		sequence   int64
+		wantStatus int
+	}{
+		{5, http.StatusOK},
+		{4, http.StatusConflict},
+		{6, http.StatusOK},
+	} {
+		rec := s.do(http.MethodPost, "/v1/check-nft", CheckNFTRequest{Address: testOperator.Hex(), CommissionRate: "5", Sequence: tt.sequence})
+		if rec.Code != tt.wantStatus {
+			t.Fatalf("sequence %d = %d, want %d: %s", tt.sequence, rec.Code, tt.wantStatus, rec.Body)
+		}
+		if rec.Code == http.StatusConflict {
+			if code := errorCode(t, rec); code != ErrCodeHeartbeatOutOfOrder {
+				t.Errorf("sequence %d code = %s, want %s", tt.sequence, code, ErrCodeHeartbeatOutOfOrder)
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+)
+
+// Legacy serves next with the responses the unversioned routes have always
+// sent: a request the service rejects is answered with 200 and
+// {"status": "error", "message": ...}, and only a wrong method or an
+// unreadable body is an HTTP error. Server errors are passed through.
+// The /v1 routes report every rejection with its HTTP status instead.
+func Legacy(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		lw := &legacyWriter{ResponseWriter: w}
+		next(lw, r)
+		if lw.status == 0 {
+			return
+		}
+
+		status := http.StatusOK
+		var resp ErrorResponse
+		if err := json.Unmarshal(lw.body.Bytes(), &resp); err != nil ||
+			resp.Code == ErrCodeMethodNotAllowed || resp.Code == ErrCodeInvalidRequestBody {
+			status = lw.status
+		}
+		w.WriteHeader(status)
+		w.Write(lw.body.Bytes())
+	}
+}
+
+// legacyWriter holds back client error responses for Legacy
+type legacyWriter struct {
+	http.ResponseWriter
+	// status is the client error being held back, if any
+	status int
+	body   bytes.Buffer
+}
+
+func (w *legacyWriter) WriteHeader(statusCode int) {
+	if statusCode >= 400 && statusCode < 500 {
+		w.status = statusCode
+		return
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *legacyWriter) Write(b []byte) (int, error) {
+	if w.status != 0 {
+		return w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
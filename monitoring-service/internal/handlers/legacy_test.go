@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestLegacy(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+
+		wantStatus int
+		wantCode   ErrorCode
+	}{
+		{
+			name: "Success",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				sendJSON(w, CheckNFTResponse{Status: "success"})
+			},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name: "Rejected",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, http.StatusForbidden, ErrCodeNoDelegations, "Address does not have any incoming delegations")
+			},
+			wantStatus: http.StatusOK,
+			wantCode:   ErrCodeNoDelegations,
+		},
+		{
+			name: "RateLimited",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				rateLimited(w, time.Second, "Too many heartbeats")
+			},
+			wantStatus: http.StatusOK,
+			wantCode:   ErrCodeRateLimited,
+		},
+		{
+			name: "MethodNotAllowed",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				methodNotAllowed(w)
+			},
+			wantStatus: http.StatusMethodNotAllowed,
+			wantCode:   ErrCodeMethodNotAllowed,
+		},
+		{
+			name: "InvalidBody",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidRequestBody, "Invalid request body")
+			},
+			wantStatus: http.StatusBadRequest,
+			wantCode:   ErrCodeInvalidRequestBody,
+		},
+		{
+			name: "ServerError",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, http.StatusBadGateway, ErrCodeChainUnavailable, "Failed to get incoming delegations")
+			},
+			wantStatus: http.StatusBadGateway,
+			wantCode:   ErrCodeChainUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Legacy(tt.handler)(rec, httptest.NewRequest(http.MethodPost, "/check-nft", nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			var resp ErrorResponse
+			if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			wantStatus := "success"
+			if tt.wantCode != "" {
+				wantStatus = "error"
+			}
+			if resp.Status != wantStatus || resp.Code != tt.wantCode {
+				t.Errorf("response = %+v, want status %s and code %q", resp, wantStatus, tt.wantCode)
+			}
+		})
+	}
+}
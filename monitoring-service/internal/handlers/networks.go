@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+	"monitoring-service/internal/tracing"
+	"monitoring-service/pkg/config"
+)
+
+// NetworkParam is the query parameter every API takes to select a network.
+// Requests without it go to the default network.
+const NetworkParam = "network"
+
+type NetworkInfo struct {
+	ID                      string `json:"id"`
+	NFTContractAddress      string `json:"nft_contract_address"`
+	DelegateContractAddress string `json:"delegate_contract_address"`
+	Default                 bool   `json:"default"`
+}
+
+type ListNetworksResponse struct {
+	Status  string        `json:"status"`
+	Message string        `json:"message"`
+	Data    []NetworkInfo `json:"data"`
+}
+
+// SelectNetwork passes each request to the handler of the network named by
+// its network parameter, or of the first network when it has none
+func SelectNetwork(networkIDs []string, handlers map[string]http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get(NetworkParam)
+		if id == "" {
+			id = networkIDs[0]
+		}
+		handler, ok := handlers[id]
+		if !ok {
+			writeError(w, http.StatusBadRequest, ErrCodeUnknownNetwork, "Unknown network "+id)
+			return
+		}
+		trace.SpanFromContext(r.Context()).SetAttributes(tracing.NetworkKey.String(id))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ListNetworks returns the networks the service monitors
+func ListNetworks(networks []config.Network) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		data := make([]NetworkInfo, len(networks))
+		for i, network := range networks {
+			data[i] = NetworkInfo{
+				ID:                      network.ID,
+				NFTContractAddress:      network.NFTContractAddr,
+				DelegateContractAddress: network.DelegateContractAddr,
+				Default:                 i == 0,
+			}
+		}
+
+		sendJSON(w, ListNetworksResponse{
+			Status:  "success",
+			Message: "Networks retrieved successfully",
+			Data:    data,
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/ranking"
+	"monitoring-service/internal/uptime"
+	"monitoring-service/pkg/config"
+)
+
+type GetOperatorRankingResponse struct {
+	Status  string                  `json:"status"`
+	Message string                  `json:"message"`
+	Weights config.RankingWeights   `json:"weights"`
+	Data    []ranking.OperatorScore `json:"data"`
+}
+
+// GetOperatorRanking ranks operators for delegators by weekly and all-time
+// uptime, commission, commission stability and incidents over the last week
+func GetOperatorRanking(db database.Store, settings *config.Live) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		weights := settings.Get().RankingWeights
+
+		limit := 0
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidLimit, "Limit must be a positive integer")
+				return
+			}
+			limit = parsed
+		}
+
+		clients, err := db.GetAllClients(r.Context())
+		if err != nil {
+			databaseError(w, err, "Failed to fetch clients")
+			return
+		}
+
+		activity, err := db.GetOperatorActivity(r.Context(), time.Now().Add(-uptime.WeeklyHistoryDuration))
+		if err != nil {
+			databaseError(w, err, "Failed to fetch operator activity")
+			return
+		}
+
+		scores := ranking.Rank(clients, activity, weights)
+		if limit > 0 && len(scores) > limit {
+			scores = scores[:limit]
+		}
+
+		sendJSON(w, GetOperatorRankingResponse{
+			Status:  "success",
+			Message: "Operators ranked successfully",
+			Weights: weights,
+			Data:    scores,
+		})
+	}
+}
@@ -0,0 +1,499 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"monitoring-service/internal/access"
+	"monitoring-service/internal/auth"
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/events"
+	"monitoring-service/internal/liveness"
+	"monitoring-service/internal/openapi"
+	"monitoring-service/internal/ratelimit"
+	"monitoring-service/pkg/config"
+)
+
+const APIVersion = "v1"
+
+// Route describes one API operation. The same table is used to mount the
+// handlers and to generate the OpenAPI document, so the published spec is
+// always built from the types the handlers encode.
+type Route struct {
+	Method      string
+	Path        string
+	OperationID string
+	Summary     string
+	Query       []QueryParam
+	Request     interface{}
+	// ContentType of successful responses; defaults to application/json
+	ContentType string
+	Responses   map[int]interface{}
+	// Role required to call the route; routes without one are public
+	Role    auth.Role
+	Handler http.HandlerFunc
+}
+
+type QueryParam struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+// Mount registers the routes on mux, dispatching on method per path. Methods
+// that are not declared for a path get the JSON 405 error.
+func Mount(mux *http.ServeMux, routes []Route, wrap func(http.Handler) http.Handler) {
+	byPath := make(map[string]map[string]http.HandlerFunc)
+	var paths []string
+	for _, route := range routes {
+		if _, ok := byPath[route.Path]; !ok {
+			byPath[route.Path] = make(map[string]http.HandlerFunc)
+			paths = append(paths, route.Path)
+		}
+		byPath[route.Path][route.Method] = route.Handler
+	}
+
+	for _, path := range paths {
+		methods := byPath[path]
+		mux.Handle(path, wrap(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Method + " " + path)
+			span.SetAttributes(attribute.String("http.route", path))
+
+			handler, ok := methods[r.Method]
+			if !ok {
+				methodNotAllowed(w)
+				return
+			}
+			handler(w, r)
+		})))
+	}
+}
+
+// OpenAPIDocument builds the OpenAPI 3 document for the given routes
+func OpenAPIDocument(routes []Route) *openapi.Document {
+	doc := openapi.NewDocument("Avail Light Client Monitoring Service", APIVersion)
+
+	for _, route := range routes {
+		op := &openapi.Operation{
+			Summary:     route.Summary,
+			OperationID: route.OperationID,
+			Responses:   make(map[string]*openapi.Response),
+		}
+
+		for _, name := range pathParams(route.Path) {
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &openapi.Schema{Type: "string"},
+			})
+		}
+
+		// Every operation is scoped to a network
+		op.Parameters = append(op.Parameters, openapi.Parameter{
+			Name:        NetworkParam,
+			In:          "query",
+			Description: "Network to use; defaults to the first network listed by GET /v1/networks",
+			Schema:      &openapi.Schema{Type: "string"},
+		})
+
+		for _, param := range route.Query {
+			op.Parameters = append(op.Parameters, openapi.Parameter{
+				Name:        param.Name,
+				In:          "query",
+				Description: param.Description,
+				Required:    param.Required,
+				Schema:      &openapi.Schema{Type: "string"},
+			})
+		}
+
+		if route.Request != nil {
+			op.RequestBody = &openapi.RequestBody{
+				Required: true,
+				Content: map[string]*openapi.MediaType{
+					"application/json": {Schema: doc.SchemaFor(route.Request)},
+				},
+			}
+		}
+
+		statuses := make([]int, 0, len(route.Responses))
+		for status := range route.Responses {
+			statuses = append(statuses, status)
+		}
+		sort.Ints(statuses)
+
+		for _, status := range statuses {
+			resp := &openapi.Response{Description: http.StatusText(status)}
+			if body := route.Responses[status]; body != nil {
+				contentType := "application/json"
+				if route.ContentType != "" && status < http.StatusBadRequest {
+					contentType = route.ContentType
+				}
+				resp.Content = map[string]*openapi.MediaType{
+					contentType: {Schema: doc.SchemaFor(body)},
+				}
+			}
+			op.Responses[fmt.Sprint(status)] = resp
+		}
+
+		if route.Role != "" {
+			op.Description = "Requires the " + string(route.Role) + " role or higher."
+			op.Security = []openapi.SecurityRequirement{{"bearerAuth": {}}, {"apiKeyAuth": {}}}
+			doc.Components.SecuritySchemes = map[string]*openapi.SecurityScheme{
+				"bearerAuth": {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "An admin API key or an HS256 JWT with sub, role and exp claims",
+				},
+				"apiKeyAuth": {Type: "apiKey", In: "header", Name: "X-API-Key"},
+			}
+		}
+
+		doc.AddOperation(route.Method, route.Path, op)
+	}
+
+	if errSchema, ok := doc.Components.Schemas["ErrorResponse"]; ok {
+		codes := make([]string, len(ErrorCodes))
+		for i, code := range ErrorCodes {
+			codes[i] = string(code)
+		}
+		errSchema.Properties["code"].Enum = codes
+		errSchema.Properties["status"].Enum = []string{"error"}
+	}
+
+	return doc
+}
+
+// OpenAPI serves the generated OpenAPI document
+func OpenAPI(doc *openapi.Document) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+		sendJSON(w, doc)
+	}
+}
+
+// pathParams returns the names of the {wildcards} in a route pattern
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}"))
+		}
+	}
+	return names
+}
+
+// VersionedPath prefixes path with the current API version
+func VersionedPath(path string) string {
+	return "/" + APIVersion + "/" + strings.TrimPrefix(path, "/")
+}
+
+// Routes returns the versioned API routes of the network with the given ID.
+// Handlers read hot-reloadable settings from settings on every request.
+func Routes(settings *config.Live, networkID string, db database.Store, delegateRegistry blockchain.DelegationReader, nftChecker blockchain.BalanceReader, broker *events.Broker, authenticator *auth.Authenticator, policy *access.Policy, limiter *ratelimit.Limiter, livenessChecker *liveness.Checker) []Route {
+	errorResponses := func(statuses ...int) map[int]interface{} {
+		responses := make(map[int]interface{})
+		for _, status := range statuses {
+			responses[status] = ErrorResponse{}
+		}
+		withTimeout(responses)
+		return responses
+	}
+	with := func(responses map[int]interface{}, status int, body interface{}) map[int]interface{} {
+		responses[status] = body
+		return responses
+	}
+
+	routes := []Route{
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/health"),
+			OperationID: "healthCheck",
+			Summary:     "Service health",
+			Responses: with(errorResponses(http.StatusMethodNotAllowed),
+				http.StatusOK, HealthResponse{}),
+			Handler: HealthCheck,
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/networks"),
+			OperationID: "listNetworks",
+			Summary:     "Networks the service monitors, selected on every operation with the network parameter",
+			Responses: with(errorResponses(http.StatusMethodNotAllowed),
+				http.StatusOK, ListNetworksResponse{}),
+			Handler: ListNetworks(settings.Get().Networks),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/clients"),
+			OperationID: "listClients",
+			Summary:     "List registered clients with uptime and status",
+			Responses: with(errorResponses(http.StatusMethodNotAllowed, http.StatusInternalServerError),
+				http.StatusOK, GetClientsResponse{}),
+			Handler: ListClients(db),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/clients/{address}"),
+			OperationID: "getClient",
+			Summary:     "Get one client with its last 24h of heartbeats, its delegations and its version history",
+			Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed,
+				http.StatusInternalServerError),
+				http.StatusOK, GetClientResponse{}),
+			Handler: GetClient(db),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/versions"),
+			OperationID: "getVersionDistribution",
+			Summary:     "Light client versions, networks and platforms across clients, against the minimum version",
+			Responses: with(errorResponses(http.StatusMethodNotAllowed, http.StatusInternalServerError),
+				http.StatusOK, GetVersionDistributionResponse{}),
+			Handler: GetVersionDistribution(db, settings),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/delegators/{address}"),
+			OperationID: "getDelegator",
+			Summary:     "Operators a holder has delegated to, with status, uptime, commission and the operator's reward points",
+			Responses: with(errorResponses(http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusInternalServerError),
+				http.StatusOK, GetDelegatorResponse{}),
+			Handler: GetDelegator(db),
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        VersionedPath("/check-nft"),
+			OperationID: "checkNFT",
+			Summary:     "Submit a heartbeat and verify the client's delegated licenses",
+			Request:     CheckNFTRequest{},
+			Responses: with(errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusMethodNotAllowed, http.StatusConflict,
+				http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusGatewayTimeout),
+				http.StatusOK, CheckNFTResponse{}),
+			Handler: CheckNFT(settings, networkID, db, delegateRegistry, nftChecker, broker, policy, limiter, livenessChecker),
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        VersionedPath("/check-delegation"),
+			OperationID: "checkDelegation",
+			Summary:     "Check the ERC1155 delegation between two addresses for a token",
+			Request:     CheckDelegationRequest{},
+			Responses: with(errorResponses(http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusGatewayTimeout),
+				http.StatusOK, CheckDelegationResponse{}),
+			Handler: CheckDelegation(nftChecker, delegateRegistry),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/stream"),
+			OperationID: "streamEvents",
+			Summary:     "Server-Sent Events stream of heartbeats, status changes and delegation updates",
+			Query: []QueryParam{
+				{Name: "address", Description: "Comma separated client addresses to receive events for"},
+				{Name: "type", Description: "Comma separated event types: heartbeat-accepted, status-changed, delegation-updated"},
+				{Name: "last_event_id", Description: "Resume after this event ID when the Last-Event-ID header cannot be set"},
+			},
+			ContentType: "text/event-stream",
+			Responses: with(errorResponses(http.StatusBadRequest, http.StatusMethodNotAllowed),
+				http.StatusOK, events.Event{}),
+			Handler: Stream(broker, policy),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/export/{dataset}"),
+			OperationID: "exportDataset",
+			Summary:     "Stream clients, heartbeats or delegations as CSV or NDJSON",
+			Query: []QueryParam{
+				{Name: "format", Description: "csv (default) or ndjson"},
+				{Name: "from", Description: "Start of the time range, RFC3339 or unix seconds"},
+				{Name: "to", Description: "End of the time range (exclusive), RFC3339 or unix seconds"},
+				{Name: "columns", Description: "Comma separated columns to include; output keeps the canonical column order"},
+				{Name: "address", Description: "Only heartbeats or delegations for this address"},
+			},
+			Responses: with(errorResponses(http.StatusBadRequest, http.StatusNotFound, http.StatusMethodNotAllowed),
+				http.StatusOK, nil),
+			Handler: Export(db),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/operators/ranking"),
+			OperationID: "getOperatorRanking",
+			Summary:     "Rank operators for delegators, with the score breakdown for each",
+			Query: []QueryParam{
+				{Name: "limit", Description: "Return only the top N operators"},
+			},
+			Responses: with(errorResponses(http.StatusBadRequest, http.StatusMethodNotAllowed, http.StatusInternalServerError),
+				http.StatusOK, GetOperatorRankingResponse{}),
+			Handler: GetOperatorRanking(db, settings),
+		},
+	}
+
+	return append(routes, AdminRoutes(db, authenticator, settings)...)
+}
+
+// AdminRoutes returns the authenticated admin API. Every route checks the
+// caller's role, and every authorized call to a mutating route is written to
+// the audit log.
+func AdminRoutes(db database.Store, authenticator *auth.Authenticator, settings *config.Live) []Route {
+	adminErrors := func(statuses ...int) map[int]interface{} {
+		responses := map[int]interface{}{
+			http.StatusUnauthorized:     ErrorResponse{},
+			http.StatusForbidden:        ErrorResponse{},
+			http.StatusMethodNotAllowed: ErrorResponse{},
+		}
+		for _, status := range statuses {
+			responses[status] = ErrorResponse{}
+		}
+		withTimeout(responses)
+		return responses
+	}
+	with := func(responses map[int]interface{}, status int, body interface{}) map[int]interface{} {
+		responses[status] = body
+		return responses
+	}
+
+	routes := []Route{
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/admin/whoami"),
+			OperationID: "adminWhoAmI",
+			Summary:     "The authenticated caller and its role",
+			Responses:   with(adminErrors(), http.StatusOK, WhoAmIResponse{}),
+			Role:        auth.RoleReadOnly,
+			Handler:     WhoAmI(),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/admin/blacklist"),
+			OperationID: "getBlacklist",
+			Summary:     "List blacklisted addresses",
+			Responses:   with(adminErrors(http.StatusInternalServerError), http.StatusOK, BlacklistResponse{}),
+			Role:        auth.RoleReadOnly,
+			Handler:     GetBlacklist(db),
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        VersionedPath("/admin/blacklist"),
+			OperationID: "addToBlacklist",
+			Summary:     "Bar an address from registering and sending heartbeats",
+			Request:     AddToBlacklistRequest{},
+			Responses: with(adminErrors(http.StatusBadRequest, http.StatusInternalServerError),
+				http.StatusOK, BlacklistEntryResponse{}),
+			Role:    auth.RoleAdmin,
+			Handler: AddToBlacklist(db),
+		},
+		{
+			Method:      http.MethodDelete,
+			Path:        VersionedPath("/admin/blacklist/{address}"),
+			OperationID: "removeFromBlacklist",
+			Summary:     "Remove an address from the blacklist",
+			Responses: with(adminErrors(http.StatusNotFound, http.StatusInternalServerError),
+				http.StatusOK, AdminResponse{}),
+			Role:    auth.RoleAdmin,
+			Handler: RemoveFromBlacklist(db),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/admin/status-overrides"),
+			OperationID: "getStatusOverrides",
+			Summary:     "List client status overrides by address, including expired ones",
+			Responses:   with(adminErrors(http.StatusInternalServerError), http.StatusOK, StatusOverridesResponse{}),
+			Role:        auth.RoleReadOnly,
+			Handler:     GetStatusOverrides(db),
+		},
+		{
+			Method:      http.MethodPut,
+			Path:        VersionedPath("/admin/clients/{address}/status"),
+			OperationID: "setStatusOverride",
+			Summary:     "Override a client's status until the override expires or is cleared",
+			Request:     SetStatusOverrideRequest{},
+			Responses: with(adminErrors(http.StatusBadRequest, http.StatusNotFound, http.StatusInternalServerError),
+				http.StatusOK, StatusOverrideResponse{}),
+			Role:    auth.RoleOperatorSupport,
+			Handler: SetStatusOverride(db),
+		},
+		{
+			Method:      http.MethodDelete,
+			Path:        VersionedPath("/admin/clients/{address}/status"),
+			OperationID: "clearStatusOverride",
+			Summary:     "Return a client to the status derived from its heartbeats",
+			Responses: with(adminErrors(http.StatusNotFound, http.StatusInternalServerError),
+				http.StatusOK, AdminResponse{}),
+			Role:    auth.RoleOperatorSupport,
+			Handler: ClearStatusOverride(db),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/admin/incidents"),
+			OperationID: "getIncidents",
+			Summary:     "List incident annotations, newest first",
+			Query: []QueryParam{
+				{Name: "address", Description: "Only incidents of this client"},
+				{Name: "from", Description: "Only incidents started at or after this time, RFC3339 or unix seconds"},
+				{Name: "to", Description: "Only incidents started before this time, RFC3339 or unix seconds"},
+			},
+			Responses: with(adminErrors(http.StatusBadRequest, http.StatusInternalServerError),
+				http.StatusOK, IncidentsResponse{}),
+			Role:    auth.RoleReadOnly,
+			Handler: GetIncidents(db),
+		},
+		{
+			Method:      http.MethodPost,
+			Path:        VersionedPath("/admin/incidents"),
+			OperationID: "createIncident",
+			Summary:     "Annotate a client with an incident",
+			Request:     CreateIncidentRequest{},
+			Responses: with(adminErrors(http.StatusBadRequest, http.StatusInternalServerError),
+				http.StatusCreated, IncidentResponse{}),
+			Role:    auth.RoleOperatorSupport,
+			Handler: CreateIncident(db),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/admin/audit-log"),
+			OperationID: "getAuditLog",
+			Summary:     "Most recent mutating admin calls, newest first",
+			Query: []QueryParam{
+				{Name: "limit", Description: "Return at most N entries (default 100)"},
+			},
+			Responses: with(adminErrors(http.StatusBadRequest, http.StatusInternalServerError),
+				http.StatusOK, AuditLogResponse{}),
+			Role:    auth.RoleAdmin,
+			Handler: GetAuditLog(db),
+		},
+		{
+			Method:      http.MethodGet,
+			Path:        VersionedPath("/admin/sybil-flags"),
+			OperationID: "getSybilFlags",
+			Summary:     "Operators sharing a delegator set or source IP, flagged for review",
+			Responses: with(adminErrors(http.StatusInternalServerError),
+				http.StatusOK, SybilFlagsResponse{}),
+			Role:    auth.RoleReadOnly,
+			Handler: GetSybilFlags(db, settings),
+		},
+	}
+
+	for i, route := range routes {
+		handler := route.Handler
+		if route.Method != http.MethodGet {
+			handler = audited(db, route.OperationID, handler)
+		}
+		routes[i].Handler = authorize(authenticator, route.Role, handler)
+	}
+	return routes
+}
+
+// withTimeout documents the 504 of routes that call the database, which
+// answer it when the call times out
+func withTimeout(responses map[int]interface{}) {
+	if _, ok := responses[http.StatusInternalServerError]; ok {
+		responses[http.StatusGatewayTimeout] = ErrorResponse{}
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"monitoring-service/internal/access"
+	"monitoring-service/internal/events"
+)
+
+// streamKeepAlive is how often a comment is sent to keep idle connections open
+const streamKeepAlive = 15 * time.Second
+
+// Stream serves live client events as Server-Sent Events. Clients may filter
+// with ?address= and ?type= (comma separated) and resume with Last-Event-ID.
+// Events about clients the access policy rejects are not sent.
+func Stream(broker *events.Broker, policy *access.Policy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		var filter events.Filter
+		if addresses := r.URL.Query().Get("address"); addresses != "" {
+			filter.Addresses = strings.Split(addresses, ",")
+		}
+		if types := r.URL.Query().Get("type"); types != "" {
+			for _, t := range strings.Split(types, ",") {
+				filter.Types = append(filter.Types, events.Type(t))
+			}
+		}
+
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+		var resumeFrom uint64
+		if lastEventID != "" {
+			id, err := strconv.ParseUint(lastEventID, 10, 64)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ErrCodeInvalidEventID, "Invalid Last-Event-ID")
+				return
+			}
+			resumeFrom = id
+		}
+
+		rc := http.NewResponseController(w)
+
+		sub, replay := broker.Subscribe(filter, resumeFrom)
+		defer broker.Unsubscribe(sub)
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		for _, event := range replay {
+			if policy.Check(event.Address) != access.Allowed {
+				continue
+			}
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case event, ok := <-sub.C:
+				if !ok {
+					if sub.Lagged() {
+						// Tell the client to reconnect; it resumes from its Last-Event-ID
+						fmt.Fprint(w, "event: lagged\ndata: {}\n\n")
+						rc.Flush()
+					}
+					return
+				}
+				if policy.Check(event.Address) != access.Allowed {
+					continue
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			case <-keepAlive.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				if err := rc.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event events.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
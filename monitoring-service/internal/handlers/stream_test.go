@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"monitoring-service/internal/events"
+)
+
+// sseEvent is one event read from a stream
+type sseEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// stream is an open /v1/stream response
+type stream struct {
+	t      *testing.T
+	resp   *http.Response
+	events chan sseEvent
+}
+
+// openStream connects to the stream route over HTTP. It returns once the
+// response headers arrive, when the subscription is in place.
+func (s *testServer) openStream(query string, lastEventID string) *stream {
+	s.t.Helper()
+
+	server := httptest.NewServer(s.mux)
+	s.t.Cleanup(server.Close)
+
+	req, err := http.NewRequest(http.MethodGet, server.URL+VersionedPath("/stream")+query, nil)
+	if err != nil {
+		s.t.Fatalf("create stream request: %v", err)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		s.t.Fatalf("GET stream: %v", err)
+	}
+	s.t.Cleanup(func() { resp.Body.Close() })
+
+	st := &stream{t: s.t, resp: resp, events: make(chan sseEvent, 16)}
+	if resp.StatusCode == http.StatusOK {
+		go st.read()
+	}
+	return st
+}
+
+// read parses events until the stream ends, skipping comments
+func (st *stream) read() {
+	defer close(st.events)
+
+	var event sseEvent
+	scanner := bufio.NewScanner(st.resp.Body)
+	for scanner.Scan() {
+		field, value, _ := strings.Cut(scanner.Text(), ": ")
+		switch field {
+		case "id":
+			event.id = value
+		case "event":
+			event.event = value
+		case "data":
+			event.data = value
+		case "":
+			if event.event != "" {
+				st.events <- event
+			}
+			event = sseEvent{}
+		}
+	}
+}
+
+// next returns the next event, failing the test if none arrives
+func (st *stream) next() sseEvent {
+	st.t.Helper()
+	select {
+	case event, ok := <-st.events:
+		if !ok {
+			st.t.Fatal("stream ended")
+		}
+		return event
+	case <-time.After(time.Second):
+		st.t.Fatal("no event received")
+		return sseEvent{}
+	}
+}
+
+// decode returns the event carried by e
+func (e sseEvent) decode(t *testing.T) events.Event {
+	t.Helper()
+	var event events.Event
+	if err := json.Unmarshal([]byte(e.data), &event); err != nil {
+		t.Fatalf("decode event %q: %v", e.data, err)
+	}
+	return event
+}
+
+func TestStream(t *testing.T) {
+	other := common.HexToAddress("0x00000000000000000000000000000000000a0002")
+	operatorKey := strings.ToLower(testOperator.Hex())
+
+	t.Run("FiltersByAddress", func(t *testing.T) {
+		s := newTestServer(t)
+		st := s.openStream("?address="+testOperator.Hex(), "")
+		if got := st.resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Errorf("Content-Type = %q, want text/event-stream", got)
+		}
+
+		s.broker.Publish(events.HeartbeatAccepted, other.Hex(), nil)
+		s.delegate(testHolder, testOperator, 1, 2)
+		rec := s.do(http.MethodPost, VersionedPath("/check-nft"), CheckNFTRequest{Address: testOperator.Hex(), CommissionRate: "5"})
+		if rec.Code != http.StatusOK {
+			t.Fatalf("heartbeat = %d: %s", rec.Code, rec.Body)
+		}
+
+		got := st.next()
+		event := got.decode(t)
+		if got.event != string(events.HeartbeatAccepted) || event.Address != operatorKey {
+			t.Fatalf("first event = %s for %s, want %s for %s", got.event, event.Address, events.HeartbeatAccepted, operatorKey)
+		}
+		if got.id != strconv.FormatUint(event.ID, 10) {
+			t.Errorf("id field = %s, want the event ID %d", got.id, event.ID)
+		}
+		if got := st.next(); got.event != string(events.DelegationUpdated) || got.decode(t).Address != operatorKey {
+			t.Errorf("second event = %s for %s, want %s for %s", got.event, got.decode(t).Address, events.DelegationUpdated, operatorKey)
+		}
+	})
+
+	t.Run("FiltersByType", func(t *testing.T) {
+		s := newTestServer(t)
+		st := s.openStream("?type="+string(events.StatusChanged), "")
+
+		s.broker.Publish(events.HeartbeatAccepted, testOperator.Hex(), nil)
+		published := s.broker.Publish(events.StatusChanged, testOperator.Hex(), nil)
+
+		if got := st.next(); got.id != strconv.FormatUint(published.ID, 10) {
+			t.Errorf("event = %s %s, want %s %d", got.event, got.id, events.StatusChanged, published.ID)
+		}
+	})
+
+	t.Run("Resumes", func(t *testing.T) {
+		s := newTestServer(t)
+		first := s.broker.Publish(events.HeartbeatAccepted, testOperator.Hex(), nil)
+		s.broker.Publish(events.HeartbeatAccepted, other.Hex(), nil)
+		missed := s.broker.Publish(events.StatusChanged, testOperator.Hex(), nil)
+
+		st := s.openStream("?address="+testOperator.Hex(), strconv.FormatUint(first.ID, 10))
+		if got := st.next(); got.id != strconv.FormatUint(missed.ID, 10) {
+			t.Errorf("replayed event %s, want %d", got.id, missed.ID)
+		}
+		live := s.broker.Publish(events.HeartbeatAccepted, testOperator.Hex(), nil)
+		if got := st.next(); got.id != strconv.FormatUint(live.ID, 10) {
+			t.Errorf("live event %s, want %d", got.id, live.ID)
+		}
+	})
+
+	t.Run("HidesRejectedClients", func(t *testing.T) {
+		s := newTestServer(t)
+		s.policy.Set([]string{other.Hex()}, nil)
+		hidden := s.broker.Publish(events.HeartbeatAccepted, other.Hex(), nil)
+
+		st := s.openStream("", strconv.FormatUint(hidden.ID-1, 10))
+		s.broker.Publish(events.HeartbeatAccepted, other.Hex(), nil)
+		shown := s.broker.Publish(events.HeartbeatAccepted, testOperator.Hex(), nil)
+
+		if got := st.next(); got.id != strconv.FormatUint(shown.ID, 10) {
+			t.Errorf("event %s, want only %d", got.id, shown.ID)
+		}
+	})
+
+	t.Run("Lagged", func(t *testing.T) {
+		s := newTestServer(t)
+		st := s.openStream("", "")
+
+		// Nothing reads past the first few events, so the handler blocks
+		// writing once the connection's buffers are full and its
+		// subscription overflows
+		payload := strings.Repeat("x", 16<<10)
+		for i := 0; i < 2048; i++ {
+			s.broker.Publish(events.HeartbeatAccepted, testOperator.Hex(), payload)
+		}
+
+		for {
+			got := st.next()
+			if got.event == "lagged" {
+				break
+			}
+		}
+		if _, ok := <-st.events; ok {
+			t.Error("stream still open after lagged")
+		}
+	})
+
+	t.Run("InvalidLastEventID", func(t *testing.T) {
+		s := newTestServer(t)
+		rec := s.do(http.MethodGet, VersionedPath("/stream")+"?last_event_id=abc", nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+		}
+		if code := errorCode(t, rec); code != ErrCodeInvalidEventID {
+			t.Errorf("code = %s, want %s", code, ErrCodeInvalidEventID)
+		}
+	})
+}
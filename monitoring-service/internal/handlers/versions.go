@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/versions"
+	"monitoring-service/pkg/config"
+)
+
+type GetVersionDistributionResponse struct {
+	Status  string                `json:"status"`
+	Message string                `json:"message"`
+	Data    versions.Distribution `json:"data"`
+}
+
+// GetVersionDistribution reports which light client versions, networks and
+// platforms registered clients run, and how many fall below the minimum
+// version
+func GetVersionDistribution(db database.ClientStore, settings *config.Live) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w)
+			return
+		}
+
+		clientVersions, err := db.GetClientVersions(r.Context())
+		if err != nil {
+			databaseError(w, err, "Failed to fetch client versions")
+			return
+		}
+
+		lastHeartbeats, err := db.GetLastHeartbeats(r.Context())
+		if err != nil {
+			databaseError(w, err, "Failed to fetch clients")
+			return
+		}
+
+		sendJSON(w, GetVersionDistributionResponse{
+			Status:  "success",
+			Message: "Version distribution retrieved successfully",
+			Data:    settings.Get().VersionPolicy.Summarize(clientVersions, lastHeartbeats, time.Now()),
+		})
+	}
+}
@@ -0,0 +1,155 @@
+// Package liveness checks the sync state a light client reports with its
+// heartbeat against the Avail chain, so a heartbeat shows that a light client
+// is actually following the chain and not only that someone can POST JSON.
+package liveness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"monitoring-service/internal/avail"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/tracing"
+)
+
+var (
+	// ErrInvalidReport is returned for a report with a malformed field
+	ErrInvalidReport = errors.New("invalid liveness report")
+	// ErrImplausible is returned for a report the chain contradicts
+	ErrImplausible = errors.New("implausible liveness report")
+)
+
+// DefaultMaxLag is how many blocks a light client may trail the finalized
+// head before it is Degraded, about seven minutes of Avail blocks
+const DefaultMaxLag = 20
+
+// AheadTolerance is how many blocks a light client may be ahead of our RPC,
+// which can itself trail the network slightly
+const AheadTolerance = 2
+
+var (
+	blockHashPattern = regexp.MustCompile(`^0x[0-9a-fA-F]{64}$`)
+	// Base58 encoded libp2p peer IDs
+	peerIDPattern = regexp.MustCompile(`^[1-9A-HJ-NP-Za-km-z]{46,128}$`)
+)
+
+// Report is the sync state a heartbeat carries
+type Report struct {
+	BlockNumber uint64
+	BlockHash   string
+	PeerID      string
+}
+
+// Validate checks the report's format
+func (r Report) Validate() error {
+	if r.BlockNumber == 0 {
+		return fmt.Errorf("%w: finalized block number is required", ErrInvalidReport)
+	}
+	if r.BlockHash != "" && !blockHashPattern.MatchString(r.BlockHash) {
+		return fmt.Errorf("%w: block hash must be 0x followed by 64 hex characters", ErrInvalidReport)
+	}
+	if r.PeerID != "" && !peerIDPattern.MatchString(r.PeerID) {
+		return fmt.Errorf("%w: peer ID must be a base58 libp2p peer ID", ErrInvalidReport)
+	}
+	return nil
+}
+
+// Checker checks reports against the chain. The allowed lag can be changed
+// while the service runs.
+type Checker struct {
+	chain  avail.Chain
+	maxLag atomic.Uint64
+	// timeout is the time.Duration set with SetTimeout
+	timeout atomic.Int64
+	logger  *slog.Logger
+}
+
+// NewChecker creates a checker. With a nil chain reports are only
+// validated and stored unverified.
+func NewChecker(chain avail.Chain, maxLag uint64, logger *slog.Logger) *Checker {
+	c := &Checker{chain: chain, logger: logger}
+	c.maxLag.Store(maxLag)
+	return c
+}
+
+// SetMaxLag sets how many blocks a client may trail the finalized head
+// before it is Degraded
+func (c *Checker) SetMaxLag(maxLag uint64) {
+	c.maxLag.Store(maxLag)
+}
+
+// SetTimeout bounds the chain reads of each check. A report the chain cannot
+// confirm in time is stored unverified.
+func (c *Checker) SetTimeout(timeout time.Duration) {
+	c.timeout.Store(int64(timeout))
+}
+
+// Check returns the liveness to store for the report. A report that is ahead
+// of the chain, or names a block hash the chain does not have at that
+// height, is implausible. When the chain cannot be reached the report is
+// stored unverified rather than failing the heartbeat.
+func (c *Checker) Check(ctx context.Context, report Report, now time.Time) (*database.Liveness, error) {
+	ctx, span := tracing.Start(ctx, "liveness.Check", tracing.BlockNumberKey.Int64(int64(report.BlockNumber)))
+	liveness, err := c.check(ctx, report, now)
+	if liveness != nil {
+		span.SetAttributes(attribute.Bool("liveness.verified", liveness.Verified), attribute.Int64("chain.head", int64(liveness.ChainHead)))
+	}
+	tracing.End(span, err)
+	return liveness, err
+}
+
+func (c *Checker) check(ctx context.Context, report Report, now time.Time) (*database.Liveness, error) {
+	if err := report.Validate(); err != nil {
+		return nil, err
+	}
+
+	liveness := &database.Liveness{
+		BlockNumber: report.BlockNumber,
+		BlockHash:   strings.ToLower(report.BlockHash),
+		PeerID:      report.PeerID,
+		CheckedAt:   now,
+	}
+	if c == nil || c.chain == nil {
+		return liveness, nil
+	}
+	if timeout := time.Duration(c.timeout.Load()); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	head, err := c.chain.FinalizedHead(ctx)
+	if err != nil {
+		c.logger.WarnContext(ctx, "Avail RPC unavailable, storing liveness unverified", "error", err)
+		return liveness, nil
+	}
+	if report.BlockNumber > head.Number+AheadTolerance {
+		return nil, fmt.Errorf("%w: block %d is ahead of the finalized head %d", ErrImplausible, report.BlockNumber, head.Number)
+	}
+
+	if report.BlockHash != "" && report.BlockNumber <= head.Number {
+		hash, err := c.chain.BlockHash(ctx, report.BlockNumber)
+		if err != nil {
+			c.logger.WarnContext(ctx, "Avail RPC unavailable, storing liveness unverified", "error", err)
+			return liveness, nil
+		}
+		if !strings.EqualFold(hash, report.BlockHash) {
+			return nil, fmt.Errorf("%w: block %d hash does not match the chain", ErrImplausible, report.BlockNumber)
+		}
+	}
+
+	liveness.Verified = true
+	liveness.ChainHead = head.Number
+	if report.BlockNumber < head.Number {
+		liveness.Lag = head.Number - report.BlockNumber
+	}
+	liveness.Degraded = liveness.Lag > c.maxLag.Load()
+	return liveness, nil
+}
@@ -0,0 +1,184 @@
+package liveness_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"monitoring-service/internal/avail"
+	"monitoring-service/internal/avail/fake"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/liveness"
+	"monitoring-service/internal/logging"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+const (
+	head   = 1000
+	peerID = "12D3KooWEyoppNCUx8Yx66oV9fJnriXwCcXwDDUA2kj6vnc6iDEp"
+)
+
+func TestCheck(t *testing.T) {
+	checker := liveness.NewChecker(fake.New(head), liveness.DefaultMaxLag, logging.Discard())
+
+	tests := []struct {
+		name   string
+		report liveness.Report
+		// want is the liveness stored, without CheckedAt
+		want    *database.Liveness
+		wantErr error
+	}{
+		{
+			name:   "AtHead",
+			report: liveness.Report{BlockNumber: head, PeerID: peerID},
+			want:   &database.Liveness{BlockNumber: head, PeerID: peerID, Verified: true, ChainHead: head},
+		},
+		{
+			name:   "LagAtThreshold",
+			report: liveness.Report{BlockNumber: head - liveness.DefaultMaxLag},
+			want:   &database.Liveness{BlockNumber: head - liveness.DefaultMaxLag, Verified: true, ChainHead: head, Lag: liveness.DefaultMaxLag},
+		},
+		{
+			name:   "LagPastThreshold",
+			report: liveness.Report{BlockNumber: head - liveness.DefaultMaxLag - 1},
+			want:   &database.Liveness{BlockNumber: head - liveness.DefaultMaxLag - 1, Verified: true, ChainHead: head, Lag: liveness.DefaultMaxLag + 1, Degraded: true},
+		},
+		{
+			// Our RPC may trail the network by a block or two
+			name:   "AheadWithinTolerance",
+			report: liveness.Report{BlockNumber: head + liveness.AheadTolerance, BlockHash: fake.Hash(1)},
+			want:   &database.Liveness{BlockNumber: head + liveness.AheadTolerance, BlockHash: fake.Hash(1), Verified: true, ChainHead: head},
+		},
+		{
+			name:    "AheadPastTolerance",
+			report:  liveness.Report{BlockNumber: head + liveness.AheadTolerance + 1},
+			wantErr: liveness.ErrImplausible,
+		},
+		{
+			name:   "HashMatches",
+			report: liveness.Report{BlockNumber: head - 5, BlockHash: "0x" + strings.ToUpper(fake.Hash(head - 5)[2:])},
+			want:   &database.Liveness{BlockNumber: head - 5, BlockHash: fake.Hash(head - 5), Verified: true, ChainHead: head, Lag: 5},
+		},
+		{
+			name:    "HashMismatch",
+			report:  liveness.Report{BlockNumber: head - 5, BlockHash: fake.Hash(head - 6)},
+			wantErr: liveness.ErrImplausible,
+		},
+		{
+			name:    "NoBlockNumber",
+			report:  liveness.Report{PeerID: peerID},
+			wantErr: liveness.ErrInvalidReport,
+		},
+		{
+			name:    "ShortHash",
+			report:  liveness.Report{BlockNumber: head, BlockHash: "0x1234"},
+			wantErr: liveness.ErrInvalidReport,
+		},
+		{
+			name:    "InvalidPeerID",
+			report:  liveness.Report{BlockNumber: head, PeerID: "0OIl" + peerID[4:]},
+			wantErr: liveness.ErrInvalidReport,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := checker.Check(context.Background(), tt.report, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) || got != nil {
+					t.Fatalf("Check = %+v, %v; want %v", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			want := *tt.want
+			want.CheckedAt = now
+			if *got != want {
+				t.Errorf("Check = %+v, want %+v", *got, want)
+			}
+		})
+	}
+}
+
+func TestSetMaxLag(t *testing.T) {
+	checker := liveness.NewChecker(fake.New(head), 5, logging.Discard())
+	report := liveness.Report{BlockNumber: head - 6}
+
+	if got, err := checker.Check(context.Background(), report, now); err != nil || !got.Degraded {
+		t.Fatalf("Check 6 blocks behind with max lag 5 = %+v, %v; want degraded", got, err)
+	}
+	checker.SetMaxLag(6)
+	if got, err := checker.Check(context.Background(), report, now); err != nil || got.Degraded {
+		t.Errorf("Check 6 blocks behind with max lag 6 = %+v, %v; want not degraded", got, err)
+	}
+}
+
+// unreachable is a chain whose RPC fails, or hangs until the context is
+// done
+type unreachable struct {
+	hang bool
+}
+
+func (c unreachable) FinalizedHead(ctx context.Context) (avail.Head, error) {
+	if c.hang {
+		<-ctx.Done()
+		return avail.Head{}, ctx.Err()
+	}
+	return avail.Head{}, errors.New("connection refused")
+}
+
+func (c unreachable) BlockHash(ctx context.Context, number uint64) (string, error) {
+	return "", errors.New("connection refused")
+}
+
+// Reports the chain cannot confirm are stored unverified, not rejected
+func TestUnverified(t *testing.T) {
+	hanging := liveness.NewChecker(unreachable{hang: true}, liveness.DefaultMaxLag, logging.Discard())
+	hanging.SetTimeout(10 * time.Millisecond)
+
+	tests := []struct {
+		name    string
+		checker *liveness.Checker
+	}{
+		{name: "NoChain", checker: liveness.NewChecker(nil, liveness.DefaultMaxLag, logging.Discard())},
+		{name: "NilChecker"},
+		{name: "RPCDown", checker: liveness.NewChecker(unreachable{}, liveness.DefaultMaxLag, logging.Discard())},
+		{name: "Timeout", checker: hanging},
+	}
+
+	// Far enough behind to be degraded, were it verified
+	report := liveness.Report{BlockNumber: 1, BlockHash: fake.Hash(1)}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.checker.Check(context.Background(), report, now)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			want := database.Liveness{BlockNumber: 1, BlockHash: fake.Hash(1), CheckedAt: now}
+			if *got != want {
+				t.Errorf("Check = %+v, want %+v", *got, want)
+			}
+		})
+	}
+
+	// The hash lookup failing leaves the report unverified too
+	headOnly := liveness.NewChecker(headOnlyChain{}, liveness.DefaultMaxLag, logging.Discard())
+	got, err := headOnly.Check(context.Background(), liveness.Report{BlockNumber: head, BlockHash: fake.Hash(head)}, now)
+	if err != nil || got.Verified {
+		t.Errorf("Check with the hash lookup failing = %+v, %v; want unverified", got, err)
+	}
+}
+
+// headOnlyChain answers the finalized head but fails block hash lookups
+type headOnlyChain struct {
+	unreachable
+}
+
+func (headOnlyChain) FinalizedHead(ctx context.Context) (avail.Head, error) {
+	return avail.Head{Number: head, Hash: fake.Hash(head)}, nil
+}
@@ -0,0 +1,272 @@
+package openapi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type child struct {
+	Name string `json:"name"`
+}
+
+type parent struct {
+	ID       int64             `json:"id"`
+	Label    string            `json:"label,omitempty"`
+	Child    child             `json:"child"`
+	Optional *child            `json:"optional"`
+	Children []child           `json:"children"`
+	Tags     map[string]string `json:"tags"`
+	Created  time.Time         `json:"created"`
+	Raw      []byte            `json:"raw,omitempty"`
+	Skipped  string            `json:"-"`
+	Untagged bool
+	hidden   string
+}
+
+// node refers to itself
+type node struct {
+	Next *node `json:"next"`
+}
+
+func TestSchemaFor(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  *Schema
+	}{
+		{name: "Bool", value: true, want: &Schema{Type: "boolean"}},
+		{name: "Int", value: 1, want: &Schema{Type: "integer", Format: "int32"}},
+		{name: "Int64", value: int64(1), want: &Schema{Type: "integer", Format: "int64"}},
+		{name: "Float64", value: 1.5, want: &Schema{Type: "number", Format: "double"}},
+		{name: "String", value: "", want: &Schema{Type: "string"}},
+		{name: "Time", value: time.Time{}, want: &Schema{Type: "string", Format: "date-time"}},
+		{name: "Bytes", value: []byte{}, want: &Schema{Type: "string", Format: "byte"}},
+		{
+			name:  "Slice",
+			value: []string{},
+			want:  &Schema{Type: "array", Items: &Schema{Type: "string"}, Nullable: true},
+		},
+		{
+			name:  "Array",
+			value: [2]int{},
+			want:  &Schema{Type: "array", Items: &Schema{Type: "integer", Format: "int32"}},
+		},
+		{
+			name:  "Map",
+			value: map[string]float64{},
+			want:  &Schema{Type: "object", AdditionalProperties: &Schema{Type: "number", Format: "double"}},
+		},
+		{name: "Pointer", value: new(string), want: &Schema{Type: "string", Nullable: true}},
+		{name: "NamedStruct", value: child{}, want: &Schema{Ref: "#/components/schemas/child"}},
+		{name: "PointerToNamedStruct", value: &child{}, want: &Schema{Ref: "#/components/schemas/child", Nullable: true}},
+		{
+			name:  "AnonymousStruct",
+			value: struct{ A int }{},
+			want: &Schema{
+				Type:       "object",
+				Properties: map[string]*Schema{"A": {Type: "integer", Format: "int32"}},
+				Required:   []string{"A"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewDocument("test", "1")
+			if got := d.SchemaFor(tt.value); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SchemaFor = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaForStruct(t *testing.T) {
+	d := NewDocument("test", "1")
+	if got := d.SchemaFor(parent{}); got.Ref != "#/components/schemas/parent" {
+		t.Fatalf("SchemaFor = %+v, want a reference to parent", got)
+	}
+
+	s := d.Components.Schemas["parent"]
+	if s == nil {
+		t.Fatal("parent not registered under components")
+	}
+	wantProperties := []string{"id", "label", "child", "optional", "children", "tags", "created", "raw", "Untagged"}
+	if len(s.Properties) != len(wantProperties) {
+		t.Errorf("properties = %v, want %v", keys(s.Properties), wantProperties)
+	}
+	for _, name := range wantProperties {
+		if s.Properties[name] == nil {
+			t.Errorf("property %q missing", name)
+		}
+	}
+	// Fields tagged omitempty are optional
+	wantRequired := []string{"id", "child", "optional", "children", "tags", "created", "Untagged"}
+	if !reflect.DeepEqual(s.Required, wantRequired) {
+		t.Errorf("required = %v, want %v", s.Required, wantRequired)
+	}
+	if child := d.Components.Schemas["child"]; child == nil || child.Properties["name"] == nil {
+		t.Errorf("child schema = %+v, want it registered with its name property", child)
+	}
+
+	// Recursive types terminate
+	d.SchemaFor(node{})
+	if next := d.Components.Schemas["node"].Properties["next"]; next.Ref != "#/components/schemas/node" || !next.Nullable {
+		t.Errorf("node.next = %+v, want a nullable reference to node", next)
+	}
+}
+
+func keys(m map[string]*Schema) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestValidate(t *testing.T) {
+	d := NewDocument("test", "1")
+	parentSchema := d.SchemaFor(parent{})
+	d.Components.Schemas["status"] = &Schema{Type: "string", Enum: []string{"active", "inactive"}}
+
+	const valid = `{"id":1,"child":{"name":"a"},"optional":null,"children":null,"tags":{"a":"b"},"created":"2024-01-02T03:04:05.123Z","Untagged":true}`
+
+	tests := []struct {
+		name    string
+		schema  *Schema
+		data    string
+		wantErr string
+	}{
+		{name: "Valid", schema: parentSchema, data: valid},
+		{
+			name:   "OptionalPresent",
+			schema: parentSchema,
+			data:   `{"id":1,"label":"x","raw":"AQI=","child":{"name":"a"},"optional":{"name":"b"},"children":[{"name":"c"}],"tags":{},"created":"2024-01-02T03:04:05Z","Untagged":false}`,
+		},
+		{name: "InvalidJSON", schema: parentSchema, data: `{"id":`, wantErr: "invalid JSON"},
+		{name: "NotAnObject", schema: parentSchema, data: `[]`, wantErr: "$: expected object"},
+		{
+			name:    "MissingRequired",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `"id":1,`, "", 1),
+			wantErr: `$: missing required property "id"`,
+		},
+		{
+			name:    "UnknownProperty",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `"id":1`, `"id":1,"extra":2`, 1),
+			wantErr: `$: property "extra" is not in the spec`,
+		},
+		{
+			name:    "NullNotAllowed",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `"child":{"name":"a"}`, `"child":null`, 1),
+			wantErr: "$.child: null is not allowed",
+		},
+		{
+			name:    "NestedType",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `"name":"a"`, `"name":1`, 1),
+			wantErr: "$.child.name: expected string",
+		},
+		{
+			name:    "ArrayItem",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `"children":null`, `"children":[{"name":"a"},{}]`, 1),
+			wantErr: `$.children[1]: missing required property "name"`,
+		},
+		{
+			name:    "AdditionalProperties",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `{"a":"b"}`, `{"a":1}`, 1),
+			wantErr: "$.tags.a: expected string",
+		},
+		{
+			name:    "Integer",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `"id":1`, `"id":1.5`, 1),
+			wantErr: "$.id: expected integer, got 1.5",
+		},
+		{
+			name:    "DateTime",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `2024-01-02T03:04:05.123Z`, `2024-01-02`, 1),
+			wantErr: `$.created: invalid date-time "2024-01-02"`,
+		},
+		{
+			name:    "Boolean",
+			schema:  parentSchema,
+			data:    strings.Replace(valid, `"Untagged":true`, `"Untagged":"yes"`, 1),
+			wantErr: "$.Untagged: expected boolean",
+		},
+		{name: "Number", schema: &Schema{Type: "number"}, data: `"1"`, wantErr: "$: expected number"},
+		{name: "Enum", schema: &Schema{Ref: "#/components/schemas/status"}, data: `"active"`},
+		{
+			name:    "NotInEnum",
+			schema:  &Schema{Ref: "#/components/schemas/status"},
+			data:    `"deleted"`,
+			wantErr: `$: "deleted" is not one of [active inactive]`,
+		},
+		{name: "NullableRef", schema: &Schema{Ref: "#/components/schemas/status", Nullable: true}, data: `null`},
+		{name: "AnyValue", schema: &Schema{}, data: `{"anything":[1,"two"]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.Validate(tt.schema, []byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateResponse(t *testing.T) {
+	d := NewDocument("test", "1")
+	d.AddOperation("GET", "/v1/children/{name}", &Operation{
+		OperationID: "getChild",
+		Responses: map[string]*Response{
+			"200": {Description: "OK", Content: map[string]*MediaType{"application/json": {Schema: d.SchemaFor(child{})}}},
+			"204": {Description: "No content"},
+		},
+	})
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		status  int
+		body    string
+		wantErr string
+	}{
+		{name: "Valid", method: "get", path: "/v1/children/{name}", status: 200, body: `{"name":"a"}`},
+		{name: "Invalid", method: "GET", path: "/v1/children/{name}", status: 200, body: `{}`, wantErr: `missing required property "name"`},
+		{name: "NoContent", method: "GET", path: "/v1/children/{name}", status: 204, body: "\n"},
+		{name: "UndocumentedBody", method: "GET", path: "/v1/children/{name}", status: 204, body: `{}`, wantErr: "no JSON content documented"},
+		{name: "UndocumentedStatus", method: "GET", path: "/v1/children/{name}", status: 404, body: `{}`, wantErr: "status 404 is not documented"},
+		{name: "UnknownMethod", method: "POST", path: "/v1/children/{name}", status: 200, wantErr: "no operation POST"},
+		{name: "UnknownPath", method: "GET", path: "/v1/parents", status: 200, wantErr: "no operation GET /v1/parents"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.ValidateResponse(tt.method, tt.path, tt.status, []byte(tt.body))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateResponse = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateResponse = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
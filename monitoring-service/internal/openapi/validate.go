@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ValidateResponse checks a response body against the schema the document
+// declares for the given operation and status code. It is used by contract
+// tests to catch handlers drifting from the published spec.
+func (d *Document) ValidateResponse(method, path string, status int, body []byte) error {
+	op := d.Operation(method, path)
+	if op == nil {
+		return fmt.Errorf("no operation %s %s in spec", method, path)
+	}
+
+	resp, ok := op.Responses[fmt.Sprint(status)]
+	if !ok {
+		return fmt.Errorf("status %d is not documented for %s %s", status, method, path)
+	}
+
+	media, ok := resp.Content["application/json"]
+	if !ok {
+		if len(bytes.TrimSpace(body)) == 0 {
+			return nil
+		}
+		return fmt.Errorf("%s %s %d: body present but no JSON content documented", method, path, status)
+	}
+
+	return d.Validate(media.Schema, body)
+}
+
+// Validate checks that data is a JSON document matching schema s
+func (d *Document) Validate(s *Schema, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	return d.validateValue(s, value, "$")
+}
+
+func (d *Document) validateValue(s *Schema, value interface{}, path string) error {
+	nullable := s != nil && s.Nullable
+	s = d.Resolve(s)
+	if s == nil || (s.Type == "" && s.Ref == "") {
+		return nil
+	}
+
+	if value == nil {
+		if nullable || s.Nullable {
+			return nil
+		}
+		return fmt.Errorf("%s: null is not allowed", path)
+	}
+
+	switch s.Type {
+	case "object":
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", path, value)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			prop, ok := s.Properties[k]
+			if !ok {
+				if s.AdditionalProperties != nil {
+					prop = s.AdditionalProperties
+				} else {
+					return fmt.Errorf("%s: property %q is not in the spec", path, k)
+				}
+			}
+			if err := d.validateValue(prop, obj[k], path+"."+k); err != nil {
+				return err
+			}
+		}
+	case "array":
+		arr, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", path, value)
+		}
+		for i, item := range arr {
+			if err := d.validateValue(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		str, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected string, got %T", path, value)
+		}
+		if s.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+				return fmt.Errorf("%s: invalid date-time %q", path, str)
+			}
+		}
+		if len(s.Enum) > 0 && !contains(s.Enum, str) {
+			return fmt.Errorf("%s: %q is not one of %v", path, str, s.Enum)
+		}
+	case "integer":
+		num, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s: expected integer, got %T", path, value)
+		}
+		if _, err := num.Int64(); err != nil {
+			return fmt.Errorf("%s: expected integer, got %s", path, num)
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return fmt.Errorf("%s: expected number, got %T", path, value)
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", path, value)
+		}
+	}
+
+	return nil
+}
+
+func contains(values []string, v string) bool {
+	for _, candidate := range values {
+		if candidate == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,204 @@
+// Package probe actively checks registered light clients through their
+// public HTTP API. Each probe is recorded as a second heartbeat source, with
+// its latency, next to the heartbeats clients push to /check-nft.
+package probe
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+const (
+	// DefaultTimeout bounds one probe, both API calls included
+	DefaultTimeout = 10 * time.Second
+	// concurrency is how many clients are probed at once
+	concurrency = 8
+)
+
+// ErrPrivateAddress is returned when a probe URL resolves to an address
+// that is not publicly routable
+var ErrPrivateAddress = errors.New("probe address is not public")
+
+// ValidateURL checks that a probe URL is an absolute http or https URL
+// without credentials
+func ValidateURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("probe URL must use http or https")
+	}
+	if u.Host == "" {
+		return errors.New("probe URL must include a host")
+	}
+	if u.User != nil {
+		return errors.New("probe URL must not include credentials")
+	}
+	return nil
+}
+
+// NewHTTPClient returns the client probes are made with. Unless
+// allowPrivate is set it refuses to connect to loopback, private and
+// link-local addresses, so registered URLs cannot reach internal services.
+func NewHTTPClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, conn syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+				ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+				return ErrPrivateAddress
+			}
+			return nil
+		}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// A redirect could lead anywhere, so it counts as a failed probe
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// versionResponse is the light client's GET /v2/version body
+type versionResponse struct {
+	Version string `json:"version"`
+}
+
+// statusResponse is the part of the light client's GET /v2/status body the
+// prober reads
+type statusResponse struct {
+	Blocks struct {
+		Latest uint64 `json:"latest"`
+	} `json:"blocks"`
+}
+
+// Probe calls the light client's version and status endpoints
+func Probe(ctx context.Context, client *http.Client, address, baseURL string, now time.Time) database.ProbeRecord {
+	record := database.ProbeRecord{ClientAddress: address, Timestamp: now}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+
+	start := time.Now()
+	var version versionResponse
+	statusCode, err := getJSON(ctx, client, baseURL+"/v2/version", &version)
+	var status statusResponse
+	if err == nil {
+		statusCode, err = getJSON(ctx, client, baseURL+"/v2/status", &status)
+	}
+	record.LatencyMs = time.Since(start).Milliseconds()
+	record.StatusCode = statusCode
+
+	if err != nil {
+		record.Error = err.Error()
+		return record
+	}
+	record.Success = true
+	record.Version = version.Version
+	record.LatestBlock = status.Blocks.Latest
+	return record
+}
+
+func getJSON(ctx context.Context, client *http.Client, url string, v interface{}) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, fmt.Errorf("%s returned %d", req.URL.Path, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return resp.StatusCode, fmt.Errorf("%s returned invalid JSON: %v", req.URL.Path, err)
+	}
+	return resp.StatusCode, nil
+}
+
+// Prober periodically probes every client that registered a probe URL
+type Prober struct {
+	db       database.ProbeStore
+	client   *http.Client
+	interval time.Duration
+	logger   *slog.Logger
+}
+
+// NewProber creates a new prober
+func NewProber(db database.ProbeStore, client *http.Client, interval time.Duration, logger *slog.Logger) *Prober {
+	return &Prober{
+		db:       db,
+		client:   client,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run probes until ctx is cancelled
+func (p *Prober) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.ProbeAll(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.ProbeAll(ctx)
+		}
+	}
+}
+
+// ProbeAll probes every target once and records the results
+func (p *Prober) ProbeAll(ctx context.Context) {
+	targets, err := p.db.GetProbeTargets(ctx)
+	if err != nil {
+		p.logger.ErrorContext(ctx, "Prober failed to load targets", "error", err)
+		return
+	}
+
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for address, baseURL := range targets {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(address, baseURL string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			record := Probe(ctx, p.client, address, baseURL, time.Now())
+			if err := p.db.AddProbe(ctx, record); err != nil {
+				p.logger.ErrorContext(ctx, "Prober failed to record probe", "client", address, "error", err)
+			}
+		}(address, baseURL)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,112 @@
+package ranking
+
+import (
+	"math"
+	"sort"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/pkg/config"
+)
+
+// MaxCommissionRate is the highest commission an operator may charge
+const MaxCommissionRate = 10
+
+// Component is one term of the score: the raw input, its normalised 0-1
+// score, the weight applied and the points it contributed to the total.
+type Component struct {
+	Value        float64 `json:"value"`
+	Score        float64 `json:"score"`
+	Weight       float64 `json:"weight"`
+	Contribution float64 `json:"contribution"`
+}
+
+type Breakdown struct {
+	WeeklyUptime        Component `json:"weekly_uptime"`
+	AllTimeUptime       Component `json:"all_time_uptime"`
+	Commission          Component `json:"commission"`
+	CommissionStability Component `json:"commission_stability"`
+	Incidents           Component `json:"incidents"`
+}
+
+type OperatorScore struct {
+	Rank           int       `json:"rank"`
+	Address        string    `json:"address"`
+	OperatorName   string    `json:"operator_name"`
+	Status         string    `json:"status"`
+	NFTAmount      int64     `json:"nft_amount"`
+	CommissionRate float64   `json:"commission_rate"`
+	Score          float64   `json:"score"`
+	Breakdown      Breakdown `json:"breakdown"`
+}
+
+// Rank scores every client and returns them best first. The score is the
+// weighted mean of the component scores, scaled to 0-100.
+func Rank(clients []database.ClientInfo, activity map[string]database.OperatorActivity, weights config.RankingWeights) []OperatorScore {
+	totalWeight := weights.WeeklyUptime + weights.AllTimeUptime + weights.Commission +
+		weights.CommissionStability + weights.Incidents
+
+	scores := make([]OperatorScore, 0, len(clients))
+	for _, client := range clients {
+		history := activity[client.Address]
+
+		breakdown := Breakdown{
+			WeeklyUptime: component(client.WeeklyUptimePercentage, clamp(client.WeeklyUptimePercentage/100),
+				weights.WeeklyUptime, totalWeight),
+			AllTimeUptime: component(client.AllUptimePercentage, clamp(client.AllUptimePercentage/100),
+				weights.AllTimeUptime, totalWeight),
+			Commission: component(client.CommissionRate, clamp(1-client.CommissionRate/MaxCommissionRate),
+				weights.Commission, totalWeight),
+			CommissionStability: component(float64(history.CommissionChanges), 1/(1+float64(history.CommissionChanges)),
+				weights.CommissionStability, totalWeight),
+			Incidents: component(float64(history.Incidents), 1/(1+float64(history.Incidents)),
+				weights.Incidents, totalWeight),
+		}
+
+		score := breakdown.WeeklyUptime.Contribution + breakdown.AllTimeUptime.Contribution +
+			breakdown.Commission.Contribution + breakdown.CommissionStability.Contribution +
+			breakdown.Incidents.Contribution
+
+		scores = append(scores, OperatorScore{
+			Address:        client.Address,
+			OperatorName:   client.OperatorName,
+			Status:         client.Status,
+			NFTAmount:      client.NFTAmount,
+			CommissionRate: client.CommissionRate,
+			Score:          round(score),
+			Breakdown:      breakdown,
+		})
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool {
+		if scores[i].Score != scores[j].Score {
+			return scores[i].Score > scores[j].Score
+		}
+		return scores[i].Address < scores[j].Address
+	})
+	for i := range scores {
+		scores[i].Rank = i + 1
+	}
+
+	return scores
+}
+
+func component(value, score, weight, totalWeight float64) Component {
+	contribution := 0.0
+	if totalWeight > 0 {
+		contribution = score * weight / totalWeight * 100
+	}
+	return Component{
+		Value:        value,
+		Score:        round(score),
+		Weight:       weight,
+		Contribution: round(contribution),
+	}
+}
+
+func clamp(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+func round(v float64) float64 {
+	return math.Round(v*10000) / 10000
+}
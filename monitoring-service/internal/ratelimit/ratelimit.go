@@ -0,0 +1,173 @@
+// Package ratelimit throttles heartbeat ingestion with token buckets keyed
+// by client address and by remote IP. Buckets live in process, or in MongoDB
+// when several replicas must share them.
+package ratelimit
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+
+	"monitoring-service/pkg/config"
+)
+
+// Limit is a token bucket holding up to Burst tokens, refilled at Rate
+// tokens per second. A zero Rate disables the limit.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute is a limit of perMinute requests a minute with the given burst
+func PerMinute(perMinute float64, burst int) Limit {
+	return Limit{Rate: perMinute / 60, Burst: burst}
+}
+
+// Enabled reports whether the limit applies
+func (l Limit) Enabled() bool {
+	return l.Rate > 0 && l.Burst > 0
+}
+
+// Buckets takes tokens from named token buckets
+type Buckets interface {
+	// TakeToken removes one token from key's bucket, or reports how long
+	// until the next token when it is empty
+	TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, time.Duration, error)
+}
+
+// Limiter applies the address and IP limits. Limits can be replaced while
+// the service runs.
+type Limiter struct {
+	buckets Buckets
+	logger  *slog.Logger
+
+	mu      sync.RWMutex
+	address Limit
+	ip      Limit
+}
+
+// New creates a limiter over the given buckets
+func New(buckets Buckets, address, ip Limit, logger *slog.Logger) *Limiter {
+	return &Limiter{buckets: buckets, logger: logger, address: address, ip: ip}
+}
+
+// FromConfig creates a limiter with the configured limits, in process or
+// over the shared buckets when the config asks for them
+func FromConfig(cfg config.RateLimitConfig, shared Buckets, logger *slog.Logger) *Limiter {
+	var buckets Buckets = NewMemory()
+	if cfg.Shared && shared != nil {
+		buckets = shared
+	}
+	address, ip := Limits(cfg)
+	return New(buckets, address, ip, logger)
+}
+
+// Limits returns the address and IP limits in the config
+func Limits(cfg config.RateLimitConfig) (address, ip Limit) {
+	return PerMinute(cfg.AddressPerMinute, cfg.AddressBurst), PerMinute(cfg.IPPerMinute, cfg.IPBurst)
+}
+
+// SetLimits replaces both limits
+func (l *Limiter) SetLimits(address, ip Limit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.address = address
+	l.ip = ip
+}
+
+// AllowAddress takes a token for a client address. When it is refused the
+// duration says when to retry.
+func (l *Limiter) AllowAddress(ctx context.Context, address string, now time.Time) (bool, time.Duration) {
+	limit, _ := l.limits()
+	return l.take(ctx, "address:"+address, limit, now)
+}
+
+// AllowIP takes a token for a remote IP. When it is refused the duration
+// says when to retry.
+func (l *Limiter) AllowIP(ctx context.Context, ip string, now time.Time) (bool, time.Duration) {
+	_, limit := l.limits()
+	return l.take(ctx, "ip:"+ip, limit, now)
+}
+
+// limits returns the current limits. A nil limiter has none.
+func (l *Limiter) limits() (address, ip Limit) {
+	if l == nil {
+		return Limit{}, Limit{}
+	}
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.address, l.ip
+}
+
+func (l *Limiter) take(ctx context.Context, key string, limit Limit, now time.Time) (bool, time.Duration) {
+	if !limit.Enabled() {
+		return true, 0
+	}
+
+	allowed, retryAfter, err := l.buckets.TakeToken(ctx, key, limit.Rate, limit.Burst, now)
+	if err != nil {
+		// Fail open: an unreachable bucket store must not stop heartbeats
+		l.logger.WarnContext(ctx, "Rate limit check failed, allowing the request", "key", key, "error", err)
+		return true, 0
+	}
+	return allowed, retryAfter
+}
+
+// sweepInterval is how often idle in-process buckets are dropped
+const sweepInterval = time.Minute
+
+// Memory keeps token buckets in process
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	// full is when the bucket has refilled and can be dropped
+	full time.Time
+}
+
+// NewMemory creates empty in-process buckets
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket)}
+}
+
+func (m *Memory) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		for k, b := range m.buckets {
+			if !now.Before(b.full) {
+				delete(m.buckets, k)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(burst), updated: now}
+		m.buckets[key] = b
+	}
+	if elapsed := now.Sub(b.updated).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		b.updated = now
+	}
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	b.full = now.Add(time.Duration((float64(burst) - b.tokens) / rate * float64(time.Second)))
+
+	if allowed {
+		return true, 0, nil
+	}
+	return false, time.Duration(math.Ceil((1 - b.tokens) / rate * float64(time.Second))), nil
+}
@@ -0,0 +1,275 @@
+package ratelimit_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/logging"
+	"monitoring-service/internal/ratelimit"
+)
+
+// start is the injected clock's first reading. Whole milliseconds, as
+// MongoDB stores them.
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// take is one TakeToken call at start+at and its expected result
+type take struct {
+	at        time.Duration
+	key       string
+	wantOK    bool
+	wantRetry time.Duration
+}
+
+func TestMemoryBuckets(t *testing.T) {
+	testBuckets(t, func(t *testing.T) (ratelimit.Buckets, ratelimit.Buckets) {
+		buckets := ratelimit.NewMemory()
+		return buckets, buckets
+	})
+}
+
+// TestMongoBuckets runs the bucket cases against MongoDB at MONGO_TEST_URI,
+// with every other call made through a second connection as by another
+// replica
+func TestMongoBuckets(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+
+	ctx := context.Background()
+	admin, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to %s: %v", uri, err)
+	}
+	t.Cleanup(func() { admin.Disconnect(ctx) })
+
+	run := time.Now().UnixNano()
+	n := 0
+	testBuckets(t, func(t *testing.T) (ratelimit.Buckets, ratelimit.Buckets) {
+		n++
+		name := fmt.Sprintf("ratelimit_%d_%d", run, n)
+		t.Cleanup(func() {
+			if err := admin.Database(name).Drop(ctx); err != nil {
+				t.Errorf("drop %s: %v", name, err)
+			}
+		})
+
+		replicas := make([]ratelimit.Buckets, 2)
+		for i := range replicas {
+			db, err := database.NewDatabase(uri, name, logging.Discard())
+			if err != nil {
+				t.Fatalf("NewDatabase: %v", err)
+			}
+			t.Cleanup(func() { db.Close() })
+			if i == 0 {
+				if _, err := db.Migrations().Up(ctx, 0); err != nil {
+					t.Fatalf("migrate %s: %v", name, err)
+				}
+			}
+			replicas[i] = db
+		}
+		return replicas[0], replicas[1]
+	})
+}
+
+// testBuckets runs the token bucket cases. newBuckets returns two views of
+// the same buckets; calls alternate between them.
+func testBuckets(t *testing.T, newBuckets func(t *testing.T) (ratelimit.Buckets, ratelimit.Buckets)) {
+	// One token a second, up to 3
+	perSecond := ratelimit.PerMinute(60, 3)
+
+	tests := []struct {
+		name  string
+		limit ratelimit.Limit
+		takes []take
+	}{
+		{
+			name:  "Burst",
+			limit: perSecond,
+			takes: []take{
+				{wantOK: true},
+				{wantOK: true},
+				{wantOK: true},
+				{wantRetry: time.Second},
+				{at: 750 * time.Millisecond, wantRetry: 250 * time.Millisecond},
+			},
+		},
+		{
+			name:  "Refill",
+			limit: perSecond,
+			takes: []take{
+				{wantOK: true},
+				{wantOK: true},
+				{wantOK: true},
+				{at: 500 * time.Millisecond, wantRetry: 500 * time.Millisecond},
+				{at: time.Second, wantOK: true},
+				{at: time.Second, wantRetry: time.Second},
+				{at: 3 * time.Second, wantOK: true},
+				{at: 3 * time.Second, wantOK: true},
+				{at: 3 * time.Second, wantRetry: time.Second},
+			},
+		},
+		{
+			name:  "RefillStopsAtBurst",
+			limit: perSecond,
+			takes: []take{
+				{wantOK: true},
+				{at: time.Hour, wantOK: true},
+				{at: time.Hour, wantOK: true},
+				{at: time.Hour, wantOK: true},
+				{at: time.Hour, wantRetry: time.Second},
+			},
+		},
+		{
+			name: "SlowRate",
+			// One token every 2 seconds, no burst
+			limit: ratelimit.PerMinute(30, 1),
+			takes: []take{
+				{wantOK: true},
+				{at: 500 * time.Millisecond, wantRetry: 1500 * time.Millisecond},
+				{at: 2 * time.Second, wantOK: true},
+			},
+		},
+		{
+			name:  "KeysAreSeparate",
+			limit: ratelimit.PerMinute(60, 1),
+			takes: []take{
+				{key: "address:a", wantOK: true},
+				{key: "address:a", wantRetry: time.Second},
+				{key: "address:b", wantOK: true},
+				{key: "ip:a", wantOK: true},
+			},
+		},
+		{
+			// A replica whose clock is behind neither refills the bucket
+			// nor moves its refill time back
+			name:  "ClockGoesBack",
+			limit: ratelimit.PerMinute(60, 1),
+			takes: []take{
+				{at: time.Minute, wantOK: true},
+				{wantRetry: time.Second},
+				{at: time.Minute + 500*time.Millisecond, wantRetry: 500 * time.Millisecond},
+				{at: time.Minute + time.Second, wantOK: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replicas := make([]ratelimit.Buckets, 2)
+			replicas[0], replicas[1] = newBuckets(t)
+
+			for i, take := range tt.takes {
+				key := take.key
+				if key == "" {
+					key = "address:test"
+				}
+				ok, retry, err := replicas[i%2].TakeToken(context.Background(), key, tt.limit.Rate, tt.limit.Burst, start.Add(take.at))
+				if err != nil {
+					t.Fatalf("take %d: %v", i, err)
+				}
+				if ok != take.wantOK || retry != take.wantRetry {
+					t.Errorf("take %d at +%v = %v, retry after %v; want %v, %v", i, take.at, ok, retry, take.wantOK, take.wantRetry)
+				}
+			}
+		})
+	}
+}
+
+// failingBuckets fails every call, as an unreachable database would
+type failingBuckets struct{}
+
+func (failingBuckets) TakeToken(ctx context.Context, key string, rate float64, burst int, now time.Time) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestLimiter(t *testing.T) {
+	address := ratelimit.PerMinute(60, 1)
+	ip := ratelimit.PerMinute(60, 2)
+
+	t.Run("PerAddressAndIP", func(t *testing.T) {
+		l := ratelimit.New(ratelimit.NewMemory(), address, ip, logging.Discard())
+		ctx := context.Background()
+
+		if ok, _ := l.AllowAddress(ctx, "0xa", start); !ok {
+			t.Fatal("first heartbeat for 0xa refused")
+		}
+		if ok, retry := l.AllowAddress(ctx, "0xa", start); ok || retry != time.Second {
+			t.Errorf("second heartbeat for 0xa = %v, retry after %v; want refused, 1s", ok, retry)
+		}
+		// Another address and the IP have buckets of their own
+		if ok, _ := l.AllowAddress(ctx, "0xb", start); !ok {
+			t.Error("heartbeat for 0xb refused")
+		}
+		for i := 0; i < 2; i++ {
+			if ok, _ := l.AllowIP(ctx, "0xa", start); !ok {
+				t.Errorf("request %d from IP 0xa refused", i)
+			}
+		}
+		if ok, retry := l.AllowIP(ctx, "0xa", start); ok || retry != time.Second {
+			t.Errorf("third request from IP 0xa = %v, retry after %v; want refused, 1s", ok, retry)
+		}
+		if ok, _ := l.AllowIP(ctx, "10.0.0.2", start); !ok {
+			t.Error("request from another IP refused")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		l := ratelimit.New(ratelimit.NewMemory(), ratelimit.PerMinute(0, 1), ratelimit.PerMinute(60, 0), logging.Discard())
+		for i := 0; i < 10; i++ {
+			if ok, _ := l.AllowAddress(context.Background(), "0xa", start); !ok {
+				t.Fatalf("heartbeat %d refused with the address limit off", i)
+			}
+			if ok, _ := l.AllowIP(context.Background(), "10.0.0.1", start); !ok {
+				t.Fatalf("request %d refused with the IP limit off", i)
+			}
+		}
+	})
+
+	t.Run("NilLimiter", func(t *testing.T) {
+		var l *ratelimit.Limiter
+		if ok, _ := l.AllowAddress(context.Background(), "0xa", start); !ok {
+			t.Error("nil limiter refused a heartbeat")
+		}
+	})
+
+	t.Run("SetLimits", func(t *testing.T) {
+		l := ratelimit.New(ratelimit.NewMemory(), address, ip, logging.Discard())
+		l.AllowAddress(context.Background(), "0xa", start)
+		if ok, _ := l.AllowAddress(context.Background(), "0xa", start); ok {
+			t.Fatal("second heartbeat allowed before the limit changed")
+		}
+
+		l.SetLimits(ratelimit.Limit{}, ip)
+		if ok, _ := l.AllowAddress(context.Background(), "0xa", start); !ok {
+			t.Error("heartbeat refused after the address limit was turned off")
+		}
+	})
+
+	t.Run("FailsOpen", func(t *testing.T) {
+		var logs bytes.Buffer
+		l := ratelimit.New(failingBuckets{}, address, ip, slog.New(slog.NewTextHandler(&logs, nil)))
+
+		for i := 0; i < 3; i++ {
+			if ok, retry := l.AllowAddress(context.Background(), "0xa", start); !ok || retry != 0 {
+				t.Errorf("heartbeat %d = %v, retry after %v; want allowed while the buckets are down", i, ok, retry)
+			}
+		}
+		if ok, _ := l.AllowIP(context.Background(), "10.0.0.1", start); !ok {
+			t.Error("request refused while the buckets are down")
+		}
+		if !strings.Contains(logs.String(), "Rate limit check failed") || !strings.Contains(logs.String(), "connection refused") {
+			t.Errorf("failure not logged: %s", logs.String())
+		}
+	})
+}
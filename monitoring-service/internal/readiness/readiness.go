@@ -0,0 +1,163 @@
+// Package readiness checks the dependencies the service needs to answer
+// requests, so load balancers only route traffic to instances that can
+// serve it. Liveness is not checked here: a process that is up is alive,
+// and restarting it does not bring a dependency back.
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/database"
+)
+
+const (
+	// DefaultTimeout bounds each check
+	DefaultTimeout = 3 * time.Second
+	// DefaultMaxBlockAge is how long the RPC's latest block number may stand
+	// still before the RPC counts as stale, a dozen Fuse blocks
+	DefaultMaxBlockAge = time.Minute
+)
+
+// Dependency and report statuses
+const (
+	StatusUp       = "up"
+	StatusDown     = "down"
+	StatusReady    = "ready"
+	StatusNotReady = "not_ready"
+)
+
+// Check probes one dependency. Probe returns nil when the dependency can
+// serve requests.
+type Check struct {
+	// Name of the dependency, e.g. mongo or rpc
+	Name string
+	// Network the dependency belongs to
+	Network string
+	Probe   func(ctx context.Context) error
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Name      string `json:"name"`
+	Network   string `json:"network,omitempty"`
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check. The service is ready when every
+// dependency is up.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether every dependency is up
+func (r Report) Ready() bool {
+	return r.Status == StatusReady
+}
+
+// Checker runs a fixed set of checks
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+}
+
+// NewChecker creates a checker bounding each check by timeout
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{checks: checks, timeout: timeout}
+}
+
+// Check runs every check concurrently and reports them in the order they
+// were given
+func (c *Checker) Check(ctx context.Context) Report {
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: StatusReady, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusUp {
+			report.Status = StatusNotReady
+		}
+	}
+	return report
+}
+
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Probe(ctx)
+	result := Result{
+		Name:      check.Name,
+		Network:   check.Network,
+		Status:    StatusUp,
+		LatencyMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		result.Status = StatusDown
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Mongo checks that the network's database answers a ping
+func Mongo(network string, store database.Store) Check {
+	return Check{Name: "mongo", Network: network, Probe: store.Ping}
+}
+
+// RPC checks that the network's RPC answers eth_blockNumber and that the
+// block number it returns has advanced within maxAge. The first answer
+// counts as fresh.
+func RPC(network string, head blockchain.HeadReader, maxAge time.Duration) Check {
+	if maxAge <= 0 {
+		maxAge = DefaultMaxBlockAge
+	}
+	f := &freshness{head: head, maxAge: maxAge, now: time.Now}
+	return Check{Name: "rpc", Network: network, Probe: f.probe}
+}
+
+// freshness remembers when the block number last changed
+type freshness struct {
+	head   blockchain.HeadReader
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	number    uint64
+	changedAt time.Time
+}
+
+func (f *freshness) probe(ctx context.Context) error {
+	number, err := f.head.BlockNumber(ctx)
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := f.now()
+	if number != f.number || f.changedAt.IsZero() {
+		f.number, f.changedAt = number, now
+	}
+	if age := now.Sub(f.changedAt); age > f.maxAge {
+		return fmt.Errorf("block %d has not advanced for %s", number, age.Truncate(time.Second))
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package readiness
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// head is an RPC whose block number and error are set by the test
+type head struct {
+	mu     sync.Mutex
+	number uint64
+	err    error
+}
+
+func (h *head) BlockNumber(ctx context.Context) (uint64, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.number, h.err
+}
+
+func (h *head) set(number uint64, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.number, h.err = number, err
+}
+
+func TestFreshness(t *testing.T) {
+	type step struct {
+		at      time.Duration
+		number  uint64
+		err     error
+		wantErr string
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "FirstAnswerIsFresh",
+			steps: []step{
+				{at: time.Hour, number: 100},
+			},
+		},
+		{
+			name: "Advancing",
+			steps: []step{
+				{number: 100},
+				{at: 50 * time.Second, number: 101},
+				{at: 100 * time.Second, number: 102},
+				{at: 150 * time.Second, number: 103},
+			},
+		},
+		{
+			name: "StandsStill",
+			steps: []step{
+				{number: 100},
+				{at: time.Minute, number: 100},
+				{at: time.Minute + time.Second, number: 100, wantErr: "block 100 has not advanced for 1m1s"},
+				// Stale until it moves again
+				{at: 2 * time.Minute, number: 100, wantErr: "block 100 has not advanced for 2m0s"},
+				{at: 2*time.Minute + time.Second, number: 101},
+				{at: 3*time.Minute + time.Second, number: 101},
+			},
+		},
+		{
+			// A reorg or another node behind a load balancer may answer
+			// an older block; any change counts as progress
+			name: "GoesBack",
+			steps: []step{
+				{number: 100},
+				{at: 50 * time.Second, number: 99},
+				{at: 100 * time.Second, number: 99},
+			},
+		},
+		{
+			// An error says nothing of the block number, so the age runs on
+			name: "Unreachable",
+			steps: []step{
+				{number: 100},
+				{at: 30 * time.Second, err: errors.New("connection refused"), wantErr: "connection refused"},
+				{at: 61 * time.Second, number: 100, wantErr: "has not advanced for 1m1s"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rpc := &head{}
+			var now time.Time
+			f := &freshness{head: rpc, maxAge: time.Minute, now: func() time.Time { return now }}
+
+			for i, step := range tt.steps {
+				now = start.Add(step.at)
+				rpc.set(step.number, step.err)
+				err := f.probe(context.Background())
+				if step.wantErr == "" && err != nil || step.wantErr != "" && (err == nil || !strings.Contains(err.Error(), step.wantErr)) {
+					t.Errorf("step %d at +%v = %v, want error %q", i, step.at, err, step.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestRPCDefaultMaxBlockAge(t *testing.T) {
+	for _, maxAge := range []time.Duration{0, -time.Second} {
+		check := RPC("fuse", &head{number: 1}, maxAge)
+		if check.Name != "rpc" || check.Network != "fuse" {
+			t.Errorf("check = %s on %s, want rpc on fuse", check.Name, check.Network)
+		}
+		if err := check.Probe(context.Background()); err != nil {
+			t.Errorf("first probe = %v, want fresh", err)
+		}
+	}
+}
+
+func TestChecker(t *testing.T) {
+	up := func(ctx context.Context) error { return nil }
+	down := func(ctx context.Context) error { return errors.New("connection refused") }
+	// hang blocks until the check's timeout
+	hang := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantStatus string
+		want       []Result
+	}{
+		{
+			name:       "NoChecks",
+			wantStatus: StatusReady,
+			want:       []Result{},
+		},
+		{
+			name: "AllUp",
+			checks: []Check{
+				{Name: "mongo", Network: "fuse", Probe: up},
+				{Name: "rpc", Network: "fuse", Probe: up},
+			},
+			wantStatus: StatusReady,
+			want: []Result{
+				{Name: "mongo", Network: "fuse", Status: StatusUp},
+				{Name: "rpc", Network: "fuse", Status: StatusUp},
+			},
+		},
+		{
+			name: "OneDown",
+			checks: []Check{
+				{Name: "mongo", Network: "fuse", Probe: up},
+				{Name: "rpc", Network: "fuse", Probe: down},
+				{Name: "mongo", Network: "spark", Probe: up},
+			},
+			wantStatus: StatusNotReady,
+			want: []Result{
+				{Name: "mongo", Network: "fuse", Status: StatusUp},
+				{Name: "rpc", Network: "fuse", Status: StatusDown, Error: "connection refused"},
+				{Name: "mongo", Network: "spark", Status: StatusUp},
+			},
+		},
+		{
+			name: "TimesOut",
+			checks: []Check{
+				{Name: "mongo", Network: "fuse", Probe: hang},
+				{Name: "rpc", Network: "fuse", Probe: up},
+			},
+			wantStatus: StatusNotReady,
+			want: []Result{
+				{Name: "mongo", Network: "fuse", Status: StatusDown, Error: context.DeadlineExceeded.Error()},
+				{Name: "rpc", Network: "fuse", Status: StatusUp},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := NewChecker(20*time.Millisecond, tt.checks...).Check(context.Background())
+			if report.Status != tt.wantStatus || report.Ready() != (tt.wantStatus == StatusReady) {
+				t.Errorf("status = %s, ready %v; want %s", report.Status, report.Ready(), tt.wantStatus)
+			}
+			for i := range report.Checks {
+				report.Checks[i].LatencyMS = 0
+			}
+			if !reflect.DeepEqual(report.Checks, tt.want) {
+				t.Errorf("checks = %+v, want %+v", report.Checks, tt.want)
+			}
+		})
+	}
+}
+
+// Checks run concurrently, so a report takes as long as the slowest check
+// rather than their sum
+func TestCheckerConcurrent(t *testing.T) {
+	slow := func(ctx context.Context) error {
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	}
+	checks := make([]Check, 10)
+	for i := range checks {
+		checks[i] = Check{Name: "rpc", Probe: slow}
+	}
+
+	began := time.Now()
+	report := NewChecker(time.Second, checks...).Check(context.Background())
+	if elapsed := time.Since(began); elapsed > 400*time.Millisecond {
+		t.Errorf("10 checks of 50ms took %v, want them run at once", elapsed)
+	}
+	if !report.Ready() {
+		t.Errorf("report = %+v, want ready", report)
+	}
+	for _, result := range report.Checks {
+		if result.LatencyMS < 50 {
+			t.Errorf("latency = %dms, want at least 50ms", result.LatencyMS)
+		}
+	}
+}
+
+func TestNewCheckerDefaultTimeout(t *testing.T) {
+	if c := NewChecker(0); c.timeout != DefaultTimeout {
+		t.Errorf("timeout = %v, want %v", c.timeout, DefaultTimeout)
+	}
+}
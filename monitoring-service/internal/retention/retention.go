@@ -0,0 +1,65 @@
+package retention
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+// DefaultInterval is how often expired heartbeats are compacted
+const DefaultInterval = time.Hour
+
+// Compactor periodically compacts raw heartbeats older than the retention
+// period into per-interval coverage, keeping uptime history exact
+type Compactor struct {
+	db        database.HeartbeatStore
+	retention time.Duration
+	interval  time.Duration
+	logger    *slog.Logger
+}
+
+// NewCompactor creates a compactor keeping retention of raw heartbeats
+func NewCompactor(db database.HeartbeatStore, retention, interval time.Duration, logger *slog.Logger) *Compactor {
+	return &Compactor{
+		db:        db,
+		retention: retention,
+		interval:  interval,
+		logger:    logger,
+	}
+}
+
+// Run compacts until ctx is cancelled
+func (c *Compactor) Run(ctx context.Context) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	c.compact(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.compact(ctx)
+		}
+	}
+}
+
+// RunOnce compacts everything that has expired and returns the report
+func (c *Compactor) RunOnce(ctx context.Context) (database.CompactionReport, error) {
+	return c.db.CompactHeartbeats(ctx, time.Now().Add(-c.retention))
+}
+
+func (c *Compactor) compact(ctx context.Context) {
+	report, err := c.RunOnce(ctx)
+	if report.Windows > 0 {
+		c.logger.InfoContext(ctx, "Compacted heartbeats",
+			"from", report.From.Format(time.RFC3339), "to", report.To.Format(time.RFC3339),
+			"heartbeats_deleted", report.HeartbeatsDeleted, "coverage_intervals", report.CoverageIntervals)
+	}
+	if err != nil {
+		// Progress is saved per window, so the next run picks up from here
+		c.logger.ErrorContext(ctx, "Heartbeat compaction failed", "error", err)
+	}
+}
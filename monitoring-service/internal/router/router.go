@@ -0,0 +1,176 @@
+package router
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"monitoring-service/internal/access"
+	"monitoring-service/internal/auth"
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/events"
+	"monitoring-service/internal/handlers"
+	"monitoring-service/internal/liveness"
+	"monitoring-service/internal/logging"
+	"monitoring-service/internal/ratelimit"
+	"monitoring-service/internal/readiness"
+	"monitoring-service/pkg/config"
+)
+
+// Network is what the service runs for one configured network
+type Network struct {
+	ID          string
+	Store       database.Store
+	Balances    blockchain.BalanceReader
+	Delegations blockchain.DelegationReader
+	// Head is the network's RPC, checked for readiness
+	Head   blockchain.HeadReader
+	Broker *events.Broker
+}
+
+// New mounts the API of every network, each selected by the network query
+// parameter, with the first network as the default. The access policy, rate
+// limits and liveness checks are shared by all networks. /livez and /readyz
+// cover the whole instance, so /readyz checks the dependencies of every
+// network.
+func New(settings *config.Live, networks []Network, policy *access.Policy, limiter *ratelimit.Limiter, livenessChecker *liveness.Checker) (http.Handler, error) {
+	cfg := settings.Get()
+	authenticator := auth.New(cfg.AdminAPIKeys, cfg.AdminJWTSecret)
+
+	ids := make([]string, 0, len(networks))
+	muxes := make(map[string]http.Handler, len(networks))
+	var checks []readiness.Check
+	for _, network := range networks {
+		if _, err := cfg.ForNetwork(network.ID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, network.ID)
+		muxes[network.ID] = newNetworkMux(settings, network, authenticator, policy, limiter, livenessChecker)
+		checks = append(checks,
+			readiness.Mongo(network.ID, network.Store),
+			readiness.RPC(network.ID, network.Head, cfg.ReadyMaxBlockAge),
+		)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/livez", logRequest(handlers.Livez))
+	mux.HandleFunc("/readyz", logRequest(handlers.Readyz(readiness.NewChecker(readiness.DefaultTimeout, checks...))))
+	mux.Handle("/", handlers.SelectNetwork(ids, muxes))
+
+	// Each request is a server span, joining the caller's trace when it
+	// sends a traceparent header
+	return otelhttp.NewHandler(withRequestID(mux), "http.server",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method }),
+	), nil
+}
+
+// withRequestID gives every request an ID, carried in its context into the
+// logs of every layer and echoed in the response. A valid X-Request-ID from
+// the caller is kept so a request can be followed across services.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("request.id", id))
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// newNetworkMux mounts the legacy and versioned API routes of one network
+// with request logging and CORS applied. Clients the access policy rejects
+// are left out of every client read.
+func newNetworkMux(settings *config.Live, network Network, authenticator *auth.Authenticator, policy *access.Policy, limiter *ratelimit.Limiter, livenessChecker *liveness.Checker) http.Handler {
+	mux := http.NewServeMux()
+	db := access.FilterStore(network.Store, policy)
+
+	// Add health check endpoint
+	mux.HandleFunc("/health", logRequest(handlers.HealthCheck))
+
+	// Versioned API, described by the OpenAPI document generated from the same routes
+	routes := handlers.Routes(settings, network.ID, db, network.Delegations, network.Balances, network.Broker, authenticator, policy, limiter, livenessChecker)
+	handlers.Mount(mux, routes, func(next http.Handler) http.Handler {
+		return enableCors(logRequest(next.ServeHTTP))
+	})
+	mux.Handle(handlers.VersionedPath("/openapi.json"), enableCors(logRequest(handlers.OpenAPI(handlers.OpenAPIDocument(routes)))))
+
+	// Unversioned routes kept for existing light clients and dashboards, with
+	// their original responses
+	mux.Handle("/delegations", enableCors(logRequest(handlers.GetDelegations(db))))
+	mux.Handle("/clients", enableCors(logRequest(handlers.Legacy(handlers.GetClients(db)))))
+	mux.HandleFunc("/check-nft", logRequest(handlers.Legacy(handlers.CheckNFT(settings, network.ID, db, network.Delegations, network.Balances, network.Broker, policy, limiter, livenessChecker))))
+	mux.HandleFunc("/check-delegation", logRequest(handlers.Legacy(handlers.CheckDelegation(network.Balances, network.Delegations))))
+
+	return mux
+}
+
+func logRequest(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startTime := time.Now()
+
+		// Name the span after the route. Legacy routes are fixed paths;
+		// Mount renames versioned ones after their pattern.
+		trace.SpanFromContext(r.Context()).SetName(r.Method + " " + r.URL.Path)
+
+		// Create a custom response writer to capture the status code
+		lrw := newLoggingResponseWriter(w)
+
+		// Call the next handler
+		next.ServeHTTP(lrw, r)
+
+		// Log the request details; server errors at error level
+		level := slog.LevelInfo
+		if lrw.statusCode >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.Log(r.Context(), level, "Request served",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", lrw.statusCode,
+			"duration_ms", time.Since(startTime).Milliseconds(),
+			"remote_addr", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	}
+}
+
+type loggingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func newLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
+	return &loggingResponseWriter{w, http.StatusOK}
+}
+
+func (lrw *loggingResponseWriter) WriteHeader(code int) {
+	lrw.statusCode = code
+	lrw.ResponseWriter.WriteHeader(code)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to flush event streams
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
+
+func enableCors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID, traceparent, tracestate")
+		w.Header().Set("Access-Control-Expose-Headers", "X-Request-ID")
+
+		if r.Method == "OPTIONS" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
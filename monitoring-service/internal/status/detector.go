@@ -0,0 +1,79 @@
+package status
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"monitoring-service/internal/database"
+	"monitoring-service/internal/events"
+)
+
+// DefaultInterval is how often client statuses are re-evaluated
+const DefaultInterval = 30 * time.Second
+
+// Detector periodically derives each client's status from its last heartbeat
+// and publishes a status-changed event whenever it differs from the last scan.
+type Detector struct {
+	db       database.ClientStore
+	broker   *events.Broker
+	interval time.Duration
+	logger   *slog.Logger
+	statuses map[string]string
+}
+
+// NewDetector creates a new status detector
+func NewDetector(db database.ClientStore, broker *events.Broker, interval time.Duration, logger *slog.Logger) *Detector {
+	return &Detector{
+		db:       db,
+		broker:   broker,
+		interval: interval,
+		logger:   logger,
+	}
+}
+
+// Run scans until ctx is cancelled
+func (d *Detector) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	d.scan(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.scan(ctx)
+		}
+	}
+}
+
+func (d *Detector) scan(ctx context.Context) {
+	lastHeartbeats, err := d.db.GetLastHeartbeats(ctx)
+	if err != nil {
+		d.logger.ErrorContext(ctx, "Status detector failed to load clients", "error", err)
+		return
+	}
+
+	now := time.Now()
+	statuses := make(map[string]string, len(lastHeartbeats))
+	for address, lastHeartbeat := range lastHeartbeats {
+		current := database.ClientStatus(lastHeartbeat, now)
+		statuses[address] = current
+
+		// The first scan only establishes the baseline
+		if d.statuses == nil {
+			continue
+		}
+
+		previous, known := d.statuses[address]
+		if known && previous != current {
+			d.broker.Publish(events.StatusChanged, address, events.StatusChangePayload{
+				Previous: previous,
+				Current:  current,
+			})
+		}
+	}
+
+	d.statuses = statuses
+}
@@ -0,0 +1,187 @@
+// Package sybil flags groups of operators that look like one party running
+// many registrations: operators backed by exactly the same delegators, or
+// heartbeating from the same IP address. Flags are for human review; nothing
+// is blocked automatically.
+package sybil
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+const (
+	// ReasonSharedDelegators flags operators backed by the same delegator set
+	ReasonSharedDelegators = "shared_delegators"
+	// ReasonSharedIP flags operators heartbeating from the same IP address
+	ReasonSharedIP = "shared_ip"
+)
+
+// DefaultWindow is how far back source IPs are compared
+const DefaultWindow = 7 * 24 * time.Hour
+
+// Options tune the heuristics
+type Options struct {
+	// MinClusterSize is how many operators must share a delegator set or an
+	// IP address before they are flagged
+	MinClusterSize int
+	// Window is how far back source IPs are compared
+	Window time.Duration
+}
+
+// Cluster is a group of operators sharing a delegator set or an IP address
+type Cluster struct {
+	Reason    string   `json:"reason"`
+	Operators []string `json:"operators"`
+	// Delegators is the shared delegator set, for shared_delegators clusters
+	Delegators []string `json:"delegators,omitempty"`
+	// IP is the shared address, for shared_ip clusters
+	IP string `json:"ip,omitempty"`
+}
+
+// FlaggedOperator is one operator in at least one cluster
+type FlaggedOperator struct {
+	Address string   `json:"address"`
+	Reasons []string `json:"reasons"`
+	// Related lists the other operators in this operator's clusters
+	Related []string `json:"related"`
+}
+
+// Report is the result of one detection run
+type Report struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Since       time.Time         `json:"since"`
+	Clusters    []Cluster         `json:"clusters"`
+	Operators   []FlaggedOperator `json:"operators"`
+}
+
+// Detect runs the heuristics over the registered clients
+func Detect(ctx context.Context, store database.Store, opts Options, now time.Time) (Report, error) {
+	if opts.MinClusterSize < 2 {
+		opts.MinClusterSize = 2
+	}
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+	report := Report{
+		GeneratedAt: now,
+		Since:       now.Add(-opts.Window),
+		Clusters:    []Cluster{},
+		Operators:   []FlaggedOperator{},
+	}
+
+	// Only registered clients count; delegations to anyone else are ignored
+	registered, err := store.GetLastHeartbeats(ctx)
+	if err != nil {
+		return report, err
+	}
+
+	delegators := make(map[string]map[string]bool)
+	err = store.StreamDelegations(ctx, "", database.TimeRange{}, func(delegation database.DelegationRecord) error {
+		operator := strings.ToLower(delegation.ToAddress)
+		if _, ok := registered[operator]; !ok {
+			return nil
+		}
+		if delegators[operator] == nil {
+			delegators[operator] = make(map[string]bool)
+		}
+		delegators[operator][strings.ToLower(delegation.FromAddress)] = true
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	bySet := make(map[string][]string)
+	sets := make(map[string][]string)
+	for operator, from := range delegators {
+		set := sortedKeys(from)
+		key := strings.Join(set, ",")
+		bySet[key] = append(bySet[key], operator)
+		sets[key] = set
+	}
+	for key, operators := range bySet {
+		if len(operators) >= opts.MinClusterSize {
+			sort.Strings(operators)
+			report.Clusters = append(report.Clusters, Cluster{
+				Reason:     ReasonSharedDelegators,
+				Operators:  operators,
+				Delegators: sets[key],
+			})
+		}
+	}
+
+	sources, err := store.GetClientSources(ctx, report.Since)
+	if err != nil {
+		return report, err
+	}
+	byIP := make(map[string]map[string]bool)
+	for _, source := range sources {
+		if _, ok := registered[source.ClientAddress]; !ok {
+			continue
+		}
+		if byIP[source.IP] == nil {
+			byIP[source.IP] = make(map[string]bool)
+		}
+		byIP[source.IP][source.ClientAddress] = true
+	}
+	for ip, operators := range byIP {
+		if len(operators) >= opts.MinClusterSize {
+			report.Clusters = append(report.Clusters, Cluster{
+				Reason:    ReasonSharedIP,
+				Operators: sortedKeys(operators),
+				IP:        ip,
+			})
+		}
+	}
+
+	// Largest clusters first, they are the most suspicious
+	sort.Slice(report.Clusters, func(i, j int) bool {
+		a, b := report.Clusters[i], report.Clusters[j]
+		if len(a.Operators) != len(b.Operators) {
+			return len(a.Operators) > len(b.Operators)
+		}
+		if a.Reason != b.Reason {
+			return a.Reason < b.Reason
+		}
+		return a.Operators[0] < b.Operators[0]
+	})
+
+	reasons := make(map[string]map[string]bool)
+	related := make(map[string]map[string]bool)
+	for _, cluster := range report.Clusters {
+		for _, operator := range cluster.Operators {
+			if reasons[operator] == nil {
+				reasons[operator] = make(map[string]bool)
+				related[operator] = make(map[string]bool)
+			}
+			reasons[operator][cluster.Reason] = true
+			for _, other := range cluster.Operators {
+				if other != operator {
+					related[operator][other] = true
+				}
+			}
+		}
+	}
+	for _, operator := range sortedKeys(reasons) {
+		report.Operators = append(report.Operators, FlaggedOperator{
+			Address: operator,
+			Reasons: sortedKeys(reasons[operator]),
+			Related: sortedKeys(related[operator]),
+		})
+	}
+
+	return report, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
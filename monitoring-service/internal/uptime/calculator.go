@@ -2,12 +2,9 @@ package uptime
 
 import (
 	"context"
+	"fmt"
 	"math"
 	"time"
-
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 const (
@@ -20,14 +17,56 @@ const (
 	WeeklyHistoryDuration = 7 * 24 * time.Hour
 )
 
+// Policy decides which heartbeat sources count towards uptime: heartbeats
+// pushed by the client, probes pulled by the service, or a mix
+type Policy string
+
+const (
+	// PolicyPush counts intervals with a pushed heartbeat
+	PolicyPush Policy = "push"
+	// PolicyPull counts intervals with a successful probe
+	PolicyPull Policy = "pull"
+	// PolicyEither counts intervals with a heartbeat or a successful probe
+	PolicyEither Policy = "either"
+	// PolicyBoth counts intervals with a heartbeat and a successful probe
+	PolicyBoth Policy = "both"
+)
+
+// Policies lists every policy
+var Policies = []Policy{PolicyPush, PolicyPull, PolicyEither, PolicyBoth}
+
+// ParsePolicy returns the named policy
+func ParsePolicy(name string) (Policy, error) {
+	for _, policy := range Policies {
+		if string(policy) == name {
+			return policy, nil
+		}
+	}
+	return "", fmt.Errorf("unknown uptime policy %q", name)
+}
+
+// IntervalCounter counts the distinct sampling intervals, aligned to the unix
+// epoch, that contain a heartbeat or probe from a client since a given time
+type IntervalCounter interface {
+	CountHeartbeatIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration) (int64, error)
+	// CountProbeIntervals counts intervals with at least one successful probe
+	CountProbeIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration) (int64, error)
+	// CountCombinedIntervals counts intervals with a heartbeat or a
+	// successful probe, or only those with both when requireBoth is set
+	CountCombinedIntervals(ctx context.Context, clientAddress string, since time.Time, interval time.Duration, requireBoth bool) (int64, error)
+}
+
 type Calculator struct {
-	heartbeats *mongo.Collection
+	heartbeats IntervalCounter
+	policy     Policy
 }
 
-// NewCalculator creates a new uptime calculator
-func NewCalculator(heartbeatsCollection *mongo.Collection) *Calculator {
+// NewCalculator creates a new uptime calculator counting the sources the
+// policy names
+func NewCalculator(heartbeats IntervalCounter, policy Policy) *Calculator {
 	return &Calculator{
-		heartbeats: heartbeatsCollection,
+		heartbeats: heartbeats,
+		policy:     policy,
 	}
 }
 
@@ -79,55 +118,39 @@ func (c *Calculator) calculateUptimeForPeriod(ctx context.Context, clientAddress
 		expectedIntervals = 1 // Avoid division by zero
 	}
 
-	pipeline := mongo.Pipeline{
-		// Stage 1: Match documents by client and time range
-		bson.D{{Key: "$match", Value: bson.D{
-			{Key: "client_address", Value: clientAddress},
-			{Key: "timestamp", Value: bson.D{{Key: "$gte", Value: startTime}}},
-		}}},
-		
-		// Stage 2: Project only necessary fields with pre-calculated interval bucket
-		bson.D{{Key: "$project", Value: bson.D{
-			{Key: "interval_bucket", Value: bson.D{
-				{Key: "$floor", Value: bson.D{
-					{Key: "$divide", Value: bson.A{
-						bson.D{{Key: "$toLong", Value: "$timestamp"}},
-						int64(IntervalDuration / time.Millisecond),
-					}},
-				}},
-			}},
-		}}},
-		
-		// Stage 3: Group by the interval bucket to count unique intervals
-		bson.D{{Key: "$group", Value: bson.D{
-			{Key: "_id", Value: "$interval_bucket"},
-		}}},
-		
-		// Stage 4: Count total intervals
-		bson.D{{Key: "$count", Value: "total_intervals"}},
+	totalIntervals, err := c.countIntervals(ctx, clientAddress, startTime)
+	if err != nil {
+		return 0, err
 	}
 
-	opts := options.Aggregate().SetMaxTime(3 * time.Second)
+	// Calculate uptime percentage
+	uptimePercentage := float64(totalIntervals) / float64(expectedIntervals) * 100
+	return math.Min(uptimePercentage, 100), nil
+}
 
-	cursor, err := c.heartbeats.Aggregate(ctx, pipeline, opts)
+// CountIntervals counts the intervals from from up to to in which the client
+// was up under the calculator's policy
+func (c *Calculator) CountIntervals(ctx context.Context, clientAddress string, from, to time.Time) (int64, error) {
+	sinceFrom, err := c.countIntervals(ctx, clientAddress, from)
 	if err != nil {
 		return 0, err
 	}
-	defer cursor.Close(ctx)
-
-	var result struct {
-		TotalIntervals int64 `bson:"total_intervals"`
+	sinceTo, err := c.countIntervals(ctx, clientAddress, to)
+	if err != nil {
+		return 0, err
 	}
+	return sinceFrom - sinceTo, nil
+}
 
-	totalIntervals := int64(0)
-	if cursor.Next(ctx) {
-		if err := cursor.Decode(&result); err != nil {
-			return 0, err
-		}
-		totalIntervals = result.TotalIntervals
+func (c *Calculator) countIntervals(ctx context.Context, clientAddress string, since time.Time) (int64, error) {
+	switch c.policy {
+	case PolicyPull:
+		return c.heartbeats.CountProbeIntervals(ctx, clientAddress, since, IntervalDuration)
+	case PolicyEither:
+		return c.heartbeats.CountCombinedIntervals(ctx, clientAddress, since, IntervalDuration, false)
+	case PolicyBoth:
+		return c.heartbeats.CountCombinedIntervals(ctx, clientAddress, since, IntervalDuration, true)
+	default:
+		return c.heartbeats.CountHeartbeatIntervals(ctx, clientAddress, since, IntervalDuration)
 	}
-
-	// Calculate uptime percentage
-	uptimePercentage := float64(totalIntervals) / float64(expectedIntervals) * 100
-	return math.Min(uptimePercentage, 100), nil
-} 
\ No newline at end of file
+}
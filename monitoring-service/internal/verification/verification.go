@@ -0,0 +1,97 @@
+package verification
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"monitoring-service/internal/blockchain"
+	"monitoring-service/internal/blockchain/delegation"
+	"monitoring-service/pkg/config"
+)
+
+var (
+	// ErrDelegationLookup wraps failures reading the delegate registry
+	ErrDelegationLookup = errors.New("failed to get incoming delegations")
+	// ErrBalanceLookup wraps failures reading a delegator's NFT balance
+	ErrBalanceLookup = errors.New("failed to check NFT balance")
+)
+
+// Result is what the chain says an address is delegated
+type Result struct {
+	// Incoming is the number of delegations of any kind to the address
+	Incoming int
+	// Delegators maps each valid delegator to the amount it counts for,
+	// capped at the delegator's NFT balance
+	Delegators map[string]int64
+	// Total is the sum of Delegators
+	Total int64
+}
+
+// Verify reads the delegations to address from the registry and keeps the
+// ERC-1155 delegations of the configured NFT contract with the configured
+// rights, backed by an NFT balance
+func Verify(ctx context.Context, cfg *config.Config, delegationReader blockchain.DelegationReader, balanceReader blockchain.BalanceReader, address string) (Result, error) {
+	result := Result{Delegators: make(map[string]int64)}
+
+	incomingDelegations, err := delegationReader.GetIncomingDelegations(&bind.CallOpts{Context: ctx}, common.HexToAddress(address))
+	if err != nil {
+		return result, fmt.Errorf("%w: %w", ErrDelegationLookup, err)
+	}
+	result.Incoming = len(incomingDelegations)
+
+	var delegations []delegation.IDelegateRegistryDelegation
+	delegatorBalances := make(map[string]int64)
+
+	// First collect all delegations and check delegator balances
+	for _, delegation := range incomingDelegations {
+		delegationRights := [32]byte(delegation.Rights)
+		configRights := [32]byte(cfg.Rights)
+		if delegationRights != configRights || delegation.Contract != common.HexToAddress(cfg.NFTContractAddr) || delegation.Type != blockchain.DelegationTypeERC1155 {
+			continue
+		}
+
+		// Check delegator's NFT balance
+		balance, err := balanceReader.GetBatchBalance(ctx, delegation.From.String(), []*big.Int{delegation.TokenId})
+		if err != nil {
+			return result, fmt.Errorf("%w for delegator %s: %w", ErrBalanceLookup, delegation.From.String(), err)
+		}
+		if len(balance) == 0 {
+			continue
+		}
+
+		slog.DebugContext(ctx, "Checked delegation",
+			"from", delegation.From.String(),
+			"to", delegation.To.String(),
+			"token_id", delegation.TokenId.String(),
+			"delegated_amount", delegation.Amount.Int64(),
+			"balance", balance[0].Int64())
+
+		if balance[0].Int64() > 0 {
+			delegations = append(delegations, delegation)
+			delegatorBalances[delegation.From.String()] += balance[0].Int64()
+		}
+	}
+
+	for _, delegation := range delegations {
+		// Only count delegation amount up to delegator's actual balance
+		availableBalance := delegatorBalances[delegation.From.String()]
+		delegationAmount := delegation.Amount.Int64()
+		if delegationAmount > availableBalance {
+			delegationAmount = availableBalance
+		}
+
+		if delegationAmount > 0 {
+			result.Delegators[delegation.From.String()] += delegationAmount
+		}
+	}
+
+	for _, amount := range result.Delegators {
+		result.Total += amount
+	}
+	return result, nil
+}
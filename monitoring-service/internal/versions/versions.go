@@ -0,0 +1,331 @@
+// Package versions tracks which light client build each operator runs and
+// applies the minimum version policy: clients below the minimum stay
+// eligible for rewards for a grace period, then lose eligibility until they
+// upgrade.
+package versions
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+// ErrInvalidReport is returned for a report with a malformed field
+var ErrInvalidReport = errors.New("invalid version report")
+
+// DefaultGracePeriod is how long an outdated client stays eligible for
+// rewards after it was first seen below the minimum version
+const DefaultGracePeriod = 7 * 24 * time.Hour
+
+var (
+	versionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	// Network, OS and arch are short identifiers such as mainnet, linux
+	// and amd64
+	identifierPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+)
+
+// Version is a semantic version. Build metadata is dropped.
+type Version struct {
+	Major, Minor, Patch int
+	// Pre is the pre-release, such as rc.1
+	Pre string
+}
+
+// Parse parses a semantic version, with or without a leading v
+func Parse(s string) (Version, error) {
+	m := versionPattern.FindStringSubmatch(s)
+	if m == nil {
+		return Version{}, fmt.Errorf("%q is not a semantic version", s)
+	}
+
+	var v Version
+	for i, part := range []*int{&v.Major, &v.Minor, &v.Patch} {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return Version{}, fmt.Errorf("%q is not a semantic version", s)
+		}
+		*part = n
+	}
+	v.Pre = m[4]
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Pre != "" {
+		s += "-" + v.Pre
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is older than, the same as or newer than o.
+// A pre-release is older than its release.
+func (v Version) Compare(o Version) int {
+	for _, pair := range [][2]int{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if pair[0] != pair[1] {
+			return compareInts(pair[0], pair[1])
+		}
+	}
+	switch {
+	case v.Pre == o.Pre:
+		return 0
+	case v.Pre == "":
+		return 1
+	case o.Pre == "":
+		return -1
+	}
+	return comparePre(v.Pre, o.Pre)
+}
+
+// comparePre compares dot separated pre-release identifiers, numeric ones
+// numerically
+func comparePre(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return compareInts(an, bn)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(as[i], bs[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(as), len(bs))
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// Report is the build information a heartbeat carries
+type Report struct {
+	Version string
+	Network string
+	OS      string
+	Arch    string
+}
+
+// Empty reports whether the heartbeat carried no build information
+func (r Report) Empty() bool {
+	return r == Report{}
+}
+
+// Validate checks the report's format
+func (r Report) Validate() error {
+	if r.Version != "" {
+		if _, err := Parse(r.Version); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidReport, err)
+		}
+	}
+	for _, field := range []struct{ name, value string }{
+		{"network", r.Network},
+		{"os", r.OS},
+		{"arch", r.Arch},
+	} {
+		if field.value != "" && !identifierPattern.MatchString(field.value) {
+			return fmt.Errorf("%w: %s must be at most 32 letters, digits, dots, dashes or underscores", ErrInvalidReport, field.name)
+		}
+	}
+	return nil
+}
+
+// Policy is the minimum version operators must run to earn rewards
+type Policy struct {
+	// Minimum is nil when any version is accepted
+	Minimum     *Version
+	GracePeriod time.Duration
+}
+
+// NewPolicy creates a policy from the configured minimum version, which may
+// be empty
+func NewPolicy(minimum string, gracePeriod time.Duration) (Policy, error) {
+	policy := Policy{GracePeriod: gracePeriod}
+	if minimum != "" {
+		v, err := Parse(minimum)
+		if err != nil {
+			return Policy{}, err
+		}
+		policy.Minimum = &v
+	}
+	return policy, nil
+}
+
+// Outdated reports whether a client running version is below the minimum.
+// Without a minimum nothing is outdated. Clients that do not report a
+// version are outdated once a minimum is set.
+func (p Policy) Outdated(version string) bool {
+	if p.Minimum == nil {
+		return false
+	}
+	v, err := Parse(version)
+	return err != nil || v.Compare(*p.Minimum) < 0
+}
+
+// Evaluate returns the version to store for a heartbeat's report, given the
+// one stored for the client before. It returns nil for a heartbeat without
+// build information when no minimum is set.
+func (p Policy) Evaluate(report Report, previous *database.ClientVersion, now time.Time) *database.ClientVersion {
+	if report.Empty() && p.Minimum == nil {
+		return nil
+	}
+
+	version := &database.ClientVersion{
+		Version:        strings.TrimPrefix(report.Version, "v"),
+		Network:        strings.ToLower(report.Network),
+		OS:             strings.ToLower(report.OS),
+		Arch:           strings.ToLower(report.Arch),
+		ReportedAt:     now,
+		RewardEligible: true,
+	}
+	if !p.Outdated(report.Version) {
+		return version
+	}
+
+	// The grace period runs from the first heartbeat below the minimum, not
+	// from the latest one
+	outdatedSince := now
+	if previous != nil && previous.OutdatedSince != nil {
+		outdatedSince = *previous.OutdatedSince
+	}
+	version.Outdated = true
+	version.OutdatedSince = &outdatedSince
+	version.RewardEligible = now.Sub(outdatedSince) < p.GracePeriod
+	return version
+}
+
+// Count is how many clients share a version, network or platform
+type Count struct {
+	Value   string `json:"value"`
+	Clients int    `json:"clients"`
+	// Active clients heartbeated within database.InactiveAfter
+	Active int `json:"active"`
+}
+
+// Distribution is how clients spread over versions, networks and platforms
+type Distribution struct {
+	MinimumVersion string `json:"minimum_version,omitempty"`
+	Clients        int    `json:"clients"`
+	// Outdated clients run a version below the minimum; Ineligible ones are
+	// also past the grace period
+	Outdated   int     `json:"outdated"`
+	Ineligible int     `json:"ineligible"`
+	Versions   []Count `json:"versions"`
+	Networks   []Count `json:"networks"`
+	// Platforms are os/arch pairs
+	Platforms []Count `json:"platforms"`
+}
+
+// Unknown stands for a value a client did not report
+const Unknown = "unknown"
+
+// Summarize builds the distribution over every client in lastHeartbeats.
+// Outdated is judged by the policy rather than the stored flag, so raising
+// the minimum shows up before clients next heartbeat.
+func (p Policy) Summarize(clientVersions map[string]database.ClientVersion, lastHeartbeats map[string]time.Time, now time.Time) Distribution {
+	dist := Distribution{Clients: len(lastHeartbeats)}
+	if p.Minimum != nil {
+		dist.MinimumVersion = p.Minimum.String()
+	}
+
+	versions := make(map[string]*Count)
+	networks := make(map[string]*Count)
+	platforms := make(map[string]*Count)
+	add := func(counts map[string]*Count, value string, active bool) {
+		if value == "" {
+			value = Unknown
+		}
+		count, ok := counts[value]
+		if !ok {
+			count = &Count{Value: value}
+			counts[value] = count
+		}
+		count.Clients++
+		if active {
+			count.Active++
+		}
+	}
+
+	for address, lastHeartbeat := range lastHeartbeats {
+		active := now.Sub(lastHeartbeat) < database.InactiveAfter
+		version := clientVersions[address]
+		add(versions, version.Version, active)
+		add(networks, version.Network, active)
+
+		platform := ""
+		if version.OS != "" || version.Arch != "" {
+			platform = orUnknown(version.OS) + "/" + orUnknown(version.Arch)
+		}
+		add(platforms, platform, active)
+
+		if p.Outdated(version.Version) {
+			dist.Outdated++
+			if version.Outdated && !version.RewardEligible {
+				dist.Ineligible++
+			}
+		}
+	}
+
+	dist.Versions = sortCounts(versions, newestFirst)
+	dist.Networks = sortCounts(networks, mostClients)
+	dist.Platforms = sortCounts(platforms, mostClients)
+	return dist
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return Unknown
+	}
+	return s
+}
+
+// newestFirst orders versions from newest to oldest, with values that are
+// not a version last
+func newestFirst(a, b Count) bool {
+	va, errA := Parse(a.Value)
+	vb, errB := Parse(b.Value)
+	if errA != nil || errB != nil {
+		if (errA == nil) != (errB == nil) {
+			return errA == nil
+		}
+		return a.Value < b.Value
+	}
+	return va.Compare(vb) > 0
+}
+
+// mostClients orders by client count, then by value
+func mostClients(a, b Count) bool {
+	if a.Clients != b.Clients {
+		return a.Clients > b.Clients
+	}
+	return a.Value < b.Value
+}
+
+func sortCounts(counts map[string]*Count, less func(a, b Count) bool) []Count {
+	sorted := make([]Count, 0, len(counts))
+	for _, count := range counts {
+		sorted = append(sorted, *count)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	return sorted
+}
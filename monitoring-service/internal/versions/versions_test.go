@@ -0,0 +1,334 @@
+package versions
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"monitoring-service/internal/database"
+)
+
+var start = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Version
+		wantErr bool
+	}{
+		{in: "1.12.0", want: Version{Major: 1, Minor: 12}},
+		{in: "v1.12.3", want: Version{Major: 1, Minor: 12, Patch: 3}},
+		{in: "1.12.0-rc.1", want: Version{Major: 1, Minor: 12, Pre: "rc.1"}},
+		// Build metadata is dropped
+		{in: "1.12.0+linux.amd64", want: Version{Major: 1, Minor: 12}},
+		{in: "1.12.0-rc.1+build-5", want: Version{Major: 1, Minor: 12, Pre: "rc.1"}},
+		{in: "1.12", wantErr: true},
+		{in: "1.12.0.1", wantErr: true},
+		{in: "1.12.0-", wantErr: true},
+		{in: "1.12.0+", wantErr: true},
+		{in: "1.x.0", wantErr: true},
+		{in: "V1.12.0", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Parse = %+v, %v; want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	// Each version is older than the next, as in the semver spec's example
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := range ordered {
+		for j := range ordered {
+			a, b := mustParse(t, ordered[i]), mustParse(t, ordered[j])
+			if got, want := a.Compare(b), compareInts(i, j); got != want {
+				t.Errorf("%s compared to %s = %d, want %d", ordered[i], ordered[j], got, want)
+			}
+		}
+	}
+
+	// Build metadata does not order versions
+	if c := mustParse(t, "1.0.0+a").Compare(mustParse(t, "v1.0.0+b")); c != 0 {
+		t.Errorf("1.0.0+a compared to v1.0.0+b = %d, want 0", c)
+	}
+}
+
+func mustParse(t *testing.T, s string) Version {
+	t.Helper()
+	v, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", s, err)
+	}
+	return v
+}
+
+func TestReportValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		report  Report
+		wantErr bool
+	}{
+		{name: "Empty", report: Report{}},
+		{name: "Full", report: Report{Version: "v1.12.0-rc.1+abc", Network: "mainnet", OS: "linux", Arch: "x86_64"}},
+		{name: "InvalidVersion", report: Report{Version: "latest"}, wantErr: true},
+		{name: "InvalidNetwork", report: Report{Network: "main net"}, wantErr: true},
+		{name: "LongArch", report: Report{Arch: "a123456789012345678901234567890123"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.report.Validate()
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Validate = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidReport) {
+				t.Errorf("Validate = %v, want ErrInvalidReport", err)
+			}
+		})
+	}
+}
+
+func TestOutdated(t *testing.T) {
+	tests := []struct {
+		minimum string
+		version string
+		want    bool
+	}{
+		{minimum: "", version: "0.1.0", want: false},
+		{minimum: "", version: "", want: false},
+		{minimum: "1.12.0", version: "1.12.0", want: false},
+		{minimum: "1.12.0", version: "v1.13.0+build", want: false},
+		{minimum: "1.12.0", version: "1.11.9", want: true},
+		// A release candidate of the minimum is below it
+		{minimum: "1.12.0", version: "1.12.0-rc.3", want: true},
+		{minimum: "1.12.0-rc.2", version: "1.12.0-rc.10", want: false},
+		// Clients that report no version, or a malformed one, are outdated
+		{minimum: "1.12.0", version: "", want: true},
+		{minimum: "1.12.0", version: "unknown", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.minimum+"/"+tt.version, func(t *testing.T) {
+			policy, err := NewPolicy(tt.minimum, DefaultGracePeriod)
+			if err != nil {
+				t.Fatalf("NewPolicy: %v", err)
+			}
+			if got := policy.Outdated(tt.version); got != tt.want {
+				t.Errorf("Outdated = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewPolicy("1.12", DefaultGracePeriod); err == nil {
+		t.Error("NewPolicy accepted 1.12")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	policy, err := NewPolicy("1.12.0", 24*time.Hour)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	outdatedAt := func(at time.Duration) *database.ClientVersion {
+		since := start.Add(at)
+		return &database.ClientVersion{Version: "1.11.0", Outdated: true, OutdatedSince: &since, RewardEligible: true}
+	}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		report   Report
+		previous *database.ClientVersion
+		at       time.Duration
+
+		// want is nil for no version stored. Its ReportedAt is set to the
+		// heartbeat's time.
+		want *database.ClientVersion
+		// wantSince is when the client became outdated, if it is
+		wantSince time.Duration
+	}{
+		{
+			name:   "NoMinimumNoReport",
+			policy: Policy{},
+		},
+		{
+			name:   "NoMinimum",
+			policy: Policy{},
+			report: Report{Version: "0.1.0", Network: "Mainnet", OS: "Linux", Arch: "AMD64"},
+			want:   &database.ClientVersion{Version: "0.1.0", Network: "mainnet", OS: "linux", Arch: "amd64", RewardEligible: true},
+		},
+		{
+			name:   "Current",
+			policy: policy,
+			report: Report{Version: "v1.12.0+abc", Network: "mainnet"},
+			want:   &database.ClientVersion{Version: "1.12.0+abc", Network: "mainnet", RewardEligible: true},
+		},
+		{
+			// The minimum is the same whichever network the client runs on
+			name:   "OutdatedOnTestnet",
+			policy: policy,
+			report: Report{Version: "1.11.0", Network: "turing"},
+			want:   &database.ClientVersion{Version: "1.11.0", Network: "turing", Outdated: true, RewardEligible: true},
+		},
+		{
+			name:   "OutdatedOnMainnet",
+			policy: policy,
+			report: Report{Version: "1.11.0", Network: "mainnet"},
+			want:   &database.ClientVersion{Version: "1.11.0", Network: "mainnet", Outdated: true, RewardEligible: true},
+		},
+		{
+			// A client that stops reporting its version is held to the
+			// minimum too
+			name:   "NoReportWithMinimum",
+			policy: policy,
+			want:   &database.ClientVersion{Outdated: true, RewardEligible: true},
+		},
+		{
+			name:      "GraceStarts",
+			policy:    policy,
+			report:    Report{Version: "1.11.0"},
+			previous:  &database.ClientVersion{Version: "1.12.0", RewardEligible: true},
+			at:        time.Hour,
+			want:      &database.ClientVersion{Version: "1.11.0", Outdated: true, RewardEligible: true},
+			wantSince: time.Hour,
+		},
+		{
+			// The grace period runs from the first outdated heartbeat
+			name:     "InGrace",
+			policy:   policy,
+			report:   Report{Version: "1.11.0"},
+			previous: outdatedAt(0),
+			at:       24*time.Hour - time.Second,
+			want:     &database.ClientVersion{Version: "1.11.0", Outdated: true, RewardEligible: true},
+		},
+		{
+			name:     "GraceExpires",
+			policy:   policy,
+			report:   Report{Version: "1.11.0"},
+			previous: outdatedAt(0),
+			at:       24 * time.Hour,
+			want:     &database.ClientVersion{Version: "1.11.0", Outdated: true},
+		},
+		{
+			// Moving to another outdated version does not restart the grace
+			// period
+			name:      "GraceKeptAcrossVersions",
+			policy:    policy,
+			report:    Report{Version: "1.10.0"},
+			previous:  outdatedAt(-23 * time.Hour),
+			at:        2 * time.Hour,
+			want:      &database.ClientVersion{Version: "1.10.0", Outdated: true},
+			wantSince: -23 * time.Hour,
+		},
+		{
+			name:     "UpgradeRestoresEligibility",
+			policy:   policy,
+			report:   Report{Version: "1.12.1"},
+			previous: outdatedAt(-48 * time.Hour),
+			want:     &database.ClientVersion{Version: "1.12.1", RewardEligible: true},
+		},
+		{
+			name:   "NoGracePeriod",
+			policy: Policy{Minimum: policy.Minimum},
+			report: Report{Version: "1.11.0"},
+			want:   &database.ClientVersion{Version: "1.11.0", Outdated: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start.Add(tt.at)
+			got := tt.policy.Evaluate(tt.report, tt.previous, now)
+
+			want := tt.want
+			if want != nil {
+				copied := *want
+				copied.ReportedAt = now
+				if copied.Outdated {
+					since := start.Add(tt.wantSince)
+					copied.OutdatedSince = &since
+				}
+				want = &copied
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Evaluate = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	policy, err := NewPolicy("1.12.0", DefaultGracePeriod)
+	if err != nil {
+		t.Fatalf("NewPolicy: %v", err)
+	}
+	now := start
+	active, inactive := now.Add(-time.Minute), now.Add(-database.InactiveAfter)
+
+	dist := policy.Summarize(
+		map[string]database.ClientVersion{
+			"0xa": {Version: "1.12.0", Network: "mainnet", OS: "linux", Arch: "amd64"},
+			"0xb": {Version: "1.13.0-rc.1", Network: "mainnet", OS: "linux", Arch: "amd64"},
+			"0xc": {Version: "1.11.0", Network: "turing", OS: "darwin", Outdated: true, RewardEligible: true},
+			"0xd": {Version: "1.11.0", Network: "turing", Outdated: true},
+		},
+		map[string]time.Time{"0xa": active, "0xb": active, "0xc": inactive, "0xd": active, "0xe": active},
+		now,
+	)
+
+	if dist.MinimumVersion != "1.12.0" || dist.Clients != 5 || dist.Outdated != 3 || dist.Ineligible != 1 {
+		t.Errorf("summary = minimum %s, %d clients, %d outdated, %d ineligible; want 1.12.0, 5, 3, 1",
+			dist.MinimumVersion, dist.Clients, dist.Outdated, dist.Ineligible)
+	}
+	wantVersions := []Count{
+		{Value: "1.13.0-rc.1", Clients: 1, Active: 1},
+		{Value: "1.12.0", Clients: 1, Active: 1},
+		{Value: "1.11.0", Clients: 2, Active: 1},
+		{Value: Unknown, Clients: 1, Active: 1},
+	}
+	if !reflect.DeepEqual(dist.Versions, wantVersions) {
+		t.Errorf("versions = %+v, want %+v", dist.Versions, wantVersions)
+	}
+	wantNetworks := []Count{
+		{Value: "mainnet", Clients: 2, Active: 2},
+		{Value: "turing", Clients: 2, Active: 1},
+		{Value: Unknown, Clients: 1, Active: 1},
+	}
+	if !reflect.DeepEqual(dist.Networks, wantNetworks) {
+		t.Errorf("networks = %+v, want %+v", dist.Networks, wantNetworks)
+	}
+	wantPlatforms := []Count{
+		{Value: "linux/amd64", Clients: 2, Active: 2},
+		{Value: Unknown, Clients: 2, Active: 2},
+		{Value: "darwin/" + Unknown, Clients: 1},
+	}
+	if !reflect.DeepEqual(dist.Platforms, wantPlatforms) {
+		t.Errorf("platforms = %+v, want %+v", dist.Platforms, wantPlatforms)
+	}
+}
@@ -3,89 +3,626 @@ package config
 import (
 	"encoding/hex"
 	"errors"
+	"fmt"
+	"log/slog"
 	"os"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/joho/godotenv"
+	"monitoring-service/internal/auth"
+	"monitoring-service/internal/logging"
+	"monitoring-service/internal/tracing"
+	"monitoring-service/internal/uptime"
+	"monitoring-service/internal/versions"
 )
 
 type Config struct {
-	Port                 string
-	MongoURI             string
+	Port     string
+	MongoURI string
+	// MongoDB, RpcURL, NFTContractAddr, DelegateContractAddr and Rights
+	// belong to the network NetworkID, the default network unless the
+	// config came from ForNetwork
 	MongoDB              string
 	RpcURL               string
 	NFTContractAddr      string
 	DelegateContractAddr string
 	Rights               []byte
-	CheckNFTInterval     int
+	NetworkID            string
+	// Networks are every network the service monitors, the default first
+	Networks         []Network
+	CheckNFTInterval int
+	RankingWeights   RankingWeights
+	// AutoMigrate applies pending schema migrations at startup
+	AutoMigrate bool
+	// HeartbeatRetentionDays is how long raw heartbeats are kept before they
+	// are compacted into per-interval coverage. 0 keeps them forever.
+	HeartbeatRetentionDays int
+	// AdminAPIKeys and AdminJWTSecret authenticate the admin API. Without
+	// either, every admin request is rejected.
+	AdminAPIKeys   []auth.APIKey
+	AdminJWTSecret []byte
+	// Blocklist addresses may not register. With a non-empty Allowlist only
+	// the addresses on it may register.
+	Blocklist []string
+	Allowlist []string
+	// TrustForwardedFor takes the client IP from X-Forwarded-For, for
+	// deployments behind a proxy that sets it
+	TrustForwardedFor bool
+	// SybilMinClusterSize is how many operators must share a delegator set or
+	// an IP address before they are flagged for review
+	SybilMinClusterSize int
+	// RateLimit throttles heartbeat ingestion per address and per IP
+	RateLimit RateLimitConfig
+	// AvailRPCURL is the Avail node heartbeat liveness reports are checked
+	// against. Without it reports are stored unverified.
+	AvailRPCURL string
+	// AvailMaxBlockLag is how many blocks a light client may trail the
+	// finalized head before it is Degraded
+	AvailMaxBlockLag uint64
+	// ProbeIntervalSeconds is how often registered light client APIs are
+	// probed. 0 disables probing.
+	ProbeIntervalSeconds int
+	ProbeTimeoutSeconds  int
+	// ProbeAllowPrivate lets probes reach private and loopback addresses
+	ProbeAllowPrivate bool
+	// UptimePolicy decides whether pushed heartbeats, probes or both count
+	// towards uptime
+	UptimePolicy uptime.Policy
+	// VersionPolicy is the minimum light client version that earns rewards
+	// and the grace period outdated clients get to upgrade
+	VersionPolicy versions.Policy
+	// LogLevel is the lowest level logged
+	LogLevel slog.Level
+	// Tracing sets where OpenTelemetry spans are exported
+	Tracing tracing.Config
+	// DBTimeout bounds each database operation, and ChainTimeout each chain
+	// read with its retries. Requests that run out of time fail with 504.
+	DBTimeout    time.Duration
+	ChainTimeout time.Duration
+	// ReadyMaxBlockAge is how long the RPC's latest block number may stand
+	// still before /readyz reports the service not ready
+	ReadyMaxBlockAge time.Duration
 }
 
+// Network is one chain and license program the service monitors. Each
+// network has its own database, so its clients, heartbeats and rewards are
+// kept apart from the others'.
+type Network struct {
+	ID                   string
+	MongoDB              string
+	RpcURL               string
+	NFTContractAddr      string
+	DelegateContractAddr string
+	Rights               []byte
+}
+
+// DefaultNetworkID names the single network configured without NETWORKS
+const DefaultNetworkID = "default"
+
+// RightsLength is the size of the bytes32 rights the delegation contract
+// checks
+const RightsLength = 32
+
+var networkIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// ForNetwork returns a copy of the config with the network fields set from
+// the network with the given ID
+func (c *Config) ForNetwork(id string) (*Config, error) {
+	for _, network := range c.Networks {
+		if network.ID != id {
+			continue
+		}
+		scoped := *c
+		scoped.NetworkID = network.ID
+		scoped.MongoDB = network.MongoDB
+		scoped.RpcURL = network.RpcURL
+		scoped.NFTContractAddr = network.NFTContractAddr
+		scoped.DelegateContractAddr = network.DelegateContractAddr
+		scoped.Rights = network.Rights
+		return &scoped, nil
+	}
+	return nil, fmt.Errorf("unknown network %q", id)
+}
+
+// loadNetworks reads the network profiles. NETWORKS is a comma separated
+// list of IDs, each configured by NETWORK_<ID>_RPC_URL and the other
+// network variables, and stored in NETWORK_<ID>_MONGO_DB, by default
+// <MONGO_DB>_<id>. Without NETWORKS the unprefixed variables configure a
+// single network stored in MONGO_DB.
+func loadNetworks(s *settings, mongoDB string) ([]Network, error) {
+	value := s.get("NETWORKS")
+	if value == "" {
+		id := s.get("NETWORK_ID")
+		if id == "" {
+			id = DefaultNetworkID
+		}
+		if !networkIDPattern.MatchString(id) {
+			return nil, errors.New("invalid NETWORK_ID, expected lowercase letters, digits and dashes")
+		}
+		network, err := loadNetwork(s, id, "", mongoDB)
+		if err != nil {
+			return nil, err
+		}
+		return []Network{network}, nil
+	}
+
+	var networks []Network
+	seen := make(map[string]bool)
+	for _, id := range strings.Split(value, ",") {
+		id = strings.TrimSpace(id)
+		if !networkIDPattern.MatchString(id) {
+			return nil, errors.New("invalid NETWORKS, expected comma separated IDs of lowercase letters, digits and dashes")
+		}
+		if seen[id] {
+			return nil, errors.New("network " + id + " is listed twice in NETWORKS")
+		}
+		seen[id] = true
+
+		prefix := networkEnvPrefix(id)
+		networkDB := s.get(prefix + "MONGO_DB")
+		if networkDB == "" {
+			networkDB = mongoDB + "_" + id
+		}
+		network, err := loadNetwork(s, id, prefix, networkDB)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// loadNetwork reads one network's chain settings from the variables with
+// the given prefix
+func loadNetwork(s *settings, id, prefix, mongoDB string) (Network, error) {
+	network := Network{ID: id, MongoDB: mongoDB}
+	for _, setting := range []struct {
+		env   string
+		value *string
+	}{
+		{"RPC_URL", &network.RpcURL},
+		{"NFT_CONTRACT_ADDRESS", &network.NFTContractAddr},
+		{"DELEGATE_CONTRACT_ADDRESS", &network.DelegateContractAddr},
+	} {
+		*setting.value = s.get(prefix + setting.env)
+		if *setting.value == "" {
+			return Network{}, errors.New(prefix + setting.env + " environment variable is required")
+		}
+	}
+	for _, contract := range []struct {
+		env     string
+		address string
+	}{
+		{"NFT_CONTRACT_ADDRESS", network.NFTContractAddr},
+		{"DELEGATE_CONTRACT_ADDRESS", network.DelegateContractAddr},
+	} {
+		if err := validateAddress(contract.address); err != nil {
+			return Network{}, fmt.Errorf("invalid %s%s: %v", prefix, contract.env, err)
+		}
+	}
+
+	rights := s.get(prefix + "RIGHTS")
+	if rights == "" {
+		return Network{}, errors.New(prefix + "RIGHTS environment variable is required")
+	}
+
+	// Remove 0x prefix if present
+	if len(rights) >= 2 && rights[:2] == "0x" {
+		rights = rights[2:]
+	}
+
+	rightsBytes, err := hex.DecodeString(rights)
+	if err != nil {
+		return Network{}, errors.New("invalid " + prefix + "RIGHTS format")
+	}
+	if len(rightsBytes) != RightsLength {
+		return Network{}, fmt.Errorf("%sRIGHTS must be exactly %d bytes, got %d", prefix, RightsLength, len(rightsBytes))
+	}
+	network.Rights = rightsBytes
+	return network, nil
+}
+
+// RateLimitConfig sets the token buckets for /check-nft. A rate of 0
+// disables that limit.
+type RateLimitConfig struct {
+	AddressPerMinute float64
+	AddressBurst     int
+	IPPerMinute      float64
+	IPBurst          int
+	// Shared keeps the buckets in MongoDB so replicas enforce one limit
+	Shared bool
+}
+
+// MinAdminJWTSecretLength is the shortest HS256 secret accepted, in bytes
+const MinAdminJWTSecretLength = 32
+
+// MinHeartbeatRetentionDays keeps the raw heartbeats that the weekly incident
+// and commission history are computed from
+const MinHeartbeatRetentionDays = 8
+
+// RankingWeights sets how much each component counts towards an operator's
+// ranking score. Weights are relative and need not sum to 1.
+type RankingWeights struct {
+	WeeklyUptime        float64 `json:"weekly_uptime"`
+	AllTimeUptime       float64 `json:"all_time_uptime"`
+	Commission          float64 `json:"commission"`
+	CommissionStability float64 `json:"commission_stability"`
+	Incidents           float64 `json:"incidents"`
+}
+
+// LoadConfig reads the config from the environment and from the YAML file
+// named by CONFIG_FILE, if any. Environment variables override the file.
 func LoadConfig() (*Config, error) {
 	godotenv.Load()
 
-	port := os.Getenv("PORT")
+	s, err := newSettings(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := load(s)
+	if err != nil {
+		return nil, s.explain(err)
+	}
+	if err := s.unused(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func load(s *settings) (*Config, error) {
+	port := s.get("PORT")
 	if port == "" {
 		port = ":8080" // default port
 	}
 
-	mongoURI := os.Getenv("MONGO_URI")
+	mongoURI := s.get("MONGO_URI")
 	if mongoURI == "" {
 		return nil, errors.New("MONGO_URI environment variable is required")
 	}
 
-	mongoDB := os.Getenv("MONGO_DB")
+	mongoDB := s.get("MONGO_DB")
 	if mongoDB == "" {
 		return nil, errors.New("MONGO_DB environment variable is required")
 	}
 
-	rpcURL := os.Getenv("RPC_URL")
-	if rpcURL == "" {
-		return nil, errors.New("RPC_URL environment variable is required")
+	networks, err := loadNetworks(s, mongoDB)
+	if err != nil {
+		return nil, err
 	}
+	defaultNetwork := networks[0]
 
-	nftContractAddr := os.Getenv("NFT_CONTRACT_ADDRESS")
-	if nftContractAddr == "" {
-		return nil, errors.New("NFT_CONTRACT_ADDRESS environment variable is required")
+	checkNFTInterval := s.get("CHECK_NFT_INTERVAL")
+	if checkNFTInterval == "" {
+		return nil, errors.New("CHECK_NFT_INTERVAL environment variable is required")
 	}
 
-	delegateContractAddr := os.Getenv("DELEGATE_CONTRACT_ADDRESS")
-	if delegateContractAddr == "" {
-		return nil, errors.New("DELEGATE_CONTRACT_ADDRESS environment variable is required")
+	checkNFTIntervalInt, err := strconv.Atoi(checkNFTInterval)
+	if err != nil {
+		return nil, errors.New("invalid CHECK_NFT_INTERVAL format")
+	}
+	if checkNFTIntervalInt < 1 {
+		return nil, errors.New("CHECK_NFT_INTERVAL must be at least 1 minute")
 	}
 
-	rights := os.Getenv("RIGHTS")
-	if rights == "" {
-		return nil, errors.New("RIGHTS environment variable is required")
+	rankingWeights := RankingWeights{}
+	for _, weight := range []struct {
+		env          string
+		value        *float64
+		defaultValue float64
+	}{
+		{"RANKING_WEIGHT_WEEKLY_UPTIME", &rankingWeights.WeeklyUptime, 0.35},
+		{"RANKING_WEIGHT_ALL_TIME_UPTIME", &rankingWeights.AllTimeUptime, 0.2},
+		{"RANKING_WEIGHT_COMMISSION", &rankingWeights.Commission, 0.2},
+		{"RANKING_WEIGHT_COMMISSION_STABILITY", &rankingWeights.CommissionStability, 0.1},
+		{"RANKING_WEIGHT_INCIDENTS", &rankingWeights.Incidents, 0.15},
+	} {
+		*weight.value = weight.defaultValue
+		if value := s.get(weight.env); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 {
+				return nil, errors.New("invalid " + weight.env + " format")
+			}
+			*weight.value = parsed
+		}
 	}
 
-	// Remove 0x prefix if present
-	if len(rights) >= 2 && rights[:2] == "0x" {
-		rights = rights[2:]
+	autoMigrate := true
+	if value := s.get("AUTO_MIGRATE"); value != "" {
+		autoMigrate, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("invalid AUTO_MIGRATE format")
+		}
 	}
 
-	rightsBytes, err := hex.DecodeString(rights)
+	heartbeatRetentionDays := 0
+	if value := s.get("HEARTBEAT_RETENTION_DAYS"); value != "" {
+		heartbeatRetentionDays, err = strconv.Atoi(value)
+		if err != nil || heartbeatRetentionDays < 0 {
+			return nil, errors.New("invalid HEARTBEAT_RETENTION_DAYS format")
+		}
+		if heartbeatRetentionDays > 0 && heartbeatRetentionDays < MinHeartbeatRetentionDays {
+			return nil, errors.New("HEARTBEAT_RETENTION_DAYS must be 0 or at least " + strconv.Itoa(MinHeartbeatRetentionDays))
+		}
+	}
+
+	// ADMIN_API_KEYS is a comma separated list of name:role:key
+	var adminAPIKeys []auth.APIKey
+	if value := s.get("ADMIN_API_KEYS"); value != "" {
+		for _, entry := range strings.Split(value, ",") {
+			fields := strings.SplitN(strings.TrimSpace(entry), ":", 3)
+			if len(fields) != 3 || fields[0] == "" || fields[2] == "" {
+				return nil, errors.New("invalid ADMIN_API_KEYS format, expected name:role:key")
+			}
+			role, err := auth.ParseRole(fields[1])
+			if err != nil {
+				return nil, errors.New("invalid ADMIN_API_KEYS role for " + fields[0])
+			}
+			adminAPIKeys = append(adminAPIKeys, auth.APIKey{Name: fields[0], Role: role, Key: fields[2]})
+		}
+	}
+
+	var adminJWTSecret []byte
+	if value := s.get("ADMIN_JWT_SECRET"); value != "" {
+		if len(value) < MinAdminJWTSecretLength {
+			return nil, errors.New("ADMIN_JWT_SECRET must be at least " + strconv.Itoa(MinAdminJWTSecretLength) + " bytes")
+		}
+		adminJWTSecret = []byte(value)
+	}
+
+	blocklist, err := parseAddressList(s, "BLOCKLIST")
 	if err != nil {
-		return nil, errors.New("invalid RIGHTS format")
+		return nil, err
+	}
+	allowlist, err := parseAddressList(s, "ALLOWLIST")
+	if err != nil {
+		return nil, err
 	}
 
-	checkNFTInterval := os.Getenv("CHECK_NFT_INTERVAL")
-	if checkNFTInterval == "" {
-		return nil, errors.New("CHECK_NFT_INTERVAL environment variable is required")
+	trustForwardedFor := false
+	if value := s.get("TRUST_FORWARDED_FOR"); value != "" {
+		trustForwardedFor, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("invalid TRUST_FORWARDED_FOR format")
+		}
 	}
 
-	checkNFTIntervalInt, err := strconv.Atoi(checkNFTInterval)
+	sybilMinClusterSize := 2
+	if value := s.get("SYBIL_MIN_CLUSTER_SIZE"); value != "" {
+		sybilMinClusterSize, err = strconv.Atoi(value)
+		if err != nil || sybilMinClusterSize < 2 {
+			return nil, errors.New("invalid SYBIL_MIN_CLUSTER_SIZE format, must be at least 2")
+		}
+	}
+
+	// By default an address may send one heartbeat per interval, with a
+	// second one allowed for clock jitter
+	rateLimit := RateLimitConfig{
+		AddressPerMinute: 1 / float64(checkNFTIntervalInt),
+		AddressBurst:     2,
+		IPPerMinute:      60,
+		IPBurst:          60,
+	}
+	for _, limit := range []struct {
+		env   string
+		value *float64
+	}{
+		{"RATE_LIMIT_ADDRESS_PER_MINUTE", &rateLimit.AddressPerMinute},
+		{"RATE_LIMIT_IP_PER_MINUTE", &rateLimit.IPPerMinute},
+	} {
+		if value := s.get(limit.env); value != "" {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil || parsed < 0 {
+				return nil, errors.New("invalid " + limit.env + " format")
+			}
+			*limit.value = parsed
+		}
+	}
+	for _, burst := range []struct {
+		env   string
+		value *int
+	}{
+		{"RATE_LIMIT_ADDRESS_BURST", &rateLimit.AddressBurst},
+		{"RATE_LIMIT_IP_BURST", &rateLimit.IPBurst},
+	} {
+		if value := s.get(burst.env); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				return nil, errors.New("invalid " + burst.env + " format, must be at least 1")
+			}
+			*burst.value = parsed
+		}
+	}
+	if value := s.get("RATE_LIMIT_SHARED"); value != "" {
+		rateLimit.Shared, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("invalid RATE_LIMIT_SHARED format")
+		}
+	}
+
+	availMaxBlockLag := uint64(20)
+	if value := s.get("AVAIL_MAX_BLOCK_LAG"); value != "" {
+		availMaxBlockLag, err = strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid AVAIL_MAX_BLOCK_LAG format")
+		}
+	}
+
+	probeIntervalSeconds, probeTimeoutSeconds := 0, 10
+	for _, setting := range []struct {
+		env   string
+		value *int
+	}{
+		{"PROBE_INTERVAL_SECONDS", &probeIntervalSeconds},
+		{"PROBE_TIMEOUT_SECONDS", &probeTimeoutSeconds},
+	} {
+		if value := s.get(setting.env); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return nil, errors.New("invalid " + setting.env + " format")
+			}
+			*setting.value = parsed
+		}
+	}
+	if probeTimeoutSeconds == 0 {
+		return nil, errors.New("PROBE_TIMEOUT_SECONDS must be at least 1")
+	}
+
+	probeAllowPrivate := false
+	if value := s.get("PROBE_ALLOW_PRIVATE"); value != "" {
+		probeAllowPrivate, err = strconv.ParseBool(value)
+		if err != nil {
+			return nil, errors.New("invalid PROBE_ALLOW_PRIVATE format")
+		}
+	}
+
+	uptimePolicy := uptime.PolicyPush
+	if value := s.get("UPTIME_POLICY"); value != "" {
+		uptimePolicy, err = uptime.ParsePolicy(value)
+		if err != nil {
+			return nil, errors.New("invalid UPTIME_POLICY, expected push, pull, either or both")
+		}
+	}
+
+	versionGracePeriod := versions.DefaultGracePeriod
+	if value := s.get("VERSION_GRACE_PERIOD_HOURS"); value != "" {
+		hours, err := strconv.Atoi(value)
+		if err != nil || hours < 0 {
+			return nil, errors.New("invalid VERSION_GRACE_PERIOD_HOURS format")
+		}
+		versionGracePeriod = time.Duration(hours) * time.Hour
+	}
+	versionPolicy, err := versions.NewPolicy(s.get("MIN_CLIENT_VERSION"), versionGracePeriod)
 	if err != nil {
-		return nil, errors.New("invalid CHECK_NFT_INTERVAL format")
+		return nil, errors.New("invalid MIN_CLIENT_VERSION, expected a semantic version such as 1.12.0")
+	}
+
+	logLevel := slog.LevelInfo
+	if value := s.get("LOG_LEVEL"); value != "" {
+		logLevel, err = logging.ParseLevel(value)
+		if err != nil {
+			return nil, errors.New("invalid LOG_LEVEL, expected debug, info, warn or error")
+		}
+	}
+
+	tracingConfig := tracing.Config{Exporter: tracing.ExporterNone, File: s.get("TRACING_FILE"), SampleRatio: 1}
+	if value := s.get("TRACING_EXPORTER"); value != "" {
+		tracingConfig.Exporter = strings.ToLower(value)
+	}
+	switch tracingConfig.Exporter {
+	case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+	case tracing.ExporterFile:
+		if tracingConfig.File == "" {
+			return nil, errors.New("TRACING_FILE is required with TRACING_EXPORTER=file")
+		}
+	default:
+		return nil, errors.New("invalid TRACING_EXPORTER, expected none, stdout, file or otlp")
+	}
+	if value := s.get("TRACING_SAMPLE_RATIO"); value != "" {
+		tracingConfig.SampleRatio, err = strconv.ParseFloat(value, 64)
+		if err != nil || tracingConfig.SampleRatio < 0 || tracingConfig.SampleRatio > 1 {
+			return nil, errors.New("invalid TRACING_SAMPLE_RATIO, expected a number from 0 to 1")
+		}
+	}
+
+	dbTimeout, chainTimeout, readyMaxBlockAge := 5*time.Second, 10*time.Second, time.Minute
+	for _, setting := range []struct {
+		env   string
+		value *time.Duration
+	}{
+		{"DB_TIMEOUT_SECONDS", &dbTimeout},
+		{"CHAIN_TIMEOUT_SECONDS", &chainTimeout},
+		{"READY_MAX_BLOCK_AGE_SECONDS", &readyMaxBlockAge},
+	} {
+		if value := s.get(setting.env); value != "" {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds < 1 {
+				return nil, errors.New(setting.env + " must be a whole number of seconds, at least 1")
+			}
+			*setting.value = time.Duration(seconds) * time.Second
+		}
 	}
 
 	return &Config{
 		Port:                 port,
 		MongoURI:             mongoURI,
-		MongoDB:              mongoDB,
-		RpcURL:               rpcURL,
-		NFTContractAddr:      nftContractAddr,
-		DelegateContractAddr: delegateContractAddr,
-		Rights:               rightsBytes,
+		MongoDB:              defaultNetwork.MongoDB,
+		RpcURL:               defaultNetwork.RpcURL,
+		NFTContractAddr:      defaultNetwork.NFTContractAddr,
+		DelegateContractAddr: defaultNetwork.DelegateContractAddr,
+		Rights:               defaultNetwork.Rights,
+		NetworkID:            defaultNetwork.ID,
+		Networks:             networks,
 		CheckNFTInterval:     checkNFTIntervalInt,
+		RankingWeights:       rankingWeights,
+		AutoMigrate:          autoMigrate,
+
+		HeartbeatRetentionDays: heartbeatRetentionDays,
+		AdminAPIKeys:           adminAPIKeys,
+		AdminJWTSecret:         adminJWTSecret,
+		Blocklist:              blocklist,
+		Allowlist:              allowlist,
+		TrustForwardedFor:      trustForwardedFor,
+		SybilMinClusterSize:    sybilMinClusterSize,
+		RateLimit:              rateLimit,
+		AvailRPCURL:            s.get("AVAIL_RPC_URL"),
+		AvailMaxBlockLag:       availMaxBlockLag,
+		ProbeIntervalSeconds:   probeIntervalSeconds,
+		ProbeTimeoutSeconds:    probeTimeoutSeconds,
+		ProbeAllowPrivate:      probeAllowPrivate,
+		UptimePolicy:           uptimePolicy,
+		VersionPolicy:          versionPolicy,
+		LogLevel:               logLevel,
+		Tracing:                tracingConfig,
+		DBTimeout:              dbTimeout,
+		ChainTimeout:           chainTimeout,
+		ReadyMaxBlockAge:       readyMaxBlockAge,
 	}, nil
 }
+
+// parseAddressList reads a comma separated list of EVM addresses from env
+func parseAddressList(s *settings, env string) ([]string, error) {
+	value := s.get(env)
+	if value == "" {
+		return nil, nil
+	}
+
+	var addresses []string
+	for _, entry := range strings.Split(value, ",") {
+		address := strings.TrimSpace(entry)
+		if address == "" {
+			continue
+		}
+		if err := validateAddress(address); err != nil {
+			return nil, fmt.Errorf("invalid %s address %s: %v", env, address, err)
+		}
+		addresses = append(addresses, strings.ToLower(address))
+	}
+	return addresses, nil
+}
+
+// validateAddress checks that address is a 0x prefixed EVM address. Mixed
+// case addresses must carry a valid EIP-55 checksum, which catches most
+// typos; all lower or all upper case ones have no checksum to check.
+func validateAddress(address string) error {
+	if !strings.HasPrefix(address, "0x") || !common.IsHexAddress(address) {
+		return errors.New("expected a 0x prefixed 20 byte hex address")
+	}
+	digits := address[2:]
+	if digits == strings.ToLower(digits) || digits == strings.ToUpper(digits) {
+		return nil
+	}
+	if checksummed := common.HexToAddress(address).Hex(); checksummed != address {
+		return fmt.Errorf("checksum mismatch, expected %s", checksummed)
+	}
+	return nil
+}
+
+// networkEnvPrefix is the prefix of the variables configuring a network
+// listed in NETWORKS
+func networkEnvPrefix(id string) string {
+	return "NETWORK_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_")) + "_"
+}
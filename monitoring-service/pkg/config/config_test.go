@@ -0,0 +1,465 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"monitoring-service/internal/auth"
+)
+
+const (
+	testNFTContract = "0x00000000000000000000000000000000000e1155"
+	testRegistry    = "0x00000000000000447e69651d841bd8d104bed493"
+	testRights      = "0x0000000000000000000000000000000000000000000000000000000000000001"
+)
+
+// testEnv is a minimal valid environment
+var testEnv = map[string]string{
+	"MONGO_URI":                 "mongodb://localhost:27017",
+	"MONGO_DB":                  "test",
+	"RPC_URL":                   "http://localhost:8545",
+	"NFT_CONTRACT_ADDRESS":      testNFTContract,
+	"DELEGATE_CONTRACT_ADDRESS": testRegistry,
+	"RIGHTS":                    testRights,
+	"CHECK_NFT_INTERVAL":        "5",
+}
+
+// clearEnv unsets the variables the tests set, so the environment the tests
+// run in does not leak into them. They are restored afterwards.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	names := []string{
+		"CONFIG_FILE", "PORT", "NETWORKS", "NETWORK_ID", "NETWORK_FUSE_MONGO_DB",
+		"BLOCKLIST", "ALLOWLIST", "RATE_LIMIT_IP_PER_MINUTE", "RATE_LIMIT_ADDRESS_PER_MINUTE",
+		"ADMIN_API_KEYS", "DB_TIMEOUT_SECONDS", "CHAIN_TIMEOUT_SECONDS",
+		"READY_MAX_BLOCK_AGE_SECONDS", "PROBE_TIMEOUT_SECONDS",
+	}
+	for name := range testEnv {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+// setEnv sets the valid test environment with overrides. An override of ""
+// leaves the variable unset.
+func setEnv(t *testing.T, overrides map[string]string) {
+	t.Helper()
+	clearEnv(t)
+	for name, value := range testEnv {
+		if override, ok := overrides[name]; ok {
+			value = override
+		}
+		if value != "" {
+			t.Setenv(name, value)
+		}
+	}
+	for name, value := range overrides {
+		if _, ok := testEnv[name]; !ok && value != "" {
+			t.Setenv(name, value)
+		}
+	}
+}
+
+// writeConfigFile writes a YAML config file and points CONFIG_FILE at it
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config file: %v", err)
+	}
+	t.Setenv("CONFIG_FILE", path)
+	return path
+}
+
+// mixedCase returns address with its EIP-55 checksum, and with the case of
+// its first letter flipped so that the checksum no longer matches
+func mixedCase(address string) (checksummed, broken string) {
+	checksummed = common.HexToAddress(address).Hex()
+	for i := 2; i < len(checksummed); i++ {
+		c := checksummed[i]
+		if c >= 'a' && c <= 'f' {
+			return checksummed, checksummed[:i] + strings.ToUpper(string(c)) + checksummed[i+1:]
+		}
+		if c >= 'A' && c <= 'F' {
+			return checksummed, checksummed[:i] + strings.ToLower(string(c)) + checksummed[i+1:]
+		}
+	}
+	return checksummed, checksummed
+}
+
+func TestLoadConfig(t *testing.T) {
+	checksummed, broken := mixedCase(testRegistry)
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+		check   func(t *testing.T, cfg *Config)
+	}{
+		{
+			name: "Defaults",
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.Port != ":8080" || cfg.NetworkID != DefaultNetworkID || cfg.MongoDB != "test" {
+					t.Errorf("port %q, network %q, database %q; want :8080, %s, test", cfg.Port, cfg.NetworkID, cfg.MongoDB, DefaultNetworkID)
+				}
+				if len(cfg.Rights) != RightsLength || cfg.Rights[RightsLength-1] != 1 {
+					t.Errorf("rights = %x, want %s", cfg.Rights, testRights)
+				}
+				if cfg.DBTimeout != 5*time.Second || cfg.ChainTimeout != 10*time.Second || cfg.ReadyMaxBlockAge != time.Minute {
+					t.Errorf("timeouts = %v, %v, %v; want 5s, 10s, 1m", cfg.DBTimeout, cfg.ChainTimeout, cfg.ReadyMaxBlockAge)
+				}
+				// One heartbeat per interval, with one more for jitter
+				if cfg.RateLimit.AddressPerMinute != 0.2 || cfg.RateLimit.AddressBurst != 2 {
+					t.Errorf("address rate limit = %+v, want 0.2 a minute with a burst of 2", cfg.RateLimit)
+				}
+			},
+		},
+		{
+			name: "ChecksummedAddress",
+			env:  map[string]string{"DELEGATE_CONTRACT_ADDRESS": checksummed},
+		},
+		{
+			name: "UpperCaseAddress",
+			env:  map[string]string{"DELEGATE_CONTRACT_ADDRESS": "0x" + strings.ToUpper(testRegistry[2:])},
+		},
+		{
+			name:    "ChecksumMismatch",
+			env:     map[string]string{"DELEGATE_CONTRACT_ADDRESS": broken},
+			wantErr: "invalid DELEGATE_CONTRACT_ADDRESS: checksum mismatch, expected " + checksummed,
+		},
+		{
+			name:    "AddressWithoutPrefix",
+			env:     map[string]string{"NFT_CONTRACT_ADDRESS": testNFTContract[2:]},
+			wantErr: "invalid NFT_CONTRACT_ADDRESS: expected a 0x prefixed 20 byte hex address",
+		},
+		{
+			name:    "ShortAddress",
+			env:     map[string]string{"NFT_CONTRACT_ADDRESS": testNFTContract[:40]},
+			wantErr: "invalid NFT_CONTRACT_ADDRESS",
+		},
+		{
+			name: "Blocklist",
+			env:  map[string]string{"BLOCKLIST": checksummed + ", " + testNFTContract + ","},
+			check: func(t *testing.T, cfg *Config) {
+				want := []string{testRegistry, testNFTContract}
+				if !reflect.DeepEqual(cfg.Blocklist, want) {
+					t.Errorf("blocklist = %v, want %v", cfg.Blocklist, want)
+				}
+			},
+		},
+		{
+			name:    "BlocklistChecksumMismatch",
+			env:     map[string]string{"BLOCKLIST": broken},
+			wantErr: "invalid BLOCKLIST address " + broken + ": checksum mismatch",
+		},
+		{
+			name: "RightsWithoutPrefix",
+			env:  map[string]string{"RIGHTS": testRights[2:]},
+		},
+		{
+			name:    "RightsTooShort",
+			env:     map[string]string{"RIGHTS": testRights[:len(testRights)-2]},
+			wantErr: "RIGHTS must be exactly 32 bytes, got 31",
+		},
+		{
+			name:    "RightsTooLong",
+			env:     map[string]string{"RIGHTS": testRights + "00"},
+			wantErr: "RIGHTS must be exactly 32 bytes, got 33",
+		},
+		{
+			name:    "RightsNotHex",
+			env:     map[string]string{"RIGHTS": "0xzz"},
+			wantErr: "invalid RIGHTS format",
+		},
+		{
+			name:    "RightsMissing",
+			env:     map[string]string{"RIGHTS": ""},
+			wantErr: "RIGHTS environment variable is required",
+		},
+		{
+			name:    "IntervalMissing",
+			env:     map[string]string{"CHECK_NFT_INTERVAL": ""},
+			wantErr: "CHECK_NFT_INTERVAL environment variable is required",
+		},
+		{
+			name:    "IntervalZero",
+			env:     map[string]string{"CHECK_NFT_INTERVAL": "0"},
+			wantErr: "CHECK_NFT_INTERVAL must be at least 1 minute",
+		},
+		{
+			name:    "IntervalNotANumber",
+			env:     map[string]string{"CHECK_NFT_INTERVAL": "5m"},
+			wantErr: "invalid CHECK_NFT_INTERVAL format",
+		},
+		{
+			name: "Timeouts",
+			env:  map[string]string{"DB_TIMEOUT_SECONDS": "1", "CHAIN_TIMEOUT_SECONDS": "30", "READY_MAX_BLOCK_AGE_SECONDS": "120"},
+			check: func(t *testing.T, cfg *Config) {
+				if cfg.DBTimeout != time.Second || cfg.ChainTimeout != 30*time.Second || cfg.ReadyMaxBlockAge != 2*time.Minute {
+					t.Errorf("timeouts = %v, %v, %v; want 1s, 30s, 2m", cfg.DBTimeout, cfg.ChainTimeout, cfg.ReadyMaxBlockAge)
+				}
+			},
+		},
+		{
+			name:    "DBTimeoutZero",
+			env:     map[string]string{"DB_TIMEOUT_SECONDS": "0"},
+			wantErr: "DB_TIMEOUT_SECONDS must be a whole number of seconds, at least 1",
+		},
+		{
+			name:    "ChainTimeoutNegative",
+			env:     map[string]string{"CHAIN_TIMEOUT_SECONDS": "-5"},
+			wantErr: "CHAIN_TIMEOUT_SECONDS must be a whole number of seconds, at least 1",
+		},
+		{
+			name:    "BlockAgeFractional",
+			env:     map[string]string{"READY_MAX_BLOCK_AGE_SECONDS": "1.5"},
+			wantErr: "READY_MAX_BLOCK_AGE_SECONDS must be a whole number of seconds, at least 1",
+		},
+		{
+			name:    "ProbeTimeoutZero",
+			env:     map[string]string{"PROBE_TIMEOUT_SECONDS": "0"},
+			wantErr: "PROBE_TIMEOUT_SECONDS must be at least 1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, tt.env)
+
+			cfg, err := LoadConfig()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadConfig = %v, want an error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadConfig: %v", err)
+			}
+			if tt.check != nil {
+				tt.check(t, cfg)
+			}
+		})
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	t.Run("Flattens", func(t *testing.T) {
+		clearEnv(t)
+		writeConfigFile(t, `
+port: ":9090"
+mongo:
+  uri: mongodb://db:27017
+  db: lc
+check_nft_interval: 10
+rate_limit:
+  ip_per_minute: 30
+blocklist: [`+testNFTContract+`, `+testRegistry+`]
+admin_api_keys:
+  - {name: ops, role: admin, key: secret}
+networks:
+  - id: fuse
+    rpc_url: https://rpc.fuse.io
+    nft_contract_address: `+testNFTContract+`
+    delegate_contract_address: `+testRegistry+`
+    rights: "`+testRights+`"
+  - id: spark-test
+    mongo_db: spark
+    rpc_url: https://rpc.fusespark.io
+    nft_contract_address: `+testNFTContract+`
+    delegate_contract_address: `+testRegistry+`
+    rights: "`+testRights+`"
+`)
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if cfg.Port != ":9090" || cfg.MongoURI != "mongodb://db:27017" || cfg.CheckNFTInterval != 10 {
+			t.Errorf("port %q, mongo %q, interval %d; want :9090, mongodb://db:27017, 10", cfg.Port, cfg.MongoURI, cfg.CheckNFTInterval)
+		}
+		if cfg.RateLimit.IPPerMinute != 30 {
+			t.Errorf("IP rate limit = %v, want 30", cfg.RateLimit.IPPerMinute)
+		}
+		if want := []string{testNFTContract, testRegistry}; !reflect.DeepEqual(cfg.Blocklist, want) {
+			t.Errorf("blocklist = %v, want %v", cfg.Blocklist, want)
+		}
+		if want := []auth.APIKey{{Name: "ops", Role: auth.RoleAdmin, Key: "secret"}}; !reflect.DeepEqual(cfg.AdminAPIKeys, want) {
+			t.Errorf("admin API keys = %+v, want %+v", cfg.AdminAPIKeys, want)
+		}
+
+		var ids, databases []string
+		for _, network := range cfg.Networks {
+			ids = append(ids, network.ID)
+			databases = append(databases, network.MongoDB)
+		}
+		if want := []string{"fuse", "spark-test"}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("networks = %v, want %v", ids, want)
+		}
+		if want := []string{"lc_fuse", "spark"}; !reflect.DeepEqual(databases, want) {
+			t.Errorf("network databases = %v, want %v", databases, want)
+		}
+		if cfg.NetworkID != "fuse" || cfg.RpcURL != "https://rpc.fuse.io" {
+			t.Errorf("default network = %s at %s, want fuse at https://rpc.fuse.io", cfg.NetworkID, cfg.RpcURL)
+		}
+	})
+
+	t.Run("EnvOverridesFile", func(t *testing.T) {
+		setEnv(t, map[string]string{"CHECK_NFT_INTERVAL": "7"})
+		writeConfigFile(t, "check_nft_interval: 3\nport: \":9090\"\n")
+
+		cfg, err := LoadConfig()
+		if err != nil {
+			t.Fatalf("LoadConfig: %v", err)
+		}
+		if cfg.CheckNFTInterval != 7 || cfg.Port != ":9090" {
+			t.Errorf("interval %d, port %q; want 7 from the environment and :9090 from the file", cfg.CheckNFTInterval, cfg.Port)
+		}
+	})
+
+	t.Run("EnvOverridesInvalidFileValue", func(t *testing.T) {
+		setEnv(t, nil)
+		writeConfigFile(t, "check_nft_interval: 0\n")
+
+		if _, err := LoadConfig(); err != nil {
+			t.Errorf("LoadConfig = %v, want the file's value overridden", err)
+		}
+	})
+
+	tests := []struct {
+		name    string
+		file    string
+		wantErr string
+	}{
+		{
+			name:    "UnknownKey",
+			file:    "rate_limit:\n  ip_per_minut: 30\nporrt: 1\n",
+			wantErr: "unknown settings in config file %s: porrt, rate_limit.ip_per_minut",
+		},
+		{
+			name:    "SetTwice",
+			file:    "mongo:\n  db: a\nmongo_db: b\n",
+			wantErr: "mongo_db is set twice",
+		},
+		{
+			name:    "InvalidValue",
+			file:    "rate_limit:\n  ip_burst: 0\n",
+			wantErr: "invalid RATE_LIMIT_IP_BURST format, must be at least 1 (rate_limit.ip_burst in %s)",
+		},
+		{
+			name:    "NestedList",
+			file:    "blocklist:\n  - [a, b]\n",
+			wantErr: "blocklist must be a list of values",
+		},
+		{
+			name:    "NetworkWithoutID",
+			file:    "networks:\n  - rpc_url: https://rpc.fuse.io\n",
+			wantErr: "networks[0] needs an id",
+		},
+		{
+			name:    "NotAMapping",
+			file:    "port\n",
+			wantErr: "expected a mapping of settings",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setEnv(t, nil)
+			path := writeConfigFile(t, tt.file)
+
+			wantErr := tt.wantErr
+			if strings.Contains(wantErr, "%s") {
+				wantErr = strings.ReplaceAll(wantErr, "%s", path)
+			}
+			if _, err := LoadConfig(); err == nil || !strings.Contains(err.Error(), wantErr) {
+				t.Errorf("LoadConfig = %v, want an error containing %q", err, wantErr)
+			}
+		})
+	}
+}
+
+func TestReload(t *testing.T) {
+	setEnv(t, map[string]string{"CHECK_NFT_INTERVAL": ""})
+	path := writeConfigFile(t, "check_nft_interval: 5\nport: \":8080\"\ndb_timeout_seconds: 5\n")
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	live := NewLive(cfg)
+	var reloaded []*Config
+	live.OnReload(func(cfg *Config) { reloaded = append(reloaded, cfg) })
+
+	rewrite := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatalf("rewrite config file: %v", err)
+		}
+	}
+
+	// Settings read at startup keep their running values and are reported
+	rewrite("check_nft_interval: 10\nport: \":9090\"\ndb_timeout_seconds: 9\nblocklist: [" + testNFTContract + "]\n")
+	restartRequired, err := live.Reload()
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if want := []string{"PORT", "DB_TIMEOUT_SECONDS"}; !reflect.DeepEqual(restartRequired, want) {
+		t.Errorf("restart required for %v, want %v", restartRequired, want)
+	}
+	got := live.Get()
+	if got.CheckNFTInterval != 10 || !reflect.DeepEqual(got.Blocklist, []string{testNFTContract}) {
+		t.Errorf("interval %d, blocklist %v; want the reloaded 10 and [%s]", got.CheckNFTInterval, got.Blocklist, testNFTContract)
+	}
+	if got.Port != ":8080" || got.DBTimeout != 5*time.Second {
+		t.Errorf("port %q, database timeout %v; want the running :8080 and 5s", got.Port, got.DBTimeout)
+	}
+	if len(reloaded) != 1 || reloaded[0] != got {
+		t.Errorf("listener called with %v, want the reloaded config once", reloaded)
+	}
+
+	// An invalid config is rejected and the running one kept
+	rewrite("check_nft_interval: 0\n")
+	if _, err := live.Reload(); err == nil {
+		t.Fatal("Reload accepted CHECK_NFT_INTERVAL 0")
+	}
+	if live.Get() != got || len(reloaded) != 1 {
+		t.Error("invalid config replaced the running one")
+	}
+}
+
+func TestKeepStartupSettings(t *testing.T) {
+	running := &Config{
+		Port:      ":8080",
+		NetworkID: "fuse",
+		RpcURL:    "https://rpc.fuse.io",
+		Networks:  []Network{{ID: "fuse", RpcURL: "https://rpc.fuse.io"}},
+		Blocklist: []string{testRegistry},
+	}
+	next := &Config{
+		Port:      ":8080",
+		NetworkID: "spark",
+		RpcURL:    "https://rpc.fusespark.io",
+		Networks:  []Network{{ID: "spark", RpcURL: "https://rpc.fusespark.io"}},
+		Blocklist: []string{testNFTContract},
+	}
+
+	changed := keepStartupSettings(next, running)
+	if want := []string{"NETWORKS"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if next.NetworkID != "fuse" || next.RpcURL != "https://rpc.fuse.io" || next.Networks[0].ID != "fuse" {
+		t.Errorf("network after reload = %s at %s, want the running fuse", next.NetworkID, next.RpcURL)
+	}
+	if !reflect.DeepEqual(next.Blocklist, []string{testNFTContract}) {
+		t.Errorf("blocklist = %v, want the reloaded one", next.Blocklist)
+	}
+}
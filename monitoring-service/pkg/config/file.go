@@ -0,0 +1,253 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The config file is YAML. Each setting is named after its environment
+// variable, lower case and nested at the underscores that make sense:
+//
+//	port: ":8080"
+//	mongo:
+//	  uri: mongodb://localhost:27017
+//	  db: lc-monitoring
+//	check_nft_interval: 5
+//	rate_limit:
+//	  ip_per_minute: 60
+//	blocklist: [0x..., 0x...]
+//	networks:
+//	  - id: fuse
+//	    rpc_url: https://rpc.fuse.io
+//	admin_api_keys:
+//	  - {name: ops, role: admin, key: ...}
+//
+// rate_limit.ip_per_minute is RATE_LIMIT_IP_PER_MINUTE. Lists become comma
+// separated values, networks become NETWORKS with NETWORK_<ID>_ variables
+// and admin_api_keys entries become name:role:key.
+
+// settings looks up configuration by environment variable name, in the
+// environment first and then in the config file
+type settings struct {
+	path string
+	// file maps variable names to values from the config file, and paths to
+	// where in the file they were set
+	file  map[string]string
+	paths map[string]string
+	used  map[string]bool
+}
+
+func newSettings(path string) (*settings, error) {
+	s := &settings{
+		path:  path,
+		file:  make(map[string]string),
+		paths: make(map[string]string),
+		used:  make(map[string]bool),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	if len(root.Content) == 0 {
+		return s, nil
+	}
+	if err := s.flatten(root.Content[0], "", ""); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// get returns the value of the named setting, or "" when it is not set
+func (s *settings) get(name string) string {
+	s.used[name] = true
+	if value, ok := os.LookupEnv(name); ok {
+		return value
+	}
+	return s.file[name]
+}
+
+// set records a value read from the file
+func (s *settings) set(name, path, value string) error {
+	if _, ok := s.file[name]; ok {
+		return fmt.Errorf("%s is set twice", path)
+	}
+	s.file[name] = value
+	s.paths[name] = path
+	return nil
+}
+
+func (s *settings) flatten(node *yaml.Node, name, path string) error {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			childName := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+			childPath := key
+			if name != "" {
+				childName = name + "_" + childName
+				childPath = path + "." + key
+			}
+
+			value := node.Content[i+1]
+			switch childName {
+			case "NETWORKS":
+				if err := s.flattenNetworks(value, childPath); err != nil {
+					return err
+				}
+				continue
+			case "ADMIN_API_KEYS":
+				if err := s.flattenAPIKeys(value, childPath); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := s.flatten(value, childName, childPath); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case yaml.SequenceNode:
+		values := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			if item.Kind != yaml.ScalarNode {
+				return fmt.Errorf("%s must be a list of values", path)
+			}
+			values = append(values, item.Value)
+		}
+		return s.set(name, path, strings.Join(values, ","))
+
+	case yaml.ScalarNode:
+		if name == "" {
+			return errors.New("expected a mapping of settings")
+		}
+		return s.set(name, path, node.Value)
+	}
+	return fmt.Errorf("%s has an unsupported value", path)
+}
+
+// flattenNetworks turns the networks list into NETWORKS and the
+// NETWORK_<ID>_ variables
+func (s *settings) flattenNetworks(node *yaml.Node, path string) error {
+	if node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s must be a list of networks", path)
+	}
+
+	var ids []string
+	for i, item := range node.Content {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if item.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s must be a mapping", itemPath)
+		}
+
+		var id string
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			if item.Content[j].Value == "id" {
+				id = item.Content[j+1].Value
+			}
+		}
+		if id == "" {
+			return fmt.Errorf("%s needs an id", itemPath)
+		}
+		ids = append(ids, id)
+
+		prefix := networkEnvPrefix(id)
+		for j := 0; j+1 < len(item.Content); j += 2 {
+			key := item.Content[j].Value
+			if key == "id" {
+				continue
+			}
+			if err := s.flatten(item.Content[j+1], prefix+strings.ToUpper(strings.ReplaceAll(key, "-", "_")), itemPath+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	return s.set("NETWORKS", path, strings.Join(ids, ","))
+}
+
+// flattenAPIKeys turns the admin_api_keys list into name:role:key entries
+func (s *settings) flattenAPIKeys(node *yaml.Node, path string) error {
+	if node.Kind != yaml.SequenceNode {
+		return fmt.Errorf("%s must be a list of keys", path)
+	}
+
+	var entries []string
+	for i, item := range node.Content {
+		var key struct {
+			Name string `yaml:"name"`
+			Role string `yaml:"role"`
+			Key  string `yaml:"key"`
+		}
+		if err := item.Decode(&key); err != nil {
+			return fmt.Errorf("%s[%d]: %v", path, i, err)
+		}
+		entries = append(entries, key.Name+":"+key.Role+":"+key.Key)
+	}
+	return s.set("ADMIN_API_KEYS", path, strings.Join(entries, ","))
+}
+
+// unused returns an error naming the settings in the file that the config
+// does not have, which are most likely misspelled
+func (s *settings) unused() error {
+	var unknown []string
+	for name, path := range s.paths {
+		if !s.used[name] {
+			unknown = append(unknown, path)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown settings in config file %s: %s", s.path, strings.Join(unknown, ", "))
+}
+
+// explain adds where in the config file a setting named in err was set,
+// unless the environment overrides it
+func (s *settings) explain(err error) error {
+	var match string
+	for name := range s.paths {
+		if _, inEnv := os.LookupEnv(name); inEnv {
+			continue
+		}
+		if mentions(err.Error(), name) && len(name) > len(match) {
+			match = name
+		}
+	}
+	if match == "" {
+		return err
+	}
+	return fmt.Errorf("%w (%s in %s)", err, s.paths[match], s.path)
+}
+
+// mentions reports whether message names the setting, and not only a longer
+// setting containing it, as TRACING_EXPORTER contains PORT
+func mentions(message, name string) bool {
+	isNamePart := func(c byte) bool {
+		return c == '_' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+	}
+	for i := 0; ; {
+		j := strings.Index(message[i:], name)
+		if j < 0 {
+			return false
+		}
+		start, end := i+j, i+j+len(name)
+		if (start == 0 || !isNamePart(message[start-1])) && (end == len(message) || !isNamePart(message[end])) {
+			return true
+		}
+		i = start + 1
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Live holds the running config. Reload swaps in a freshly loaded config
+// without restarting the service. Settings the service only reads at
+// startup keep their running values until the next restart.
+type Live struct {
+	current atomic.Pointer[Config]
+
+	mu        sync.Mutex
+	listeners []func(*Config)
+}
+
+// NewLive creates a live config starting from cfg
+func NewLive(cfg *Config) *Live {
+	l := &Live{}
+	l.current.Store(cfg)
+	return l
+}
+
+// Get returns the current config. Callers must not modify it.
+func (l *Live) Get() *Config {
+	return l.current.Load()
+}
+
+// OnReload registers fn to be called with every reloaded config
+func (l *Live) OnReload(fn func(*Config)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listeners = append(l.listeners, fn)
+}
+
+// Reload loads the config again and applies it. An invalid config is
+// rejected and the running one kept. restartRequired names the changed
+// settings that only take effect after a restart.
+func (l *Live) Reload() (restartRequired []string, err error) {
+	next, err := LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	restartRequired = keepStartupSettings(next, l.Get())
+	l.current.Store(next)
+	for _, fn := range l.listeners {
+		fn(next)
+	}
+	return restartRequired, nil
+}
+
+// keepStartupSettings copies the settings that are only read at startup
+// from running into next, and returns the names of those that differ
+func keepStartupSettings(next, running *Config) []string {
+	var changed []string
+	keep(&changed, "PORT", &next.Port, running.Port)
+	keep(&changed, "MONGO_URI", &next.MongoURI, running.MongoURI)
+	// Chain clients and databases are opened per network at startup
+	keep(&changed, "NETWORKS", &next.Networks, running.Networks)
+	next.NetworkID = running.NetworkID
+	next.MongoDB = running.MongoDB
+	next.RpcURL = running.RpcURL
+	next.NFTContractAddr = running.NFTContractAddr
+	next.DelegateContractAddr = running.DelegateContractAddr
+	next.Rights = running.Rights
+	keep(&changed, "AUTO_MIGRATE", &next.AutoMigrate, running.AutoMigrate)
+	keep(&changed, "HEARTBEAT_RETENTION_DAYS", &next.HeartbeatRetentionDays, running.HeartbeatRetentionDays)
+	keep(&changed, "ADMIN_API_KEYS", &next.AdminAPIKeys, running.AdminAPIKeys)
+	keep(&changed, "ADMIN_JWT_SECRET", &next.AdminJWTSecret, running.AdminJWTSecret)
+	keep(&changed, "AVAIL_RPC_URL", &next.AvailRPCURL, running.AvailRPCURL)
+	keep(&changed, "PROBE_INTERVAL_SECONDS", &next.ProbeIntervalSeconds, running.ProbeIntervalSeconds)
+	keep(&changed, "PROBE_TIMEOUT_SECONDS", &next.ProbeTimeoutSeconds, running.ProbeTimeoutSeconds)
+	keep(&changed, "PROBE_ALLOW_PRIVATE", &next.ProbeAllowPrivate, running.ProbeAllowPrivate)
+	keep(&changed, "RATE_LIMIT_SHARED", &next.RateLimit.Shared, running.RateLimit.Shared)
+	// Chain readers and databases are opened with their timeouts
+	keep(&changed, "DB_TIMEOUT_SECONDS", &next.DBTimeout, running.DBTimeout)
+	keep(&changed, "CHAIN_TIMEOUT_SECONDS", &next.ChainTimeout, running.ChainTimeout)
+	keep(&changed, "READY_MAX_BLOCK_AGE_SECONDS", &next.ReadyMaxBlockAge, running.ReadyMaxBlockAge)
+	keep(&changed, "TRACING_EXPORTER", &next.Tracing.Exporter, running.Tracing.Exporter)
+	keep(&changed, "TRACING_FILE", &next.Tracing.File, running.Tracing.File)
+	keep(&changed, "TRACING_SAMPLE_RATIO", &next.Tracing.SampleRatio, running.Tracing.SampleRatio)
+	return changed
+}
+
+func keep[T any](changed *[]string, name string, next *T, running T) {
+	if !reflect.DeepEqual(*next, running) {
+		*changed = append(*changed, name)
+	}
+	*next = running
+}
+
+// WatchFile calls fn after the file at path changes, until ctx is
+// cancelled. The file's directory is watched so that editors that replace
+// the file, and Kubernetes config map updates, are noticed too.
+func WatchFile(ctx context.Context, path string, fn func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	path = filepath.Clean(path)
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return err
+	}
+
+	go func() {
+		defer watcher.Close()
+
+		// Writes often arrive as several events, so wait for them to settle
+		const settle = 500 * time.Millisecond
+		timer := time.NewTimer(settle)
+		timer.Stop()
+		defer timer.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// Config maps swap a ..data symlink rather than the file
+				if filepath.Clean(event.Name) == path || filepath.Base(event.Name) == "..data" {
+					timer.Reset(settle)
+				}
+			case <-watcher.Errors:
+			case <-timer.C:
+				fn()
+			}
+		}
+	}()
+	return nil
+}